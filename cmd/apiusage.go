@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/spf13/cobra"
+)
+
+var apiUsageFlags struct {
+	packages []string
+	format   string
+	unused   bool
+	strict   bool
+}
+
+var apiUsageCmd = &cobra.Command{
+	Use:   "api-usage",
+	Short: "Show which exported functions other packages call, and which could be unexported",
+	Long: `api-usage lists, for every stored package, its exported functions that other
+packages call, with the callers and their packages, and the exported
+functions only the package itself calls, or nothing does: API that could be
+unexported. Tests, generated code and the standard library are left out.
+
+Functions are matched by name, so an exported method only called through an
+interface shows as unused unless the graph has those calls. --package limits
+the report to the given packages and the ones below them; their callers are
+counted from every package.`,
+	Example: `  geeparse api-usage
+  geeparse api-usage --package github.com/acme/app/pkg/store --unused
+  geeparse api-usage --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if apiUsageFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+
+		usage := analysis.APIUsage(graph, apiUsageFlags.packages)
+		if apiUsageFlags.unused {
+			usage = analysis.UnusedAPI(usage)
+		}
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(apiUsageFlags.format) {
+		case "text":
+			for i, api := range usage {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "%s: %d exported, %d used by other packages\n", api.Package, api.Exported, api.Exported-len(api.Unused))
+				for _, fn := range api.Used {
+					fmt.Fprintf(out, "  %s from %s: %s\n", fn.Name, strings.Join(fn.Packages, ", "), strings.Join(fn.Callers, ", "))
+				}
+				for _, fn := range api.Unused {
+					fmt.Fprintf(out, "  %s:%d: %s could be unexported (%d internal callers)\n", displayPath(fn.File), fn.Line, fn.Name, fn.Internal)
+				}
+			}
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(usage)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", apiUsageFlags.format)
+		}
+		return nil
+	},
+}
+
+func init() {
+	f := apiUsageCmd.Flags()
+	f.StringSliceVar(&apiUsageFlags.packages, "package", nil, "only report these packages and the ones below them")
+	f.StringVarP(&apiUsageFlags.format, "format", "f", "text", "output format: text or json")
+	f.BoolVar(&apiUsageFlags.unused, "unused", false, "only list exported functions no other package calls")
+	f.BoolVar(&apiUsageFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	rootCmd.AddCommand(apiUsageCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/spf13/cobra"
+)
+
+var auditFlags struct {
+	actor  string
+	action string
+	source string
+	since  time.Duration
+	limit  int
+	format string
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "List who changed the store, and when",
+	Long: `audit lists the changes recorded in the store's audit log, newest first:
+rebuilds, ingests, imports and snapshot deletions made by geeparse commands,
+and the edits and admin operations made through a shared server's API, each
+with who made it and how. /api/audit serves the same log.
+
+Commands record the operating system user, or GEEPARSE_USER when set. The
+server records the user an authenticating proxy sets in X-Forwarded-User or
+X-Forwarded-Email, else the name the UI signs notes with, but only for
+requests through a serve --trusted-proxy or with the admin token, since
+anyone can send those headers. Otherwise it records "admin" for requests
+with the admin token, else the client's address.`,
+	Example: `  geeparse audit --since 24h
+  geeparse audit --actor ana --action annotation.set --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		q := persistence.AuditQuery{Actor: auditFlags.actor, Action: auditFlags.action, Source: auditFlags.source, Limit: auditFlags.limit}
+		if auditFlags.since > 0 {
+			q.Since = time.Now().Add(-auditFlags.since)
+		}
+		entries, err := store.AuditLog(q)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(auditFlags.format) {
+		case "text":
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "WHEN\tACTOR\tSOURCE\tACTION\tSUMMARY")
+			for _, e := range entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.At.Local().Format(time.DateTime), e.Actor, e.Source, e.Action, e.Summary)
+			}
+			return tw.Flush()
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", auditFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := auditCmd.Flags()
+	f.StringVar(&auditFlags.actor, "actor", "", "only changes made by this user")
+	f.StringVar(&auditFlags.action, "action", "", `only changes of this kind, e.g. "build" or "snapshot.delete"`)
+	f.StringVar(&auditFlags.source, "source", "", "only changes made through api, cli, schedule or webhook")
+	f.DurationVar(&auditFlags.since, "since", 0, "only changes made within this long, e.g. 24h (0 = all)")
+	f.IntVar(&auditFlags.limit, "limit", 50, "list at most this many changes (0 = all)")
+	f.StringVarP(&auditFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(auditCmd)
+}
+
+// recordAudit notes a change a command made to store in its audit log.
+// Failing to is only logged: the change has been made.
+func recordAudit(store *persistence.Store, action, summary string) {
+	err := store.RecordAudit(persistence.AuditEntry{Actor: cliActor(), Source: persistence.AuditCLI, Action: action, Summary: summary})
+	if err != nil {
+		slog.Warn("audit", "action", action, "err", err)
+	}
+}
+
+// cliActor is who runs geeparse: GEEPARSE_USER, else the operating
+// system user.
+func cliActor() string {
+	if u := os.Getenv("GEEPARSE_USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return cmp.Or(os.Getenv("USER"), os.Getenv("USERNAME"), "unknown")
+}
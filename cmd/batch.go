@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/config"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+)
+
+var batchFlags struct {
+	parallel int
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [project...]",
+	Short: "Build the graphs of a fleet of repositories into one store",
+	Long: `batch builds every project listed under projects: in the config file (or
+just the projects named) into --db, --parallel of them at a time. Each
+project's functions are stored as name/Function, replacing only that
+namespace as ingest --namespace does, and a snapshot labelled after the
+project is kept of the result, so teams maintaining many services can
+follow them all from one UI.
+
+A project is either a local checkout or a git URL that is shallow-cloned
+for the build and removed afterwards:
+
+  projects:
+    - name: api
+      dir: ../api
+    - name: billing
+      repo: https://github.com/acme/billing
+      ref: main
+      exclude: [testdata]
+
+The analysis flags apply to every project. A project that fails to build
+leaves its namespace as it was; the others are stored regardless, and
+batch exits non-zero once all are done.`,
+	Example: `  geeparse batch --config projects.yaml
+  geeparse batch --config projects.yaml --parallel 4 api billing`,
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projects, err := batchProjects(args)
+		if err != nil {
+			return err
+		}
+		if batchFlags.parallel < 1 {
+			return fmt.Errorf("--parallel must be at least 1, not %d", batchFlags.parallel)
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		results := runBatch(cmd.Context(), store, projects, batchFlags.parallel)
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		if jsonOutput() {
+			if err := printJSON(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+		} else if err := writeBatch(cmd.OutOrStdout(), results); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d projects failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func init() {
+	addAnalysisFlags(batchCmd.Flags())
+	batchCmd.Flags().IntVarP(&batchFlags.parallel, "parallel", "j", 2, "how many projects to build at once; each runs its own gopls")
+	rootCmd.AddCommand(batchCmd)
+}
+
+// batchResult is how the build of one project went.
+type batchResult struct {
+	Project   string        `json:"project"`
+	Functions int           `json:"functions"`
+	Calls     int           `json:"calls"`
+	Snapshot  int64         `json:"snapshot,omitempty"`
+	Label     string        `json:"label,omitempty"`
+	Commit    string        `json:"commit,omitempty"`
+	Duration  time.Duration `json:"duration"` // nanoseconds
+	Error     string        `json:"error,omitempty"`
+}
+
+// batchProjects returns the configured projects, or those of them names
+// lists, in config order.
+func batchProjects(names []string) ([]config.Project, error) {
+	if len(cfg.Projects) == 0 {
+		return nil, fmt.Errorf("no projects configured; list them under projects: in the file given with --config")
+	}
+	if len(names) == 0 {
+		return cfg.Projects, nil
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(cfg.Projects, func(p config.Project) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("no project named %q in the config", name)
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(cfg.Projects), func(p config.Project) bool {
+		return !slices.Contains(names, p.Name)
+	}), nil
+}
+
+// runBatch builds projects, parallel at a time, storing each as soon as
+// it's built. The store is written to one project at a time. The build
+// reports are merged and saved once all are done.
+func runBatch(ctx context.Context, store *persistence.Store, projects []config.Project, parallel int) []batchResult {
+	var (
+		mu      sync.Mutex // the store and report
+		report  callgraph.BuildReport
+		built   int
+		results = make([]batchResult, len(projects))
+		wg      sync.WaitGroup
+		next    = make(chan int)
+	)
+	for range min(parallel, len(projects)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p := projects[i]
+				start := time.Now()
+				graph, rep, src, err := buildProject(ctx, p)
+				r := batchResult{Project: p.Name, Commit: src.Commit}
+				if err == nil {
+					mu.Lock()
+					r.Snapshot, r.Label, err = storeProject(store, p, graph, src)
+					if err == nil {
+						report.Add(rep.Namespace(p.Name))
+						built++
+					}
+					mu.Unlock()
+				}
+				r.Duration = time.Since(start)
+				if err != nil {
+					r.Error = err.Error()
+					slog.Error("project failed", "project", p.Name, "err", err)
+				} else {
+					r.Functions, r.Calls = len(graph), callgraph.EdgeCount(graph)
+					slog.Info("project built", "project", p.Name, "functions", r.Functions, "calls", r.Calls, "took", r.Duration.Round(time.Millisecond))
+				}
+				results[i] = r
+			}
+		}()
+	}
+	for i := range projects {
+		if ctx.Err() != nil {
+			results[i] = batchResult{Project: projects[i].Name, Error: ctx.Err().Error()}
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if built > 0 {
+		if err := store.SaveBuildReport(report); err != nil {
+			slog.Error("save build report", "err", err)
+		}
+		warnIncomplete(report)
+	}
+	return results
+}
+
+// buildProject analyzes p, cloning it first when it's a repository.
+func buildProject(ctx context.Context, p config.Project) (map[string]callgraph.FunctionNode, callgraph.BuildReport, persistence.Source, error) {
+	dir, src := p.Dir, persistence.Source{}
+	if p.Repo != "" {
+		co, err := vcs.Clone(p.Repo, p.Ref)
+		if err != nil {
+			return nil, callgraph.BuildReport{}, src, fmt.Errorf("clone %s: %w", p.Repo, err)
+		}
+		defer co.Remove()
+		dir, src = co.Dir, persistence.Source{Repo: p.Repo, Ref: p.Ref, Commit: co.Commit}
+	}
+	opts := analysisOptions()
+	opts.Exclude = append(slices.Clone(opts.Exclude), p.Exclude...)
+	graph, report, err := callgraph.BuildCallGraphReport(ctx, dir, opts)
+	return graph, report, src, err
+}
+
+// storeProject replaces p's namespace with graph and snapshots the
+// resulting store. The standard library functions of --stdlib, shared by
+// every project, are added to those stored first, so the calls into them
+// link.
+func storeProject(store *persistence.Store, p config.Project, graph map[string]callgraph.FunctionNode, src persistence.Source) (int64, string, error) {
+	own, std := callgraph.SplitStdlib(callgraph.Namespace(graph, p.Name))
+	if len(std) > 0 {
+		stored, err := store.LoadGraph()
+		if err != nil {
+			return 0, "", err
+		}
+		_, all := callgraph.SplitStdlib(stored)
+		maps.Copy(all, std)
+		if err := store.ReplaceNamespace(callgraph.StdlibPrefix, all); err != nil {
+			return 0, "", err
+		}
+	}
+	if err := store.ReplaceNamespace(p.Name, own); err != nil {
+		return 0, "", err
+	}
+	full, err := store.LoadGraph()
+	if err != nil {
+		return 0, "", err
+	}
+	label := p.Name + " " + time.Now().UTC().Format(time.RFC3339)
+	if src.Commit != "" {
+		label = p.Name + "@" + shortCommit(src.Commit)
+	}
+	snap, err := store.SaveSnapshot(label, full, src)
+	if err != nil {
+		return 0, "", err
+	}
+	recordAudit(store, "build", fmt.Sprintf("project %s, snapshot #%d %q: %d functions, %d calls",
+		p.Name, snap.ID, snap.Label, len(graph), callgraph.EdgeCount(graph)))
+	return snap.ID, snap.Label, nil
+}
+
+// writeBatch lists how each project went.
+func writeBatch(w io.Writer, results []batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tFUNCTIONS\tCALLS\tTOOK\tSNAPSHOT")
+	for _, r := range results {
+		if r.Error != "" {
+			// the whole error was logged; git's run over several lines
+			msg, _, _ := strings.Cut(r.Error, "\n")
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\tfailed: %s\n", r.Project, r.Duration.Round(time.Second), msg)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t#%d %q\n", r.Project, r.Functions, r.Calls, r.Duration.Round(time.Second), r.Snapshot, r.Label)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,463 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/lspclient"
+	"github.com/ishanmadhav/geeparse/pkg/manifest"
+	"github.com/ishanmadhav/geeparse/pkg/notify"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// analysisFlags are shared by every command that analyzes source code.
+var analysisFlags struct {
+	root            string
+	exclude         []string
+	backend         string
+	index           string
+	maxFileSize     int
+	maxFunctionSize int
+	redact          string
+	sample          int
+	sampleRoots     []string
+	stdlib          bool
+	argTypes        bool
+	goplsMaxMemory  int
+	goplsMaxCPU     float64
+	goplsRestarts   int
+}
+
+var buildFlags struct {
+	label   string
+	stdout  bool
+	format  string
+	repo    string
+	ref     string
+	timings bool
+	merge   string
+}
+
+var buildCmd = &cobra.Command{
+	Use:   "build [dir...]",
+	Short: "Analyze a source tree and save its call graph",
+	Long: `build analyzes the Go code under dir (default: --root) with gopls, replaces
+the current graph in the store, and records it as a new snapshot.
+
+Given several directories, for a service spread over several repositories,
+it analyzes each and stores them together as one graph. Every function is
+named prefix/Function and placed in package prefix/path, so the roots stay
+apart: the prefix is the directory's base name, or set it with prefix=dir.
+
+A directory holding several Go modules (several go.mod files, as in a
+monorepo) is analyzed one module at a time the same way, prefixed by module
+path: github.com/acme/api/SaveGraph in package github.com/acme/api/store.
+Calls from one module into another are added from the imports they go
+through and recorded with via "import". Go files outside every module are
+skipped.
+
+With --stdout it writes the graph to standard output in --format instead
+(NDJSON by default, one node or edge per line) and leaves the store alone,
+e.g. geeparse build --stdout | jq -r 'select(.type=="edge") | .callee'
+
+For trees too big to analyze whole, --sample N analyzes only the N
+functions nearest the entrypoints (--sample-roots, default main, init and
+TestMain): their calls, then the calls of the functions they call, and so on
+breadth-first until the budget is spent. The graph holds those and what they
+call; the functions left unanalyzed are listed in /api/build-report and
+drawn dashed in the UI. It's an approximation, good for finding your way
+around a repository of millions of lines.
+
+--gopls-max-memory and --gopls-max-cpu bound the gopls process: a watchdog
+samples it every few seconds and, past a limit, logs it, restarts gopls
+and asks the new one what the old one was working on, so the build goes on.
+After --gopls-max-restarts restarts the build fails instead, rather than a
+runaway gopls taking a CI runner down. Set them for every build under
+gopls: in the config file (max_memory_mb, max_cpu, max_restarts).
+
+Calls into the standard library are left out, unless --stdlib adds them
+and the functions they call: fmt.Println becomes std/fmt.Println in package
+std/fmt, with its signature and source, shared by every root. They come
+from the Go toolchain on PATH, analyzed once per Go version and cached in
+the user cache directory, and are matched by import path and name, so
+calls of methods on standard library types are still left out.
+
+--arg-types type-checks each package with go/types and records, on each
+call, the types of the parameters and of the arguments passed to them, so
+the passes() query can find, say, the callers that pass a nil
+context.Context. Packages that don't type-check leave the types they
+touch as "?".
+
+--merge merges the new graph into the current one instead of replacing it,
+so one snapshot holds the calls of several builds of the same code: with
+another --backend, or with GOOS, GOARCH or GOFLAGS=-tags=... set for
+another platform. Every call either graph has is kept, with the more
+certain provenance of the two; --merge keep or replace says whose
+signature, definition and location a function both have keeps, and fail
+stops at the first whose signatures differ. ingest --merge does the same
+for graphs from other tools.
+
+With --repo it analyzes a remote repository instead: --ref (a branch, tag or
+commit) is shallow-cloned into a temporary directory that is removed
+afterwards, the dirs select subdirectories of the clone, and the snapshot
+records the repository, ref and commit.
+
+--manifest also writes a manifest of the graph: digests of its functions
+and calls, the commit built (noting uncommitted changes), the geeparse
+version and the snapshot ID, signed with --sign-key into <manifest>.sig.
+See geeparse manifest.`,
+	Example: `  geeparse build .
+  geeparse build ../api ../billing web=../frontend/server
+  geeparse build --sample 5000 --sample-roots 'main,Handle*'
+  geeparse build --repo https://github.com/spf13/cobra --ref v1.10.2
+  GOOS=windows geeparse build . --merge keep
+  geeparse build . --manifest build.manifest.json --sign-key geeparse-signing.key`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkManifestFlags(); err != nil {
+			return err
+		}
+		if buildFlags.merge != "" {
+			if buildFlags.stdout {
+				return fmt.Errorf("--merge merges into the store; it can't be used with --stdout")
+			}
+			if !slices.Contains(callgraph.MergeStrategies, buildFlags.merge) {
+				return fmt.Errorf("unknown --merge strategy %q (want %s)", buildFlags.merge, strings.Join(callgraph.MergeStrategies, ", "))
+			}
+		}
+		if len(args) == 0 {
+			args = []string{analysisFlags.root}
+			if buildFlags.repo != "" {
+				args = []string{"."}
+			}
+		}
+		roots, err := parseRoots(args)
+		if err != nil {
+			return err
+		}
+
+		var src persistence.Source
+		if buildFlags.repo != "" {
+			co, err := vcs.Clone(buildFlags.repo, buildFlags.ref)
+			if err != nil {
+				return fmt.Errorf("clone %s: %w", buildFlags.repo, err)
+			}
+			defer co.Remove()
+			for i := range roots {
+				roots[i].dir = filepath.Join(co.Dir, roots[i].dir)
+			}
+			src = persistence.Source{Repo: buildFlags.repo, Ref: buildFlags.ref, Commit: co.Commit}
+		}
+
+		if buildFlags.stdout {
+			graph, report, err := buildRoots(cmd.Context(), roots)
+			if err != nil {
+				return err
+			}
+			if buildFlags.timings {
+				defer printTimings(cmd.ErrOrStderr(), report)
+			}
+			if err := export.Write(cmd.OutOrStdout(), buildFlags.format, graph); err != nil {
+				return err
+			}
+			return writeManifest(manifest.New(graph, manifestSource(roots, src)))
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		label := buildFlags.label
+		if label == "" && src.Repo != "" {
+			label = src.Repo + "@" + shortCommit(src.Commit)
+		}
+		graph, snap, err := buildAndSave(cmd.Context(), store, roots, label, src)
+		if err != nil {
+			return err
+		}
+		recordAudit(store, "build", fmt.Sprintf("snapshot #%d %q: %d functions, %d calls",
+			snap.ID, snap.Label, len(graph), callgraph.EdgeCount(graph)))
+		m := manifest.New(graph, manifestSource(roots, src))
+		m.Snapshot = snap.ID
+		if err := writeManifest(m); err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON(cmd.OutOrStdout(), savedGraph{Functions: len(graph), Calls: callgraph.EdgeCount(graph),
+				DB: dbPath, Snapshot: snap.ID, Label: snap.Label})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "built %d functions, %d calls into %s (snapshot #%d %q)\n",
+			len(graph), callgraph.EdgeCount(graph), dbPath, snap.ID, snap.Label)
+		return nil
+	},
+}
+
+func init() {
+	addAnalysisFlags(buildCmd.Flags())
+	addNotifyFlags(buildCmd.Flags())
+	addManifestFlags(buildCmd.Flags())
+	buildCmd.Flags().StringVar(&buildFlags.label, "label", "", "snapshot label (default: build time)")
+	buildCmd.Flags().BoolVar(&buildFlags.stdout, "stdout", false, "write the graph to stdout instead of the store")
+	buildCmd.Flags().StringVarP(&buildFlags.format, "format", "f", "ndjson",
+		"output format with --stdout: "+strings.Join(export.Formats, "|"))
+	buildCmd.Flags().StringVar(&buildFlags.repo, "repo", "", "git URL of a remote repository to clone and analyze")
+	buildCmd.Flags().StringVar(&buildFlags.ref, "ref", "", "branch, tag or commit to analyze with --repo (default: the remote's HEAD)")
+	buildCmd.Flags().BoolVar(&buildFlags.timings, "timings", false, "print how long each build phase took to stderr")
+	buildCmd.Flags().StringVar(&buildFlags.merge, "merge", "", "merge into the stored graph instead of replacing it, keeping the stored or the new details of functions in both: "+strings.Join(callgraph.MergeStrategies, "|"))
+	rootCmd.AddCommand(buildCmd)
+}
+
+// addAnalysisFlags registers the source-analysis flags on f.
+func addAnalysisFlags(f *pflag.FlagSet) {
+	f.StringVarP(&analysisFlags.root, "root", "r", ".", "root directory of the code to analyze")
+	f.StringSliceVar(&analysisFlags.exclude, "exclude", nil, `glob of files or directories to skip, e.g. "vendor" or "*_gen.go" (repeatable)`)
+	f.StringVar(&analysisFlags.backend, "backend", "gopls", fmt.Sprintf("analysis backend (%s)", strings.Join(callgraph.Backends, ", ")))
+	f.StringVar(&analysisFlags.index, "index", "", "LSIF dump to read calls from with --backend lsif (convert SCIP indexes with scip convert)")
+	f.IntVar(&analysisFlags.maxFileSize, "max-file-size", callgraph.DefaultMaxFileSize, "skip .go files larger than this many bytes (-1 = no limit)")
+	f.IntVar(&analysisFlags.maxFunctionSize, "max-function-size", callgraph.DefaultMaxFunctionSize, "truncate stored function definitions longer than this many bytes (-1 = no limit)")
+	f.StringVar(&analysisFlags.redact, "redact", "", "keep function bodies out of the graph, for sharing it without the code: "+strings.Join(callgraph.RedactModes, "|"))
+	f.IntVar(&analysisFlags.sample, "sample", 0, "analyze only this many functions, breadth-first from the entrypoints, for trees too big to analyze whole (0 = all)")
+	f.StringSliceVar(&analysisFlags.sampleRoots, "sample-roots", nil, "entrypoints --sample starts from, as name globs (default main,init,TestMain)")
+	f.IntVar(&analysisFlags.goplsMaxMemory, "gopls-max-memory", 0, "restart gopls when its resident memory passes this many MiB (0 = no limit)")
+	f.Float64Var(&analysisFlags.goplsMaxCPU, "gopls-max-cpu", 0, fmt.Sprintf("restart gopls when it keeps more than this many cores busy for %s (0 = no limit)", lspclient.DefaultCPUWindow))
+	f.IntVar(&analysisFlags.goplsRestarts, "gopls-max-restarts", lspclient.DefaultMaxRestarts, "fail the build once gopls has been restarted this many times for going over its limits")
+	f.BoolVar(&analysisFlags.stdlib, "stdlib", false, "add the standard library functions the code calls, as std/pkg.Func, instead of leaving those calls out")
+	f.BoolVar(&analysisFlags.argTypes, "arg-types", false, "record the parameter and argument types of each call, for the passes() query")
+}
+
+// analysisOptions collects the source-analysis flags.
+func analysisOptions() callgraph.Options {
+	return callgraph.Options{
+		Exclude: analysisFlags.exclude,
+		Backend: analysisFlags.backend,
+		Index:   analysisFlags.index,
+		Logger:  slog.Default(),
+
+		MaxFileSize:     analysisFlags.maxFileSize,
+		MaxFunctionSize: analysisFlags.maxFunctionSize,
+		Redact:          analysisFlags.redact,
+		Sample:          analysisFlags.sample,
+		SampleRoots:     analysisFlags.sampleRoots,
+		Stdlib:          analysisFlags.stdlib,
+		ArgTypes:        analysisFlags.argTypes,
+		Gopls: lspclient.Limits{
+			MaxMemory:   uint64(max(analysisFlags.goplsMaxMemory, 0)) << 20,
+			MaxCPU:      analysisFlags.goplsMaxCPU,
+			MaxRestarts: analysisFlags.goplsRestarts,
+		},
+	}
+}
+
+// sourceRoot is one directory to analyze, and with several the prefix
+// its functions are namespaced by.
+type sourceRoot struct {
+	prefix, dir string
+}
+
+// singleRoot is the usual case of one directory, with no prefix.
+func singleRoot(dir string) []sourceRoot {
+	return []sourceRoot{{dir: dir}}
+}
+
+// parseRoots reads build arguments, each "dir" or "prefix=dir". Prefixes
+// default to the directory's base name and must be unique.
+func parseRoots(args []string) ([]sourceRoot, error) {
+	var roots []sourceRoot
+	seen := make(map[string]string)
+	for _, arg := range args {
+		r := sourceRoot{dir: arg}
+		if prefix, dir, ok := strings.Cut(arg, "="); ok {
+			r = sourceRoot{prefix: prefix, dir: dir}
+		} else if len(args) > 1 {
+			abs, err := filepath.Abs(arg)
+			if err != nil {
+				return nil, err
+			}
+			r.prefix = filepath.Base(abs)
+		}
+		if len(args) == 1 && r.prefix == "" {
+			roots = append(roots, r)
+			break
+		}
+		if r.prefix == "" || strings.ContainsAny(r.prefix, "/*? \t") {
+			return nil, fmt.Errorf("%s: bad prefix %q; name the root with prefix=dir", arg, r.prefix)
+		}
+		if other, dup := seen[r.prefix]; dup {
+			return nil, fmt.Errorf("%s and %s would both be prefixed %q; name them with prefix=dir", other, arg, r.prefix)
+		}
+		seen[r.prefix] = arg
+		roots = append(roots, r)
+	}
+	return roots, nil
+}
+
+// buildRoots analyzes roots into one graph, each namespaced by its prefix
+// and merged. A single root without a prefix is built as is.
+func buildRoots(ctx context.Context, roots []sourceRoot) (map[string]callgraph.FunctionNode, callgraph.BuildReport, error) {
+	if len(roots) == 1 && roots[0].prefix == "" {
+		return callgraph.BuildCallGraphReport(ctx, roots[0].dir, analysisOptions())
+	}
+	if len(roots) > 1 && analysisFlags.index != "" {
+		return nil, callgraph.BuildReport{}, fmt.Errorf("an LSIF index covers one root, not %d", len(roots))
+	}
+	merged := make(map[string]callgraph.FunctionNode)
+	var report callgraph.BuildReport
+	for _, r := range roots {
+		graph, rep, err := callgraph.BuildCallGraphReport(ctx, r.dir, analysisOptions())
+		if err != nil {
+			return nil, report, fmt.Errorf("%s: %w", r.dir, err)
+		}
+		maps.Copy(merged, callgraph.Namespace(graph, r.prefix))
+		report.Add(rep.Namespace(r.prefix))
+	}
+	return merged, report, nil
+}
+
+// buildAndSave analyzes roots, makes the result the store's current graph,
+// or merges it into that with --merge, and keeps a snapshot of it labelled
+// label (or the build time). With --webhook the changes from the previous current graph are posted there.
+// Crossed thresholds are logged as warnings.
+func buildAndSave(ctx context.Context, store *persistence.Store, roots []sourceRoot, label string, src persistence.Source) (map[string]callgraph.FunctionNode, persistence.Snapshot, error) {
+	hook, err := webhook()
+	if err != nil {
+		return nil, persistence.Snapshot{}, err
+	}
+	graph, report, err := buildRoots(ctx, roots)
+	if err != nil {
+		return nil, persistence.Snapshot{}, err
+	}
+	return saveBuild(ctx, store, hook, graph, report, label, src)
+}
+
+// saveBuild is the second half of buildAndSave, for a graph already built.
+func saveBuild(ctx context.Context, store *persistence.Store, hook *notify.Webhook, graph map[string]callgraph.FunctionNode,
+	report callgraph.BuildReport, label string, src persistence.Source,
+) (map[string]callgraph.FunctionNode, persistence.Snapshot, error) {
+	var old map[string]callgraph.FunctionNode
+	if hook != nil {
+		var err error
+		if old, err = store.LoadGraph(); err != nil {
+			return nil, persistence.Snapshot{}, err
+		}
+	}
+	start := time.Now()
+	if buildFlags.merge != "" {
+		var err error
+		if graph, err = store.MergeGraph(graph, buildFlags.merge); err != nil {
+			return nil, persistence.Snapshot{}, err
+		}
+	} else if err := store.SaveGraph(graph); err != nil {
+		return nil, persistence.Snapshot{}, err
+	}
+	if label == "" {
+		label = time.Now().UTC().Format(time.RFC3339)
+	}
+	snap, err := store.SaveSnapshot(label, graph, src)
+	if err != nil {
+		return nil, persistence.Snapshot{}, err
+	}
+	report.Timings.Persist = time.Since(start)
+	if err := store.SaveBuildReport(report); err != nil {
+		return nil, persistence.Snapshot{}, err
+	}
+	warnIncomplete(report)
+	if report.Sampled > 0 {
+		slog.Info("sampled build: the graph covers only what the budget reached from the entrypoints",
+			"analyzed", report.Sampled, "unexplored", len(report.Unexplored))
+	}
+	notifyRebuild(ctx, hook, label, old, graph)
+	warnThresholds(graph)
+	if buildFlags.timings {
+		printTimings(os.Stderr, report)
+	}
+	return graph, snap, nil
+}
+
+// printTimings writes a table of how long each phase of a build took.
+func printTimings(w io.Writer, r callgraph.BuildReport) {
+	total := r.Timings.Total()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "phase\ttime\tshare")
+	for _, p := range r.Timings.Phases() {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\n", p.Name, p.Duration.Round(time.Millisecond), 100*float64(p.Duration)/float64(total))
+	}
+	fmt.Fprintf(tw, "total\t%s\n", total.Round(time.Millisecond))
+	tw.Flush()
+	fmt.Fprintf(w, "%d functions in %d files, %d queried\n", r.Functions, r.Files, r.Queried)
+	if r.Modules > 1 {
+		fmt.Fprintf(w, "%d modules, %d calls between them\n", r.Modules, r.CrossModule)
+	}
+	if r.Stdlib > 0 {
+		fmt.Fprintf(w, "%d calls into the standard library\n", r.Stdlib)
+	}
+	if r.Skipped > 0 || r.Truncated > 0 {
+		fmt.Fprintf(w, "%d files skipped as too large or binary, %d definitions truncated\n", r.Skipped, r.Truncated)
+	}
+	if r.Generated > 0 {
+		fmt.Fprintf(w, "%d generated files\n", r.Generated)
+	}
+	if r.GoplsRestarts > 0 {
+		fmt.Fprintf(w, "gopls restarted %d times for going over its limits\n", r.GoplsRestarts)
+	}
+	if r.Sampled > 0 {
+		fmt.Fprintf(w, "sampled %d functions from the entrypoints; %d more reached but not analyzed\n", r.Sampled, len(r.Unexplored))
+	}
+	if len(r.Incomplete) > 0 {
+		fmt.Fprintf(w, "%d functions with incomplete calls\n", len(r.Incomplete))
+	}
+}
+
+// warnIncomplete logs the functions whose calls gopls failed to list, so
+// a graph missing edges doesn't pass unnoticed.
+func warnIncomplete(r callgraph.BuildReport) {
+	if len(r.Incomplete) == 0 {
+		return
+	}
+	names := make([]string, 0, len(r.Incomplete))
+	for name := range r.Incomplete {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.Incomplete[name][0]
+		slog.Debug("calls incomplete", "function", name, "request", f.Request, "err", f.Error, "file", displayPath(f.File), "line", f.Line)
+	}
+	slog.Warn("gopls failed for some functions; their calls may be incomplete (see /api/build-report)",
+		"functions", len(r.Incomplete), "failures", r.IncompleteCount())
+}
+
+// warnThresholds logs each configured threshold graph crosses, so every
+// build reports them.
+func warnThresholds(graph map[string]callgraph.FunctionNode) {
+	if !cfg.Thresholds.Set() {
+		return
+	}
+	for _, w := range policy.Warn(graph, cfg.Thresholds) {
+		slog.Warn(w.Message, "kind", w.Kind, "file", displayPath(w.File), "line", w.Line)
+	}
+}
+
+// shortCommit abbreviates a commit SHA for display.
+func shortCommit(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+	"github.com/ishanmadhav/geeparse/pkg/sarif"
+	"github.com/spf13/cobra"
+)
+
+var checkFlags struct {
+	format        string
+	strict        bool
+	baseline      string
+	writeBaseline string
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the stored graph against the architecture rules in the config",
+	Long: `check evaluates the rules listed under "rules:" in geeparse.yaml against the
+stored graph and exits non-zero if any call breaks one. Each rule forbids
+functions in the "from" packages (and below) from calling into the "to"
+packages:
+
+  rules:
+    - name: server-uses-store-api
+      from: pkg/server
+      to: pkg/persistence
+      reason: go through the service layer
+
+Thresholds under "thresholds:" are checked too, but only warn: they're
+listed (in text and SARIF output) without failing the check.
+
+  thresholds:
+    max_fan_out: 25      # distinct functions one function may call
+    max_depth: 20        # call chain length from an entrypoint
+    max_cycle_size: 5    # functions in one call cycle
+    entrypoints: [main]  # where depth is measured from (default: main, init, TestMain)
+
+To clean up an existing codebase step by step, commit a baseline of the
+violations it has today and check against it: only new violations fail,
+and accepted ones that have been fixed are pointed out so the baseline
+can shrink with them. --baseline also takes a graph as export --format
+json writes it, accepting any violation by a call that graph has.`,
+	Example: `  geeparse check
+  geeparse check --write-baseline baseline.json
+  geeparse check --baseline baseline.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cfg.Rules) == 0 && !cfg.Thresholds.Set() {
+			return errors.New("no rules or thresholds configured; add a rules: or thresholds: section to geeparse.yaml")
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if checkFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+
+		violations := policy.Check(graph, cfg.Rules)
+		if path := checkFlags.writeBaseline; path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := policy.NewBaseline(violations).Write(f); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "wrote %s accepting %d violations\n", path, len(violations))
+			return nil
+		}
+		var gone []policy.BaselineEntry
+		if path := checkFlags.baseline; path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			baseline, err := policy.ReadBaseline(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			violations, gone = baseline.Apply(violations)
+		}
+		warnings := policy.Warn(graph, cfg.Thresholds)
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(checkFlags.format) {
+		case "text":
+			for _, v := range violations {
+				fmt.Fprintf(out, "%s:%d: %s (%s) calls %s (%s): %s\n", displayPath(v.File), v.Line,
+					v.Caller, v.CallerPackage, v.Callee, v.CalleePackage, v.Rule)
+			}
+			for _, w := range warnings {
+				fmt.Fprintf(out, "%s:%d: warning: %s\n", displayPath(w.File), w.Line, w.Message)
+			}
+		case "json":
+			if violations == nil {
+				violations = []policy.Violation{}
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(violations); err != nil {
+				return err
+			}
+		case "sarif":
+			report := sarif.NewReport(".")
+			report.AddViolations(violations)
+			report.AddWarnings(warnings)
+			if err := report.Write(out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown format %q (want text, json or sarif)", checkFlags.format)
+		}
+
+		for _, e := range gone {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s no longer occurs; remove it from %s\n", e, checkFlags.baseline)
+		}
+
+		if len(violations) > 0 && checkFlags.baseline != "" {
+			return fmt.Errorf("%d new policy violations", len(violations))
+		}
+		if len(violations) > 0 {
+			return fmt.Errorf("%d policy violations", len(violations))
+		}
+		return nil
+	},
+}
+
+func init() {
+	f := checkCmd.Flags()
+	f.StringVarP(&checkFlags.format, "format", "f", "text", "output format: text, json or sarif")
+	f.BoolVar(&checkFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	f.StringVar(&checkFlags.baseline, "baseline", "", "fail only on violations this baseline file doesn't accept")
+	f.StringVar(&checkFlags.writeBaseline, "write-baseline", "", "write the current violations to this file as the baseline, and pass")
+	checkCmd.MarkFlagsMutuallyExclusive("baseline", "write-baseline")
+	rootCmd.AddCommand(checkCmd)
+}
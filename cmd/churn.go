@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/churn"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+)
+
+var churnFlags struct {
+	root   string
+	since  string
+	stored bool
+	top    int
+	format string
+}
+
+var churnCmd = &cobra.Command{
+	Use:   "churn",
+	Short: "Count the commits touching each function and list high-churn, much-called ones",
+	Long: `churn follows the lines of every stored function back through the history of
+the repository containing --root with git log -L, counts the commits since
+--since that changed them, and saves the result, replacing any earlier
+measurement; the UI can then color nodes by churn. It then lists the danger
+zones: functions that change often and have many callers, ranked by commits
+times callers. The graph should have been built from the checked-out
+revision, since line numbers are matched against it. With --stored it
+reports on the churn measured last instead.`,
+	Example: `  geeparse churn --since "6 months ago"
+  geeparse churn --stored --top 10 --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+
+		var measured map[string]churn.Churn
+		if churnFlags.stored {
+			if measured, err = store.Churn(); err != nil {
+				return err
+			}
+			if len(measured) == 0 {
+				return fmt.Errorf("no churn stored in %s; run geeparse churn without --stored", dbPath)
+			}
+		} else {
+			repoRoot, err := vcs.Git(churnFlags.root, "rev-parse", "--show-toplevel")
+			if err != nil {
+				return err
+			}
+			if measured, err = churn.Measure(graph, repoRoot, churnFlags.since); err != nil {
+				return err
+			}
+			if err := store.ReplaceChurn(measured); err != nil {
+				return err
+			}
+			recordAudit(store, "churn", fmt.Sprintf("since %s: %d functions changed", churnFlags.since, len(measured)))
+			fmt.Fprintf(cmd.ErrOrStderr(), "measured churn since %s: %d of %d functions changed\n",
+				churnFlags.since, len(measured), len(graph))
+		}
+
+		zones := churn.DangerZones(graph, measured, churnFlags.top)
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(churnFlags.format) {
+		case "text":
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "SCORE\tCOMMITS\tCALLERS\tFUNCTION\tLOCATION")
+			for _, z := range zones {
+				fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s:%d\n", z.Score, z.Commits, z.Callers, z.Name, displayPath(z.File), z.Line)
+			}
+			return tw.Flush()
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(zones)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", churnFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := churnCmd.Flags()
+	f.StringVarP(&churnFlags.root, "root", "r", ".", "directory inside the repository the graph was built from")
+	f.StringVar(&churnFlags.since, "since", churn.DefaultSince, `count commits after this date, in any form git accepts ("90 days ago", "2024-01-01")`)
+	f.BoolVar(&churnFlags.stored, "stored", false, "report on the churn measured last instead of measuring again")
+	f.IntVar(&churnFlags.top, "top", 20, "report at most this many functions (0 = all)")
+	f.StringVarP(&churnFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(churnCmd)
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var clonesFlags struct {
+	minTokens    int
+	threshold    float64
+	crossPackage bool
+	format       string
+}
+
+var clonesCmd = &cobra.Command{
+	Use:   "clones",
+	Short: "Find duplicated and near-duplicated functions in the stored graph",
+	Long: `clones compares the bodies of the stored functions to find copy-paste
+the call graph alone can't show, since copies rarely call each other.
+
+Exact clones have the same body hash: the same code but for the
+function's name and layout. Near clones are pairs whose token sequences,
+with identifiers and literals blanked out, overlap by at least
+--threshold, so copies with renamed variables or a changed line or two
+still match. Functions shorter than --min-tokens, whose bodies often
+match by accident, and generated code are left out. The longest clones
+come first.`,
+	Example: `  geeparse clones
+  geeparse clones --cross-package --threshold 0.9
+  geeparse clones --threshold 1 --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if t := clonesFlags.threshold; t <= 0 || t > 1 {
+			return fmt.Errorf("--threshold must be in (0, 1], got %v", t)
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+
+		clones := analysis.Clones(graph, analysis.CloneOptions{
+			MinTokens:    clonesFlags.minTokens,
+			Threshold:    clonesFlags.threshold,
+			CrossPackage: clonesFlags.crossPackage,
+		})
+		switch strings.ToLower(clonesFlags.format) {
+		case "text":
+			return writeClones(cmd.OutOrStdout(), clones)
+		case "json":
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(clones)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", clonesFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := clonesCmd.Flags()
+	f.IntVar(&clonesFlags.minTokens, "min-tokens", analysis.DefaultCloneMinTokens, "leave out functions with fewer tokens than this")
+	f.Float64Var(&clonesFlags.threshold, "threshold", analysis.DefaultCloneThreshold, "least similarity of near clones, 0 to 1; 1 reports exact clones only")
+	f.BoolVar(&clonesFlags.crossPackage, "cross-package", false, "only report clones spanning several packages")
+	f.StringVarP(&clonesFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(clonesCmd)
+}
+
+func writeClones(w io.Writer, clones []analysis.Clone) error {
+	if len(clones) == 0 {
+		_, err := fmt.Fprintln(w, "no clones")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, c := range clones {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		kind := "exact"
+		if !c.Exact {
+			kind = fmt.Sprintf("%.0f%% similar", c.Similarity*100)
+		}
+		fmt.Fprintf(tw, "%s, %d tokens:\n", kind, c.Tokens)
+		for _, loc := range c.Functions {
+			fmt.Fprintf(tw, "  %s\t%s\t%s:%d\n", loc.Name, loc.Package, loc.File, loc.Line)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+// maxCompletions caps how many function names are offered at once.
+const maxCompletions = 200
+
+// completeFunction completes the first argument with stored function
+// names. The shell's completion script installs it; see geeparse
+// completion --help.
+func completeFunction(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return functionNames(cmd, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFunctionFlag completes a flag value with stored function names.
+func completeFunctionFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return functionNames(cmd, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeExportFormat completes export --format with the built-in
+// formats and the configured plugins, which completion doesn't register.
+func completeExportFormat(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	formats := append([]string(nil), export.Formats...)
+	if loadConfig(cmd) == nil {
+		for _, p := range cfg.Plugins {
+			formats = append(formats, p.Format)
+		}
+	}
+	return formats, cobra.ShellCompDirectiveNoFileComp
+}
+
+// functionNames returns the stored functions starting with prefix, or
+// nothing if the store can't be read: completion must not fail loudly, or
+// create a store that isn't there.
+func functionNames(cmd *cobra.Command, prefix string) []string {
+	if err := loadConfig(cmd); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil
+	}
+	store, err := openStore()
+	if err != nil {
+		return nil
+	}
+	defer store.Close()
+	names, err := store.FunctionNames(prefix, maxCompletions)
+	if err != nil {
+		return nil
+	}
+	return names
+}
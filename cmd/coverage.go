@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/coverage"
+	"github.com/spf13/cobra"
+)
+
+var coverageFlags struct {
+	profile string
+	below   float64
+	top     int
+	format  string
+}
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Import a Go cover profile and list poorly tested, heavily called functions",
+	Long: `coverage attributes the statements in a cover profile (go test
+-coverprofile) to the stored functions and saves the result, replacing any
+earlier import; the UI can then color nodes by coverage. It then lists the
+functions covered below --below percent, the most called first: the spots
+where a missing test hurts most. Without --profile it reports on the
+coverage imported last.`,
+	Example: `  go test -coverprofile cover.out ./... && geeparse coverage --profile cover.out
+  geeparse coverage --below 1 --top 10 --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		stats := make(map[string]coverage.Stats)
+		if coverageFlags.profile != "" {
+			f, err := os.Open(coverageFlags.profile)
+			if err != nil {
+				return err
+			}
+			blocks, err := coverage.ParseProfile(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", coverageFlags.profile, err)
+			}
+			stats = coverage.Attribute(graph, blocks)
+			if err := store.ReplaceCoverage(stats); err != nil {
+				return err
+			}
+			recordAudit(store, "coverage", fmt.Sprintf("%s: %d functions", coverageFlags.profile, len(stats)))
+			var total coverage.Stats
+			for _, st := range stats {
+				total.Covered += st.Covered
+				total.Statements += st.Statements
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "imported coverage for %d of %d functions (%.1f%% of statements)\n",
+				len(stats), len(graph), total.Percent())
+		} else {
+			stored, err := store.Coverage()
+			if err != nil {
+				return err
+			}
+			if len(stored) == 0 {
+				return fmt.Errorf("no coverage stored in %s; import a profile with --profile", dbPath)
+			}
+			for name, c := range stored {
+				stats[name] = c.Stats
+			}
+		}
+
+		spots := coverage.Hotspots(graph, stats, coverageFlags.below, coverageFlags.top)
+		switch strings.ToLower(coverageFlags.format) {
+		case "text":
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "CALLERS\tCOVERED\tFUNCTION\tLOCATION")
+			for _, h := range spots {
+				fmt.Fprintf(tw, "%d\t%.0f%%\t%s\t%s:%d\n", h.Callers, h.Percent, h.Name, displayPath(h.File), h.Line)
+			}
+			return tw.Flush()
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(spots)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", coverageFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := coverageCmd.Flags()
+	f.StringVarP(&coverageFlags.profile, "profile", "p", "", "cover profile to import")
+	f.Float64Var(&coverageFlags.below, "below", 50, "report functions with less than this percentage of statements covered")
+	f.IntVar(&coverageFlags.top, "top", 20, "report at most this many functions (0 = all)")
+	f.StringVarP(&coverageFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(coverageCmd)
+}
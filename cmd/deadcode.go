@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/sarif"
+	"github.com/spf13/cobra"
+)
+
+var deadcodeFlags struct {
+	roots     []string
+	format    string
+	threshold int
+	strict    bool
+	likely    bool
+	sort      string
+	minConf   float64
+}
+
+var deadcodeCmd = &cobra.Command{
+	Use:   "deadcode",
+	Short: "List functions unreachable from the given entrypoints",
+	Long: `deadcode lists stored functions that no --roots entrypoint reaches. Root
+names may use wildcards ("Test*"). With --threshold N the command exits
+non-zero when more than N functions are unreachable, so it can gate merges.
+
+With --likely-unused it also weighs in the coverage and runtime profile
+imported with "geeparse coverage" and "geeparse profile": reachable
+functions that no test covered and no profile sampled are listed as likely
+unused, each with a confidence from 0 to 1 that grows with the evidence.
+Unreachable functions score 1, unless coverage or the profile shows them
+running after all, which points at a call the graph missed. --sort picks
+between the most confident first and source order; --threshold still
+counts only unreachable functions.`,
+	Example: `  geeparse deadcode --roots main,TestMain
+  geeparse deadcode --roots 'main,Test*' --format json --threshold 0
+  geeparse deadcode --likely-unused --min-confidence 0.5`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if deadcodeFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+
+		dead := analysis.DeadCode(graph, deadcodeFlags.roots)
+		out := cmd.OutOrStdout()
+		if deadcodeFlags.likely {
+			if err := printLikelyUnused(out, store, graph); err != nil {
+				return err
+			}
+			return checkDeadThreshold(len(dead))
+		}
+		switch strings.ToLower(deadcodeFlags.format) {
+		case "text":
+			for _, d := range dead {
+				fmt.Fprintf(out, "%s:%d: %s is unreachable\n", displayPath(d.File), d.Line, d.Name)
+			}
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(dead); err != nil {
+				return err
+			}
+		case "sarif":
+			report := sarif.NewReport(".")
+			report.AddDeadCode(dead)
+			if err := report.Write(out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown format %q (want text, json or sarif)", deadcodeFlags.format)
+		}
+
+		return checkDeadThreshold(len(dead))
+	},
+}
+
+func init() {
+	f := deadcodeCmd.Flags()
+	f.StringSliceVar(&deadcodeFlags.roots, "roots", analysis.DefaultRoots, "entrypoint function names or patterns")
+	f.StringVarP(&deadcodeFlags.format, "format", "f", "text", "output format: text, json or sarif")
+	f.IntVar(&deadcodeFlags.threshold, "threshold", -1, "exit non-zero when more than this many functions are unreachable (-1 = never)")
+	f.BoolVar(&deadcodeFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	f.BoolVar(&deadcodeFlags.likely, "likely-unused", false, "also list reachable functions stored coverage and profile never saw run, with a confidence")
+	f.StringVar(&deadcodeFlags.sort, "sort", "confidence", "order of --likely-unused results: confidence or location")
+	f.Float64Var(&deadcodeFlags.minConf, "min-confidence", 0, "leave out --likely-unused results below this confidence (0-1)")
+	deadcodeCmd.RegisterFlagCompletionFunc("sort", cobra.FixedCompletions([]string{"confidence", "location"}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.AddCommand(deadcodeCmd)
+}
+
+func checkDeadThreshold(dead int) error {
+	if deadcodeFlags.threshold >= 0 && dead > deadcodeFlags.threshold {
+		return fmt.Errorf("%d unreachable functions, more than the threshold of %d", dead, deadcodeFlags.threshold)
+	}
+	return nil
+}
+
+// printLikelyUnused scores graph's functions against the stored coverage
+// and profile and prints the suspects in the selected format and order.
+func printLikelyUnused(out io.Writer, store *persistence.Store, graph map[string]callgraph.FunctionNode) error {
+	var ev analysis.Evidence
+	cov, err := store.Coverage()
+	if err != nil {
+		return err
+	}
+	if len(cov) > 0 {
+		ev.Covered = make(map[string]bool, len(cov))
+		for name, c := range cov {
+			if c.Statements > 0 {
+				ev.Covered[name] = c.Covered > 0
+			}
+		}
+	}
+	prof, err := store.Profile()
+	switch {
+	case err == nil:
+		ev.Sampled = make(map[string]bool, len(prof.Nodes))
+		for name, c := range prof.Nodes {
+			ev.Sampled[name] = c.Cum > 0
+		}
+	case !errors.Is(err, persistence.ErrNotFound):
+		return err
+	}
+	if ev.Covered == nil && ev.Sampled == nil {
+		slog.Warn("no coverage or profile imported; only unreachable functions can be listed")
+	}
+
+	suspects := slices.DeleteFunc(analysis.LikelyUnused(graph, deadcodeFlags.roots, ev), func(s analysis.Suspect) bool {
+		return s.Confidence < deadcodeFlags.minConf
+	})
+	switch strings.ToLower(deadcodeFlags.sort) {
+	case "confidence":
+	case "location":
+		slices.SortStableFunc(suspects, func(a, b analysis.Suspect) int {
+			return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Name, b.Name))
+		})
+	default:
+		return fmt.Errorf("unknown sort %q (want confidence or location)", deadcodeFlags.sort)
+	}
+
+	switch strings.ToLower(deadcodeFlags.format) {
+	case "text":
+		for _, s := range suspects {
+			fmt.Fprintf(out, "%s:%d: %s: %s (confidence %.2f)\n", displayPath(s.File), s.Line, s.Name, s.Reason, s.Confidence)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(suspects)
+	default:
+		return fmt.Errorf("--likely-unused prints text or json, not %q", deadcodeFlags.format)
+	}
+}
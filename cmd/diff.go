@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+)
+
+var diffFlags struct {
+	format   string
+	git      string
+	breaking bool
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old> [new]",
+	Short: "Show functions, calls and signatures that changed between two graphs",
+	Long: `diff compares two graphs. Each side is either a path to a graph DB (its
+current graph is used) or a snapshot in --db, given by label or ID ("#12").
+With only <old>, the current graph in --db is the new side.
+
+Exported functions whose parameters or results changed are listed first,
+as possibly breaking API changes, apart from functions whose body alone
+changed. With --fail-breaking the command exits non-zero when there are
+any, so it can gate releases.
+
+A function that disappeared while another with the same body (bar its
+name) appeared is listed as renamed rather than removed and added, as long
+as no other function shares that body. Storing a graph moves annotations
+and tags along the same renames.
+
+Removed calls someone left a note on in the UI, in --db or in the old DB
+file, are listed again with their notes, author and review status, so a
+"remove after the migration" hack going away is easy to confirm.
+
+With --git A..B it instead checks out both revisions of the repository
+containing --root into temporary worktrees, builds both graphs and reports
+what the range changed; A...B compares B against its merge base with A,
+like git diff. Neither the store nor your working tree is touched.`,
+	Example: `  geeparse diff old.db new.db
+  geeparse diff v1.2.0 v1.3.0 --format json
+  geeparse diff '#4'
+  geeparse diff --git HEAD~5..HEAD
+  geeparse diff --git main...my-branch
+  geeparse diff v1.3.0 --fail-breaking`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if diffFlags.git != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var old, new map[string]callgraph.FunctionNode
+		var err error
+		if diffFlags.git != "" {
+			old, new, err = buildGitRange(cmd.Context(), diffFlags.git)
+			if err != nil {
+				return err
+			}
+		} else {
+			old, err = loadGraphRef(args[0])
+			if err != nil {
+				return err
+			}
+			newRef := ""
+			if len(args) == 2 {
+				newRef = args[1]
+			}
+			new, err = loadGraphRef(newRef)
+			if err != nil {
+				return err
+			}
+		}
+
+		res := diff.Compare(old, new)
+		notes, err := diffNotes(args)
+		if err != nil {
+			return err
+		}
+		res.AttachNotes(notes)
+		switch strings.ToLower(diffFlags.format) {
+		case "text":
+			if err := res.WriteText(cmd.OutOrStdout()); err != nil {
+				return err
+			}
+		case "json":
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", diffFlags.format)
+		}
+		if n := len(res.SignatureChanges); diffFlags.breaking && n > 0 {
+			return fmt.Errorf("%d exported signatures changed", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffFlags.format, "format", "f", "text", "output format: text or json")
+	diffCmd.Flags().StringVar(&diffFlags.git, "git", "", `git revision range to compare, "A..B" or "A...B"`)
+	diffCmd.Flags().BoolVar(&diffFlags.breaking, "fail-breaking", false, "exit non-zero if an exported function's signature changed")
+	addAnalysisFlags(diffCmd.Flags())
+	rootCmd.AddCommand(diffCmd)
+}
+
+// loadGraphRef loads the graph a diff argument refers to: an existing DB
+// file's current graph, a snapshot in --db, or ("") the current graph in --db.
+func loadGraphRef(ref string) (map[string]callgraph.FunctionNode, error) {
+	if ref != "" {
+		if fi, err := os.Stat(ref); err == nil && !fi.IsDir() {
+			store, err := persistence.NewStore(ref, slog.Default())
+			if err != nil {
+				return nil, err
+			}
+			defer store.Close()
+			return store.LoadGraph()
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if ref == "" {
+		return store.LoadGraph()
+	}
+	snap, err := store.FindSnapshot(ref)
+	if err != nil {
+		return nil, err
+	}
+	return store.LoadSnapshot(snap.ID)
+}
+
+// diffNotes collects the call annotations kept in --db and in the old
+// graph's DB file, when it is one, for the removed calls to report them.
+// A missing --db has none.
+func diffNotes(args []string) ([]diff.EdgeNote, error) {
+	paths := []string{dbPath}
+	if len(args) > 0 && args[0] != dbPath {
+		paths = append(paths, args[0])
+	}
+	var notes []diff.EdgeNote
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		store, err := persistence.NewStore(path, slog.Default())
+		if err != nil {
+			return nil, err
+		}
+		n, err := store.EdgeNotes()
+		store.Close()
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, n...)
+	}
+	return notes, nil
+}
+
+// buildGitRange builds the graphs of both ends of a git revision range in
+// the repository containing --root. A missing end defaults to HEAD.
+func buildGitRange(ctx context.Context, rng string) (old, new map[string]callgraph.FunctionNode, err error) {
+	root := analysisFlags.root
+	var from, to string
+	if a, b, ok := strings.Cut(rng, "..."); ok {
+		from, to = orHEAD(a), orHEAD(b)
+		if from, err = vcs.MergeBase(root, from, to); err != nil {
+			return nil, nil, err
+		}
+	} else if a, b, ok := strings.Cut(rng, ".."); ok {
+		from, to = orHEAD(a), orHEAD(b)
+	} else {
+		from, to = rng, "HEAD"
+	}
+
+	// analyze the same subdirectory of each worktree that --root is of
+	// the repository
+	top, err := vcs.Git(root, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub, err := filepath.Rel(top, absRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	build := func(ref string) (map[string]callgraph.FunctionNode, error) {
+		wt, err := vcs.Worktree(root, ref)
+		if err != nil {
+			return nil, err
+		}
+		defer wt.Remove()
+		slog.Info("building revision", "ref", ref, "commit", shortCommit(wt.Commit))
+		return callgraph.BuildCallGraph(ctx, filepath.Join(wt.Dir, sub), analysisOptions())
+	}
+	if old, err = build(from); err != nil {
+		return nil, nil, err
+	}
+	if new, err = build(to); err != nil {
+		return nil, nil, err
+	}
+	return old, new, nil
+}
+
+func orHEAD(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	return ref
+}
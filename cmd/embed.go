@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/semantic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// embeddingsFlags are shared by every command that embeds text.
+var embeddingsFlags struct {
+	provider string
+	model    string
+	endpoint string
+}
+
+var searchFlags struct {
+	limit  int
+	format string
+}
+
+var embedCmd = &cobra.Command{
+	Use:   "embed",
+	Short: "Compute embeddings of the stored functions for semantic search",
+	Long: `embed sends the source of every stored function to the embeddings provider
+and keeps the vectors in the store, for geeparse search and the server's
+/api/semantic-search. Functions already embedded with the same model and
+unchanged since are skipped, so rerunning after a build only embeds what
+changed.
+
+Providers: openai (or any OpenAI-compatible API via --embeddings-endpoint,
+key in GEEPARSE_EMBEDDINGS_API_KEY or OPENAI_API_KEY), ollama, and hash, an
+offline keyword-based stand-in.`,
+	Example: `  geeparse embed --embeddings-provider ollama
+  geeparse search "functions that open a DB transaction" --embeddings-provider ollama`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := embedder()
+		if err != nil {
+			return err
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		have, err := store.Embeddings()
+		if err != nil {
+			return err
+		}
+
+		fresh, err := semantic.Update(cmd.Context(), p, graph, have, func(done, total int) {
+			slog.Debug("embedded functions", "done", done, "total", total)
+		})
+		// keep whatever finished before a failure
+		inGraph := func(name string) bool { _, ok := graph[name]; return ok }
+		if serr := store.SaveEmbeddings(fresh, inGraph); serr != nil {
+			return serr
+		}
+		recordAudit(store, "embed", fmt.Sprintf("%d functions with %s", len(fresh), p.Model()))
+		if err != nil {
+			return fmt.Errorf("after %d functions: %w", len(fresh), err)
+		}
+		if jsonOutput() {
+			return printJSON(cmd.OutOrStdout(), struct {
+				Embedded  int    `json:"embedded"`
+				Model     string `json:"model"`
+				Unchanged int    `json:"unchanged"`
+			}{len(fresh), p.Model(), len(graph) - len(fresh)})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "embedded %d functions with %s (%d unchanged)\n",
+			len(fresh), p.Model(), len(graph)-len(fresh))
+		return nil
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search <description>",
+	Short: "Find functions by what they do, using stored embeddings",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := embedder()
+		if err != nil {
+			return err
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		embeddings, err := store.Embeddings()
+		if err != nil {
+			return err
+		}
+		usable := make(map[string]semantic.Embedding)
+		for name, e := range embeddings {
+			if _, ok := graph[name]; ok && e.Model == p.Model() {
+				usable[name] = e
+			}
+		}
+		if len(usable) == 0 {
+			return fmt.Errorf("no %s embeddings stored; run geeparse embed first", p.Model())
+		}
+		matches, err := semantic.Search(cmd.Context(), p, args[0], usable, searchFlags.limit)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(searchFlags.format) {
+		case "text":
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			for _, m := range matches {
+				loc := analysis.LocationOf(graph, m.Function)
+				fmt.Fprintf(tw, "%.3f\t%s\t%s:%d\n", m.Score, m.Function, displayPath(loc.File), loc.Line)
+			}
+			return tw.Flush()
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(matches)
+		}
+		return fmt.Errorf("unknown format %q (want text or json)", searchFlags.format)
+	},
+}
+
+func init() {
+	addEmbeddingsFlags(embedCmd.Flags())
+	addEmbeddingsFlags(searchCmd.Flags())
+	searchCmd.Flags().IntVarP(&searchFlags.limit, "limit", "n", 10, "how many functions to list")
+	searchCmd.Flags().StringVarP(&searchFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(embedCmd, searchCmd)
+}
+
+// addEmbeddingsFlags registers the embeddings provider flags on f.
+func addEmbeddingsFlags(f *pflag.FlagSet) {
+	f.StringVar(&embeddingsFlags.provider, "embeddings-provider", "", "embeddings provider: "+strings.Join(semantic.Providers, ", "))
+	f.StringVar(&embeddingsFlags.model, "embeddings-model", "", "embedding model (default: the provider's usual one)")
+	f.StringVar(&embeddingsFlags.endpoint, "embeddings-endpoint", "", "embeddings API base URL (default: the provider's)")
+}
+
+// embedder returns the provider the embeddings flags select.
+func embedder() (semantic.Provider, error) {
+	key := os.Getenv("GEEPARSE_EMBEDDINGS_API_KEY")
+	if key == "" && embeddingsFlags.provider == "openai" {
+		key = os.Getenv("OPENAI_API_KEY")
+	}
+	return semantic.NewProvider(semantic.Config{
+		Provider: embeddingsFlags.provider,
+		Model:    embeddingsFlags.model,
+		Endpoint: embeddingsFlags.endpoint,
+		APIKey:   key,
+	})
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/spf13/cobra"
+)
+
+var entrypointsFlags struct {
+	roots  []string
+	format string
+	strict bool
+}
+
+var entrypointsCmd = &cobra.Command{
+	Use:   "entrypoints",
+	Short: "Compare how much of the stored graph each entrypoint reaches",
+	Long: `entrypoints lists each --roots function with the number of functions it
+reaches, the depth of the farthest one in calls, the number of packages
+they span, and how many of them no other entrypoint reaches. Root names
+may use wildcards ("handle*"), so commands or HTTP handlers can be
+compared side by side. The largest footprint comes first.`,
+	Example: `  geeparse entrypoints
+  geeparse entrypoints --roots 'handle*' --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if entrypointsFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+
+		eps := analysis.Entrypoints(graph, entrypointsFlags.roots)
+		switch strings.ToLower(entrypointsFlags.format) {
+		case "text":
+			return writeEntrypoints(cmd.OutOrStdout(), eps)
+		case "json":
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(eps)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", entrypointsFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := entrypointsCmd.Flags()
+	f.StringSliceVar(&entrypointsFlags.roots, "roots", analysis.DefaultRoots, "entrypoint function names or patterns")
+	f.StringVarP(&entrypointsFlags.format, "format", "f", "text", "output format: text or json")
+	f.BoolVar(&entrypointsFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	rootCmd.AddCommand(entrypointsCmd)
+}
+
+func writeEntrypoints(w io.Writer, eps []analysis.Footprint) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "entrypoint\treachable\tdepth\tpackages\texclusive\n")
+	for _, ep := range eps {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", ep.Name, ep.Reachable, ep.MaxDepth, ep.Packages, ep.Exclusive)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+var exportFlags struct {
+	format    string
+	out       string
+	root      string
+	depth     int
+	packages  []string
+	hot       bool
+	owners    []string
+	generated string
+	kinds     []string
+	redact    string
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the stored graph in another format",
+	Long: `export writes the stored graph (optionally narrowed to what --root reaches,
+to --package and to the calls of --kinds) as ` + strings.Join(export.Formats, ", ") + `.
+It produces the same output as the server's /api/export endpoint.
+
+--kinds keeps only calls of those kinds: direct calls, deferred ones, go
+statements starting goroutines, dynamic calls through interfaces, and
+indirect references to functions passed around as values. --kinds go
+shows the structure of goroutine spawns.
+
+--redact omit drops function bodies, keeping names, signatures, locations
+and calls; --redact hash replaces each with a hash of it, so renamed and
+changed functions still show between graphs. Either makes a graph of proprietary code safe
+to hand to a vendor.
+
+matrix and matrix-json are for notebooks: matrix is a dense adjacency
+matrix in CSV labelled with the function names (pandas.read_csv with
+index_col=0), matrix-json the calls as a sparse matrix in coordinate form
+with the index of names and packages, ready for scipy.sparse.coo_matrix.
+
+Exec plugins listed under "plugins" in geeparse.yaml add further formats:
+geeparse pipes the graph as JSON to the plugin's command and writes out
+whatever the command prints.
+
+--manifest also writes a manifest of what was exported: digests of its
+functions and calls, the commit of the newest snapshot, the geeparse
+version and the hash of --out, signed with --sign-key into <manifest>.sig.
+See geeparse manifest.
+
+  plugins:
+    - name: plantuml
+      command: ./tools/geeparse-plantuml   # relative to the config file
+      args: [--compact]
+      extension: puml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkManifestFlags(); err != nil {
+			return err
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		kinds, err := callgraph.ParseKinds(exportFlags.kinds...)
+		if err != nil {
+			return fmt.Errorf("--kinds: %w", err)
+		}
+		graph, err = export.Filter{
+			Root:      exportFlags.root,
+			Depth:     exportFlags.depth,
+			Packages:  exportFlags.packages,
+			Kinds:     kinds,
+			Generated: exportFlags.generated,
+			Redact:    exportFlags.redact,
+		}.Apply(graph)
+		if err != nil {
+			return err
+		}
+
+		if len(exportFlags.owners) > 0 {
+			owners, err := store.Owners()
+			if err != nil {
+				return err
+			}
+			graph = callgraph.FilterFunctions(graph, func(name string) bool {
+				return slices.Contains(exportFlags.owners, owners[name].Owner)
+			})
+		}
+
+		var weights export.Weights
+		if exportFlags.hot {
+			prof, err := store.Profile()
+			if err != nil {
+				return fmt.Errorf("--hot needs a profile imported with geeparse profile: %w", err)
+			}
+			weights = prof.EdgeWeights()
+		}
+
+		if exportFlags.out == "" || exportFlags.out == "-" {
+			if err := writeExport(cmd.OutOrStdout(), graph, weights); err != nil {
+				return err
+			}
+		} else {
+			f, err := os.Create(exportFlags.out)
+			if err != nil {
+				return err
+			}
+			if err := writeExport(f, graph, weights); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		if manifestFlags.path == "" {
+			return nil
+		}
+		m, err := exportManifest(store, graph, exportFlags.format, exportFlags.out)
+		if err != nil {
+			return err
+		}
+		return writeManifest(m)
+	},
+}
+
+func writeExport(w io.Writer, graph map[string]callgraph.FunctionNode, weights export.Weights) error {
+	if err := export.WriteWeighted(w, exportFlags.format, graph, weights); err != nil {
+		return fmt.Errorf("export %s: %w", exportFlags.format, err)
+	}
+	return nil
+}
+
+func init() {
+	f := exportCmd.Flags()
+	f.StringVarP(&exportFlags.format, "format", "f", "dot", "output format: "+strings.Join(export.Formats, "|"))
+	f.StringVarP(&exportFlags.out, "out", "o", "", "output file (default: stdout)")
+	f.StringVar(&exportFlags.root, "root", "", "only export functions reachable from this function")
+	f.IntVar(&exportFlags.depth, "depth", 0, "with --root, max number of calls to follow (0 = unlimited)")
+	f.StringSliceVar(&exportFlags.packages, "package", nil, "only export these packages and their subpackages (repeatable)")
+	f.StringSliceVar(&exportFlags.owners, "owner", nil, "only export functions with these owners (see geeparse owners)")
+	f.StringSliceVar(&exportFlags.kinds, "kinds", nil, "only export calls of these kinds: "+strings.Join(callgraph.CallKinds, "|")+" (repeatable)")
+	f.StringVar(&exportFlags.generated, "generated", "", "collapse generated code into one node per kind and package, or hide it: collapse|hide")
+	f.StringVar(&exportFlags.redact, "redact", "", "leave function bodies out, to share the graph without the code: "+strings.Join(callgraph.RedactModes, "|"))
+	f.BoolVar(&exportFlags.hot, "hot", false, "emphasize calls by the cost in the imported runtime profile")
+	addManifestFlags(f)
+	exportCmd.RegisterFlagCompletionFunc("format", completeExportFormat)
+	exportCmd.RegisterFlagCompletionFunc("root", completeFunctionFlag)
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+)
+
+var impactFlags struct {
+	changed []string
+	since   string
+	format  string
+	strict  bool
+}
+
+var impactCmd = &cobra.Command{
+	Use:   "impact",
+	Short: "List every function affected by a change, and the tests to rerun",
+	Long: `impact maps a change set to the stored functions it touches and reports all
+of their transitive callers, nearest first, plus the affected Test*,
+Benchmark*, Fuzz* and Example* functions.
+
+The change set is either whole files (--changed, or "--changed -" to read
+file names from stdin, e.g. from git diff --name-only) or, by default, the
+changed lines in the working tree since --since (HEAD).`,
+	Example: `  geeparse impact
+  geeparse impact --since main --format json
+  geeparse impact --changed pkg/server/server.go,pkg/server/admin.go
+  git diff --name-only main | geeparse impact --changed -`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		changes, err := changeSet(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if impactFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+
+		imp := analysis.ImpactOf(graph, analysis.FunctionsAt(graph, changes))
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(impactFlags.format) {
+		case "text":
+			return writeImpact(out, imp)
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(imp)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", impactFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := impactCmd.Flags()
+	f.StringSliceVar(&impactFlags.changed, "changed", nil, `changed files, or "-" to read them from stdin one per line`)
+	f.StringVar(&impactFlags.since, "since", "HEAD", "git revision to diff the working tree against when --changed isn't given")
+	f.StringVarP(&impactFlags.format, "format", "f", "text", "output format: text or json")
+	f.BoolVar(&impactFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	rootCmd.AddCommand(impactCmd)
+}
+
+// changeSet collects the changed files (as absolute paths) and lines the
+// flags describe.
+func changeSet(stdin io.Reader) (map[string][]analysis.LineRange, error) {
+	changes := make(map[string][]analysis.LineRange)
+	if len(impactFlags.changed) == 0 {
+		hunks, err := vcs.DiffHunks(".", impactFlags.since)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hunks {
+			if h.Start == 0 {
+				changes[h.File] = nil
+				continue
+			}
+			if ranges, ok := changes[h.File]; !ok || ranges != nil {
+				changes[h.File] = append(ranges, analysis.LineRange{Start: h.Start, End: h.End})
+			}
+		}
+		return changes, nil
+	}
+
+	files := impactFlags.changed
+	if len(files) == 1 && files[0] == "-" {
+		files = nil
+		sc := bufio.NewScanner(stdin)
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				files = append(files, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		changes[abs] = nil
+	}
+	return changes, nil
+}
+
+func writeImpact(w io.Writer, imp analysis.Impact) error {
+	fmt.Fprintf(w, "Changed functions (%d):\n", len(imp.Changed))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range imp.Changed {
+		fmt.Fprintf(tw, "  %s\t%s:%d\n", c.Name, displayPath(c.File), c.Line)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nAffected callers (%d):\n", len(imp.Affected))
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, a := range imp.Affected {
+		fmt.Fprintf(tw, "  %d\t%s\t%s:%d\n", a.Distance, a.Name, displayPath(a.File), a.Line)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(imp.Tests) > 0 {
+		fmt.Fprintf(w, "\nTests to rerun (%d): %s\n", len(imp.Tests), strings.Join(imp.Tests, " "))
+	}
+	return nil
+}
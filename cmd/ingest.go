@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/ingest"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/spf13/cobra"
+)
+
+var ingestFlags struct {
+	namespace string
+	label     string
+	schema    bool
+	redact    string
+	merge     string
+}
+
+var ingestCmd = &cobra.Command{
+	Use:   "ingest [file]",
+	Short: "Store a call graph produced by another tool or language",
+	Long: `ingest reads a language-neutral call graph from file (or standard input)
+and stores it, so analyzers for Python, TypeScript and other languages can
+feed the same store, API and UI. The graph is JSON,
+
+  {"version": 1, "language": "python",
+   "nodes": [{"name": "models.User.save", "package": "app/models",
+              "file": "app/models.py", "line": 10, "endLine": 24}],
+   "edges": [{"caller": "views.signup", "callee": "models.User.save"}]}
+
+or the same node and edge records one per line, as build --stdout writes.
+Only a node's name is required, and edges to names that aren't nodes are
+dropped, except those with a "language" other than their caller's: calls
+into another language's graph, such as a Python extension calling C, which
+are linked to the function of that name once a graph of that language is
+stored too. --schema prints the JSON Schema.
+
+With --namespace the functions are stored as namespace/name and replace
+only that namespace's previous ones, leaving the rest of the graph (say,
+the Go build) in place; without it they replace the whole graph, unless
+--merge merges them into it, as build --merge does: say, the calls an SSA
+analyzer found on top of those of the gopls build. A running
+server accepts the same input at POST /api/ingest?namespace=, with the
+admin token.`,
+	Example: `  pyan-to-geeparse app/ | geeparse ingest --namespace py
+  geeparse ingest --namespace web web-graph.json
+  ssa-calls ./... | geeparse ingest --merge keep`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ingestFlags.schema {
+			_, err := cmd.OutOrStdout().Write(ingest.Schema)
+			return err
+		}
+		ns := strings.Trim(ingestFlags.namespace, "/")
+		if strings.ContainsAny(ns, "*? ") {
+			return fmt.Errorf("--namespace may not contain *, ? or spaces")
+		}
+		if ingestFlags.merge != "" {
+			if ns != "" {
+				return fmt.Errorf("--merge merges into the whole graph; it can't be used with --namespace")
+			}
+			if !slices.Contains(callgraph.MergeStrategies, ingestFlags.merge) {
+				return fmt.Errorf("unknown --merge strategy %q (want %s)", ingestFlags.merge, strings.Join(callgraph.MergeStrategies, ", "))
+			}
+		}
+		var in io.Reader = cmd.InOrStdin()
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		res, err := ingest.Read(in)
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := callgraph.Redact(res.Graph, ingestFlags.redact)
+		if err != nil {
+			return fmt.Errorf("--redact: %w", err)
+		}
+		switch {
+		case ns != "":
+			graph = callgraph.Namespace(graph, ns)
+			err = store.ReplaceNamespace(ns, graph)
+		case ingestFlags.merge != "":
+			_, err = store.MergeGraph(graph, ingestFlags.merge)
+		default:
+			err = store.SaveGraph(graph)
+		}
+		if err != nil {
+			return err
+		}
+		full, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		label := ingestFlags.label
+		if label == "" {
+			label = strings.TrimSpace("ingest " + ns + " " + time.Now().UTC().Format(time.RFC3339))
+		}
+		snap, err := store.SaveSnapshot(label, full, persistence.Source{})
+		if err != nil {
+			return err
+		}
+		recordAudit(store, "ingest", fmt.Sprintf("snapshot #%d %q: %d functions, %d calls",
+			snap.ID, snap.Label, len(graph), callgraph.EdgeCount(graph)))
+		if jsonOutput() {
+			return printJSON(cmd.OutOrStdout(), savedGraph{Functions: len(graph), Calls: callgraph.EdgeCount(graph),
+				DB: dbPath, Snapshot: snap.ID, Label: snap.Label, Dropped: res.Dropped, Foreign: res.Foreign})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "ingested %d functions, %d calls into %s (snapshot #%d %q)",
+			len(graph), callgraph.EdgeCount(graph), dbPath, snap.ID, snap.Label)
+		if res.Dropped > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "; dropped %d calls to unknown functions", res.Dropped)
+		}
+		if res.Foreign > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "; kept %d calls into other languages", res.Foreign)
+		}
+		fmt.Fprintln(cmd.OutOrStdout())
+		return nil
+	},
+}
+
+func init() {
+	ingestCmd.Flags().StringVar(&ingestFlags.namespace, "namespace", "", "store the functions as namespace/name, replacing only that namespace")
+	ingestCmd.Flags().StringVar(&ingestFlags.label, "label", "", "snapshot label (default: ingest time)")
+	ingestCmd.Flags().StringVar(&ingestFlags.redact, "redact", "", "keep function bodies out of the store: "+strings.Join(callgraph.RedactModes, "|"))
+	ingestCmd.Flags().StringVar(&ingestFlags.merge, "merge", "", "merge into the stored graph instead of replacing it, keeping the stored or the new details of functions in both: "+strings.Join(callgraph.MergeStrategies, "|"))
+	ingestCmd.Flags().BoolVar(&ingestFlags.schema, "schema", false, "print the JSON Schema of the input and exit")
+	rootCmd.AddCommand(ingestCmd)
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var manFlags struct {
+	dir string
+}
+
+var manCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Write man pages for every command",
+	Long: `man writes a section 1 man page per command, geeparse.1 and
+geeparse-build.1 and so on, into --dir, generated from the same help text
+the commands print. Packagers install them under share/man/man1.
+
+The page date is the current day, or SOURCE_DATE_EPOCH when set, for
+reproducible builds. Shell completions come from geeparse completion.`,
+	Example: `  geeparse man --dir /usr/local/share/man/man1
+  geeparse completion bash > /etc/bash_completion.d/geeparse`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(manFlags.dir, 0o755); err != nil {
+			return err
+		}
+		date := time.Now()
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			sec, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				return fmt.Errorf("SOURCE_DATE_EPOCH: %w", err)
+			}
+			date = time.Unix(sec, 0)
+		}
+		n := 0
+		err := walkCommands(cmd.Root(), func(c *cobra.Command) error {
+			path := filepath.Join(manFlags.dir, manName(c)+".1")
+			if err := os.WriteFile(path, manPage(c, date), 0o644); err != nil {
+				return err
+			}
+			n++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "wrote %d man pages to %s\n", n, manFlags.dir)
+		return nil
+	},
+}
+
+func init() {
+	manCmd.Flags().StringVarP(&manFlags.dir, "dir", "d", "man", "directory to write the pages to")
+	rootCmd.AddCommand(manCmd)
+}
+
+// walkCommands calls fn for c and every command below it that users can
+// run, skipping help and hidden commands.
+func walkCommands(c *cobra.Command, fn func(*cobra.Command) error) error {
+	if !c.IsAvailableCommand() && c.HasParent() {
+		return nil
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	for _, sub := range c.Commands() {
+		if err := walkCommands(sub, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manName is c's page name: its command path joined with dashes.
+func manName(c *cobra.Command) string {
+	return strings.ReplaceAll(c.CommandPath(), " ", "-")
+}
+
+// manPage renders c's help as a roff man page.
+func manPage(c *cobra.Command, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, ".TH %q 1 %q %q \"geeparse manual\"\n", strings.ToUpper(manName(c)), date.UTC().Format("2006-01-02"), "geeparse "+buildinfo.Version())
+
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", roff(manName(c)), roff(c.Short))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n", roff(c.UseLine()))
+
+	b.WriteString(".SH DESCRIPTION\n")
+	desc := c.Long
+	if desc == "" {
+		desc = c.Short
+	}
+	manText(&b, desc)
+
+	if flags := c.NonInheritedFlags(); flags.HasAvailableFlags() {
+		b.WriteString(".SH OPTIONS\n")
+		manFlagList(&b, flags)
+	}
+	if flags := c.InheritedFlags(); flags.HasAvailableFlags() {
+		b.WriteString(".SH GLOBAL OPTIONS\n")
+		manFlagList(&b, flags)
+	}
+	if c.Example != "" {
+		b.WriteString(".SH EXAMPLES\n")
+		manText(&b, c.Example)
+	}
+
+	var related []string
+	if c.HasParent() {
+		related = append(related, manName(c.Parent()))
+	}
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() {
+			related = append(related, manName(sub))
+		}
+	}
+	if len(related) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		for i, name := range related {
+			sep := ","
+			if i == len(related)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, ".BR %s (1)%s\n", roff(name), sep)
+		}
+	}
+	return b.Bytes()
+}
+
+// manText writes help text as paragraphs, keeping indented blocks
+// (examples, YAML) as preformatted text.
+func manText(b *bytes.Buffer, text string) {
+	b.WriteString(".PP\n")
+	pre, para, blanks := false, true, 0
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		switch {
+		case line == "":
+			blanks++
+			continue
+		case indented && !pre:
+			if !para {
+				b.WriteString(".PP\n")
+			}
+			b.WriteString(".nf\n.RS\n")
+			pre = true
+		case indented:
+			// blank lines inside a block are kept
+			b.WriteString(strings.Repeat("\n", blanks))
+		case pre:
+			b.WriteString(".RE\n.fi\n.PP\n")
+			pre = false
+		case blanks > 0 && !para:
+			b.WriteString(".PP\n")
+		}
+		b.WriteString(roff(line) + "\n")
+		para, blanks = false, 0
+	}
+	if pre {
+		b.WriteString(".RE\n.fi\n")
+	}
+}
+
+// manFlagList writes one tagged paragraph per flag.
+func manFlagList(b *bytes.Buffer, flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		b.WriteString(".TP\n")
+		name := `\fB\-\-` + roff(f.Name) + `\fR`
+		if f.Shorthand != "" {
+			name = `\fB\-` + roff(f.Shorthand) + `\fR, ` + name
+		}
+		varname, usage := pflag.UnquoteUsage(f)
+		if varname != "" {
+			name += ` \fI` + roff(varname) + `\fR`
+		}
+		b.WriteString(name + "\n")
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "[]" && f.DefValue != "0" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		b.WriteString(roff(usage) + "\n")
+	})
+}
+
+// roff escapes text for roff: backslashes and dashes, and control
+// characters at the start of a line.
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/manifest"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// manifestFlags are shared by the commands that can describe what they
+// wrote in a signed manifest.
+var manifestFlags struct {
+	path    string
+	signKey string
+}
+
+var manifestVerifyFlags struct {
+	key      string
+	artifact string
+	snapshot string
+	format   string
+}
+
+// manifestReport is what manifest verify prints with --format json.
+type manifestReport struct {
+	// Signature is "ok", or "unchecked" without --key; a bad signature
+	// fails verify before anything is reported.
+	Signature string          `json:"signature"`
+	Tool      string          `json:"tool"`
+	Source    manifest.Source `json:"source"`
+	// Artifact is the exported file's hash against the recorded one, if
+	// the manifest describes a file.
+	Artifact *artifactHash   `json:"artifact,omitempty"`
+	Checks   []manifestCheck `json:"checks"`
+	OK       bool            `json:"ok"`
+}
+
+type artifactHash struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	// Actual is empty when the file couldn't be read.
+	Actual string `json:"actual"`
+	OK     bool   `json:"ok"`
+}
+
+type manifestCheck struct {
+	Check string `json:"check"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Make signing keys for graph manifests and verify manifests",
+	Long: `build and export write, with --manifest, a manifest of the graph they saved
+or exported: SHA-256 digests of its functions and of its calls, the commit
+it was built from (and whether the tree had uncommitted changes), the
+geeparse version, the snapshot ID and the exported file's hash. With
+--sign-key they also write a detached Ed25519 signature next to it, as
+manifest.sig, so consumers can check the graph is the one built from that
+revision and hasn't been altered since.`,
+}
+
+var manifestKeygenCmd = &cobra.Command{
+	Use:   "keygen <name>",
+	Short: "Write a new signing key pair as name.key and name.pub",
+	Long: `keygen writes a new Ed25519 key pair as PEM files: name.key, the private key
+to pass to --sign-key, readable only by you, and name.pub, the public key to
+hand to whoever verifies. It won't overwrite an existing name.key. Keys made
+by "openssl genpkey -algorithm ed25519" work too.`,
+	Example:     `  geeparse manifest keygen geeparse-signing`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		priv, pub := args[0]+".key", args[0]+".pub"
+		if err := manifest.GenerateKey(priv, pub); err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON(cmd.OutOrStdout(), struct {
+				PrivateKey string `json:"privateKey"`
+				PublicKey  string `json:"publicKey"`
+			}{priv, pub})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "wrote private key %s and public key %s\n", priv, pub)
+		return nil
+	},
+}
+
+var manifestVerifyCmd = &cobra.Command{
+	Use:   "verify <manifest>",
+	Short: "Check a manifest's signature and the graph or file it describes",
+	Long: `verify checks, with --key, that the manifest's signature (manifest.sig) was
+made by that key's owner over this exact manifest. It then checks what the
+manifest describes is unaltered: the exported file, found at --artifact or
+where the manifest records it, relative to the manifest, must have the
+recorded hash, and a JSON export must hold the recorded functions and
+calls; the snapshot given with --snapshot, or else the one the manifest
+names if --db exists, must too. It exits non-zero if anything fails.`,
+	Example: `  geeparse manifest verify graph.manifest.json --key geeparse-signing.pub
+  geeparse manifest verify build.manifest.json --db graph.db --snapshot '#12'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var pub ed25519.PublicKey
+		if manifestVerifyFlags.key != "" {
+			var err error
+			if pub, err = manifest.LoadPublicKey(manifestVerifyFlags.key); err != nil {
+				return err
+			}
+		}
+		format := strings.ToLower(manifestVerifyFlags.format)
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unknown format %q (want text or json)", manifestVerifyFlags.format)
+		}
+		m, err := manifest.Read(args[0], pub)
+		if err != nil {
+			return err
+		}
+		report := manifestReport{Signature: "unchecked", Tool: m.Tool, Source: m.Source, Checks: []manifestCheck{}}
+		if pub != nil {
+			report.Signature = "ok"
+		}
+
+		var failed []error
+		check := func(what string, err error) {
+			c := manifestCheck{Check: what, OK: err == nil}
+			if err != nil {
+				c.Error = err.Error()
+				failed = append(failed, fmt.Errorf("%s: %w", what, err))
+			}
+			report.Checks = append(report.Checks, c)
+		}
+		if m.Artifact != nil {
+			path := manifestVerifyFlags.artifact
+			if path == "" {
+				path = m.Artifact.Path
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(filepath.Dir(args[0]), path)
+				}
+			}
+			sum, err := checkArtifact(path, m)
+			report.Artifact = &artifactHash{Path: path, SHA256: m.Artifact.SHA256, Actual: sum, OK: sum == m.Artifact.SHA256}
+			check("artifact "+path, err)
+		}
+		if ref := snapshotToVerify(m); ref != "" {
+			check("snapshot "+ref, checkSnapshot(ref, m))
+		}
+		if len(report.Checks) == 0 {
+			return errors.New("nothing to check the manifest against; give --artifact or --snapshot")
+		}
+		report.OK = len(failed) == 0
+
+		out := cmd.OutOrStdout()
+		if format == "json" {
+			if err := printJSON(out, report); err != nil {
+				return err
+			}
+			return errors.Join(failed...)
+		}
+		if pub != nil {
+			fmt.Fprintln(out, "signature: ok")
+		} else {
+			fmt.Fprintln(out, "signature: not checked (no --key)")
+		}
+		fmt.Fprintf(out, "built by geeparse %s from %s\n", m.Tool, describeSource(m.Source))
+		for _, c := range report.Checks {
+			if c.OK {
+				fmt.Fprintf(out, "%s: ok\n", c.Check)
+			} else {
+				fmt.Fprintf(out, "%s: FAILED: %s\n", c.Check, c.Error)
+			}
+		}
+		return errors.Join(failed...)
+	},
+}
+
+func init() {
+	f := manifestVerifyCmd.Flags()
+	f.StringVar(&manifestVerifyFlags.key, "key", "", "public key (PEM) the manifest must be signed with")
+	f.StringVar(&manifestVerifyFlags.artifact, "artifact", "", "exported file to check (default: the path the manifest records)")
+	f.StringVar(&manifestVerifyFlags.snapshot, "snapshot", "", "snapshot in --db to check, by ID (#12) or label")
+	f.StringVarP(&manifestVerifyFlags.format, "format", "f", "text", "output format: text or json")
+	manifestCmd.AddCommand(manifestKeygenCmd, manifestVerifyCmd)
+	rootCmd.AddCommand(manifestCmd)
+}
+
+// addManifestFlags registers --manifest and --sign-key on f.
+func addManifestFlags(f *pflag.FlagSet) {
+	f.StringVar(&manifestFlags.path, "manifest", "", "also write a manifest of the graph (digests, commit, geeparse version) to this file")
+	f.StringVar(&manifestFlags.signKey, "sign-key", "", "Ed25519 private key (PEM) to sign the manifest with, into <manifest>.sig")
+}
+
+// checkManifestFlags fails early, before any work, on a bad --sign-key.
+func checkManifestFlags() error {
+	if manifestFlags.signKey == "" {
+		return nil
+	}
+	if manifestFlags.path == "" {
+		return errors.New("--sign-key needs --manifest")
+	}
+	_, err := manifest.LoadPrivateKey(manifestFlags.signKey)
+	return err
+}
+
+// writeManifest writes m to --manifest, signed with --sign-key if set,
+// when --manifest is set.
+func writeManifest(m manifest.Manifest) error {
+	if manifestFlags.path == "" {
+		return nil
+	}
+	var key ed25519.PrivateKey
+	if manifestFlags.signKey != "" {
+		var err error
+		if key, err = manifest.LoadPrivateKey(manifestFlags.signKey); err != nil {
+			return err
+		}
+	}
+	if err := manifest.Write(manifestFlags.path, m, key); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// manifestSource describes where a graph of roots was built from: src
+// for remote repositories, else the commit checked out in a single root
+// and whether its tree had changes. Several local roots have no one
+// revision.
+func manifestSource(roots []sourceRoot, src persistence.Source) manifest.Source {
+	if src.Repo != "" || len(roots) != 1 {
+		return manifest.Source{Repo: src.Repo, Ref: src.Ref, Commit: src.Commit}
+	}
+	commit, err := vcs.Git(roots[0].dir, "rev-parse", "HEAD")
+	if err != nil {
+		return manifest.Source{}
+	}
+	status, err := vcs.Git(roots[0].dir, "status", "--porcelain", "--", ".")
+	return manifest.Source{Commit: commit, Dirty: err != nil || status != ""}
+}
+
+func describeSource(src manifest.Source) string {
+	if src.Commit == "" {
+		return "an unrecorded revision"
+	}
+	s := "commit " + src.Commit
+	if src.Repo != "" {
+		s = src.Repo + " " + s
+	}
+	if src.Dirty {
+		s += " with uncommitted changes"
+	}
+	return s
+}
+
+// checkArtifact compares the file at path with m's artifact, and for
+// JSON exports its graph with m's digests. It returns the file's hash,
+// empty if it couldn't be read.
+func checkArtifact(path string, m manifest.Manifest) (string, error) {
+	sum, err := manifest.FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	if sum != m.Artifact.SHA256 {
+		return sum, fmt.Errorf("hash %s, manifest says %s", sum, m.Artifact.SHA256)
+	}
+	if !strings.EqualFold(m.Artifact.Format, "json") {
+		return sum, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sum, err
+	}
+	var graph map[string]callgraph.FunctionNode
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return sum, err
+	}
+	return sum, m.Check(graph)
+}
+
+// snapshotToVerify is --snapshot, or the snapshot m names when --db
+// exists to look it up in.
+func snapshotToVerify(m manifest.Manifest) string {
+	if manifestVerifyFlags.snapshot != "" {
+		return manifestVerifyFlags.snapshot
+	}
+	if m.Snapshot == 0 {
+		return ""
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("#%d", m.Snapshot)
+}
+
+func checkSnapshot(ref string, m manifest.Manifest) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	snap, err := store.FindSnapshot(ref)
+	if err != nil {
+		return err
+	}
+	graph, err := store.LoadSnapshot(snap.ID)
+	if err != nil {
+		return err
+	}
+	return m.Check(graph)
+}
+
+// exportManifest describes a graph exported to out in format, noting the
+// revision of the newest snapshot in store.
+func exportManifest(store *persistence.Store, graph map[string]callgraph.FunctionNode, format, out string) (manifest.Manifest, error) {
+	var src manifest.Source
+	snaps, err := store.Snapshots()
+	if err != nil {
+		return manifest.Manifest{}, err
+	}
+	if len(snaps) > 0 {
+		src = manifest.Source{Repo: snaps[0].Repo, Ref: snaps[0].Ref, Commit: snaps[0].Commit}
+	}
+	m := manifest.New(graph, src)
+	if out != "" && out != "-" {
+		sum, err := manifest.FileSHA256(out)
+		if err != nil {
+			return manifest.Manifest{}, err
+		}
+		rel := out
+		if abs, err := filepath.Abs(out); err == nil {
+			if dir, err := filepath.Abs(filepath.Dir(manifestFlags.path)); err == nil {
+				if r, err := filepath.Rel(dir, abs); err == nil {
+					rel = r
+				}
+			}
+		}
+		m.Artifact = &manifest.Artifact{Path: filepath.ToSlash(rel), Format: format, SHA256: sum}
+	}
+	return m, nil
+}
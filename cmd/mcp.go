@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/mcp"
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve the stored graph to coding assistants over the Model Context Protocol",
+	Long: `mcp speaks the Model Context Protocol on stdin and stdout, offering tools
+to find functions and to look up their definitions, callers, callees and the
+call chains between them. Point an MCP client at it, e.g.
+
+  {"mcpServers": {"geeparse": {"command": "geeparse", "args": ["mcp", "--db", "/path/to/graph.db"]}}}
+
+It reads the graph from the store on every call, so keep it fresh with
+build or watch.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		return mcp.New(store, buildinfo.Version()).Serve(cmd.Context(), os.Stdin, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/notify"
+	"github.com/spf13/pflag"
+)
+
+// notifyFlags are shared by every command that rebuilds the graph.
+var notifyFlags struct {
+	webhook string
+	format  string
+}
+
+// addNotifyFlags registers the rebuild notification flags on f.
+func addNotifyFlags(f *pflag.FlagSet) {
+	f.StringVar(&notifyFlags.webhook, "webhook", "", "post a summary of each rebuild's changes to this Slack, Teams or other webhook URL")
+	f.StringVar(&notifyFlags.format, "webhook-format", "", fmt.Sprintf("webhook payload (%s; default: from the URL's host)", strings.Join(notify.Formats, ", ")))
+}
+
+// webhook returns the configured webhook, or nil if there is none.
+func webhook() (*notify.Webhook, error) {
+	if notifyFlags.webhook == "" {
+		return nil, nil
+	}
+	w := &notify.Webhook{URL: notifyFlags.webhook, Format: notifyFlags.format}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// notifyRebuild posts what changed between old and new to w. A first
+// build (old is empty) and a rebuild that changed nothing worth reporting
+// stay quiet; failures are logged rather than failing the build.
+func notifyRebuild(ctx context.Context, w *notify.Webhook, label string, old, new map[string]callgraph.FunctionNode) {
+	if w == nil || len(old) == 0 {
+		return
+	}
+	s := notify.Summarize(label, old, new, cfg.Rules)
+	if s.Empty() {
+		return
+	}
+	if err := w.Post(ctx, s); err != nil {
+		slog.Error("notify failed", "err", err)
+		return
+	}
+	slog.Debug("posted rebuild summary", "added", len(s.AddedFunctions), "removed", len(s.RemovedFunctions),
+		"cycles", len(s.NewCycles), "violations", len(s.NewViolations))
+}
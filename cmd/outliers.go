@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/spf13/cobra"
+)
+
+var outliersFlags struct {
+	maxStatements int
+	maxNesting    int
+	packages      []string
+	format        string
+	strict        bool
+}
+
+var outliersCmd = &cobra.Command{
+	Use:   "outliers",
+	Short: "List the functions that are too long or too deeply nested",
+	Long: `outliers lists the stored functions with more statements than --max-statements
+or blocks nested deeper than --max-nesting, the longest first, with how many
+functions call them and how many they call: a long function with a high
+fan-in is the one to split up first. Statements count those of nested blocks
+and function literals; each if, for, switch, select and function literal
+nests one deeper, and an else if no deeper than its if. A limit of 0 isn't
+checked. Generated code and the standard library are left out.
+
+Graphs built before geeparse measured functions have no statement counts;
+build them again to list outliers.`,
+	Example: `  geeparse outliers
+  geeparse outliers --max-statements 0 --max-nesting 5
+  geeparse outliers --package github.com/acme/app/pkg/store --format json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if outliersFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+		if !analysis.Measured(graph) {
+			return fmt.Errorf("the stored graph has no statement counts; build it again")
+		}
+
+		outliers := analysis.Outliers(graph, outliersFlags.maxStatements, outliersFlags.maxNesting, outliersFlags.packages)
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(outliersFlags.format) {
+		case "text":
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "Function\tstatements\tnesting\tfan-in\tfan-out\tlocation\n")
+			for _, o := range outliers {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s:%d\n", o.Name, o.Statements, o.Nesting, o.FanIn, o.FanOut, displayPath(o.File), o.Line)
+			}
+			return tw.Flush()
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(outliers)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", outliersFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := outliersCmd.Flags()
+	f.IntVar(&outliersFlags.maxStatements, "max-statements", analysis.DefaultMaxStatements, "list functions with more statements than this (0 = don't check)")
+	f.IntVar(&outliersFlags.maxNesting, "max-nesting", analysis.DefaultMaxNesting, "list functions with blocks nested deeper than this (0 = don't check)")
+	f.StringSliceVar(&outliersFlags.packages, "package", nil, "only report these packages and the ones below them")
+	f.StringVarP(&outliersFlags.format, "format", "f", "text", "output format: text or json")
+	f.BoolVar(&outliersFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics from fan-in and fan-out")
+	rootCmd.AddCommand(outliersCmd)
+}
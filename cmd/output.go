@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// outputMode is --output: "text", or "json" for commands to print their
+// results as JSON so scripts don't have to parse text.
+var outputMode string
+
+// printsJSON marks, in a command's Annotations, a command without a
+// --format flag that prints JSON itself under --output json (see
+// jsonOutput), or always does.
+const printsJSON = "geeparse/json"
+
+// applyOutput validates --output. Under json, commands with a --format
+// flag the user didn't pass get --format json; others must be marked
+// printsJSON, so long-running commands such as serve fail loudly rather
+// than print text a script would choke on.
+func applyOutput(cmd *cobra.Command) error {
+	switch strings.ToLower(outputMode) {
+	case "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("unknown --output %q (want text or json)", outputMode)
+	}
+	if f := cmd.Flags().Lookup("format"); f != nil {
+		if f.Changed {
+			return nil
+		}
+		return f.Value.Set("json")
+	}
+	// help is for people, whatever the output mode
+	if _, ok := cmd.Annotations[printsJSON]; ok || cmd.Name() == "help" {
+		return nil
+	}
+	return fmt.Errorf("%s has no JSON output", cmd.CommandPath())
+}
+
+// jsonOutput reports whether --output json was given.
+func jsonOutput() bool {
+	return strings.EqualFold(outputMode, "json")
+}
+
+// printJSON writes v indented, as every --format json does.
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// savedGraph is what build and ingest print under --output json.
+type savedGraph struct {
+	Functions int    `json:"functions"`
+	Calls     int    `json:"calls"`
+	DB        string `json:"db"`
+	Snapshot  int64  `json:"snapshot"`
+	Label     string `json:"label"`
+	// Dropped counts the ingested calls to unknown functions; always 0
+	// for build.
+	Dropped int `json:"dropped"`
+	// Foreign counts the ingested calls into other languages' functions.
+	Foreign int `json:"foreign,omitempty"`
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/ownership"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+)
+
+var ownersFlags struct {
+	root       string
+	blame      bool
+	codeowners string
+	format     string
+}
+
+var ownersCmd = &cobra.Command{
+	Use:   "owners",
+	Short: "Attach owners to functions and list what each owner has",
+}
+
+var ownersAssignCmd = &cobra.Command{
+	Use:   "assign",
+	Short: "Work out an owner for every stored function",
+	Long: `assign gives each stored function the first owner CODEOWNERS lists for its
+file (CODEOWNERS, .github/CODEOWNERS, docs/CODEOWNERS or .gitlab/CODEOWNERS
+in the repository containing --root, or --codeowners). With --blame,
+functions CODEOWNERS doesn't cover go to whoever wrote most of their lines
+according to git blame. The result replaces earlier assignments; the UI
+shows it and filters on "owner:NAME", and export --owner narrows to it.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoRoot, err := vcs.Git(ownersFlags.root, "rev-parse", "--show-toplevel")
+		if err != nil {
+			if ownersFlags.blame {
+				return err
+			}
+			if repoRoot, err = filepath.Abs(ownersFlags.root); err != nil {
+				return err
+			}
+		}
+
+		var co *ownership.Codeowners
+		if ownersFlags.codeowners != "" {
+			f, err := os.Open(ownersFlags.codeowners)
+			if err != nil {
+				return err
+			}
+			co, err = ownership.ParseCodeowners(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", ownersFlags.codeowners, err)
+			}
+		} else if co, err = ownership.FindCodeowners(repoRoot); err != nil {
+			return err
+		}
+		if co == nil && !ownersFlags.blame {
+			return fmt.Errorf("no CODEOWNERS file in %s; pass --codeowners or --blame", repoRoot)
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		owners, err := ownership.Assign(graph, repoRoot, co, ownersFlags.blame)
+		if err != nil {
+			return err
+		}
+		if err := store.ReplaceOwners(owners); err != nil {
+			return err
+		}
+		recordAudit(store, "owners", fmt.Sprintf("%d of %d functions", len(owners), len(graph)))
+		if jsonOutput() {
+			return printJSON(cmd.OutOrStdout(), struct {
+				Assigned  int `json:"assigned"`
+				Functions int `json:"functions"`
+			}{len(owners), len(graph)})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "assigned owners to %d of %d functions\n", len(owners), len(graph))
+		return nil
+	},
+}
+
+var ownersListCmd = &cobra.Command{
+	Use:   "list [owner]",
+	Short: "Count functions per owner, or list the functions of one owner",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		owners, err := store.Owners()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		format := strings.ToLower(ownersFlags.format)
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unknown format %q (want text or json)", ownersFlags.format)
+		}
+
+		if len(args) == 0 {
+			counts := make(map[string]int)
+			for _, o := range owners {
+				counts[o.Owner]++
+			}
+			if format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(counts)
+			}
+			names := make([]string, 0, len(counts))
+			for name := range counts {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				if counts[names[i]] != counts[names[j]] {
+					return counts[names[i]] > counts[names[j]]
+				}
+				return names[i] < names[j]
+			})
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			for _, name := range names {
+				fmt.Fprintf(tw, "%d\t%s\n", counts[name], name)
+			}
+			return tw.Flush()
+		}
+
+		fns := []string{}
+		for name, o := range owners {
+			if o.Owner == args[0] {
+				fns = append(fns, name)
+			}
+		}
+		sort.Strings(fns)
+		if format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(fns)
+		}
+		for _, name := range fns {
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	ownersAssignCmd.Flags().StringVarP(&ownersFlags.root, "root", "r", ".", "directory inside the repository the graph was built from")
+	ownersAssignCmd.Flags().BoolVar(&ownersFlags.blame, "blame", false, "fall back to the main git blame author")
+	ownersAssignCmd.Flags().StringVar(&ownersFlags.codeowners, "codeowners", "", "CODEOWNERS file to use instead of the repository's")
+	ownersListCmd.Flags().StringVarP(&ownersFlags.format, "format", "f", "text", "output format: text or json")
+	ownersCmd.AddCommand(ownersAssignCmd, ownersListCmd)
+	rootCmd.AddCommand(ownersCmd)
+}
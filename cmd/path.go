@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/spf13/cobra"
+)
+
+var pathFlags struct {
+	from     string
+	to       string
+	all      bool
+	maxDepth int
+	limit    int
+	format   string
+	strict   bool
+}
+
+var pathCmd = &cobra.Command{
+	Use:   "path --from <function> --to <function>",
+	Short: "Print call chains between two functions",
+	Long: `path prints the shortest call chain from --from to --to, or with --all
+every chain that doesn't revisit a function (up to --limit of them, each at
+most --max-depth calls long, 10 unless set). There can be exponentially
+many chains, so --all also gives up after a fixed amount of searching and
+says so.`,
+	Example: `  geeparse path --from main --to SaveGraph
+  geeparse path --from main --to SaveGraph --all --max-depth 6`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if pathFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+		for _, fn := range []string{pathFlags.from, pathFlags.to} {
+			if _, ok := graph[fn]; !ok {
+				return fmt.Errorf("unknown function %q", fn)
+			}
+		}
+
+		var paths [][]string
+		truncated := false
+		if pathFlags.all {
+			paths, truncated = analysis.AllPaths(graph, pathFlags.from, pathFlags.to, pathFlags.maxDepth, pathFlags.limit)
+		} else if p := analysis.ShortestPath(graph, pathFlags.from, pathFlags.to, pathFlags.maxDepth); p != nil {
+			paths = [][]string{p}
+		}
+		if paths == nil {
+			paths = [][]string{}
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(pathFlags.format) {
+		case "text":
+			if len(paths) == 0 {
+				fmt.Fprintf(out, "no call chain from %s to %s\n", pathFlags.from, pathFlags.to)
+			}
+			for _, p := range paths {
+				fmt.Fprintln(out, strings.Join(p, " → "))
+			}
+			if truncated && pathFlags.limit > 0 && len(paths) >= pathFlags.limit {
+				fmt.Fprintf(out, "(stopped after %d paths; raise --limit to see more)\n", pathFlags.limit)
+			} else if truncated {
+				fmt.Fprintln(out, "(stopped searching, there are too many chains; lower --max-depth to see them all)")
+			}
+			return nil
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(struct {
+				From      string     `json:"from"`
+				To        string     `json:"to"`
+				Paths     [][]string `json:"paths"`
+				Truncated bool       `json:"truncated"`
+			}{pathFlags.from, pathFlags.to, paths, truncated})
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", pathFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := pathCmd.Flags()
+	f.StringVar(&pathFlags.from, "from", "", "function the chains start at")
+	f.StringVar(&pathFlags.to, "to", "", "function the chains end at")
+	f.BoolVar(&pathFlags.all, "all", false, "print every chain instead of only the shortest")
+	f.IntVar(&pathFlags.maxDepth, "max-depth", 0, "max number of calls per chain (0 = unlimited, or 10 with --all)")
+	f.IntVar(&pathFlags.limit, "limit", 100, "with --all, stop after this many chains (0 = unlimited)")
+	f.StringVarP(&pathFlags.format, "format", "f", "text", "output format: text or json")
+	pathCmd.MarkFlagRequired("from")
+	pathCmd.MarkFlagRequired("to")
+	pathCmd.RegisterFlagCompletionFunc("from", completeFunctionFlag)
+	pathCmd.RegisterFlagCompletionFunc("to", completeFunctionFlag)
+	f.BoolVar(&pathFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	rootCmd.AddCommand(pathCmd)
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/perf"
+	"github.com/spf13/cobra"
+)
+
+var profileFlags struct {
+	file       string
+	sampleType string
+	top        int
+	format     string
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Overlay a pprof CPU or heap profile on the stored graph",
+	Long: `profile maps the samples of a pprof profile onto the stored functions and
+calls and saves the result, replacing any earlier import. The UI can then
+draw hot calls thicker, and export --hot does the same for DOT, Mermaid,
+GraphML, GEXF and NDJSON. It prints the costliest functions and calls;
+without --file it reports on the profile imported last.`,
+	Example: `  go test -cpuprofile cpu.pprof ./pkg/server && geeparse profile --file cpu.pprof
+  geeparse profile --file heap.pprof --sample alloc_space`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		var prof *perf.Profile
+		if profileFlags.file != "" {
+			graph, err := store.LoadGraph()
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(profileFlags.file)
+			if err != nil {
+				return err
+			}
+			prof, err = perf.Load(f, profileFlags.sampleType, graph)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", profileFlags.file, err)
+			}
+			if err := store.SaveProfile(prof); err != nil {
+				return err
+			}
+			recordAudit(store, "profile", profileFlags.file)
+		} else if prof, err = store.Profile(); err != nil {
+			return fmt.Errorf("no profile in %s (%w); import one with --file", dbPath, err)
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(profileFlags.format) {
+		case "text":
+			return writeProfile(out, prof, profileFlags.top)
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(prof)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", profileFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := profileCmd.Flags()
+	f.StringVarP(&profileFlags.file, "file", "p", "", "pprof profile to import (gzipped or not)")
+	f.StringVar(&profileFlags.sampleType, "sample", "", "sample type to use, e.g. cpu, alloc_space (default: the profile's default)")
+	f.IntVar(&profileFlags.top, "top", 10, "number of functions and calls to list")
+	f.StringVarP(&profileFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(profileCmd)
+}
+
+func writeProfile(w io.Writer, p *perf.Profile, top int) error {
+	pct := func(v int64) string {
+		if p.Total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(v)/float64(p.Total))
+	}
+	fmt.Fprintf(w, "%s samples in %s, total %d\n\n", p.SampleType, p.Unit, p.Total)
+
+	names := make([]string, 0, len(p.Nodes))
+	for name := range p.Nodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := p.Nodes[names[i]], p.Nodes[names[j]]
+		if a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		return names[i] < names[j]
+	})
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CUM\tFLAT\tFUNCTION")
+	for i, name := range names {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", pct(p.Nodes[name].Cum), pct(p.Nodes[name].Flat), name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CALL\t\tSHARE")
+	for i, e := range p.Edges {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s → %s\t\t%s\n", e.Caller, e.Callee, pct(e.Value))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/query"
+	"github.com/spf13/cobra"
+)
+
+var queryFlags struct {
+	format string
+	depth  int
+}
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Answer call-graph questions from the store",
+	Long: `query looks up callers, callees or everything reachable from a function in
+the stored graph, or every function a query-language expression selects,
+and prints the answer as text, JSON or Graphviz DOT.`,
+}
+
+var queryCallersCmd = &cobra.Command{
+	Use:               "callers <function>",
+	Short:             "List the functions that call <function>",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFunction,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runQuery(cmd, "callers", args[0], func(store *persistence.Store, fn string) (map[string]callgraph.FunctionNode, []string, error) {
+			callers, err := store.Callers(fn)
+			graph := map[string]callgraph.FunctionNode{fn: {Callees: []string{}}}
+			for _, c := range callers {
+				graph[c] = callgraph.FunctionNode{Callees: []string{fn}}
+			}
+			return graph, callers, err
+		})
+	},
+}
+
+var queryCalleesCmd = &cobra.Command{
+	Use:               "callees <function>",
+	Short:             "List the functions <function> calls",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFunction,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runQuery(cmd, "callees", args[0], func(store *persistence.Store, fn string) (map[string]callgraph.FunctionNode, []string, error) {
+			callees, err := store.Callees(fn)
+			graph := map[string]callgraph.FunctionNode{fn: {Callees: callees}}
+			for _, c := range callees {
+				graph[c] = callgraph.FunctionNode{Callees: []string{}}
+			}
+			return graph, callees, err
+		})
+	},
+}
+
+var queryReachableCmd = &cobra.Command{
+	Use:               "reachable <function>",
+	Short:             "List every function reachable from <function>",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFunction,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runQuery(cmd, "reachable", args[0], func(store *persistence.Store, fn string) (map[string]callgraph.FunctionNode, []string, error) {
+			sub, err := store.Subgraph(fn, queryFlags.depth)
+			if err != nil {
+				return nil, nil, err
+			}
+			names, err := store.Reachable(fn, queryFlags.depth)
+			return sub, names, err
+		})
+	},
+}
+
+var querySelectCmd = &cobra.Command{
+	Use:   "select <expression>",
+	Short: "List the functions a query-language expression selects",
+	Long: `select evaluates an expression of the query language against the stored
+graph. A bare name is that function, and names with * or ? are patterns.
+Sets combine with & (and), | (or), - (minus) and ! (not), grouped with
+parentheses, and these functions:
+
+  all()  name("Save*")  pkg("persistence")  file("_gen.go")  tag("hot-path")
+  callers(set, depth)  callees(set, depth)   (depth 1 by default, 0 = unlimited)
+  callees(set, depth, "go,defer")             (only calls of those kinds)
+  passes(set, "context.Context", nil)         (callers passing such an
+                                               argument; build --arg-types)
+  tests()  roots()  leaves()  cycles()  dead()
+
+With --format dot it draws the selected functions and the calls between them.`,
+	Example: `  geeparse query select 'callers(SaveGraph) & pkg("persistence") - tests()'
+  geeparse query select 'callees(main, 0) & cycles()'
+  geeparse query select 'tag("hot-path") - tests()'
+  geeparse query select 'callees(main, 0, "go")'
+  geeparse query select 'passes(all(), "context.Context", nil)'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q, err := query.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		tags, err := store.FunctionTags()
+		if err != nil {
+			return err
+		}
+		names, err := q.EvalTagged(graph, tags)
+		if err != nil {
+			return err
+		}
+		selected := make(map[string]bool, len(names))
+		for _, name := range names {
+			selected[name] = true
+		}
+		sub := callgraph.FilterFunctions(graph, func(name string) bool { return selected[name] })
+		return printNames(cmd.OutOrStdout(), queryFlags.format, queryResult{Query: "select", Expression: q.String(), Results: names}, sub)
+	},
+}
+
+func init() {
+	queryCmd.PersistentFlags().StringVarP(&queryFlags.format, "format", "f", "text", "output format: text, json or dot")
+	queryCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"text", "json", "dot"}, cobra.ShellCompDirectiveNoFileComp))
+	queryReachableCmd.Flags().IntVar(&queryFlags.depth, "depth", 0, "max number of calls to follow (0 = unlimited)")
+	queryCmd.AddCommand(queryCallersCmd, queryCalleesCmd, queryReachableCmd, querySelectCmd)
+	rootCmd.AddCommand(queryCmd)
+}
+
+// queryResult is the JSON shape printed by query --format json.
+type queryResult struct {
+	Query      string   `json:"query"`
+	Function   string   `json:"function,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+	Results    []string `json:"results"`
+}
+
+// runQuery opens the store, checks fn exists, runs lookup and prints its
+// answer in the selected format. lookup returns both the matching names and
+// the small graph they form, which is what the dot format draws.
+func runQuery(cmd *cobra.Command, query, fn string,
+	lookup func(*persistence.Store, string) (map[string]callgraph.FunctionNode, []string, error),
+) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if _, err := store.Function(fn); err != nil {
+		return fmt.Errorf("function %s: %w", fn, err)
+	}
+	graph, names, err := lookup(store, fn)
+	if err != nil {
+		return err
+	}
+	return printNames(cmd.OutOrStdout(), queryFlags.format, queryResult{Query: query, Function: fn, Results: names}, graph)
+}
+
+func printNames(w io.Writer, format string, res queryResult, graph map[string]callgraph.FunctionNode) error {
+	switch strings.ToLower(format) {
+	case "text":
+		for _, name := range res.Results {
+			if _, err := fmt.Fprintln(w, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(res)
+	case "dot":
+		return export.DOT(w, graph)
+	default:
+		return fmt.Errorf("unknown format %q (want text, json or dot)", format)
+	}
+}
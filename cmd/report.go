@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+var reportFlags struct {
+	format   string
+	output   string
+	title    string
+	top      int
+	roots    []string
+	template string
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Render an architectural report of the stored graph as HTML or Markdown",
+	Long: `report summarizes the stored graph for people who don't use geeparse: size,
+the most called and most calling functions, a package diagram and coupling
+matrix, cycles, dead code, and warnings for the thresholds configured in
+geeparse.yaml. HTML reports are a single standalone file;
+Markdown reports render on GitHub, diagrams included.
+
+--template replaces the built-in layout with a Go template of your own; it
+sees the fields of report.Report (.Stats, .Warnings, .Cycles, .DeadCode,
+.Coupling, .PackageDiagram, ...) and the helpers join, inc, shade and cell.`,
+	Example: `  geeparse report -o architecture.html
+  geeparse report --format markdown --title "Payments service" > ARCHITECTURE.md`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := reportFlags.format
+		if !cmd.Flags().Changed("format") && reportFlags.output != "" {
+			switch strings.ToLower(filepath.Ext(reportFlags.output)) {
+			case ".md", ".markdown":
+				format = "markdown"
+			}
+		}
+		var tmpl string
+		if reportFlags.template != "" {
+			data, err := os.ReadFile(reportFlags.template)
+			if err != nil {
+				return err
+			}
+			tmpl = string(data)
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		r := report.Build(graph, report.Options{
+			Title: reportFlags.title, Top: reportFlags.top, Roots: reportFlags.roots, Thresholds: cfg.Thresholds,
+		})
+
+		out := cmd.OutOrStdout()
+		if reportFlags.output != "" {
+			f, err := os.Create(reportFlags.output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if tmpl != "" {
+			err = report.WriteTemplate(out, format, tmpl, r)
+		} else {
+			err = report.Write(out, format, r)
+		}
+		if err != nil {
+			return err
+		}
+		if reportFlags.output != "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "wrote %s\n", reportFlags.output)
+		}
+		return nil
+	},
+}
+
+func init() {
+	f := reportCmd.Flags()
+	f.StringVarP(&reportFlags.format, "format", "f", "html", "report format: "+strings.Join(report.Formats, " or ")+" (default: from --output's extension, else html)")
+	f.StringVarP(&reportFlags.output, "output", "o", "", "file to write (default: stdout)")
+	f.StringVar(&reportFlags.title, "title", "", "report heading")
+	f.IntVar(&reportFlags.top, "top", 10, "how many hubs and cycles to list")
+	f.StringSliceVar(&reportFlags.roots, "roots", nil, "entrypoints dead code is measured from (default main,init,TestMain)")
+	f.StringVar(&reportFlags.template, "template", "", "Go template to render instead of the built-in layout")
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,189 @@
+// Package cmd implements the geeparse command-line interface.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/config"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dbPath is the SQLite store every subcommand reads from or writes to.
+var dbPath string
+
+// configPath is the geeparse.yaml to load; empty means ./geeparse.yaml
+// if it exists.
+var configPath string
+
+// cfg is the loaded config; applyConfig sets it before any command runs.
+var cfg = &config.Config{}
+
+// logLevel and logFormat select what goes to stderr and how.
+var logLevel, logFormat string
+
+// level is the logger's minimum level, which serve changes when its
+// configuration is reloaded.
+var level slog.LevelVar
+
+// otlpEndpoint is where to send traces; empty leaves tracing to the
+// standard OTEL_EXPORTER_OTLP_* variables.
+var otlpEndpoint string
+
+// commandSpan traces the running command, and stopTracing flushes spans
+// before exit. applyConfig sets both.
+var (
+	commandSpan trace.Span
+	stopTracing func(context.Context) error
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "geeparse",
+	Short: "Build, store and explore call graphs of Go code",
+	Long: `geeparse analyzes a Go source tree with gopls, stores the internal
+call graph in SQLite, and serves it as JSON and an interactive UI.
+
+With --output json every command that reports results prints them as JSON
+instead, in the same shape as its --format json, for scripts and wrappers;
+commands that only serve or write files reject it. report keeps its own
+--output, the file to write.`,
+	SilenceUsage:      true,
+	PersistentPreRunE: applyConfig,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "graph.db", "path to the SQLite graph store")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", os.Getenv("GEEPARSE_CONFIG"), "config file (default: ./geeparse.yaml if present)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "minimum level of log messages: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log output format: text or json")
+	rootCmd.PersistentFlags().StringVar(&outputMode, "output", "text", "print results as text or json")
+	rootCmd.PersistentFlags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "send OpenTelemetry traces over OTLP/HTTP to this host:port or URL")
+}
+
+// applyConfig fills in every flag of cmd the user didn't pass from the
+// config file and GEEPARSE_* environment variables. Precedence is flags,
+// then environment, then file, then built-in defaults.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if err := loadConfig(cmd); err != nil {
+		return err
+	}
+	if err := applyOutput(cmd); err != nil {
+		return err
+	}
+	for i := range cfg.Plugins {
+		if err := export.Register(&cfg.Plugins[i]); err != nil {
+			return fmt.Errorf("plugin: %w", err)
+		}
+	}
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	return startTracing(cmd)
+}
+
+// loadConfig loads cfg and sets the flags of cmd the user didn't pass
+// from it. Shell completion, which skips applyConfig, uses it to find the
+// configured store.
+func loadConfig(cmd *cobra.Command) error {
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	cfg = loaded
+	for name, value := range cfg.Flags() {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("config setting for --%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setupLogging installs the default logger every package logs through,
+// writing to stderr at --log-level in --log-format.
+func setupLogging() error {
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("--log-level: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: &level}
+	var h slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown --log-format %q (want text or json)", logFormat)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// startTracing sets up the trace exporter and starts a span covering the
+// whole command, which later spans nest under through cmd.Context().
+func startTracing(cmd *cobra.Command) error {
+	shutdown, err := telemetry.Setup(cmd.Context(), otlpEndpoint, buildinfo.Version())
+	if err != nil {
+		return err
+	}
+	stopTracing = shutdown
+	ctx, span := telemetry.Start(cmd.Context(), cmd.CommandPath())
+	commandSpan = span
+	cmd.SetContext(ctx)
+	return nil
+}
+
+// Execute runs the CLI.
+func Execute() error {
+	err := rootCmd.Execute()
+	if commandSpan != nil {
+		telemetry.End(commandSpan, err)
+	}
+	if stopTracing != nil {
+		if err := stopTracing(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "flush traces: %v\n", err)
+		}
+	}
+	return err
+}
+
+// openStore opens the store selected by --db. Its whole-graph operations
+// are traced under the running command.
+func openStore() (*persistence.Store, error) {
+	store, err := persistence.NewStore(dbPath, slog.Default())
+	if err != nil {
+		return nil, err
+	}
+	if commandSpan != nil {
+		store.SetContext(trace.ContextWithSpan(context.Background(), commandSpan))
+	}
+	return store, nil
+}
+
+// displayPath shortens absolute source paths to be relative to the working
+// directory when they're inside it.
+func displayPath(path string) string {
+	if path == "" {
+		return "?"
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+	"github.com/ishanmadhav/geeparse/pkg/sarif"
+	"github.com/spf13/cobra"
+)
+
+var sarifFlags struct {
+	roots []string
+	out   string
+}
+
+var sarifCmd = &cobra.Command{
+	Use:   "sarif",
+	Short: "Write dead-code, cycle and policy findings as SARIF",
+	Long: `sarif reports every finding geeparse knows about for the stored graph —
+functions unreachable from --roots, call cycles, breaches of the rules in
+geeparse.yaml and crossed thresholds — as one SARIF 2.1.0 log for code-scanning upload. Paths
+are written relative to the working directory, so run it from the
+repository root.`,
+	Example:     `  geeparse sarif -o geeparse.sarif`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{printsJSON: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+
+		report := sarif.NewReport(".")
+		report.AddDeadCode(analysis.DeadCode(graph, sarifFlags.roots))
+		report.AddCycles(graph, analysis.Cycles(graph))
+		report.AddViolations(policy.Check(graph, cfg.Rules))
+		report.AddWarnings(policy.Warn(graph, cfg.Thresholds))
+		return writeSARIF(cmd.OutOrStdout(), sarifFlags.out, report)
+	},
+}
+
+func init() {
+	f := sarifCmd.Flags()
+	f.StringSliceVar(&sarifFlags.roots, "roots", analysis.DefaultRoots, "entrypoint function names or patterns for dead-code findings")
+	f.StringVarP(&sarifFlags.out, "out", "o", "", "write to this file instead of stdout")
+	rootCmd.AddCommand(sarifCmd)
+}
+
+// writeSARIF writes report to the file at path, or to stdout if path is
+// empty.
+func writeSARIF(stdout io.Writer, path string, report *sarif.Report) error {
+	if path == "" {
+		return report.Write(stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/config"
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+	"github.com/ishanmadhav/geeparse/pkg/ingest"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/server"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// serverFlags are shared by every command that starts the HTTP server.
+var serverFlags struct {
+	addr       string
+	basePath   string
+	maxNodes   int
+	maxEdges   int
+	adminToken string
+	idLength   int
+	cacheSize  int
+	cacheTTL   time.Duration
+	ephemeral  bool
+	proxies    []net.IPNet
+}
+
+var serveFlags struct {
+	build        bool
+	githubSecret string
+	githubBranch string
+	interval     time.Duration
+	from         string
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [dir]",
+	Short: "Serve the stored call graph as JSON and a browser UI",
+	Long: `serve loads the current graph from the store and serves the UI and API.
+With --build it first (re)analyzes --root, like running build beforehand;
+a dir argument is analyzed the same way, in place of --root.
+
+--ephemeral keeps the store in a temporary directory instead of --db,
+removed when serve exits, and builds first: for a quick look at a tree
+without leaving a graph.db behind.
+
+With --github-secret it also accepts GitHub push webhooks at /hooks/github
+(content type application/json, signed with the same secret). Each push to
+--github-branch fast-forwards the git checkout at --root, rebuilds it,
+records a snapshot and starts serving the new graph.
+
+With --rebuild-interval it rebuilds --root on a timer instead of (or as well
+as) on pushes, for hosted instances without webhooks. Whatever keeps the
+checkout at --root current, say a cron job running git pull, is up to you;
+a rebuild that finds nothing changed stores nothing. Changed graphs are
+saved, snapshotted and swapped in like a webhook rebuild's.
+
+Builds, diffs between snapshots and exports can also run in the background
+as jobs: POST {"kind": "build"|"diff"|"export", "params": {...}} to
+/api/jobs, then poll /api/jobs/{id} and fetch /api/jobs/{id}/result. Build
+jobs rebuild --root like --rebuild-interval does and need --admin-token.
+
+On SIGHUP, or a POST to /api/admin/config with the admin token, serve
+re-reads the config file and environment and switches to their admin
+token, GitHub secret and branch, rebuild interval, graph budgets, rules,
+thresholds and log level without dropping connections. Settings given as
+flags keep their values; the rest need a restart. A config that fails to
+load leaves the running one in place. serve has no rate limits to reload:
+put a reverse proxy in front of it to limit requests.
+
+With --from it serves a graph file instead of the store: a JSON export
+(export --format json) or a graph ingest reads, such as build --stdout's
+NDJSON. No --db is needed; the graph is loaded into a temporary store,
+removed on exit, and served read-only, so annotations, tags, views and
+admin actions are refused.`,
+	Example: `  geeparse serve --build --addr :8080
+  geeparse serve --ephemeral ../somerepo
+  geeparse serve --from graph.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			if err := cmd.Flags().Set("root", args[0]); err != nil {
+				return err
+			}
+		}
+		build := serveFlags.build || len(args) == 1 || serverFlags.ephemeral
+		// stop on SIGINT and SIGTERM, during the first build too, through
+		// the deferred closes, which remove a temporary store
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var store *persistence.Store
+		if serveFlags.from != "" {
+			if build || serveFlags.githubSecret != "" || serveFlags.interval != 0 {
+				return fmt.Errorf("--from serves a file as it is; it can't be used with a dir, --build, --ephemeral, --github-secret or --rebuild-interval")
+			}
+			graph, err := readGraphFile(serveFlags.from)
+			if err != nil {
+				return err
+			}
+			var cleanup func()
+			if store, cleanup, err = openTempStore(); err != nil {
+				return err
+			}
+			defer cleanup()
+			if err := store.SaveGraph(graph); err != nil {
+				return err
+			}
+			if _, err := store.SaveSnapshot(filepath.Base(serveFlags.from), graph, persistence.Source{}); err != nil {
+				return err
+			}
+		} else {
+			var (
+				closeStore func()
+				err        error
+			)
+			if store, closeStore, err = openServingStore(); err != nil {
+				return err
+			}
+			defer closeStore()
+		}
+
+		if build {
+			var (
+				built map[string]callgraph.FunctionNode
+				snap  persistence.Snapshot
+			)
+			err := interruptible(ctx, func() (err error) {
+				built, snap, err = buildAndSave(ctx, store, singleRoot(analysisFlags.root), "", persistence.Source{})
+				return err
+			})
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			recordAudit(store, "build", fmt.Sprintf("snapshot #%d %q: %d functions, %d calls",
+				snap.ID, snap.Label, len(built), callgraph.EdgeCount(built)))
+		}
+
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		opts := serveOptions()
+		if serveFlags.from != "" {
+			opts.ReadOnly = true
+		} else {
+			// the secret may only come with a reload, so pushes can always
+			// rebuild
+			opts.Rebuild = func(ctx context.Context, p server.Push) (map[string]callgraph.FunctionNode, error) {
+				return pullAndBuild(ctx, store, analysisFlags.root, p)
+			}
+			opts.Refresh = func(ctx context.Context) (map[string]callgraph.FunctionNode, error) {
+				return rebuildIfChanged(ctx, store, analysisFlags.root)
+			}
+		}
+		opts.Reconfigure = func() (server.Options, error) { return reloadServeConfig(cmd) }
+		if embeddingsFlags.provider != "" {
+			if opts.Embedder, err = embedder(); err != nil {
+				return err
+			}
+		}
+		srv := server.New(graph, store, opts)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				changed, err := srv.ReloadConfig()
+				if err != nil {
+					slog.Error("reload configuration on SIGHUP", "err", err)
+					continue
+				}
+				err = store.RecordAudit(persistence.AuditEntry{Actor: cliActor(), Source: persistence.AuditSignal,
+					Action: "config.reload", Summary: "SIGHUP, changed: " + strings.Join(changed, ", ")})
+				if err != nil {
+					slog.Warn("audit", "action", "config.reload", "err", err)
+				}
+			}
+		}()
+		served := make(chan error, 1)
+		go func() { served <- srv.ListenAndServe(serverFlags.addr) }()
+		select {
+		case err := <-served:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	},
+}
+
+func init() {
+	addServerFlags(serveCmd.Flags())
+	serveCmd.Flags().BoolVar(&serveFlags.build, "build", false, "analyze --root before serving")
+	addAnalysisFlags(serveCmd.Flags())
+	addNotifyFlags(serveCmd.Flags())
+	addEmbeddingsFlags(serveCmd.Flags())
+	serveCmd.Flags().StringVar(&serveFlags.githubSecret, "github-secret", "", "enable /hooks/github, rebuilding on pushes signed with this webhook secret")
+	serveCmd.Flags().StringVar(&serveFlags.githubBranch, "github-branch", "main", "branch whose pushes trigger a rebuild with --github-secret")
+	serveCmd.Flags().DurationVar(&serveFlags.interval, "rebuild-interval", 0, "rebuild --root this often while serving, e.g. 15m (0 = never)")
+	serveCmd.Flags().StringVar(&serveFlags.from, "from", "", "serve this exported graph file read-only instead of the store")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// readGraphFile reads a graph written by export --format json, or one
+// ingest reads: build --stdout's NDJSON or a graph document.
+func readGraphFile(path string) (map[string]callgraph.FunctionNode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var graph map[string]callgraph.FunctionNode
+	if err := json.Unmarshal(data, &graph); err == nil {
+		// the file may come from anyone; hold it to what ingest accepts
+		if err := ingest.CheckGraph(graph); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return graph, nil
+	}
+	res, err := ingest.Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a JSON export nor a graph ingest reads: %w", path, err)
+	}
+	return res.Graph, nil
+}
+
+// serveOptions are serve's server options: the shared ones plus its
+// webhook and schedule settings.
+func serveOptions() server.Options {
+	opts := serverOptions()
+	opts.GitHubSecret = serveFlags.githubSecret
+	opts.GitHubBranch = serveFlags.githubBranch
+	opts.RebuildInterval = serveFlags.interval
+	return opts
+}
+
+// reloadableFlags are the serve flags a configuration reload re-reads;
+// server.Reconfigure applies the options they make.
+var reloadableFlags = []string{
+	"admin-token", "max-nodes", "max-edges", "github-secret", "github-branch", "rebuild-interval", "log-level",
+}
+
+// reloadMu keeps a SIGHUP and a POST /api/admin/config from reloading at
+// once.
+var reloadMu sync.Mutex
+
+// reloadServeConfig re-reads the config file and environment into those
+// of cmd's reloadableFlags not given on the command line, settings no
+// longer configured going back to their defaults, applies the log level
+// and returns serve's options. A bad setting leaves every flag as it was.
+func reloadServeConfig(cmd *cobra.Command) (server.Options, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		return server.Options{}, fmt.Errorf("load config: %w", err)
+	}
+	values := loaded.Flags()
+	old := make(map[*pflag.Flag]string)
+	restore := func() {
+		for f, v := range old {
+			f.Value.Set(v)
+		}
+	}
+	for _, name := range reloadableFlags {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		v, ok := values[name]
+		if !ok {
+			v = f.DefValue
+		}
+		old[f] = f.Value.String()
+		if err := f.Value.Set(v); err != nil {
+			restore()
+			return server.Options{}, fmt.Errorf("config setting for --%s: %w", name, err)
+		}
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(logLevel)); err != nil {
+		restore()
+		return server.Options{}, fmt.Errorf("--log-level: %w", err)
+	}
+	if lvl != level.Level() {
+		slog.Info("log level changed", "from", level.Level(), "to", lvl)
+		level.Set(lvl)
+	}
+	opts := serveOptions()
+	opts.Rules, opts.Thresholds = loaded.Rules, loaded.Thresholds
+	return opts, nil
+}
+
+// pullAndBuild brings the checkout at root up to date with a pushed
+// branch, then rebuilds and snapshots it.
+func pullAndBuild(ctx context.Context, store *persistence.Store, root string, p server.Push) (map[string]callgraph.FunctionNode, error) {
+	commit, err := vcs.Pull(root, p.Branch)
+	if err != nil {
+		return nil, fmt.Errorf("pull %s: %w", p.Branch, err)
+	}
+	src := persistence.Source{Repo: p.Repo, Ref: p.Branch, Commit: commit}
+	graph, _, err := buildAndSave(ctx, store, singleRoot(root), p.Branch+"@"+shortCommit(commit), src)
+	return graph, err
+}
+
+// rebuildIfChanged rebuilds root and, if the graph differs from the
+// store's current one, saves and snapshots it. It returns nil when
+// nothing changed.
+func rebuildIfChanged(ctx context.Context, store *persistence.Store, root string) (map[string]callgraph.FunctionNode, error) {
+	hook, err := webhook()
+	if err != nil {
+		return nil, err
+	}
+	graph, report, err := buildRoots(ctx, singleRoot(root))
+	if err != nil {
+		return nil, err
+	}
+	old, err := store.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	if diff.Compare(old, graph).Empty() {
+		return nil, nil
+	}
+	graph, _, err = saveBuild(ctx, store, hook, graph, report, "", persistence.Source{})
+	return graph, err
+}
+
+// addServerFlags registers the HTTP server flags on f.
+func addServerFlags(f *pflag.FlagSet) {
+	f.StringVarP(&serverFlags.addr, "addr", "a", ":8080", `listen address, or "unix:/path/to.sock" for a unix socket`)
+	f.StringVar(&serverFlags.basePath, "base-path", "/", "URL prefix to serve under, e.g. /geeparse/")
+	f.IntVar(&serverFlags.maxNodes, "max-nodes", server.DefaultMaxNodes, "max functions per graph response (0 = unlimited)")
+	f.IntVar(&serverFlags.maxEdges, "max-edges", server.DefaultMaxEdges, "max calls per graph response (0 = unlimited)")
+	f.StringVar(&serverFlags.adminToken, "admin-token", "", "bearer token enabling /api/admin/ endpoints")
+	f.IntVar(&serverFlags.idLength, "id-length", callgraph.DefaultIDLength, "hex digits in stable function IDs and /f/ permalinks (at most 64)")
+	f.IntVar(&serverFlags.cacheSize, "cache-size", server.DefaultCacheSize, "max bytes of cached graph, query and export responses (0 = no cache)")
+	f.DurationVar(&serverFlags.cacheTTL, "cache-ttl", server.DefaultCacheTTL, "how long cached responses live")
+	f.IPNetSliceVar(&serverFlags.proxies, "trusted-proxy", nil, "network of an authenticating proxy, as a CIDR (10.0.0.5/32), whose X-Forwarded-User the audit log trusts (repeatable)")
+	f.BoolVar(&serverFlags.ephemeral, "ephemeral", false, "keep the store in a temporary directory removed on exit, instead of --db")
+}
+
+// serverOptions collects the server flags.
+func serverOptions() server.Options {
+	return server.Options{
+		MaxNodes:       serverFlags.maxNodes,
+		MaxEdges:       serverFlags.maxEdges,
+		BasePath:       serverFlags.basePath,
+		AdminToken:     serverFlags.adminToken,
+		TrustedProxies: serverFlags.proxies,
+		IDLength:       serverFlags.idLength,
+		CacheSize:      serverFlags.cacheSize,
+		CacheTTL:       serverFlags.cacheTTL,
+		Rules:          cfg.Rules,
+		Thresholds:     cfg.Thresholds,
+		Logger:         slog.Default(),
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var statsFlags struct {
+	format string
+	top    int
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize the stored graph's size, hubs, depth, cycles and packages",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+
+		st := analysis.ComputeStats(graph, statsFlags.top)
+		switch strings.ToLower(statsFlags.format) {
+		case "text":
+			return writeStats(cmd.OutOrStdout(), st)
+		case "json":
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(st)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", statsFlags.format)
+		}
+	},
+}
+
+func init() {
+	statsCmd.Flags().StringVarP(&statsFlags.format, "format", "f", "text", "output format: text or json")
+	statsCmd.Flags().IntVar(&statsFlags.top, "top", 5, "how many functions to list by fan-in and fan-out")
+	rootCmd.AddCommand(statsCmd)
+}
+
+func writeStats(w io.Writer, st analysis.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Functions:\t%d\n", st.Functions)
+	fmt.Fprintf(tw, "Calls:\t%d\n", st.Calls)
+	fmt.Fprintf(tw, "Packages:\t%d\n", st.Packages)
+	if len(st.Languages) > 0 {
+		langs := make([]string, 0, len(st.Languages))
+		for lang, n := range st.Languages {
+			langs = append(langs, fmt.Sprintf("%s %d", cmp.Or(lang, "unknown"), n))
+		}
+		sort.Strings(langs)
+		fmt.Fprintf(tw, "Languages:\t%s\n", strings.Join(langs, ", "))
+	}
+	fmt.Fprintf(tw, "Cycles:\t%d (largest: %d functions)\n", st.Cycles, st.LargestCycle)
+	fmt.Fprintf(tw, "Deepest chain:\t%d (%s)\n", len(st.DeepestChain), strings.Join(st.DeepestChain, " → "))
+
+	fmt.Fprintf(tw, "\nTop fan-in\tcallers\n")
+	for _, d := range st.TopFanIn {
+		fmt.Fprintf(tw, "  %s\t%d\n", d.Name, d.Count)
+	}
+	fmt.Fprintf(tw, "\nTop fan-out\tcallees\n")
+	for _, d := range st.TopFanOut {
+		fmt.Fprintf(tw, "  %s\t%d\n", d.Name, d.Count)
+	}
+
+	fmt.Fprintf(tw, "\nPackage\tfunctions\tinternal\toutgoing\tincoming\n")
+	for _, p := range st.PackageStats {
+		if p.Package == "" {
+			p.Package = "(unknown)" // graphs stored before packages were recorded
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%d\n", p.Package, p.Functions, p.InternalCalls, p.OutgoingCalls, p.IncomingCalls)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openTempStore opens a store in a new temporary directory, for commands
+// that need one only while they run. The returned cleanup closes it and
+// removes the directory.
+func openTempStore() (*persistence.Store, func(), error) {
+	dir, err := os.MkdirTemp("", "geeparse-")
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := persistence.NewStore(filepath.Join(dir, "graph.db"), slog.Default())
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	if commandSpan != nil {
+		store.SetContext(trace.ContextWithSpan(context.Background(), commandSpan))
+	}
+	return store, func() {
+		store.Close()
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("remove temporary store", "dir", dir, "err", err)
+		}
+	}, nil
+}
+
+// interruptible runs f but returns, with ctx's error, as soon as ctx is
+// done, leaving f to end with the process. Builds don't stop when their
+// context is cancelled, and a signal during one must still get to the
+// deferred closes that remove a temporary store.
+func interruptible(ctx context.Context, f func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- f() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// openServingStore opens the store of a command that serves the graph:
+// --db, or with --ephemeral a temporary one. The returned func closes
+// it, removing a temporary one.
+func openServingStore() (*persistence.Store, func(), error) {
+	if serverFlags.ephemeral {
+		return openTempStore()
+	}
+	store, err := openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, func() { store.Close() }, nil
+}
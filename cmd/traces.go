@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ishanmadhav/geeparse/pkg/traces"
+	"github.com/spf13/cobra"
+)
+
+var tracesFlags struct {
+	file   string
+	rules  []string
+	top    int
+	format string
+}
+
+var tracesCmd = &cobra.Command{
+	Use:   "traces",
+	Short: "Overlay OpenTelemetry or Jaeger traces on the stored graph",
+	Long: `traces maps the spans of an OTLP/JSON trace export, or of Jaeger's JSON, onto
+the stored functions and saves the calls they observed, replacing any earlier
+import. A span's caller is its nearest ancestor mapped to another function.
+
+Spans are mapped by the rules given with --map, then those under traces.rules
+in geeparse.yaml, then by their code.function attributes and their name.
+A rule is a regular expression matched against the span name, and the
+function it maps to, which may use the expression's groups:
+
+  --map '^GET /api/(\w+)$=handle$1'
+
+Each observed call is reported as a call the static graph has too, one it
+makes through other functions, or one it has no way to make: where the
+running system departs from the code's design, or the graph misses dynamic
+calls. The UI can then highlight the traced paths. Without --file it
+reports on the traces imported last.`,
+	Example: `  geeparse traces --file otel-traces.json
+  geeparse traces --file jaeger.json --map '^HTTP (GET|POST) (.*)$=serve' -f json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		var overlay *traces.Overlay
+		if tracesFlags.file != "" {
+			var rules []traces.Rule
+			for _, s := range tracesFlags.rules {
+				r, err := traces.ParseRule(s)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, r)
+			}
+			rules = append(rules, cfg.Traces.Rules...)
+
+			graph, err := store.LoadGraph()
+			if err != nil {
+				return err
+			}
+			mapper, err := traces.NewMapper(graph, rules)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(tracesFlags.file)
+			if err != nil {
+				return err
+			}
+			spans, err := traces.Parse(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", tracesFlags.file, err)
+			}
+			overlay = traces.Build(spans, graph, mapper)
+			if err := store.SaveTraces(overlay); err != nil {
+				return err
+			}
+			recordAudit(store, "traces", fmt.Sprintf("%s: %d spans, %d calls", tracesFlags.file, overlay.Spans, len(overlay.Calls)))
+		} else if overlay, err = store.Traces(); err != nil {
+			return fmt.Errorf("no traces in %s (%w); import some with --file", dbPath, err)
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(tracesFlags.format) {
+		case "text":
+			return writeTraces(out, overlay, tracesFlags.top)
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(overlay)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", tracesFlags.format)
+		}
+	},
+}
+
+func init() {
+	f := tracesCmd.Flags()
+	f.StringVarP(&tracesFlags.file, "file", "t", "", "OTLP/JSON or Jaeger JSON traces to import")
+	f.StringArrayVar(&tracesFlags.rules, "map", nil, "span mapping as regexp=function, tried before the configured rules (repeatable)")
+	f.IntVar(&tracesFlags.top, "top", 10, "number of calls and span names to list")
+	f.StringVarP(&tracesFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(tracesCmd)
+}
+
+func writeTraces(w io.Writer, o *traces.Overlay, top int) error {
+	fmt.Fprintf(w, "%d spans in %d traces, %d mapped to %d functions; %d calls observed\n\n",
+		o.Spans, o.Traces, o.Mapped, len(o.Functions), len(o.Calls))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT\tCALL\tSTATIC")
+	for i, c := range o.Calls {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%d\t%s → %s\t%s\n", c.Count, c.Caller, c.Callee, c.Static)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if missing := o.Missing(); len(missing) > 0 {
+		fmt.Fprintf(w, "\n%d observed calls are not in the static graph:\n", len(missing))
+		for i, c := range missing {
+			if i == top {
+				fmt.Fprintf(w, "  … %d more\n", len(missing)-top)
+				break
+			}
+			fmt.Fprintf(w, "  %s → %s (%d)\n", c.Caller, c.Callee, c.Count)
+		}
+	}
+
+	if len(o.Unmapped) > 0 {
+		fmt.Fprintf(w, "\n%d spans matched no function; commonest names (add --map rules for them):\n", o.Spans-o.Mapped)
+		for i, s := range o.Unmapped {
+			if i == top {
+				break
+			}
+			fmt.Fprintf(w, "  %s (%d)\n", s.Name, s.Count)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiFlags struct {
+	strict bool
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [function]",
+	Short: "Browse the stored graph in the terminal",
+	Long: `tui browses the stored graph in the terminal: type to fuzzy-find a
+function, then walk its callers (←) and callees (→) and follow them with
+enter, going back with the left arrow. s shows the function's source
+under its calls, / finds another function, q quits. Given a function, it
+starts there.`,
+	Example: `  geeparse tui
+  geeparse tui handleGraph`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		graph, err := store.LoadGraph()
+		if err != nil {
+			return err
+		}
+		if tuiFlags.strict {
+			graph = callgraph.Strict(graph)
+		}
+		var start string
+		if len(args) == 1 {
+			start = args[0]
+		}
+		return tui.Run(graph, start, os.Stdin, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	tuiCmd.Flags().BoolVar(&tuiFlags.strict, "strict", false, "leave out calls that were only guessed by heuristics")
+	rootCmd.AddCommand(tuiCmd)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/spf13/cobra"
+)
+
+var verifyFlags struct {
+	fix    bool
+	format string
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the store for inconsistencies and optionally repair them",
+	Long: `verify checks the store (--db) for what the call graph can't represent and
+other commands would trip over:
+
+  integrity            damage SQLite itself finds in the file
+  schema-drift         tables whose columns differ from what this version creates
+  dangling-call        calls from functions that aren't stored
+  orphan-callee        calls to functions that aren't stored
+  duplicate-function   one declaration (file and line) stored under several names
+  stale-body-hash      body hashes that don't match the definition, so renames are missed
+  unknown-call-kind    calls of a kind this version doesn't know
+
+It lists each issue and exits non-zero if any is left. With --fix it
+repairs all but integrity problems in place: drifted tables are rebuilt
+keeping the columns both versions have, dangling calls are deleted,
+duplicates are merged into the name with the most calls (annotations and
+tags follow), hashes are recomputed and unknown kinds cleared. Back up
+the file first; for a damaged one, rebuild the graph or restore a copy.`,
+	Example: `  geeparse verify
+  geeparse verify --fix --db graph.db`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		issues, err := store.Verify(verifyFlags.fix)
+		if err != nil {
+			return err
+		}
+		if verifyFlags.fix {
+			recordAudit(store, "verify.fix", fixedSummary(issues))
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(verifyFlags.format) {
+		case "text":
+			writeIssues(out, issues)
+		case "json":
+			if issues == nil {
+				issues = []persistence.Issue{}
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(issues); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", verifyFlags.format)
+		}
+
+		left := 0
+		for _, issue := range issues {
+			if !issue.Fixed {
+				left++
+			}
+		}
+		if left > 0 {
+			return fmt.Errorf("%d store issues", left)
+		}
+		return nil
+	},
+}
+
+func init() {
+	f := verifyCmd.Flags()
+	f.BoolVar(&verifyFlags.fix, "fix", false, "repair the issues that can be repaired")
+	f.StringVarP(&verifyFlags.format, "format", "f", "text", "output format: text or json")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// fixedSummary counts the issues --fix repaired by check, in the order
+// Verify found them: "2 dangling-call, 1 stale-body-hash".
+func fixedSummary(issues []persistence.Issue) string {
+	var checks []string
+	counts := make(map[string]int)
+	for _, issue := range issues {
+		if !issue.Fixed {
+			continue
+		}
+		if counts[issue.Check] == 0 {
+			checks = append(checks, issue.Check)
+		}
+		counts[issue.Check]++
+	}
+	if len(checks) == 0 {
+		return "nothing fixed"
+	}
+	parts := make([]string, len(checks))
+	for i, c := range checks {
+		parts[i] = fmt.Sprintf("%d %s", counts[c], c)
+	}
+	return "fixed " + strings.Join(parts, ", ")
+}
+
+func writeIssues(w io.Writer, issues []persistence.Issue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "no issues")
+		return
+	}
+	fixed := 0
+	for _, issue := range issues {
+		mark := ""
+		switch {
+		case issue.Fixed:
+			mark = " (fixed)"
+			fixed++
+		case issue.Fixable:
+			mark = " (fixable with --fix)"
+		}
+		fmt.Fprintf(w, "%s: %s%s\n", issue.Check, issue.Detail, mark)
+	}
+	fmt.Fprintf(w, "%d issues, %d fixed\n", len(issues), fixed)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+var versionFlags struct {
+	format string
+	server string
+}
+
+// versionReport is what version --format json prints.
+type versionReport struct {
+	Client buildinfo.Info    `json:"client"`
+	Store  *persistence.Info `json:"store,omitempty"`
+	Server *server.Version   `json:"server,omitempty"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the geeparse version, and which versions built the store and run a server",
+	Long: `version prints this binary's version, commit and build date, then which
+geeparse version built the newest snapshot in --db (when the store exists),
+and with --server the version of a running server and of its store, read
+from its /api/version.`,
+	Example: `  geeparse version
+  geeparse version --server http://graphs.internal:8080`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report := versionReport{Client: buildinfo.Get()}
+		if _, err := os.Stat(dbPath); err == nil {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			info, err := store.Info()
+			store.Close()
+			if err != nil {
+				return err
+			}
+			report.Store = &info
+		}
+		if versionFlags.server != "" {
+			v, err := fetchVersion(versionFlags.server)
+			if err != nil {
+				return err
+			}
+			report.Server = v
+		}
+
+		out := cmd.OutOrStdout()
+		switch strings.ToLower(versionFlags.format) {
+		case "text":
+			fmt.Fprintf(out, "geeparse %s\n", report.Client)
+			if report.Store != nil {
+				fmt.Fprintf(out, "store %s: %s\n", dbPath, storeSummary(*report.Store))
+			}
+			if v := report.Server; v != nil {
+				fmt.Fprintf(out, "server %s: geeparse %s\n", versionFlags.server, v.Info)
+				fmt.Fprintf(out, "server store: %s\n", storeSummary(v.Store))
+			}
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		default:
+			return fmt.Errorf("unknown format %q (want text or json)", versionFlags.format)
+		}
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().StringVarP(&versionFlags.format, "format", "f", "text", "output format: text or json")
+	versionCmd.Flags().StringVar(&versionFlags.server, "server", "", "also report the version of the geeparse server at this URL")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// storeSummary describes a store's snapshots in a few words.
+func storeSummary(info persistence.Info) string {
+	switch {
+	case info.Snapshots == 0:
+		return "no snapshots"
+	case info.BuiltBy == "":
+		return fmt.Sprintf("%d snapshots, newest built by an unknown (older) version", info.Snapshots)
+	}
+	return fmt.Sprintf("%d snapshots, newest built by %s", info.Snapshots, info.BuiltBy)
+}
+
+// fetchVersion reads /api/version from the server at base, which may
+// include a base path.
+func fetchVersion(base string) (*server.Version, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(base, "/") + "/api/version")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s (is it a geeparse server, and new enough to report its version?)", base, resp.Status)
+	}
+	var v server.Version
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: decode version: %w", base, err)
+	}
+	return &v, nil
+}
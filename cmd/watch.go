@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/server"
+	"github.com/ishanmadhav/geeparse/pkg/watch"
+	"github.com/spf13/cobra"
+)
+
+var watchFlags struct {
+	serve    bool
+	interval time.Duration
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [dir]",
+	Short: "Rebuild the graph whenever Go files change",
+	Long: `watch builds the graph once, then keeps a gopls session open and rebuilds
+incrementally whenever .go files under dir change, saving each result to
+the store. With --serve it also runs the server, and open browsers reload
+the graph after every rebuild. With --ephemeral the store is a temporary
+one, removed when watch exits, instead of --db.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := analysisFlags.root
+		if len(args) == 1 {
+			root = args[0]
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		store, closeStore, err := openServingStore()
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+
+		hook, err := webhook()
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		var (
+			builder *callgraph.Builder
+			graph   map[string]callgraph.FunctionNode
+		)
+		err = interruptible(ctx, func() (err error) {
+			if builder, err = callgraph.NewBuilder(root, analysisOptions()); err != nil {
+				return err
+			}
+			if graph, err = builder.Build(ctx); err != nil {
+				builder.Close()
+			}
+			return err
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer builder.Close()
+		if err := store.SaveGraph(graph); err != nil {
+			return err
+		}
+		if err := store.SaveBuildReport(builder.Report()); err != nil {
+			return err
+		}
+		warnIncomplete(builder.Report())
+		recordAudit(store, "build", fmt.Sprintf("watching %s: %d functions, %d calls", root, len(graph), callgraph.EdgeCount(graph)))
+		slog.Info("built graph; watching for changes", "functions", len(graph), "duration", time.Since(start).Round(time.Millisecond), "root", root)
+		warnThresholds(graph)
+
+		var srv *server.Server
+		serveErr := make(chan error, 1)
+		if watchFlags.serve {
+			srv = server.New(graph, store, serverOptions())
+			go func() { serveErr <- srv.ListenAndServe(serverFlags.addr) }()
+		}
+
+		watchErr := make(chan error, 1)
+		go func() {
+			watchErr <- watch.Watch(ctx, root, watchFlags.interval, func(changed []string) {
+				start := time.Now()
+				// each rebuild is its own trace rather than part of the
+				// long-running command's
+				next, err := builder.Rebuild(context.Background(), changed)
+				if err != nil {
+					slog.Error("rebuild failed", "err", err)
+					return
+				}
+				if err := store.SaveGraph(next); err != nil {
+					slog.Error("save failed", "err", err)
+					return
+				}
+				if err := store.SaveBuildReport(builder.Report()); err != nil {
+					slog.Error("save failed", "err", err)
+					return
+				}
+				recordAudit(store, "rebuild", fmt.Sprintf("%d files changed: %d functions, %d calls",
+					len(changed), len(next), callgraph.EdgeCount(next)))
+				warnIncomplete(builder.Report())
+				if srv != nil {
+					srv.SetGraph(next)
+				}
+				slog.Info("rebuilt graph", "changed", len(changed), "duration", time.Since(start).Round(time.Millisecond),
+					"functions", len(next), "calls", callgraph.EdgeCount(next))
+				old := graph
+				graph = next
+				notifyRebuild(context.Background(), hook, root, old, graph)
+				warnThresholds(graph)
+			})
+		}()
+
+		select {
+		case err := <-serveErr:
+			return fmt.Errorf("server: %w", err)
+		case err := <-watchErr:
+			return err
+		}
+	},
+}
+
+func init() {
+	f := watchCmd.Flags()
+	addAnalysisFlags(f)
+	f.BoolVar(&watchFlags.serve, "serve", false, "also serve the UI, live-updating after each rebuild")
+	f.DurationVar(&watchFlags.interval, "interval", time.Second, "how often to poll for changed files")
+	addServerFlags(f)
+	addNotifyFlags(f)
+	rootCmd.AddCommand(watchCmd)
+}
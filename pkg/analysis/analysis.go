@@ -0,0 +1,96 @@
+// Package analysis computes architectural facts from a call-graph: what is
+// reachable from entrypoints, dead code, cycles, paths and summary
+// statistics.
+package analysis
+
+import (
+	"path"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// DefaultRoots are the entrypoints assumed when none are given: program
+// and test mains, and package initializers.
+var DefaultRoots = []string{"main", "init", "TestMain"}
+
+// MatchRoots returns, sorted, the functions whose names match any of the
+// patterns (path.Match syntax, so "Test*" selects every test).
+func MatchRoots(graph map[string]callgraph.FunctionNode, patterns []string) []string {
+	var roots []string
+	for name := range graph {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				roots = append(roots, name)
+				break
+			}
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// Reachable returns every function reachable from roots, roots included.
+func Reachable(graph map[string]callgraph.FunctionNode, roots []string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), roots...)
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[name] {
+			continue
+		}
+		node, ok := graph[name]
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		stack = append(stack, node.Callees...)
+	}
+	return seen
+}
+
+// Location identifies a function and where it is defined.
+type Location struct {
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+}
+
+// LocationOf returns name's location in graph.
+func LocationOf(graph map[string]callgraph.FunctionNode, name string) Location {
+	node := graph[name]
+	return Location{Name: name, Package: node.Package, File: node.File, Line: node.Line}
+}
+
+// DeadCode returns the functions no root pattern can reach, ordered by
+// file and line. Generated functions are left out: protobuf getters and
+// mock methods nobody calls are expected, and deleting them means
+// changing the generator's input, not the code. So are the standard
+// library functions of callgraph.Options.Stdlib, which aren't yours to
+// delete. Calls through them still count towards reachability.
+func DeadCode(graph map[string]callgraph.FunctionNode, rootPatterns []string) []Location {
+	live := Reachable(graph, MatchRoots(graph, rootPatterns))
+	dead := []Location{}
+	for name, node := range graph {
+		if !live[name] && node.Generated == "" && !callgraph.IsStdlib(node.Package) {
+			dead = append(dead, LocationOf(graph, name))
+		}
+	}
+	sortLocations(dead)
+	return dead
+}
+
+func sortLocations(locs []Location) {
+	sort.Slice(locs, func(i, j int) bool {
+		a, b := locs[i], locs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// PackageAPI is how a package's exported functions are used: Used are
+// called from other packages, Unused only from within the package or not
+// at all, so they could be unexported.
+type PackageAPI struct {
+	Package  string        `json:"package"`
+	Exported int           `json:"exported"`
+	Used     []APIFunction `json:"used"`
+	Unused   []APIFunction `json:"unused"`
+}
+
+// APIFunction is one exported function, with its callers outside its
+// package, sorted, and how many callers it has inside. Each package
+// lists them by name.
+type APIFunction struct {
+	Location
+	Callers  []string `json:"callers,omitempty"`
+	Packages []string `json:"packages,omitempty"` // of Callers
+	Internal int      `json:"internal"`
+}
+
+// APIUsage reports, per package of graph sorted by path, which of its
+// exported Go functions other packages call and which they don't. A
+// non-empty pkgs limits the report to those packages and the ones below
+// them, with callers counted from everywhere. Tests,
+// generated code and the standard library of callgraph.Options.Stdlib
+// have no API to trim and are left out, as are packages exporting
+// nothing. Functions are matched by name, without types, so exported
+// methods called only through an interface count as unused unless the
+// graph has those calls.
+func APIUsage(graph map[string]callgraph.FunctionNode, pkgs []string) []PackageAPI {
+	callers := make(map[string][]string)
+	for name, node := range graph {
+		for _, c := range node.Callees {
+			callers[c] = append(callers[c], name)
+		}
+	}
+	byPkg := make(map[string]*PackageAPI)
+	for name, node := range graph {
+		if !exportedAPI(name, node) || (len(pkgs) > 0 && !callgraph.InPackages(node.Package, pkgs)) {
+			continue
+		}
+		api := byPkg[node.Package]
+		if api == nil {
+			api = &PackageAPI{Package: node.Package, Used: []APIFunction{}, Unused: []APIFunction{}}
+			byPkg[node.Package] = api
+		}
+		api.Exported++
+		fn := APIFunction{Location: LocationOf(graph, name)}
+		callerPkgs := make(map[string]bool)
+		for _, caller := range callers[name] {
+			if p := graph[caller].Package; p != node.Package {
+				fn.Callers = append(fn.Callers, caller)
+				callerPkgs[p] = true
+			} else {
+				fn.Internal++
+			}
+		}
+		if len(fn.Callers) == 0 {
+			api.Unused = append(api.Unused, fn)
+			continue
+		}
+		sort.Strings(fn.Callers)
+		for p := range callerPkgs {
+			fn.Packages = append(fn.Packages, p)
+		}
+		sort.Strings(fn.Packages)
+		api.Used = append(api.Used, fn)
+	}
+
+	out := make([]PackageAPI, 0, len(byPkg))
+	for _, api := range byPkg {
+		sortAPI(api.Used)
+		sortAPI(api.Unused)
+		out = append(out, *api)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Package < out[j].Package })
+	return out
+}
+
+// UnusedAPI keeps, of usage, the packages with exported functions no other
+// package calls, and only those functions.
+func UnusedAPI(usage []PackageAPI) []PackageAPI {
+	out := []PackageAPI{}
+	for _, api := range usage {
+		if len(api.Unused) > 0 {
+			api.Used = []APIFunction{}
+			out = append(out, api)
+		}
+	}
+	return out
+}
+
+func sortAPI(fns []APIFunction) {
+	sort.Slice(fns, func(i, j int) bool { return fns[i].Name < fns[j].Name })
+}
+
+// exportedAPI reports whether name is an exported function of its
+// package that other packages could stop calling.
+func exportedAPI(name string, node callgraph.FunctionNode) bool {
+	if node.Generated != "" || callgraph.IsStdlib(node.Package) ||
+		(node.Language != "" && node.Language != callgraph.LanguageGo) ||
+		strings.HasSuffix(node.File, "_test.go") {
+		return false
+	}
+	// namespaced names carry their prefix: api/SaveGraph
+	base := name[strings.LastIndex(name, "/")+1:]
+	r, _ := utf8.DecodeRuneInString(base)
+	return unicode.IsUpper(r)
+}
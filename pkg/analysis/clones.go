@@ -0,0 +1,252 @@
+package analysis
+
+import (
+	"go/scanner"
+	"go/token"
+	"hash/fnv"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Defaults of CloneOptions.
+const (
+	DefaultCloneMinTokens = 50
+	DefaultCloneThreshold = 0.8
+)
+
+// Clone is a set of functions with the same or nearly the same body:
+// copy-paste the call graph can't show, since copies rarely call each
+// other. Exact clones match token for token but for their names and
+// spacing, as callgraph.BodyHash sees them, and may have any number of
+// members; near clones are pairs whose token sequences, with identifiers
+// and literals blanked out, overlap by Similarity (the Jaccard index of
+// their runs of cloneShingle tokens). Tokens is the length of the shortest
+// member.
+type Clone struct {
+	Functions  []Location `json:"functions"`
+	Exact      bool       `json:"exact"`
+	Similarity float64    `json:"similarity"`
+	Tokens     int        `json:"tokens"`
+}
+
+// CloneOptions tune Clones. Zero values pick the defaults.
+type CloneOptions struct {
+	// MinTokens leaves out functions shorter than this, whose bodies
+	// match by accident.
+	MinTokens int
+	// Threshold is the least Similarity of a near clone; 1 reports exact
+	// clones only.
+	Threshold float64
+	// CrossPackage keeps only clones spanning several packages.
+	CrossPackage bool
+}
+
+// How near clones are found: functions' shingles are MinHashed with
+// cloneBands*cloneRows hash functions and pairs agreeing on every row of
+// some band are compared in full, so pairs well above the threshold are
+// found without comparing every pair.
+const (
+	cloneShingle = 5
+	cloneBands   = 16
+	cloneRows    = 4
+)
+
+// Clones finds the exact and near clones among graph's handwritten
+// functions, longest first. Functions without definitions are skipped.
+func Clones(graph map[string]callgraph.FunctionNode, opts CloneOptions) []Clone {
+	if opts.MinTokens <= 0 {
+		opts.MinTokens = DefaultCloneMinTokens
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultCloneThreshold
+	}
+
+	type fn struct {
+		name     string
+		tokens   int
+		shingles map[uint64]bool
+		sig      []uint64
+	}
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fns []fn
+	byHash := make(map[string][]int)
+	for _, name := range names {
+		node := graph[name]
+		if node.Generated != "" || callgraph.IsStdlib(node.Package) || node.Definition == "" || callgraph.Redacted(node.Definition) {
+			continue
+		}
+		toks := cloneTokens(node.Definition)
+		if len(toks) < opts.MinTokens {
+			continue
+		}
+		f := fn{name: name, tokens: len(toks), shingles: shingles(toks)}
+		f.sig = minHash(f.shingles)
+		hash := callgraph.BodyHash(name, node)
+		byHash[hash] = append(byHash[hash], len(fns))
+		fns = append(fns, f)
+	}
+
+	var out []Clone
+	group := make([]int, len(fns)) // exact group of each function, by first member
+	for i := range group {
+		group[i] = i
+	}
+	for _, members := range byHash {
+		if len(members) < 2 {
+			continue
+		}
+		c := Clone{Exact: true, Similarity: 1, Tokens: fns[members[0]].tokens}
+		for _, i := range members {
+			group[i] = members[0]
+			c.Functions = append(c.Functions, LocationOf(graph, fns[i].name))
+			c.Tokens = min(c.Tokens, fns[i].tokens)
+		}
+		out = append(out, c)
+	}
+
+	if opts.Threshold < 1 {
+		seen := make(map[[2]int]bool)
+		for band := 0; band < cloneBands; band++ {
+			buckets := make(map[[cloneRows]uint64][]int)
+			for i, f := range fns {
+				var key [cloneRows]uint64
+				copy(key[:], f.sig[band*cloneRows:])
+				buckets[key] = append(buckets[key], i)
+			}
+			for _, bucket := range buckets {
+				for x := 0; x < len(bucket); x++ {
+					for y := x + 1; y < len(bucket); y++ {
+						i, j := bucket[x], bucket[y]
+						if group[i] == group[j] || seen[[2]int{i, j}] {
+							continue
+						}
+						seen[[2]int{i, j}] = true
+						sim := jaccard(fns[i].shingles, fns[j].shingles)
+						if sim < opts.Threshold {
+							continue
+						}
+						out = append(out, Clone{
+							Functions:  []Location{LocationOf(graph, fns[i].name), LocationOf(graph, fns[j].name)},
+							Similarity: sim,
+							Tokens:     min(fns[i].tokens, fns[j].tokens),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	if opts.CrossPackage {
+		kept := out[:0]
+		for _, c := range out {
+			for _, loc := range c.Functions[1:] {
+				if loc.Package != c.Functions[0].Package {
+					kept = append(kept, c)
+					break
+				}
+			}
+		}
+		out = kept
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Tokens != b.Tokens {
+			return a.Tokens > b.Tokens
+		}
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		return a.Functions[0].Name < b.Functions[0].Name
+	})
+	if out == nil {
+		out = []Clone{}
+	}
+	return out
+}
+
+// cloneTokens scans a definition into tokens with every identifier and
+// literal blanked to its kind, so copies with renamed variables or changed
+// constants still line up.
+func cloneTokens(def string) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(def))
+	s.Init(file, []byte(def), func(token.Position, string) {}, 0)
+	var out []string
+	for {
+		_, tok, lit := s.Scan()
+		switch {
+		case tok == token.EOF:
+			return out
+		case tok == token.SEMICOLON && lit == "\n":
+			// automatic semicolons follow the layout, not the code
+		default:
+			// identifiers and literals print as their kind, IDENT, INT
+			// and so on, operators and keywords as themselves
+			out = append(out, tok.String())
+		}
+	}
+}
+
+// shingles hashes every run of cloneShingle tokens.
+func shingles(toks []string) map[uint64]bool {
+	out := make(map[uint64]bool)
+	for i := 0; i+cloneShingle <= len(toks); i++ {
+		h := fnv.New64a()
+		for _, t := range toks[i : i+cloneShingle] {
+			h.Write([]byte(t))
+			h.Write([]byte{0})
+		}
+		out[h.Sum64()] = true
+	}
+	return out
+}
+
+// minHash returns the MinHash signature of a shingle set, one minimum per
+// hash function; the hash functions are fixed so signatures compare
+// across calls.
+func minHash(set map[uint64]bool) []uint64 {
+	sig := make([]uint64, cloneBands*cloneRows)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for x := range set {
+		for i := range sig {
+			if h := mix(x ^ uint64(i+1)*0x9e3779b97f4a7c15); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+// mix is the SplitMix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for x := range a {
+		if b[x] {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Coupling counts the calls between packages: Calls[i][j] is how many
+// calls functions in Packages[i] make to functions in Packages[j], so the
+// diagonal holds each package's internal calls.
+type Coupling struct {
+	Packages []string `json:"packages"`
+	Calls    [][]int  `json:"calls"`
+}
+
+// PackageCoupling builds the package coupling matrix of graph, packages
+// sorted by path. Calls to functions outside the graph are ignored.
+func PackageCoupling(graph map[string]callgraph.FunctionNode) Coupling {
+	seen := make(map[string]bool)
+	for _, node := range graph {
+		seen[node.Package] = true
+	}
+	c := Coupling{Packages: make([]string, 0, len(seen))}
+	for p := range seen {
+		c.Packages = append(c.Packages, p)
+	}
+	sort.Strings(c.Packages)
+	index := make(map[string]int, len(c.Packages))
+	c.Calls = make([][]int, len(c.Packages))
+	for i, p := range c.Packages {
+		index[p] = i
+		c.Calls[i] = make([]int, len(c.Packages))
+	}
+	for _, node := range graph {
+		for _, callee := range node.Callees {
+			if target, ok := graph[callee]; ok {
+				c.Calls[index[node.Package]][index[target.Package]]++
+			}
+		}
+	}
+	return c
+}
+
+// Max returns the largest count between two different packages.
+func (c Coupling) Max() int {
+	max := 0
+	for i, row := range c.Calls {
+		for j, n := range row {
+			if i != j && n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
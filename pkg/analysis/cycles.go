@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Components returns the strongly connected components of graph (Tarjan's
+// algorithm, iterative so deep graphs can't overflow the stack). Components
+// come out in reverse topological order: a component only calls into
+// components listed before it. Names within a component are sorted.
+func Components(graph map[string]callgraph.FunctionNode) [][]string {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make(map[string]int, len(graph))
+	low := make(map[string]int, len(graph))
+	onStack := make(map[string]bool)
+	var stack []string
+	var comps [][]string
+	next := 0
+
+	type frame struct {
+		name string
+		i    int // next callee to visit
+	}
+	for _, start := range names {
+		if _, seen := index[start]; seen {
+			continue
+		}
+		work := []frame{{name: start}}
+		index[start], low[start] = next, next
+		next++
+		stack = append(stack, start)
+		onStack[start] = true
+
+		for len(work) > 0 {
+			top := &work[len(work)-1]
+			callees := graph[top.name].Callees
+			if top.i < len(callees) {
+				c := callees[top.i]
+				top.i++
+				if _, ok := graph[c]; !ok {
+					continue
+				}
+				if _, seen := index[c]; !seen {
+					index[c], low[c] = next, next
+					next++
+					stack = append(stack, c)
+					onStack[c] = true
+					work = append(work, frame{name: c})
+				} else if onStack[c] && index[c] < low[top.name] {
+					low[top.name] = index[c]
+				}
+				continue
+			}
+
+			name := top.name
+			work = work[:len(work)-1]
+			if len(work) > 0 {
+				parent := work[len(work)-1].name
+				if low[name] < low[parent] {
+					low[parent] = low[name]
+				}
+			}
+			if low[name] == index[name] {
+				var comp []string
+				for {
+					n := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					onStack[n] = false
+					comp = append(comp, n)
+					if n == name {
+						break
+					}
+				}
+				sort.Strings(comp)
+				comps = append(comps, comp)
+			}
+		}
+	}
+	return comps
+}
+
+// Cycles returns the components that contain a cycle: more than one
+// function, or a single function that calls itself. Largest first.
+func Cycles(graph map[string]callgraph.FunctionNode) [][]string {
+	var cycles [][]string
+	for _, comp := range Components(graph) {
+		if len(comp) > 1 || callsItself(graph[comp[0]], comp[0]) {
+			cycles = append(cycles, comp)
+		}
+	}
+	sort.SliceStable(cycles, func(i, j int) bool { return len(cycles[i]) > len(cycles[j]) })
+	return cycles
+}
+
+func callsItself(node callgraph.FunctionNode, name string) bool {
+	for _, c := range node.Callees {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
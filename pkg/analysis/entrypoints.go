@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Footprint sizes up what one entrypoint pulls in, to compare commands or
+// handlers: Reachable counts the functions it reaches, itself included;
+// MaxDepth is how many calls the farthest of them is from it, along the
+// shortest path there; Packages counts the packages they belong to; and
+// Exclusive counts those no other entrypoint reaches, roughly what would
+// go if this entrypoint did.
+type Footprint struct {
+	Location
+	Reachable int `json:"reachable"`
+	MaxDepth  int `json:"maxDepth"`
+	Packages  int `json:"packages"`
+	Exclusive int `json:"exclusive"`
+}
+
+// Entrypoints computes the Footprint of every function matching
+// rootPatterns (path.Match syntax, as in MatchRoots), largest first.
+func Entrypoints(graph map[string]callgraph.FunctionNode, rootPatterns []string) []Footprint {
+	roots := MatchRoots(graph, rootPatterns)
+	out := make([]Footprint, 0, len(roots))
+	reachedBy := make(map[string]int) // how many entrypoints reach each function
+	reached := make([]map[string]int, len(roots))
+	for i, root := range roots {
+		depth := depths(graph, root)
+		reached[i] = depth
+		fp := Footprint{Location: LocationOf(graph, root), Reachable: len(depth)}
+		pkgs := make(map[string]bool)
+		for name, d := range depth {
+			reachedBy[name]++
+			fp.MaxDepth = max(fp.MaxDepth, d)
+			pkgs[graph[name].Package] = true
+		}
+		fp.Packages = len(pkgs)
+		out = append(out, fp)
+	}
+	for i := range out {
+		for name := range reached[i] {
+			if reachedBy[name] == 1 {
+				out[i].Exclusive++
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Reachable > out[j].Reachable })
+	return out
+}
+
+// depths maps every function root reaches to its distance in calls, by a
+// breadth-first walk.
+func depths(graph map[string]callgraph.FunctionNode, root string) map[string]int {
+	depth := map[string]int{root: 0}
+	frontier := []string{root}
+	for d := 1; len(frontier) > 0; d++ {
+		var next []string
+		for _, name := range frontier {
+			for _, c := range graph[name].Callees {
+				if _, ok := graph[c]; !ok {
+					continue
+				}
+				if _, seen := depth[c]; !seen {
+					depth[c] = d
+					next = append(next, c)
+				}
+			}
+		}
+		frontier = next
+	}
+	return depth
+}
@@ -0,0 +1,137 @@
+package analysis
+
+import (
+	"path"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// LineRange is an inclusive span of changed lines in one file.
+type LineRange struct {
+	Start, End int
+}
+
+// FunctionsAt returns, sorted, the functions touched by changes, which
+// maps absolute file paths to changed line ranges. A file with no ranges
+// counts as changed throughout. Graphs stored before end lines were
+// recorded attribute a line to the closest function starting above it.
+func FunctionsAt(graph map[string]callgraph.FunctionNode, changes map[string][]LineRange) []string {
+	byFile := make(map[string][]string)
+	for name, node := range graph {
+		if _, ok := changes[node.File]; ok {
+			byFile[node.File] = append(byFile[node.File], name)
+		}
+	}
+
+	var out []string
+	for file, names := range byFile {
+		sort.Slice(names, func(i, j int) bool { return graph[names[i]].Line < graph[names[j]].Line })
+		ranges := changes[file]
+		for i, name := range names {
+			node := graph[name]
+			end := node.EndLine
+			if end == 0 {
+				end = int(^uint(0) >> 1)
+				if i+1 < len(names) {
+					end = graph[names[i+1]].Line - 1
+				}
+			}
+			if len(ranges) == 0 || overlaps(ranges, node.Line, end) {
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func overlaps(ranges []LineRange, start, end int) bool {
+	for _, r := range ranges {
+		if r.Start <= end && r.End >= start {
+			return true
+		}
+	}
+	return false
+}
+
+// Affected is a function that transitively calls a changed one.
+type Affected struct {
+	Location
+	// Distance is the number of calls between this function and the
+	// nearest changed function.
+	Distance int `json:"distance"`
+}
+
+// Impact is the blast radius of a change.
+type Impact struct {
+	Changed  []Location `json:"changed"`
+	Affected []Affected `json:"affected"`
+	// Tests lists the affected (or changed) functions that look like Go
+	// tests, benchmarks, fuzz targets or examples: the ones worth rerunning.
+	Tests []string `json:"tests"`
+}
+
+// ImpactOf returns the changed functions and every transitive caller of
+// them, nearest first.
+func ImpactOf(graph map[string]callgraph.FunctionNode, changed []string) Impact {
+	callers := make(map[string][]string)
+	for caller, node := range graph {
+		for _, callee := range node.Callees {
+			callers[callee] = append(callers[callee], caller)
+		}
+	}
+
+	imp := Impact{Changed: []Location{}, Affected: []Affected{}, Tests: []string{}}
+	dist := make(map[string]int)
+	var queue []string
+	for _, name := range changed {
+		if _, ok := graph[name]; !ok {
+			continue
+		}
+		if _, dup := dist[name]; dup {
+			continue
+		}
+		dist[name] = 0
+		queue = append(queue, name)
+		imp.Changed = append(imp.Changed, LocationOf(graph, name))
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[name] {
+			if _, seen := dist[caller]; seen {
+				continue
+			}
+			dist[caller] = dist[name] + 1
+			queue = append(queue, caller)
+			imp.Affected = append(imp.Affected, Affected{Location: LocationOf(graph, caller), Distance: dist[caller]})
+		}
+	}
+
+	sortLocations(imp.Changed)
+	sort.Slice(imp.Affected, func(i, j int) bool {
+		a, b := imp.Affected[i], imp.Affected[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Name < b.Name
+	})
+	for name := range dist {
+		if isTest(name) {
+			imp.Tests = append(imp.Tests, name)
+		}
+	}
+	sort.Strings(imp.Tests)
+	return imp
+}
+
+// isTest reports whether name follows the go test naming conventions.
+func isTest(name string) bool {
+	for _, p := range []string{"Test?*", "Benchmark?*", "Fuzz?*", "Example*"} {
+		if ok, _ := path.Match(p, name); ok && name != "TestMain" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Layering arranges a graph in layers by distance from its entrypoints,
+// for a quick look at its architecture: entrypoints start in Layers[0],
+// and every other function sits one layer below the deepest of its
+// callers, so calls always point down the layers. Cycles are collapsed
+// first: the functions of a strongly connected component share a layer,
+// and calls among them are the only ones that stay level. Without root
+// patterns the entrypoints are the components nothing else calls, which
+// places every function; otherwise the functions the roots can't reach
+// go in Unreached. Names within a layer are sorted.
+type Layering struct {
+	Layers    [][]string `json:"layers"`
+	Unreached []string   `json:"unreached"`
+}
+
+// Layer returns name's layer, or -1 if it was unreached or isn't in the
+// graph.
+func (l Layering) Layer(name string) int {
+	for i, layer := range l.Layers {
+		if j := sort.SearchStrings(layer, name); j < len(layer) && layer[j] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Layers computes the Layering of graph from rootPatterns (path.Match
+// syntax, as in MatchRoots).
+func Layers(graph map[string]callgraph.FunctionNode, rootPatterns []string) Layering {
+	comps := Components(graph)
+	compOf := make(map[string]int, len(graph))
+	for i, comp := range comps {
+		for _, name := range comp {
+			compOf[name] = i
+		}
+	}
+
+	layer := make([]int, len(comps))
+	for i := range layer {
+		layer[i] = -1
+	}
+	if len(rootPatterns) == 0 {
+		called := make([]bool, len(comps))
+		for i, comp := range comps {
+			for _, name := range comp {
+				for _, callee := range graph[name].Callees {
+					if j, ok := compOf[callee]; ok && j != i {
+						called[j] = true
+					}
+				}
+			}
+		}
+		for i := range comps {
+			if !called[i] {
+				layer[i] = 0
+			}
+		}
+	} else {
+		for _, root := range MatchRoots(graph, rootPatterns) {
+			layer[compOf[root]] = 0
+		}
+	}
+
+	// components arrive callees-first, so walking them backwards settles
+	// every caller before its callees
+	for i := len(comps) - 1; i >= 0; i-- {
+		if layer[i] < 0 {
+			continue
+		}
+		for _, name := range comps[i] {
+			for _, callee := range graph[name].Callees {
+				if j, ok := compOf[callee]; ok && j != i && layer[j] < layer[i]+1 {
+					layer[j] = layer[i] + 1
+				}
+			}
+		}
+	}
+
+	l := Layering{Layers: [][]string{}, Unreached: []string{}}
+	for i, comp := range comps {
+		if layer[i] < 0 {
+			l.Unreached = append(l.Unreached, comp...)
+			continue
+		}
+		for len(l.Layers) <= layer[i] {
+			l.Layers = append(l.Layers, []string{})
+		}
+		l.Layers[layer[i]] = append(l.Layers[layer[i]], comp...)
+	}
+	for _, names := range l.Layers {
+		sort.Strings(names)
+	}
+	sort.Strings(l.Unreached)
+	return l
+}
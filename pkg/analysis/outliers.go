@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Defaults for Outliers: past them a function is long or nested enough
+// to be worth splitting up.
+const (
+	DefaultMaxStatements = 50
+	DefaultMaxNesting    = 4
+)
+
+// Outlier is a function over a size or nesting limit, with its fan-in
+// and fan-out: a long function many others call is the riskier one to
+// leave alone.
+type Outlier struct {
+	Location
+	Statements int `json:"statements"`
+	Nesting    int `json:"nesting"`
+	FanIn      int `json:"fanIn"`
+	FanOut     int `json:"fanOut"`
+}
+
+// Outliers returns graph's functions with more than maxStatements
+// statements or blocks nested deeper than maxNesting, the longest first,
+// then the deepest. A limit of 0 isn't checked, and a non-empty pkgs
+// limits the report to those packages and the ones below them. Generated
+// code and the standard library are left out, as are functions of graphs
+// built before geeparse measured them.
+func Outliers(graph map[string]callgraph.FunctionNode, maxStatements, maxNesting int, pkgs []string) []Outlier {
+	fanIn := make(map[string]int)
+	for _, node := range graph {
+		for _, c := range node.Callees {
+			fanIn[c]++
+		}
+	}
+	out := []Outlier{}
+	for name, node := range graph {
+		if node.Generated != "" || callgraph.IsStdlib(node.Package) ||
+			(len(pkgs) > 0 && !callgraph.InPackages(node.Package, pkgs)) {
+			continue
+		}
+		if (maxStatements <= 0 || node.Statements <= maxStatements) && (maxNesting <= 0 || node.Nesting <= maxNesting) {
+			continue
+		}
+		out = append(out, Outlier{
+			Location:   LocationOf(graph, name),
+			Statements: node.Statements,
+			Nesting:    node.Nesting,
+			FanIn:      fanIn[name],
+			FanOut:     len(node.Callees),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Statements != b.Statements {
+			return a.Statements > b.Statements
+		}
+		if a.Nesting != b.Nesting {
+			return a.Nesting > b.Nesting
+		}
+		return a.Name < b.Name
+	})
+	return out
+}
+
+// Measured reports whether any function of graph has the statement
+// counts of callgraph.FunctionNode.Statements: graphs stored before
+// geeparse recorded them, or ingested from elsewhere, don't.
+func Measured(graph map[string]callgraph.FunctionNode) bool {
+	for _, node := range graph {
+		if node.Statements > 0 {
+			return true
+		}
+	}
+	return false
+}
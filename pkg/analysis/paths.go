@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// ShortestPath returns one shortest call chain from → to (both included),
+// or nil if to isn't reachable within maxDepth calls (0 = unlimited).
+func ShortestPath(graph map[string]callgraph.FunctionNode, from, to string, maxDepth int) []string {
+	if _, ok := graph[from]; !ok {
+		return nil
+	}
+	prev := map[string]string{from: ""}
+	depth := map[string]int{from: 0}
+	queue := []string{from}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name == to {
+			var path []string
+			for n := to; n != ""; n = prev[n] {
+				path = append([]string{n}, path...)
+				if n == from {
+					break
+				}
+			}
+			return path
+		}
+		if maxDepth > 0 && depth[name] >= maxDepth {
+			continue
+		}
+		for _, c := range sortedCallees(graph[name]) {
+			if _, seen := prev[c]; seen {
+				continue
+			}
+			if _, ok := graph[c]; !ok {
+				continue
+			}
+			prev[c] = name
+			depth[c] = depth[name] + 1
+			queue = append(queue, c)
+		}
+	}
+	return nil
+}
+
+// DefaultPathDepth is the chain length AllPaths stops at when given no
+// maxDepth: there can be exponentially many chains, and long ones are
+// rarely the ones anybody reads.
+const DefaultPathDepth = 10
+
+// maxPathSteps bounds how many partial chains AllPaths extends before it
+// gives up, whatever limit says, so a dense graph can't keep it busy.
+const maxPathSteps = 1_000_000
+
+// AllPaths returns up to limit call chains from → to that never repeat a
+// function, each at most maxDepth calls long (DefaultPathDepth if 0),
+// shortest first. limit 0 doesn't cap the number of chains, but the
+// search still stops after a fixed amount of work. The bool reports
+// whether the search was cut short, by limit or by that.
+func AllPaths(graph map[string]callgraph.FunctionNode, from, to string, maxDepth, limit int) ([][]string, bool) {
+	if _, ok := graph[from]; !ok {
+		return nil, false
+	}
+	if _, ok := graph[to]; !ok {
+		return nil, false
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultPathDepth
+	}
+	distTo := callsTo(graph, to)
+	var paths [][]string
+	onPath := map[string]bool{}
+	var path []string
+	truncated := false
+	steps := 0
+
+	var walk func(name string)
+	walk = func(name string) {
+		if truncated {
+			return
+		}
+		if steps++; steps > maxPathSteps {
+			truncated = true
+			return
+		}
+		path = append(path, name)
+		onPath[name] = true
+		defer func() {
+			path = path[:len(path)-1]
+			onPath[name] = false
+		}()
+
+		if name == to {
+			if limit > 0 && len(paths) >= limit {
+				truncated = true
+				return
+			}
+			paths = append(paths, append([]string(nil), path...))
+			return
+		}
+		for _, c := range sortedCallees(graph[name]) {
+			// calling c makes len(path) calls; skip it if to is further
+			// from there than maxDepth allows, or out of reach
+			if d, ok := distTo[c]; ok && !onPath[c] && len(path)+d <= maxDepth {
+				walk(c)
+			}
+		}
+	}
+	walk(from)
+
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+	return paths, truncated
+}
+
+// callsTo maps every function of graph that reaches to to the fewest
+// calls it takes, to itself included at 0.
+func callsTo(graph map[string]callgraph.FunctionNode, to string) map[string]int {
+	callers := make(map[string][]string)
+	for name, node := range graph {
+		for _, c := range node.Callees {
+			callers[c] = append(callers[c], name)
+		}
+	}
+	dist := map[string]int{to: 0}
+	queue := []string{to}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[name] {
+			if _, seen := dist[caller]; !seen {
+				dist[caller] = dist[name] + 1
+				queue = append(queue, caller)
+			}
+		}
+	}
+	return dist
+}
+
+func sortedCallees(node callgraph.FunctionNode) []string {
+	callees := append([]string(nil), node.Callees...)
+	sort.Strings(callees)
+	return callees
+}
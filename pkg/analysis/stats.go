@@ -0,0 +1,195 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Degree is a function with its number of callers or callees.
+type Degree struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PackageStats totals one package's functions and calls.
+type PackageStats struct {
+	Package       string `json:"package"`
+	Functions     int    `json:"functions"`
+	InternalCalls int    `json:"internalCalls"`
+	OutgoingCalls int    `json:"outgoingCalls"`
+	IncomingCalls int    `json:"incomingCalls"`
+}
+
+// Stats is a quick architectural health summary of a graph.
+type Stats struct {
+	Functions    int            `json:"functions"`
+	Calls        int            `json:"calls"`
+	Packages     int            `json:"packages"`
+	TopFanIn     []Degree       `json:"topFanIn"`
+	TopFanOut    []Degree       `json:"topFanOut"`
+	DeepestChain []string       `json:"deepestChain"`
+	Cycles       int            `json:"cycles"`
+	LargestCycle int            `json:"largestCycle"`
+	PackageStats []PackageStats `json:"packageStats"`
+	// Languages counts functions per source language, when the graph
+	// holds more than one.
+	Languages map[string]int `json:"languages,omitempty"`
+}
+
+// ComputeStats summarizes graph, listing the top functions by fan-in and
+// fan-out.
+func ComputeStats(graph map[string]callgraph.FunctionNode, top int) Stats {
+	st := Stats{
+		Functions:    len(graph),
+		Calls:        callgraph.EdgeCount(graph),
+		DeepestChain: DeepestChain(graph),
+	}
+
+	fanIn := make(map[string]int)
+	pkgs := make(map[string]*PackageStats)
+	pkg := func(name string) *PackageStats {
+		p := graph[name].Package
+		if pkgs[p] == nil {
+			pkgs[p] = &PackageStats{Package: p}
+		}
+		return pkgs[p]
+	}
+	var fanOut []Degree
+	for name, node := range graph {
+		pkg(name).Functions++
+		fanOut = append(fanOut, Degree{Name: name, Count: len(node.Callees)})
+		for _, c := range node.Callees {
+			fanIn[c]++
+			if _, ok := graph[c]; !ok {
+				continue
+			}
+			if graph[c].Package == node.Package {
+				pkg(name).InternalCalls++
+			} else {
+				pkg(name).OutgoingCalls++
+				pkg(c).IncomingCalls++
+			}
+		}
+	}
+	var fanInList []Degree
+	for name := range graph {
+		fanInList = append(fanInList, Degree{Name: name, Count: fanIn[name]})
+	}
+	st.TopFanIn = topDegrees(fanInList, top)
+	st.TopFanOut = topDegrees(fanOut, top)
+
+	cycles := Cycles(graph)
+	st.Cycles = len(cycles)
+	if len(cycles) > 0 {
+		st.LargestCycle = len(cycles[0])
+	}
+
+	st.PackageStats = []PackageStats{}
+	for _, p := range pkgs {
+		st.PackageStats = append(st.PackageStats, *p)
+	}
+	sort.Slice(st.PackageStats, func(i, j int) bool { return st.PackageStats[i].Package < st.PackageStats[j].Package })
+	st.Packages = len(st.PackageStats)
+	if langs := callgraph.Languages(graph); len(langs) > 1 {
+		st.Languages = langs
+	}
+	return st
+}
+
+// DeepestChain returns one longest call chain without repeated functions.
+// Cycles are collapsed, so each strongly connected component contributes a
+// single function to the chain.
+func DeepestChain(graph map[string]callgraph.FunctionNode) []string {
+	c := longestChains(graph)
+	best := -1
+	for i := range c.comps {
+		if best < 0 || c.depth[i] > c.depth[best] {
+			best = i
+		}
+	}
+	return c.from(best)
+}
+
+// DeepestChainsFrom returns, for each of names in order, one longest call
+// chain starting there, with cycles collapsed as in DeepestChain. Names not
+// in graph get a nil chain.
+func DeepestChainsFrom(graph map[string]callgraph.FunctionNode, names []string) [][]string {
+	c := longestChains(graph)
+	out := make([][]string, len(names))
+	for i, name := range names {
+		if j, ok := c.compOf[name]; ok {
+			out[i] = c.from(j)
+			out[i][0] = name
+		}
+	}
+	return out
+}
+
+// chains holds, for each strongly connected component, the length of the
+// longest chain starting there and the component it continues to.
+type chains struct {
+	comps  [][]string
+	compOf map[string]int
+	depth  []int
+	next   []int
+}
+
+func longestChains(graph map[string]callgraph.FunctionNode) chains {
+	comps := Components(graph)
+	c := chains{
+		comps:  comps,
+		compOf: make(map[string]int, len(graph)),
+		depth:  make([]int, len(comps)),
+		next:   make([]int, len(comps)),
+	}
+	for i, comp := range comps {
+		for _, name := range comp {
+			c.compOf[name] = i
+		}
+	}
+
+	// components arrive callees-first, so every successor is already done
+	for i, comp := range comps {
+		c.depth[i], c.next[i] = 1, -1
+		for _, name := range comp {
+			for _, callee := range graph[name].Callees {
+				j, ok := c.compOf[callee]
+				if !ok || j == i {
+					continue
+				}
+				if c.depth[j]+1 > c.depth[i] {
+					c.depth[i], c.next[i] = c.depth[j]+1, j
+				}
+			}
+		}
+	}
+	return c
+}
+
+// from returns the chain starting at component i, one function per
+// component.
+func (c chains) from(i int) []string {
+	chain := []string{}
+	for ; i >= 0; i = c.next[i] {
+		chain = append(chain, c.comps[i][0])
+	}
+	return chain
+}
+
+// topDegrees returns the n highest counts, ties broken by name.
+func topDegrees(ds []Degree, n int) []Degree {
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].Count != ds[j].Count {
+			return ds[i].Count > ds[j].Count
+		}
+		return ds[i].Name < ds[j].Name
+	})
+	if n >= 0 && len(ds) > n {
+		ds = ds[:n]
+	}
+	if ds == nil {
+		ds = []Degree{}
+	}
+	return ds
+}
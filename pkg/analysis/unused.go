@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Evidence is what is known to have run. Covered maps each function with
+// test coverage data to whether the tests ran any of it; Sampled holds
+// the functions a runtime profile caught running. Either is nil when no
+// such data was imported.
+type Evidence struct {
+	Covered map[string]bool
+	Sampled map[string]bool
+}
+
+// Suspect is a function that may be unused, with how sure that is, 0-1.
+type Suspect struct {
+	Location
+	Confidence float64 `json:"confidence"`
+	Reachable  bool    `json:"reachable"`
+	Reason     string  `json:"reason"`
+}
+
+// How much each kind of evidence counts towards a suspect being unused.
+// Unreachable functions are certain, short of the graph missing a call;
+// a function no test covered is likelier unused than one a profile never
+// sampled, since profiles only catch what runs long enough to be seen.
+const (
+	missedByCoverage = 0.5
+	missedByProfile  = 0.3
+	ranAnyway        = 0.2 // unreachable, yet covered or sampled
+)
+
+// LikelyUnused combines DeadCode with ev. Functions the rootPatterns
+// can't reach are suspects with confidence 1, or ranAnyway if ev shows
+// them running, which means the graph missed their callers. Reachable
+// functions become suspects when ev has data on them and none of it saw
+// them run; each source that missed them adds to the confidence. As in
+// DeadCode, generated and standard library functions are never suspects. The most likely
+// unused come first.
+func LikelyUnused(graph map[string]callgraph.FunctionNode, rootPatterns []string, ev Evidence) []Suspect {
+	live := Reachable(graph, MatchRoots(graph, rootPatterns))
+	out := []Suspect{}
+	for name, node := range graph {
+		if node.Generated != "" || callgraph.IsStdlib(node.Package) {
+			continue
+		}
+		covered, hasCoverage := ev.Covered[name]
+		sampled := ev.Sampled[name]
+		ran := covered || sampled
+		s := Suspect{Location: LocationOf(graph, name), Reachable: live[name]}
+		switch {
+		case !live[name] && ran:
+			s.Confidence, s.Reason = ranAnyway, "unreachable, but "+ranBy(covered, sampled)
+		case !live[name]:
+			s.Confidence, s.Reason = 1, "unreachable"
+		case ran:
+			continue
+		default:
+			notRun := 1.0
+			var missed []string
+			if hasCoverage {
+				notRun *= 1 - missedByCoverage
+				missed = append(missed, "covered")
+			}
+			if ev.Sampled != nil {
+				notRun *= 1 - missedByProfile
+				missed = append(missed, "sampled")
+			}
+			if len(missed) == 0 {
+				continue
+			}
+			s.Confidence = 1 - notRun
+			s.Reason = "never " + missed[0]
+			if len(missed) > 1 {
+				s.Reason += " or " + missed[1]
+			}
+		}
+		out = append(out, s)
+	}
+	SortSuspects(out)
+	return out
+}
+
+func ranBy(covered, sampled bool) string {
+	switch {
+	case covered && sampled:
+		return "covered and sampled"
+	case covered:
+		return "covered"
+	}
+	return "sampled"
+}
+
+// SortSuspects orders suspects by confidence, highest first, then by
+// location.
+func SortSuspects(s []Suspect) {
+	sort.Slice(s, func(i, j int) bool {
+		a, b := s[i], s[j]
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,84 @@
+// Package buildinfo reports which geeparse binary is running: its version,
+// the commit it was built from and when. Release builds set them with
+//
+//	-ldflags "-X github.com/ishanmadhav/geeparse/pkg/buildinfo.version=v1.2.3
+//	          -X github.com/ishanmadhav/geeparse/pkg/buildinfo.commit=$(git rev-parse HEAD)
+//	          -X github.com/ishanmadhav/geeparse/pkg/buildinfo.date=$(date -u +%FT%TZ)"
+//
+// and anything left unset is filled in from the module and VCS stamps the
+// Go toolchain embeds, so go install and plain go build report something
+// useful too.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Set by the linker; see the package comment.
+var version, commit, date string
+
+// Info describes the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a dirty tree
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the running binary's build information.
+var Get = sync.OnceValue(func() Info {
+	info := Info{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+})
+
+// Version is Get().Version.
+func Version() string {
+	return Get().Version
+}
+
+// String formats info on one line, e.g.
+// "v1.2.3 (commit 0123456789ab, built 2025-01-02T03:04:05Z, go1.24.4)".
+func (info Info) String() string {
+	var details []string
+	if info.Commit != "" {
+		c := info.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if info.Modified {
+			c += "+dirty"
+		}
+		details = append(details, "commit "+c)
+	}
+	if info.Date != "" {
+		details = append(details, "built "+info.Date)
+	}
+	details = append(details, info.GoVersion)
+	return info.Version + " (" + strings.Join(details, ", ") + ")"
+}
@@ -0,0 +1,232 @@
+package callgraph
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Arg is one argument of a call, as FunctionNode.Args records it: the
+// static type of the parameter it is passed to and of the value passed,
+// written with package names ("context.Context", "*persistence.Store").
+// Untyped constants have their default type and nil is ArgNil. What
+// didn't type-check, say for a dependency missing from the module cache,
+// is ArgUnknown.
+type Arg struct {
+	Param string `json:"param"`
+	Type  string `json:"type"`
+}
+
+// Types of Arg for nil and for what didn't type-check.
+const (
+	ArgNil     = "nil"
+	ArgUnknown = "?"
+)
+
+// addCallArgs records the arguments of graph's calls, as callArgs finds
+// them in files. caller names the graph's function for a declaration, if
+// it has one, and callee the function a call of a bare name is to.
+func addCallArgs(graph map[string]FunctionNode, files []*ast.File, fset *token.FileSet,
+	caller func(*ast.FuncDecl) (string, bool), callee func(string) string) {
+
+	for name, calls := range callArgs(files, fset, caller) {
+		node := graph[name]
+		args := make(map[string][][]Arg, len(calls))
+		for c, sites := range calls {
+			if target := callee(c); slices.Contains(node.Callees, target) {
+				args[target] = sites
+			}
+		}
+		if len(args) > 0 {
+			node.Args = args
+			graph[name] = node
+		}
+	}
+}
+
+// callArgs type-checks each package of files with go/types, importing
+// the others among files from them and the rest from source, with the
+// go command in the working directory, and returns, by caller and then
+// callee name, the arguments
+// of every call whose arguments are different from those of the calls
+// before it. Like callKinds it goes by name: calls through an interface
+// or a function value count for the method or function of that name, and
+// calls inside function literals for the function around them. Type
+// errors are tolerated, leaving what they touch ArgUnknown.
+func callArgs(files []*ast.File, fset *token.FileSet, caller func(*ast.FuncDecl) (string, bool)) map[string]map[string][][]Arg {
+	imp := &argImporter{
+		fset:    fset,
+		files:   make(map[string][]*ast.File),
+		paths:   make(map[string]string),
+		checked: make(map[string]*checkedPackage),
+		source:  importer.ForCompiler(fset, "source", nil).(types.ImporterFrom),
+	}
+	// a package is a directory and a package name, _test packages apart
+	var order []string
+	mods := make(map[string]string)
+	for _, f := range files {
+		dir := filepath.Dir(fset.Position(f.Package).Filename)
+		key := dir + "\x00" + f.Name.Name
+		if imp.files[key] == nil {
+			order = append(order, key)
+			if p := importPathOf(dir, mods); p != "" && !strings.HasSuffix(f.Name.Name, "_test") {
+				imp.paths[p] = key
+			}
+		}
+		imp.files[key] = append(imp.files[key], f)
+	}
+
+	out := make(map[string]map[string][][]Arg)
+	for _, key := range order {
+		info := imp.check(key).info
+		for _, f := range imp.files[key] {
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Body == nil {
+					continue
+				}
+				name, ok := caller(fn)
+				if !ok {
+					continue
+				}
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					c := calleeName(call.Fun)
+					if c == "" {
+						return true
+					}
+					if tv, ok := info.Types[call.Fun]; ok && (tv.IsType() || tv.IsBuiltin()) {
+						return true // a conversion or len(x), not a call of c
+					}
+					args := argsOf(call, info)
+					if out[name] == nil {
+						out[name] = make(map[string][][]Arg)
+					}
+					if !slices.ContainsFunc(out[name][c], func(seen []Arg) bool { return slices.Equal(seen, args) }) {
+						out[name][c] = append(out[name][c], args)
+					}
+					return true
+				})
+			}
+		}
+	}
+	return out
+}
+
+// argImporter type-checks the packages of callArgs, importing those among
+// them from their syntax and the others through source.
+type argImporter struct {
+	fset    *token.FileSet
+	files   map[string][]*ast.File // by package key
+	paths   map[string]string      // package key by import path
+	checked map[string]*checkedPackage
+	source  types.ImporterFrom
+}
+
+type checkedPackage struct {
+	pkg  *types.Package
+	info *types.Info
+}
+
+// check type-checks the package key names, once.
+func (imp *argImporter) check(key string) *checkedPackage {
+	if c, ok := imp.checked[key]; ok {
+		return c
+	}
+	c := &checkedPackage{info: &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}}
+	imp.checked[key] = c // an import cycle finds it unfinished
+	conf := types.Config{Importer: imp, Error: func(error) {}}
+	c.pkg, _ = conf.Check(strings.Split(key, "\x00")[1], imp.fset, imp.files[key], c.info)
+	return c
+}
+
+func (imp *argImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, "", 0)
+}
+
+func (imp *argImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if key, ok := imp.paths[path]; ok {
+		if c := imp.check(key); c.pkg != nil {
+			return c.pkg, nil
+		}
+		return nil, fmt.Errorf("import cycle through %s", path)
+	}
+	return imp.source.ImportFrom(path, dir, mode)
+}
+
+// importPathOf returns the import path of the package in dir, from the
+// nearest go.mod above it, or "" outside every module. mods caches the
+// module path of each directory looked at.
+func importPathOf(dir string, mods map[string]string) string {
+	for d := dir; ; {
+		modPath, ok := mods[d]
+		if !ok {
+			modPath, _ = modulePath(filepath.Join(d, "go.mod"))
+			mods[d] = modPath
+		}
+		if modPath != "" {
+			rel, err := filepath.Rel(d, dir)
+			if err != nil {
+				return ""
+			}
+			return path.Join(modPath, filepath.ToSlash(rel))
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return ""
+		}
+		d = parent
+	}
+}
+
+// argsOf types the arguments of call.
+func argsOf(call *ast.CallExpr, info *types.Info) []Arg {
+	var params *types.Tuple
+	variadic := false
+	if tv, ok := info.Types[call.Fun]; ok && tv.Type != nil {
+		if sig, ok := tv.Type.Underlying().(*types.Signature); ok {
+			params, variadic = sig.Params(), sig.Variadic()
+		}
+	}
+	args := make([]Arg, len(call.Args))
+	for i, a := range call.Args {
+		args[i] = Arg{Param: ArgUnknown, Type: ArgUnknown}
+		switch tv, ok := info.Types[a]; {
+		case ok && tv.IsNil():
+			args[i].Type = ArgNil
+		case ok && tv.Type != nil && tv.Type != types.Typ[types.Invalid]:
+			args[i].Type = typeString(types.Default(tv.Type))
+		}
+		if params == nil {
+			continue
+		}
+		n := params.Len()
+		switch {
+		case variadic && i >= n-1:
+			last := params.At(n - 1).Type()
+			if s, ok := last.(*types.Slice); ok && !call.Ellipsis.IsValid() {
+				last = s.Elem()
+			}
+			args[i].Param = typeString(last)
+		case i < n:
+			args[i].Param = typeString(params.At(i).Type())
+		}
+	}
+	return args
+}
+
+func typeString(t types.Type) string {
+	if t == types.Typ[types.Invalid] {
+		return ArgUnknown
+	}
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
@@ -0,0 +1,352 @@
+package callgraph
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/lspclient"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Builder keeps one gopls session open across builds, so that after the
+// first full Build, Rebuild only re-queries the files that changed. gopls
+// reads files from disk itself: a Rebuild just tells it which changed, as
+// watch mode's edits are saved to disk. Only Options.Overlay contents,
+// which differ from disk and stay the same for the Builder's life, are
+// sent as open documents. Watch mode uses it; one-off builds go through
+// BuildCallGraph.
+// With the lsif backend there is no session and every build re-reads the
+// index.
+type Builder struct {
+	rootDir  string
+	opts     Options
+	client   *lspclient.Client // nil with the lsif backend
+	versions map[string]int32  // open overlay documents by absolute path
+	graph    map[string]FunctionNode
+	initTime time.Duration // gopls startup, charged to the first build
+	restarts int           // gopls restarts charged to earlier builds
+	report   BuildReport
+	std      map[string]FunctionNode // with Options.Stdlib, once loaded
+}
+
+// NewBuilder starts a gopls session rooted at rootDir.
+func NewBuilder(rootDir string, opts Options) (*Builder, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.backend() == "lsif" {
+		return &Builder{rootDir: rootDir, opts: opts, versions: make(map[string]int32)}, nil
+	}
+	start := time.Now()
+	client, err := lspclient.New(rootDir, opts.logger(), opts.Gopls)
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{
+		rootDir:  rootDir,
+		opts:     opts,
+		client:   client,
+		versions: make(map[string]int32),
+		initTime: time.Since(start),
+	}, nil
+}
+
+// Report describes the most recent Build or Rebuild.
+func (b *Builder) Report() BuildReport {
+	return b.report
+}
+
+// Close shuts down the gopls session.
+func (b *Builder) Close() {
+	if b.client != nil {
+		b.client.Close()
+	}
+}
+
+// Build analyzes every .go file under the root.
+func (b *Builder) Build(ctx context.Context) (map[string]FunctionNode, error) {
+	return b.build(ctx, nil)
+}
+
+// Rebuild re-analyzes after the given files were created, modified or
+// deleted. Functions in other files keep their previous callees, minus
+// calls to functions that no longer exist. A sampled build samples again
+// from scratch, since a change anywhere can move what the budget reaches.
+func (b *Builder) Rebuild(ctx context.Context, changed []string) (map[string]FunctionNode, error) {
+	if b.graph == nil || b.opts.Sample > 0 {
+		return b.Build(ctx)
+	}
+	set := make(map[string]bool, len(changed))
+	for _, path := range changed {
+		set[absPath(path)] = true
+	}
+	return b.build(ctx, set)
+}
+
+// build runs the pipeline; a nil changed set means everything changed.
+// Each phase is traced as a child span of the build.
+func (b *Builder) build(ctx context.Context, changed map[string]bool) (_ map[string]FunctionNode, err error) {
+	ctx, span := telemetry.Start(ctx, "callgraph.build",
+		attribute.String("root", b.rootDir),
+		attribute.String("backend", b.opts.backend()),
+		attribute.Bool("incremental", changed != nil))
+	defer func() { telemetry.End(span, err) }()
+	report := &b.report
+	prevIncomplete := report.Incomplete
+	*report = BuildReport{Timings: Timings{Init: b.initTime}}
+	b.initTime = 0
+
+	// 1. Parse files & collect your function names
+	_, parseSpan := telemetry.Start(ctx, "callgraph.parse")
+	start := time.Now()
+	names, files, fset, generated, err := parseGoFiles(b.rootDir, b.opts, report)
+	report.Timings.Parse = time.Since(start)
+	report.Files = len(files)
+	parseSpan.SetAttributes(attribute.Int("files", len(files)), attribute.Int("functions", len(names)))
+	telemetry.End(parseSpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Extract AST-based signature & definition for each
+	start = time.Now()
+	details := extractDetails(b.rootDir, files, fset, generated, b.opts, report)
+	report.Timings.Details = time.Since(start)
+
+	if b.client == nil {
+		_, lsifSpan := telemetry.Start(ctx, "callgraph.lsif", attribute.String("index", b.opts.Index))
+		start = time.Now()
+		rawGraph, err := extractGraphLSIF(b.opts.Index, details)
+		report.Timings.Index = time.Since(start)
+		telemetry.End(lsifSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		report.Queried = len(files)
+		refs := valueReferences(files, files, fset, names)
+		graph := b.assemble(details, names, rawGraph, ViaLSIF, refs, callKinds(files), cgoCalls(files), nil)
+		b.withArgs(graph, files, fset)
+		return b.withStdlib(ctx, graph, files, fset)
+	}
+
+	// 3. Bring gopls up to date and pick the files to query
+	_, syncSpan := telemetry.Start(ctx, "callgraph.sync")
+	start = time.Now()
+	var query []*ast.File
+	requeried := make(map[string]bool)
+	var fromDisk []string
+	for _, f := range files {
+		filename := absPath(fset.Position(f.Package).Filename)
+		if changed != nil && !changed[filename] {
+			continue
+		}
+		if src, ok := b.opts.overlay(filename); ok {
+			if err := b.openOverlay(filename, src); err != nil {
+				telemetry.End(syncSpan, err)
+				return nil, err
+			}
+		} else if b.graph != nil {
+			// gopls read the files when it started; since then only the
+			// ones it's told about
+			fromDisk = append(fromDisk, filename)
+		}
+		query = append(query, f)
+		requeried[filename] = true
+	}
+	var deleted []string
+	for path := range changed {
+		if requeried[path] {
+			continue
+		}
+		// excluded, oversized and broken files are still there
+		if _, err := os.Stat(path); err == nil {
+			fromDisk = append(fromDisk, path)
+		} else {
+			deleted = append(deleted, path)
+		}
+	}
+	if err := b.client.FilesChanged(fromDisk, deleted); err != nil {
+		telemetry.End(syncSpan, err)
+		return nil, err
+	}
+	report.Timings.Sync = time.Since(start)
+	report.Queried = len(query)
+	syncSpan.SetAttributes(attribute.Int("files", len(query)))
+	syncSpan.End()
+
+	// 4. Compute only internal call-graph edges via LSP, for every
+	// function or, sampling, those nearest the entrypoints
+	var rawGraph map[string][]string
+	if b.opts.Sample > 0 {
+		var reached map[string]struct{}
+		rawGraph, reached, report.Unexplored, err = sampleCalls(ctx, b.client, query, fset, names,
+			b.opts.sampleRoots(), b.opts.Sample, b.opts.logger(), report)
+		names, details = reached, sampledDetails(details, reached)
+	} else {
+		rawGraph, err = extractGraphLSP(ctx, b.client, query, fset, names, b.opts.logger(), report)
+	}
+	if restarts := b.client.Restarts(); restarts > b.restarts {
+		report.GoplsRestarts, b.restarts = restarts-b.restarts, restarts
+	}
+	if err == nil {
+		err = b.client.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// functions of files not queried again keep their calls, and so
+	// whatever was missing from them
+	for name, fs := range prevIncomplete {
+		if _, ok := names[name]; !ok {
+			continue
+		}
+		for _, f := range fs {
+			if !requeried[f.File] {
+				report.addFailure(name, f)
+			}
+		}
+	}
+
+	// 5. Add best-effort edges for functions referenced without a call
+	refs := valueReferences(files, query, fset, names)
+
+	graph := b.assemble(details, names, rawGraph, ViaCallHierarchy, refs, callKinds(query), cgoCalls(query), requeried)
+	b.withArgs(graph, files, fset)
+	return b.withStdlib(ctx, graph, files, fset)
+}
+
+// withArgs records the arguments of graph's calls with
+// Options.ArgTypes. Every file is type-checked again: a package's types
+// depend on all of its files.
+func (b *Builder) withArgs(graph map[string]FunctionNode, files []*ast.File, fset *token.FileSet) {
+	if !b.opts.ArgTypes {
+		return
+	}
+	start := time.Now()
+	addCallArgs(graph, files, fset, declaredIn(graph, fset, ""), func(c string) string { return c })
+	b.report.Timings.Types += time.Since(start)
+}
+
+// withStdlib adds the standard library overlay to graph with
+// Options.Stdlib. Every file is scanned again, since the functions of
+// those not requeried kept only their calls to functions of the tree.
+func (b *Builder) withStdlib(ctx context.Context, graph map[string]FunctionNode, files []*ast.File, fset *token.FileSet) (map[string]FunctionNode, error) {
+	if !b.opts.Stdlib {
+		return graph, nil
+	}
+	if b.std == nil {
+		std, err := LoadStdlib(ctx, b.opts.logger())
+		if err != nil {
+			return nil, err
+		}
+		b.std = std
+	}
+	b.report.Stdlib = addStdlibCalls(graph, b.std, files, declaredIn(graph, fset, ""), b.opts)
+	return graph, nil
+}
+
+// declaredIn names the function of graph a declaration of fset is, as
+// prefix and its name, if it's the one of that name in graph.
+func declaredIn(graph map[string]FunctionNode, fset *token.FileSet, prefix string) func(*ast.FuncDecl) (string, bool) {
+	return func(fn *ast.FuncDecl) (string, bool) {
+		name := prefix + fn.Name.Name
+		node, ok := graph[name]
+		return name, ok && node.File == absPath(fset.Position(fn.Pos()).Filename)
+	}
+}
+
+// assemble builds the final graph from the parsed details and the calls
+// found via kind in requeried files (all files when requeried is nil),
+// with their kinds from kindsOf (see callKinds), plus the value
+// references in refs that aren't also calls and the cgo calls in foreign;
+// functions in other files keep their previous callees that still exist.
+func (b *Builder) assemble(details map[string]funcDetail, names map[string]struct{}, rawGraph map[string][]string, kind string, refs map[string][]string, kindsOf map[string]map[string]string, foreign map[string][]string, requeried map[string]bool) map[string]FunctionNode {
+	out := make(map[string]FunctionNode, len(details))
+	for name, det := range details {
+		var callees []string
+		var via, kinds map[string]string
+		var calls []string
+		if requeried == nil || requeried[det.File] {
+			callees = rawGraph[name]
+			calls = foreign[name]
+			via = viaAll(callees, kind)
+			for _, c := range callees {
+				if k := kindsOf[name][c]; k != "" {
+					if kinds == nil {
+						kinds = make(map[string]string)
+					}
+					kinds[c] = k
+				}
+			}
+			for _, c := range refs[name] {
+				if _, ok := via[c]; ok {
+					continue
+				}
+				if via == nil {
+					via = make(map[string]string)
+				}
+				if kinds == nil {
+					kinds = make(map[string]string)
+				}
+				callees = append(callees, c)
+				via[c] = ViaAST
+				kinds[c] = KindIndirect
+			}
+		} else {
+			prev := b.graph[name]
+			for _, c := range prev.Callees {
+				if _, ok := names[c]; ok {
+					callees = append(callees, c)
+				}
+			}
+			via, kinds, calls = prev.Via, prev.Kinds, prev.Foreign
+		}
+		if callees == nil {
+			callees = []string{}
+		}
+		out[name] = FunctionNode{
+			Callees:    callees,
+			Signature:  det.Signature,
+			Definition: det.Definition,
+			Package:    det.Package,
+			File:       det.File,
+			Line:       det.Line,
+			EndLine:    det.EndLine,
+			Via:        via,
+			Kinds:      kinds,
+			Generated:  det.Generated,
+			Language:   LanguageGo,
+			Foreign:    calls,
+			Statements: det.Statements,
+			Nesting:    det.Nesting,
+		}
+	}
+	b.graph = out
+	b.report.Functions = len(out)
+	return out
+}
+
+// openOverlay opens path in gopls with the overlay contents src, which
+// stay the same for the Builder's life, unless it's open already.
+func (b *Builder) openOverlay(path string, src []byte) error {
+	if b.versions[path] > 0 {
+		return nil
+	}
+	if err := b.client.OpenDocument(path, src); err != nil {
+		return err
+	}
+	b.versions[path] = 1
+	return nil
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -3,16 +3,25 @@ package callgraph
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/printer"
 	"go/token"
 	"io/fs"
-	"log"
+	"log/slog"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ishanmadhav/geeparse/pkg/lspclient"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
 	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // FunctionNode represents one function in the call graph.
@@ -20,76 +29,131 @@ type FunctionNode struct {
 	Callees    []string `json:"callees"`
 	Signature  string   `json:"signature"`
 	Definition string   `json:"definition"`
+	Package    string   `json:"package"`
+	File       string   `json:"file"`
+	Line       int      `json:"line"`
+	EndLine    int      `json:"endLine"`
+	// Via records how each callee was found, keyed by callee; see
+	// ViaCallHierarchy and the other kinds. Calls missing from it have
+	// unknown provenance.
+	Via map[string]string `json:"via,omitempty"`
+	// Kinds records each call's kind other than KindDirect, keyed by
+	// callee: KindGo, KindDefer and the rest. Use Kind to look one up.
+	Kinds map[string]string `json:"kinds,omitempty"`
+	// Args records the arguments of each call, keyed by callee: for each
+	// call site passing different types, the type of every argument and
+	// of its parameter. Only builds with Options.ArgTypes record them.
+	Args map[string][][]Arg `json:"args,omitempty"`
+	// Generated is the kind of generator that wrote the function's file,
+	// GeneratedProtobuf, GeneratedMock or GeneratedOther, or empty for
+	// handwritten code. Dead-code analysis leaves generated functions out
+	// and views can collapse them; see CollapseGenerated.
+	Generated string `json:"generated,omitempty"`
+	// Language is the source language of the function, LanguageGo for
+	// those geeparse builds, or empty when an ingested graph didn't say.
+	Language string `json:"language,omitempty"`
+	// Foreign lists the function's calls into other languages, as
+	// ForeignCall writes them, whether or not a function they name is
+	// in the graph; LinkLanguages adds those it can find as calls.
+	Foreign []string `json:"foreign,omitempty"`
+	// Statements and Nesting measure the function's body: how many
+	// statements it holds, those of nested blocks and function literals
+	// included, and how deep its blocks nest, 0 for straight-line code.
+	// Functions without Go source to measure have neither.
+	Statements int `json:"statements,omitempty"`
+	Nesting    int `json:"nesting,omitempty"`
 }
 
 // BuildCallGraph walks rootDir, parses your .go files to get signatures/definitions,
 // then uses gopls (via lspclient) to compute only *internal* caller→callee edges.
-func BuildCallGraph(rootDir string) (map[string]FunctionNode, error) {
-	// 1. Parse files & collect your function names
-	names, files, fset, err := parseGoFiles(rootDir)
-	if err != nil {
-		return nil, err
-	}
-
-	// 2. Extract AST-based signature & definition for each
-	details := extractDetails(files, fset)
+func BuildCallGraph(ctx context.Context, rootDir string, opts Options) (map[string]FunctionNode, error) {
+	graph, _, err := BuildCallGraphReport(ctx, rootDir, opts)
+	return graph, err
+}
 
-	// 3. Start a single gopls LSP session
-	client, err := lspclient.New(rootDir)
+// BuildCallGraphReport is BuildCallGraph that also reports how the build
+// went, timings included.
+//
+// A root holding several Go modules, such as a monorepo, is built one
+// module at a time and its functions are namespaced by module path; see
+// buildModules. A Builder always treats its root as one tree.
+func BuildCallGraphReport(ctx context.Context, rootDir string, opts Options) (map[string]FunctionNode, BuildReport, error) {
+	if err := opts.validate(); err != nil {
+		return nil, BuildReport{}, err
+	}
+	mods, err := FindModules(rootDir, opts)
 	if err != nil {
-		return nil, err
+		return nil, BuildReport{}, err
 	}
-	defer client.Close()
-
-	// 4. Open each file in gopls
-	for _, f := range files {
-		filename := fset.Position(f.Package).Filename
-		if err := client.OpenDocument(filename); err != nil {
-			return nil, err
-		}
+	if len(mods) > 1 {
+		return buildModules(ctx, rootDir, mods, opts)
 	}
-
-	// 5. Compute only internal call-graph edges via LSP
-	rawGraph, err := extractGraphLSP(client, files, fset, names)
+	b, err := NewBuilder(rootDir, opts)
 	if err != nil {
-		return nil, err
-	}
-
-	// 6. Assemble final JSON-serializable map
-	out := make(map[string]FunctionNode, len(details))
-	for name, det := range details {
-		callees := rawGraph[name]
-		if callees == nil {
-			callees = []string{}
-		}
-		out[name] = FunctionNode{
-			Callees:    callees,
-			Signature:  det.Signature,
-			Definition: det.Definition,
-		}
+		return nil, BuildReport{}, err
 	}
-	return out, nil
+	defer b.Close()
+	graph, err := b.Build(ctx)
+	return graph, b.Report(), err
 }
 
-// parseGoFiles finds and parses all .go files under rootDir,
-// returns your function-names set, the parsed ASTs, and the FileSet.
-func parseGoFiles(rootDir string) (map[string]struct{}, []*ast.File,
-	*token.FileSet, error) {
+// parseGoFiles finds and parses all .go files under rootDir that opts
+// doesn't exclude, returns your function-names set, the parsed ASTs, and
+// the FileSet, with the kind of generated code (see generatedKind) in each
+// generated file, by absolute path. Files over opts' size limit, or that
+// look binary, are skipped and counted in report. Files in opts.Overlay are
+// parsed from their overlay contents.
+func parseGoFiles(rootDir string, opts Options, report *BuildReport) (map[string]struct{}, []*ast.File,
+	*token.FileSet, map[string]string, error) {
 
 	fset := token.NewFileSet()
 	names := make(map[string]struct{})
 	var files []*ast.File
+	generated := make(map[string]string)
 
 	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, e error) error {
-		if e != nil || d.IsDir() || filepath.Ext(path) != ".go" {
+		if e != nil {
 			return nil
 		}
-		astFile, err := parser.ParseFile(fset, path, nil, 0)
+		if opts.excluded(rootDir, path) || (d.IsDir() && slices.Contains(opts.nested, path)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || filepath.Ext(path) != ".go" {
+			return nil
+		}
+		if max := opts.maxFileSize(); max >= 0 {
+			if info, err := d.Info(); err == nil && info.Size() > int64(max) {
+				opts.logger().Warn("skipping oversized file", "file", path, "size", info.Size(), "limit", max)
+				report.Skipped++
+				return nil
+			}
+		}
+		src, ok := opts.overlay(absPath(path))
+		if !ok {
+			var err error
+			if src, err = os.ReadFile(path); err != nil {
+				opts.logger().Warn("skipping unreadable file", "file", path, "err", err)
+				return nil
+			}
+		}
+		if binary(src) {
+			opts.logger().Warn("skipping binary file", "file", path)
+			report.Skipped++
+			return nil
+		}
+		astFile, err := parser.ParseFile(fset, path, src, 0)
 		if err != nil {
-			log.Printf("parse error %s: %v", path, err)
+			opts.logger().Warn("skipping unparsable file", "file", path, "err", err)
 			return nil
 		}
 		files = append(files, astFile)
+		if kind := generatedKind(path, src); kind != "" {
+			generated[absPath(path)] = kind
+			report.Generated++
+		}
 		for _, decl := range astFile.Decls {
 			if fn, ok := decl.(*ast.FuncDecl); ok {
 				names[fn.Name.Name] = struct{}{}
@@ -97,26 +161,63 @@ func parseGoFiles(rootDir string) (map[string]struct{}, []*ast.File,
 		}
 		return nil
 	})
-	return names, files, fset, err
+	return names, files, fset, generated, err
+}
+
+// binary reports whether src looks like a binary blob rather than Go
+// source: it holds a NUL byte near the start, which Go source can't.
+func binary(src []byte) bool {
+	return bytes.IndexByte(src[:min(len(src), 8000)], 0) >= 0
 }
 
 // extractDetails builds a map[name] giving each func's signature+definition.
 type funcDetail struct {
 	Signature  string
 	Definition string
+	Package    string
+	File       string
+	Line       int
+	EndLine    int
+	Generated  string
+	Statements int
+	Nesting    int
 }
 
-func extractDetails(files []*ast.File, fset *token.FileSet) map[string]funcDetail {
+// Definitions are redacted as opts say; those over its size limit are
+// truncated and counted in report.
+func extractDetails(rootDir string, files []*ast.File, fset *token.FileSet, generated map[string]string, opts Options, report *BuildReport) map[string]funcDetail {
+	max := opts.maxFunctionSize()
 	out := make(map[string]funcDetail, len(files))
 	for _, f := range files {
+		filename := fset.Position(f.Package).Filename
+		pkg := packagePath(rootDir, filename)
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
 		for _, decl := range f.Decls {
 			if fn, ok := decl.(*ast.FuncDecl); ok {
 				var sigBuf, defBuf bytes.Buffer
 				printer.Fprint(&sigBuf, fset, fn.Type)
 				printer.Fprint(&defBuf, fset, fn)
+				def := defBuf.String()
+				if opts.Redact != "" {
+					def = redactDefinition(fn.Name.Name, FunctionNode{Definition: def}, opts.Redact)
+				}
+				if max >= 0 && len(def) > max {
+					def = truncateDefinition(def, max)
+					report.Truncated++
+				}
+				stmts, nesting := bodyMetrics(fn.Body)
 				out[fn.Name.Name] = funcDetail{
 					Signature:  sigBuf.String(),
-					Definition: defBuf.String(),
+					Definition: def,
+					Package:    pkg,
+					File:       filename,
+					Line:       fset.Position(fn.Pos()).Line,
+					EndLine:    fset.Position(fn.End()).Line,
+					Generated:  generated[filename],
+					Statements: stmts,
+					Nesting:    nesting,
 				}
 			}
 		}
@@ -124,15 +225,46 @@ func extractDetails(files []*ast.File, fset *token.FileSet) map[string]funcDetai
 	return out
 }
 
+// truncateDefinition cuts def to at most max bytes, at a line break where
+// there is one, and says how much was left out.
+func truncateDefinition(def string, max int) string {
+	cut := max
+	if i := strings.LastIndexByte(def[:cut], '\n'); i > 0 {
+		cut = i
+	}
+	for cut > 0 && !utf8.RuneStart(def[cut]) {
+		cut--
+	}
+	return def[:cut] + fmt.Sprintf("\n\t// ... %d more bytes not stored by geeparse\n}", len(def)-cut)
+}
+
+// packagePath returns the slash-separated directory of filename relative
+// to rootDir (e.g. "pkg/server"), which is what the UI clusters nodes by.
+func packagePath(rootDir, filename string) string {
+	rel, err := filepath.Rel(rootDir, filepath.Dir(filename))
+	if err != nil {
+		return filepath.ToSlash(filepath.Dir(filename))
+	}
+	return filepath.ToSlash(rel)
+}
+
 // extractGraphLSP uses lspclient to prepare call-hierarchy and then
-// fetch outgoing calls *only* for functions in the `names` set.
+// fetch outgoing calls *only* for functions in the `names` set. Requests
+// that fail leave the function without (some of) its calls and are
+// recorded in report.Incomplete rather than failing the build.
 func extractGraphLSP(
+	ctx context.Context,
 	client *lspclient.Client,
 	files []*ast.File,
 	fset *token.FileSet,
 	names map[string]struct{},
+	logger *slog.Logger,
+	report *BuildReport,
 ) (map[string][]string, error) {
 
+	ctx, span := telemetry.Start(ctx, "callgraph.calls", attribute.Int("files", len(files)))
+	defer span.End()
+
 	graph := make(map[string][]string)
 
 	for _, f := range files {
@@ -141,43 +273,75 @@ func extractGraphLSP(
 			if !ok || fn.Body == nil {
 				continue
 			}
-			caller := fn.Name.Name
-			pos := fset.Position(fn.Name.Pos())
-			protoPos := protocol.Position{
-				Line:      uint32(pos.Line - 1),
-				Character: uint32(pos.Column - 1),
+			if callees := outgoingCalls(ctx, client, fset, fn, names, logger, report); len(callees) > 0 {
+				graph[fn.Name.Name] = callees
 			}
-			file := pos.Filename
+		}
+	}
+	return graph, nil
+}
 
-			items, err := client.PrepareCallHierarchy(file, protoPos)
-			if err != nil {
-				log.Printf("prepare hierarchy %s: %v", caller, err)
-				continue
-			}
-			if len(items) == 0 {
-				continue
-			}
-			root := items[0]
+// outgoingCalls asks gopls for the functions in names that fn calls, in
+// the order it lists them. A failed request is logged and recorded in
+// report.Incomplete, leaving whatever calls were found.
+func outgoingCalls(
+	ctx context.Context,
+	client *lspclient.Client,
+	fset *token.FileSet,
+	fn *ast.FuncDecl,
+	names map[string]struct{},
+	logger *slog.Logger,
+	report *BuildReport,
+) []string {
+	caller := fn.Name.Name
+	pos := fset.Position(fn.Name.Pos())
+	protoPos := protocol.Position{
+		Line:      uint32(pos.Line - 1),
+		Character: uint32(pos.Column - 1),
+	}
+	file := pos.Filename
+	failed := func(request string, err error) {
+		report.addFailure(caller, Failure{File: absPath(file), Line: pos.Line, Request: request, Error: err.Error()})
+	}
 
-			outgoing, err := client.OutgoingCalls(root)
-			if err != nil {
-				log.Printf("outgoing calls %s: %v", caller, err)
-				continue
-			}
+	_, lspSpan := telemetry.Start(ctx, "lsp.prepareCallHierarchy", attribute.String("function", caller))
+	start := time.Now()
+	items, err := client.PrepareCallHierarchy(file, protoPos)
+	report.Timings.Prepare += time.Since(start)
+	telemetry.End(lspSpan, err)
+	if err != nil {
+		logger.Warn("prepare call hierarchy failed", "function", caller, "err", err)
+		failed("textDocument/prepareCallHierarchy", err)
+		return nil
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	root := items[0]
 
-			seen := make(map[string]struct{})
-			for _, call := range outgoing {
-				callee := call.To.Name
-				// ONLY record if it's one of your own funcs
-				if _, ok := names[callee]; !ok {
-					continue
-				}
-				if _, dup := seen[callee]; !dup {
-					graph[caller] = append(graph[caller], callee)
-					seen[callee] = struct{}{}
-				}
-			}
+	_, lspSpan = telemetry.Start(ctx, "lsp.outgoingCalls", attribute.String("function", caller))
+	start = time.Now()
+	outgoing, err := client.OutgoingCalls(root)
+	report.Timings.Outgoing += time.Since(start)
+	telemetry.End(lspSpan, err)
+	if err != nil {
+		logger.Warn("outgoing calls failed", "function", caller, "err", err)
+		failed("callHierarchy/outgoingCalls", err)
+		return nil
+	}
+
+	var callees []string
+	seen := make(map[string]struct{})
+	for _, call := range outgoing {
+		callee := call.To.Name
+		// ONLY record if it's one of your own funcs
+		if _, ok := names[callee]; !ok {
+			continue
+		}
+		if _, dup := seen[callee]; !dup {
+			callees = append(callees, callee)
+			seen[callee] = struct{}{}
 		}
 	}
-	return graph, nil
+	return callees
 }
@@ -0,0 +1,81 @@
+package callgraph
+
+import "strings"
+
+// Subgraph returns the functions reachable from root (root included),
+// following at most maxDepth calls when maxDepth > 0, with only the edges
+// between them. It returns nil if root isn't in graph.
+func Subgraph(graph map[string]FunctionNode, root string, maxDepth int) map[string]FunctionNode {
+	if _, ok := graph[root]; !ok {
+		return nil
+	}
+	depth := map[string]int{root: 0}
+	queue := []string{root}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if maxDepth > 0 && depth[name] >= maxDepth {
+			continue
+		}
+		for _, c := range graph[name].Callees {
+			if _, seen := depth[c]; seen {
+				continue
+			}
+			if _, ok := graph[c]; !ok {
+				continue
+			}
+			depth[c] = depth[name] + 1
+			queue = append(queue, c)
+		}
+	}
+	return induced(graph, func(name string) bool { _, ok := depth[name]; return ok })
+}
+
+// FilterPackages keeps the functions whose package is one of pkgs or nested
+// below one of them ("pkg" matches "pkg/server"), and the edges between
+// them. An empty pkgs keeps everything.
+func FilterPackages(graph map[string]FunctionNode, pkgs []string) map[string]FunctionNode {
+	if len(pkgs) == 0 {
+		return graph
+	}
+	return induced(graph, func(name string) bool {
+		return InPackages(graph[name].Package, pkgs)
+	})
+}
+
+// InPackages reports whether pkg is one of pkgs or nested below one of them.
+func InPackages(pkg string, pkgs []string) bool {
+	for _, p := range pkgs {
+		p = strings.TrimSuffix(p, "/")
+		if pkg == p || strings.HasPrefix(pkg, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterFunctions keeps only the functions for which keep is true, and
+// the calls between them.
+func FilterFunctions(graph map[string]FunctionNode, keep func(name string) bool) map[string]FunctionNode {
+	return induced(graph, keep)
+}
+
+// induced returns the functions for which keep is true and the edges
+// between them.
+func induced(graph map[string]FunctionNode, keep func(string) bool) map[string]FunctionNode {
+	out := make(map[string]FunctionNode)
+	for name, node := range graph {
+		if !keep(name) {
+			continue
+		}
+		callees := []string{}
+		for _, c := range node.Callees {
+			if _, ok := graph[c]; ok && keep(c) {
+				callees = append(callees, c)
+			}
+		}
+		node.Callees = callees
+		out[name] = node
+	}
+	return out
+}
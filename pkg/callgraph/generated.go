@@ -0,0 +1,166 @@
+package callgraph
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Kinds of generated code, as recorded in FunctionNode.Generated.
+const (
+	// GeneratedProtobuf is code from protoc plugins: protoc-gen-go,
+	// protoc-gen-go-grpc and the like.
+	GeneratedProtobuf = "protobuf"
+	// GeneratedMock is code from mock generators such as mockgen,
+	// mockery and moq.
+	GeneratedMock = "mock"
+	// GeneratedOther is code from any other generator, such as stringer.
+	GeneratedOther = "other"
+)
+
+// generatedKind classifies the Go source src by its "// Code generated
+// ... DO NOT EDIT." header (https://go.dev/s/generatedcode), returning ""
+// for handwritten code.
+func generatedKind(filename string, src []byte) string {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil || !ast.IsGenerated(f) {
+		return ""
+	}
+	var header string
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") {
+				header = strings.ToLower(c.Text)
+			}
+		}
+	}
+	switch {
+	case strings.Contains(header, "protoc"):
+		return GeneratedProtobuf
+	case strings.Contains(header, "mock") || strings.Contains(header, "moq"):
+		return GeneratedMock
+	}
+	return GeneratedOther
+}
+
+// WithoutGenerated returns graph without its generated functions and the
+// calls to them.
+func WithoutGenerated(graph map[string]FunctionNode) map[string]FunctionNode {
+	return induced(graph, func(name string) bool { return graph[name].Generated == "" })
+}
+
+// GeneratedProxy names the node CollapseGenerated stands in for the
+// generated functions of one kind in pkg, e.g. "protobuf:api/v1".
+func GeneratedProxy(kind, pkg string) string {
+	return kind + ":" + pkg
+}
+
+// CollapseGenerated replaces the generated functions of each kind in each
+// package with a single proxy node named by GeneratedProxy, which makes
+// all their calls and takes all their callers, so views of code leaning on
+// protobuf messages or mocks aren't swamped by them. Calls among the
+// collapsed functions disappear. Graphs without generated code are
+// returned as they are.
+func CollapseGenerated(graph map[string]FunctionNode) map[string]FunctionNode {
+	proxyOf := make(map[string]string)
+	members := make(map[string][]string)
+	for name, node := range graph {
+		if node.Generated != "" {
+			p := GeneratedProxy(node.Generated, node.Package)
+			proxyOf[name] = p
+			members[p] = append(members[p], name)
+		}
+	}
+	if len(proxyOf) == 0 {
+		return graph
+	}
+	rename := func(name string) string {
+		if p, ok := proxyOf[name]; ok {
+			return p
+		}
+		return name
+	}
+	// redirect calls; a proxy's calls are its members' calls, in order
+	redirect := func(node FunctionNode, self string, callees []string, via, kinds map[string]string, args map[string][][]Arg) []string {
+		for _, c := range node.Callees {
+			target := rename(c)
+			if target == self {
+				continue
+			}
+			if _, seen := via[target]; seen {
+				continue
+			}
+			via[target], kinds[target] = node.Via[c], node.Kinds[c]
+			if a, ok := node.Args[c]; ok {
+				args[target] = a
+			}
+			callees = append(callees, target)
+		}
+		return callees
+	}
+
+	out := make(map[string]FunctionNode, len(graph)-len(proxyOf)+len(members))
+	for name, node := range graph {
+		if _, ok := proxyOf[name]; ok {
+			continue
+		}
+		via, kinds, args := make(map[string]string), make(map[string]string), make(map[string][][]Arg)
+		node.Callees = redirect(node, name, []string{}, via, kinds, args)
+		node.Via, node.Kinds, node.Args = compactEdges(via), compactEdges(kinds), compactArgs(args)
+		out[name] = node
+	}
+	for p, names := range members {
+		sort.Strings(names)
+		first := graph[names[0]]
+		callees, via, kinds, args := []string{}, make(map[string]string), make(map[string]string), make(map[string][][]Arg)
+		for _, name := range names {
+			callees = redirect(graph[name], p, callees, via, kinds, args)
+		}
+		out[p] = FunctionNode{
+			Callees:    callees,
+			Definition: collapsedDefinition(len(names)),
+			Package:    first.Package,
+			File:       first.File,
+			Generated:  first.Generated,
+			Language:   first.Language,
+			Via:        compactEdges(via),
+			Kinds:      compactEdges(kinds),
+			Args:       compactArgs(args),
+		}
+	}
+	return out
+}
+
+// collapsedDefinition is the stand-in definition of a proxy for n
+// functions.
+func collapsedDefinition(n int) string {
+	if n == 1 {
+		return "// 1 generated function collapsed by geeparse"
+	}
+	return fmt.Sprintf("// %d generated functions collapsed by geeparse", n)
+}
+
+// compactArgs is compactEdges for Args, whose entries are never empty.
+func compactArgs(m map[string][][]Arg) map[string][][]Arg {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// compactEdges drops the empty entries of a per-callee map such as Via,
+// leaving nil when none is left.
+func compactEdges(m map[string]string) map[string]string {
+	for c, v := range m {
+		if v == "" {
+			delete(m, c)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,45 @@
+package callgraph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// DefaultIDLength is how many hex digits IDs keep by default: 40 bits,
+// which leaves a collision unlikely until a graph has about a million
+// functions.
+const DefaultIDLength = 10
+
+// ID returns the stable short ID of the function name in graph: the first
+// length hex digits (DefaultIDLength for 0, at most 64) of the SHA-256 of
+// its qualified name, package and name. Unlike a position it survives
+// edits and moves within the package, so it suits permalinks; it changes
+// when the function is renamed or moves to another package.
+func ID(graph map[string]FunctionNode, name string, length int) string {
+	sum := sha256.Sum256([]byte(graph[name].Package + "." + name))
+	digits := hex.EncodeToString(sum[:])
+	if length <= 0 {
+		length = DefaultIDLength
+	}
+	return digits[:min(length, len(digits))]
+}
+
+// IDs maps the ID of every function of graph to its name. Should two IDs
+// collide, the function whose name sorts first keeps it and the other
+// can't be looked up by ID; a longer length fixes that.
+func IDs(graph map[string]FunctionNode, length int) map[string]string {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make(map[string]string, len(graph))
+	for _, name := range names {
+		id := ID(graph, name, length)
+		if _, taken := out[id]; !taken {
+			out[id] = name
+		}
+	}
+	return out
+}
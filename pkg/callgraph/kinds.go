@@ -0,0 +1,160 @@
+package callgraph
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// Kinds of call, as recorded in FunctionNode.Kinds. Where Via says how a
+// call was found, its kind says how it happens at run time.
+const (
+	// KindDirect is an ordinary call, finished before the caller goes on.
+	KindDirect = "direct"
+	// KindDefer is a deferred call, made as the caller returns.
+	KindDefer = "defer"
+	// KindGo is a call starting a goroutine.
+	KindGo = "go"
+	// KindDynamic is a call through an interface or function value,
+	// resolved at run time; calls expanded ViaImplementation are dynamic.
+	KindDynamic = "dynamic"
+	// KindIndirect is a reference to the function as a value, handed on
+	// for someone else to call, as valueReferences finds them.
+	KindIndirect = "indirect"
+)
+
+// CallKinds lists the known kinds of call.
+var CallKinds = []string{KindDirect, KindDefer, KindGo, KindDynamic, KindIndirect}
+
+// Kind returns the kind of n's call of callee: its entry in Kinds,
+// KindDynamic for calls expanded ViaImplementation, and KindDirect
+// otherwise.
+func (n FunctionNode) Kind(callee string) string {
+	if kind := n.Kinds[callee]; kind != "" {
+		return kind
+	}
+	if n.Via[callee] == ViaImplementation {
+		return KindDynamic
+	}
+	return KindDirect
+}
+
+// ParseKinds splits comma-separated lists of call kinds, as the kinds
+// query parameter and --kinds flag take them, and checks each is known.
+func ParseKinds(lists ...string) ([]string, error) {
+	var kinds []string
+	for _, list := range lists {
+		for _, k := range strings.Split(list, ",") {
+			k = strings.TrimSpace(k)
+			if k == "" {
+				continue
+			}
+			if !knownKind(k) {
+				return nil, fmt.Errorf("unknown call kind %q (want %s)", k, strings.Join(CallKinds, ", "))
+			}
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds, nil
+}
+
+func knownKind(kind string) bool {
+	for _, k := range CallKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterKinds returns graph with only its calls of the given kinds, say
+// KindGo alone for the structure of goroutine spawns. Every function
+// stays. No kinds keeps every call.
+func FilterKinds(graph map[string]FunctionNode, kinds []string) map[string]FunctionNode {
+	if len(kinds) == 0 {
+		return graph
+	}
+	keep := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		keep[k] = true
+	}
+	out := make(map[string]FunctionNode, len(graph))
+	for name, node := range graph {
+		callees := []string{}
+		for _, c := range node.Callees {
+			if keep[node.Kind(c)] {
+				callees = append(callees, c)
+			}
+		}
+		node.Callees = callees
+		out[name] = node
+	}
+	return out
+}
+
+// callKinds finds, in the functions of files, the calls made by go and
+// defer statements, keyed by caller and then callee name. Calls inside a
+// function literal a go or defer statement runs share its kind, since
+// they run in the goroutine or as the caller returns; the statement's
+// arguments are evaluated on the spot and don't. Like valueReferences it
+// goes by name, without type information. Functions both called and
+// spawned or deferred count as the rarer kind: go, then defer.
+func callKinds(files []*ast.File) map[string]map[string]string {
+	out := make(map[string]map[string]string)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller := fn.Name.Name
+			mark := func(call *ast.CallExpr, kind string) {
+				record := func(fun ast.Expr) {
+					name := calleeName(fun)
+					if name == "" {
+						return
+					}
+					if out[caller] == nil {
+						out[caller] = make(map[string]string)
+					}
+					if out[caller][name] != KindGo {
+						out[caller][name] = kind
+					}
+				}
+				lit, ok := callee(call.Fun).(*ast.FuncLit)
+				if !ok {
+					record(call.Fun)
+					return
+				}
+				ast.Inspect(lit.Body, func(n ast.Node) bool {
+					if c, ok := n.(*ast.CallExpr); ok {
+						record(c.Fun)
+					}
+					return true
+				})
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.GoStmt:
+					mark(n.Call, KindGo)
+				case *ast.DeferStmt:
+					mark(n.Call, KindDefer)
+				}
+				return true
+			})
+		}
+	}
+	return out
+}
+
+// calleeName returns the name of the function a call's function
+// expression names, or "" for anything else.
+func calleeName(fun ast.Expr) string {
+	switch fun := callee(fun).(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package callgraph
+
+import (
+	"go/ast"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguageGo is the Language of the functions geeparse builds from Go
+// source; ingested graphs name their own, such as "python" or "c".
+const LanguageGo = "go"
+
+// LanguageC is the language cgo calls go into.
+const LanguageC = "c"
+
+// ForeignCall names a call into a function of another language, as
+// FunctionNode.Foreign records it: language:symbol, "c:sqlite3_open" for
+// the cgo call C.sqlite3_open.
+func ForeignCall(language, symbol string) string {
+	return language + ":" + symbol
+}
+
+// SplitForeign splits a ForeignCall into its language and symbol.
+func SplitForeign(call string) (language, symbol string, ok bool) {
+	language, symbol, ok = strings.Cut(call, ":")
+	return language, symbol, ok && language != "" && symbol != ""
+}
+
+// Languages counts graph's functions per language; functions of no
+// known language count under "".
+func Languages(graph map[string]FunctionNode) map[string]int {
+	out := make(map[string]int)
+	for _, node := range graph {
+		out[node.Language]++
+	}
+	return out
+}
+
+// LinkLanguages turns the foreign calls of graph's functions into calls
+// of the functions they name, once graphs of both languages share it, as
+// when a C graph is ingested next to a Go build. A symbol names the
+// function of that language called symbol, or called prefix/symbol when
+// the graph was ingested under a namespace; symbols matching more than
+// one are left alone. Links are recorded ViaForeign. It returns how many
+// calls it added.
+func LinkLanguages(graph map[string]FunctionNode) int {
+	type key struct{ language, symbol string }
+	var index map[key][]string
+	added := 0
+	for caller, node := range graph {
+		if len(node.Foreign) == 0 {
+			continue
+		}
+		if index == nil {
+			index = make(map[key][]string)
+			for name, n := range graph {
+				if n.Language == "" {
+					continue
+				}
+				lang := strings.ToLower(n.Language)
+				index[key{lang, name}] = append(index[key{lang, name}], name)
+				if i := strings.LastIndexByte(name, '/'); i >= 0 {
+					k := key{lang, name[i+1:]}
+					index[k] = append(index[k], name)
+				}
+			}
+		}
+		for _, call := range node.Foreign {
+			lang, symbol, ok := SplitForeign(call)
+			if !ok {
+				continue
+			}
+			targets := index[key{strings.ToLower(lang), symbol}]
+			if len(targets) != 1 || targets[0] == caller {
+				continue
+			}
+			target := targets[0]
+			if _, dup := node.Via[target]; dup {
+				continue
+			}
+			if node.Via == nil {
+				node.Via = make(map[string]string)
+			}
+			node.Callees = append(node.Callees, target)
+			node.Via[target] = ViaForeign
+			added++
+		}
+		graph[caller] = node
+	}
+	return added
+}
+
+// cgoCalls finds, in the functions of files importing "C", the calls of
+// C functions through cgo, as ForeignCalls keyed by caller name.
+func cgoCalls(files []*ast.File) map[string][]string {
+	out := make(map[string][]string)
+	for _, f := range files {
+		if !importsC(f) {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			seen := make(map[string]bool)
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				sel, ok := callee(call.Fun).(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "C" || x.Obj != nil {
+					return true
+				}
+				if !seen[sel.Sel.Name] && !cgoBuiltin[sel.Sel.Name] {
+					seen[sel.Sel.Name] = true
+					out[fn.Name.Name] = append(out[fn.Name.Name], ForeignCall(LanguageC, sel.Sel.Name))
+				}
+				return true
+			})
+			sort.Strings(out[fn.Name.Name])
+		}
+	}
+	return out
+}
+
+// cgoBuiltin holds the names cgo itself defines under C: its string and
+// byte helpers, and the numeric types, whose conversions look like calls.
+var cgoBuiltin = map[string]bool{
+	"CString": true, "CBytes": true, "GoString": true, "GoStringN": true, "GoBytes": true,
+	"char": true, "schar": true, "uchar": true, "short": true, "ushort": true,
+	"int": true, "uint": true, "long": true, "ulong": true, "longlong": true, "ulonglong": true,
+	"float": true, "double": true, "complexfloat": true, "complexdouble": true, "size_t": true,
+}
+
+func importsC(f *ast.File) bool {
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err == nil && path == "C" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package callgraph
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// Range is a span of a source file: byte offsets, End exclusive, and the
+// 1-based lines and byte columns they fall on, as go/token counts them.
+type Range struct {
+	Start       int `json:"start"`
+	End         int `json:"end"`
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// Ranges locates the parts of one function declaration.
+type Ranges struct {
+	Declaration Range  `json:"declaration"` // func keyword through the closing brace
+	Doc         *Range `json:"doc,omitempty"`
+	Name        Range  `json:"name"`
+	Signature   Range  `json:"signature"` // func keyword up to the body
+	Body        *Range `json:"body,omitempty"`
+}
+
+// Locate parses the Go source src and finds the declaration of the
+// function or method called name whose func keyword is on line, as
+// FunctionNode records it. It reports false when there is none, say
+// because the file changed since the graph was built.
+func Locate(src []byte, filename, name string, line int) (Ranges, bool) {
+	fset := token.NewFileSet()
+	// a file with syntax errors elsewhere may still hold the function,
+	// so only a file that didn't parse at all is given up on
+	f, _ := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if f == nil {
+		return Ranges{}, false
+	}
+	span := func(from, to token.Pos) Range {
+		a, b := fset.Position(from), fset.Position(to)
+		return Range{Start: a.Offset, End: b.Offset, StartLine: a.Line, StartColumn: a.Column, EndLine: b.Line, EndColumn: b.Column}
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != name || fset.Position(fn.Pos()).Line != line {
+			continue
+		}
+		r := Ranges{
+			Declaration: span(fn.Pos(), fn.End()),
+			Name:        span(fn.Name.Pos(), fn.Name.End()),
+			Signature:   span(fn.Pos(), fn.Type.End()),
+		}
+		if fn.Doc != nil {
+			doc := span(fn.Doc.Pos(), fn.Doc.End())
+			r.Doc = &doc
+		}
+		if fn.Body != nil {
+			body := span(fn.Body.Pos(), fn.Body.End())
+			r.Body = &body
+		}
+		return r, true
+	}
+	return Ranges{}, false
+}
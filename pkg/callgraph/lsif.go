@@ -0,0 +1,246 @@
+package callgraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/fileuri"
+)
+
+// lsifElement is the part of an LSIF vertex or edge the importer reads.
+// IDs may be numbers or strings, so they're kept raw and compared as text.
+type lsifElement struct {
+	ID          json.RawMessage   `json:"id"`
+	Type        string            `json:"type"`
+	Label       string            `json:"label"`
+	URI         string            `json:"uri"`
+	ProjectRoot string            `json:"projectRoot"`
+	Start       *lsifPosition     `json:"start"`
+	OutV        json.RawMessage   `json:"outV"`
+	InV         json.RawMessage   `json:"inV"`
+	InVs        []json.RawMessage `json:"inVs"`
+	Document    json.RawMessage   `json:"document"`
+}
+
+type lsifPosition struct {
+	Line int `json:"line"` // zero-based
+}
+
+// lsifIndex is the call-relevant content of an LSIF dump.
+type lsifIndex struct {
+	projectRoot string
+	documents   map[string]string   // document id → path relative to projectRoot
+	ranges      map[string]lsifSpot // range id → where it starts
+	next        map[string]string   // range or result set id → result set id
+	definition  map[string]string   // result set id → definitionResult id
+	items       map[string][]string // definitionResult id → range ids
+}
+
+type lsifSpot struct {
+	doc  string
+	line int // one-based
+}
+
+// readLSIF loads an LSIF dump: newline-delimited JSON as produced by
+// lsif-go, scip convert and geeparse's own export, or one JSON array.
+func readLSIF(path string) (*lsifIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := &lsifIndex{
+		documents:  make(map[string]string),
+		ranges:     make(map[string]lsifSpot),
+		next:       make(map[string]string),
+		definition: make(map[string]string),
+		items:      make(map[string][]string),
+	}
+	var elems []lsifElement
+	r := bufio.NewReader(f)
+	if b, err := r.Peek(1); err == nil && b[0] == '[' {
+		if err := json.NewDecoder(r).Decode(&elems); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		dec := json.NewDecoder(r)
+		for {
+			var e lsifElement
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			elems = append(elems, e)
+		}
+	}
+
+	var docURIs = make(map[string]string)
+	for _, e := range elems {
+		id := lsifID(e.ID)
+		switch e.Label {
+		case "metaData":
+			idx.projectRoot = e.ProjectRoot
+		case "document":
+			docURIs[id] = e.URI
+		case "range":
+			if e.Start != nil {
+				idx.ranges[id] = lsifSpot{line: e.Start.Line + 1}
+			}
+		case "next":
+			idx.next[lsifID(e.OutV)] = lsifID(e.InV)
+		case "textDocument/definition":
+			idx.definition[lsifID(e.OutV)] = lsifID(e.InV)
+		case "contains":
+			for _, in := range e.InVs {
+				if spot, ok := idx.ranges[lsifID(in)]; ok {
+					spot.doc = lsifID(e.OutV)
+					idx.ranges[lsifID(in)] = spot
+				}
+			}
+		case "item":
+			out := lsifID(e.OutV)
+			for _, in := range e.InVs {
+				idx.items[out] = append(idx.items[out], lsifID(in))
+			}
+			// items also name their document, which covers ranges no
+			// contains edge mentions
+			if doc := lsifID(e.Document); doc != "" {
+				for _, in := range e.InVs {
+					if spot, ok := idx.ranges[lsifID(in)]; ok && spot.doc == "" {
+						spot.doc = doc
+						idx.ranges[lsifID(in)] = spot
+					}
+				}
+			}
+		}
+	}
+	if idx.projectRoot == "" {
+		return nil, fmt.Errorf("%s: no LSIF metaData vertex; is this an LSIF dump?", path)
+	}
+	root := uriPath(idx.projectRoot)
+	for id, uri := range docURIs {
+		p := uriPath(uri)
+		if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+		idx.documents[id] = filepath.ToSlash(p)
+	}
+	return idx, nil
+}
+
+func lsifID(raw json.RawMessage) string {
+	return string(bytes.Trim(raw, `"`))
+}
+
+// uriPath returns the local path of a file:// URI, or the URI unchanged.
+func uriPath(uri string) string {
+	if p, err := fileuri.ToPath(uri); err == nil {
+		return p
+	}
+	return uri
+}
+
+// resultSet follows next edges from a range to the last result set.
+func (idx *lsifIndex) resultSet(id string) string {
+	for i := 0; i < 16; i++ { // chains are short; the bound stops cycles
+		n, ok := idx.next[id]
+		if !ok {
+			break
+		}
+		id = n
+	}
+	return id
+}
+
+// extractGraphLSIF builds caller→callee edges from an LSIF index: every
+// range whose definition is one of our function declarations is a
+// reference to that function, made from whichever of our functions
+// encloses it. The index's documents are matched to the parsed files by
+// their path relative to the index's project root, so an index made in a
+// CI checkout at another path still lines up.
+func extractGraphLSIF(indexPath string, details map[string]funcDetail) (map[string][]string, error) {
+	idx, err := readLSIF(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// map each document to one of our files
+	byFile := make(map[string][]string) // file → functions in it
+	for name, det := range details {
+		byFile[det.File] = append(byFile[det.File], name)
+	}
+	docFile := make(map[string]string)
+	for id, rel := range idx.documents {
+		for file := range byFile {
+			if filepath.ToSlash(file) == rel || strings.HasSuffix(filepath.ToSlash(file), "/"+rel) {
+				docFile[id] = file
+				break
+			}
+		}
+	}
+
+	// functions by declaration line, and the function enclosing a line
+	declared := make(map[string]map[int]string)
+	for file, names := range byFile {
+		declared[file] = make(map[int]string)
+		for _, name := range names {
+			declared[file][details[name].Line] = name
+		}
+		sort.Slice(names, func(i, j int) bool { return details[names[i]].Line < details[names[j]].Line })
+	}
+	enclosing := func(file string, line int) string {
+		for _, name := range byFile[file] {
+			det := details[name]
+			if det.Line <= line && line <= det.EndLine {
+				return name
+			}
+		}
+		return ""
+	}
+
+	// which of our functions each result set defines
+	defines := make(map[string]string)
+	for set, defResult := range idx.definition {
+		for _, rng := range idx.items[defResult] {
+			spot := idx.ranges[rng]
+			if name, ok := declared[docFile[spot.doc]][spot.line]; ok {
+				defines[set] = name
+			}
+		}
+	}
+
+	graph := make(map[string][]string)
+	seen := make(map[[2]string]bool)
+	ids := make([]string, 0, len(idx.ranges))
+	for id := range idx.ranges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		callee, ok := defines[idx.resultSet(id)]
+		if !ok {
+			continue
+		}
+		spot := idx.ranges[id]
+		file := docFile[spot.doc]
+		if file == "" || declared[file][spot.line] == callee {
+			continue // the declaration itself
+		}
+		caller := enclosing(file, spot.line)
+		if caller == "" || seen[[2]string{caller, callee}] {
+			continue
+		}
+		seen[[2]string{caller, callee}] = true
+		graph[caller] = append(graph[caller], callee)
+	}
+	return graph, nil
+}
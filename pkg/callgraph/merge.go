@@ -0,0 +1,128 @@
+package callgraph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Strategies of Merge, for the details of a function both graphs hold:
+// its signature, definition, location and the rest. Calls are always
+// united.
+const (
+	// MergeKeep keeps the first graph's details.
+	MergeKeep = "keep"
+	// MergeReplace takes the second graph's.
+	MergeReplace = "replace"
+	// MergeFail keeps the first graph's details but fails when both have
+	// a signature and they differ: the graphs were built from different
+	// code, not from different builds of the same.
+	MergeFail = "fail"
+)
+
+// MergeStrategies lists the strategies Merge accepts.
+var MergeStrategies = []string{MergeKeep, MergeReplace, MergeFail}
+
+// Merge returns the union of graph and other, built from the same code by
+// different backends, say gopls and an SSA analyzer, or for different
+// platforms and build tags, so one graph holds every call either found.
+// Functions only one of them holds are taken as they are; for those in
+// both, strategy picks whose details win. A call both hold keeps the more
+// certain of its two provenances, in the order of Provenances, and the
+// argument types of both. Neither graph is modified.
+func Merge(graph, other map[string]FunctionNode, strategy string) (map[string]FunctionNode, error) {
+	if !slices.Contains(MergeStrategies, strategy) {
+		return nil, fmt.Errorf("unknown merge strategy %q (want %s)", strategy, strings.Join(MergeStrategies, ", "))
+	}
+	out := make(map[string]FunctionNode, max(len(graph), len(other)))
+	for name, node := range graph {
+		out[name] = node
+	}
+	for name, theirs := range other {
+		ours, ok := out[name]
+		if !ok {
+			out[name] = theirs
+			continue
+		}
+		if strategy == MergeFail && ours.Signature != theirs.Signature && ours.Signature != "" && theirs.Signature != "" {
+			return nil, fmt.Errorf("%s has signature %s in one graph and %s in the other", name, ours.Signature, theirs.Signature)
+		}
+		first, second := ours, theirs
+		if strategy == MergeReplace {
+			first, second = theirs, ours
+		}
+		out[name] = mergeNode(first, second)
+	}
+	return out, nil
+}
+
+// mergeNode is first with the calls of second added. Per-call details of
+// the calls both make come from first, but for the more certain Via.
+func mergeNode(first, second FunctionNode) FunctionNode {
+	n := first
+	n.Callees = slices.Clone(first.Callees)
+	n.Via, n.Kinds, n.Args = nil, nil, nil
+	for _, c := range second.Callees {
+		if !slices.Contains(n.Callees, c) {
+			n.Callees = append(n.Callees, c)
+		}
+	}
+	if n.Callees == nil {
+		n.Callees = []string{}
+	}
+	for _, c := range n.Callees {
+		if via := moreCertain(first.Via[c], second.Via[c]); via != "" {
+			if n.Via == nil {
+				n.Via = make(map[string]string)
+			}
+			n.Via[c] = via
+		}
+		kind := first.Kinds[c]
+		if kind == "" {
+			kind = second.Kinds[c]
+		}
+		if kind != "" {
+			if n.Kinds == nil {
+				n.Kinds = make(map[string]string)
+			}
+			n.Kinds[c] = kind
+		}
+		sites := slices.Clone(first.Args[c])
+		for _, site := range second.Args[c] {
+			if !slices.ContainsFunc(sites, func(seen []Arg) bool { return slices.Equal(seen, site) }) {
+				sites = append(sites, site)
+			}
+		}
+		if len(sites) > 0 {
+			if n.Args == nil {
+				n.Args = make(map[string][][]Arg)
+			}
+			n.Args[c] = sites
+		}
+	}
+	n.Foreign = slices.Clone(first.Foreign)
+	for _, call := range second.Foreign {
+		if !slices.Contains(n.Foreign, call) {
+			n.Foreign = append(n.Foreign, call)
+		}
+	}
+	return n
+}
+
+// moreCertain returns whichever of two Via values comes first in
+// Provenances, a known one before an unknown, and a before b otherwise.
+func moreCertain(a, b string) string {
+	rank := func(via string) int {
+		if i := slices.Index(Provenances, via); i >= 0 {
+			return i
+		}
+		if via == "" {
+			return len(Provenances) + 1
+		}
+		return len(Provenances)
+	}
+	if rank(b) < rank(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,58 @@
+package callgraph
+
+import "go/ast"
+
+// bodyMetrics measures a function body for FunctionNode.Statements and
+// FunctionNode.Nesting.
+func bodyMetrics(body *ast.BlockStmt) (statements, nesting int) {
+	if body == nil {
+		return 0, 0
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause, *ast.EmptyStmt:
+		case ast.Stmt:
+			statements++
+		}
+		return true
+	})
+	return statements, nestingOf(body, 0)
+}
+
+// nestingOf returns how deep the blocks below n go, n being at depth.
+// Each if, for, switch, select and function literal goes one deeper; an
+// else if stays at the depth of its if.
+func nestingOf(n ast.Node, depth int) int {
+	deepest := depth
+	ast.Inspect(n, func(c ast.Node) bool {
+		if c == n {
+			return true
+		}
+		switch c := c.(type) {
+		case *ast.IfStmt:
+			deepest = max(deepest, ifNesting(c, depth+1))
+			return false
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+			deepest = max(deepest, nestingOf(c, depth+1))
+			return false
+		}
+		return true
+	})
+	return deepest
+}
+
+// ifNesting is nestingOf for an if statement whose blocks are at depth.
+func ifNesting(s *ast.IfStmt, depth int) int {
+	deepest := nestingOf(s.Body, depth)
+	if s.Init != nil {
+		deepest = max(deepest, nestingOf(s.Init, depth-1))
+	}
+	deepest = max(deepest, nestingOf(s.Cond, depth-1))
+	switch e := s.Else.(type) {
+	case *ast.IfStmt:
+		deepest = max(deepest, ifNesting(e, depth))
+	case *ast.BlockStmt:
+		deepest = max(deepest, nestingOf(e, depth))
+	}
+	return deepest
+}
@@ -0,0 +1,268 @@
+package callgraph
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Module is a Go module found under a build's root.
+type Module struct {
+	Path string // module path from go.mod, e.g. "github.com/acme/api"
+	Dir  string // directory holding its go.mod
+}
+
+// FindModules lists the modules under rootDir, the root's own included,
+// skipping directories opts excludes and vendor and testdata trees, as
+// the go command does. Modules come sorted by directory.
+func FindModules(rootDir string, opts Options) ([]Module, error) {
+	var mods []Module
+	err := filepath.WalkDir(rootDir, func(p string, d fs.DirEntry, e error) error {
+		if e != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != rootDir && (opts.excluded(rootDir, p) || name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		modPath, err := modulePath(p)
+		if err != nil {
+			return err
+		}
+		mods = append(mods, Module{Path: modPath, Dir: filepath.Dir(p)})
+		return nil
+	})
+	sort.Slice(mods, func(i, j int) bool { return mods[i].Dir < mods[j].Dir })
+	return mods, err
+}
+
+// modulePath reads the module directive of the go.mod file at p.
+func modulePath(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		rest, ok := strings.CutPrefix(line, "module")
+		if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t' && rest[0] != '"') {
+			continue
+		}
+		rest = strings.TrimSpace(rest)
+		if unq, err := strconv.Unquote(rest); err == nil {
+			rest = unq
+		}
+		if rest != "" {
+			return rest, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: no module directive", p)
+}
+
+// buildModules analyzes each module of a monorepo on its own, so every
+// gopls session sees one module the way the go command does, and merges
+// the results with each function named modulePath/Function and placed in
+// package modulePath/dir. Files outside every module are left out. Calls
+// from one module into another can't be seen by either session, so they
+// are added afterwards from the import paths the calls go through, and
+// recorded ViaImport.
+func buildModules(ctx context.Context, rootDir string, mods []Module, opts Options) (map[string]FunctionNode, BuildReport, error) {
+	opts.excludeRoot = rootDir
+	merged := make(map[string]FunctionNode)
+	var report BuildReport
+	for _, m := range mods {
+		o := opts
+		o.nested = nestedIn(m.Dir, modDirs(mods))
+		o.Stdlib = false // added once all are merged, so Namespace leaves it be
+		b, err := NewBuilder(m.Dir, o)
+		if err != nil {
+			return nil, report, err
+		}
+		graph, err := b.Build(ctx)
+		b.Close()
+		if err != nil {
+			return nil, report, fmt.Errorf("module %s: %w", m.Path, err)
+		}
+		maps.Copy(merged, Namespace(graph, m.Path))
+		report.Add(b.Report().Namespace(m.Path))
+	}
+	report.Modules = len(mods)
+	report.CrossModule = addCrossModuleCalls(merged, mods, opts)
+	if opts.Stdlib {
+		std, err := LoadStdlib(ctx, opts.logger())
+		if err != nil {
+			return nil, report, err
+		}
+		report.Stdlib = addModuleStdlibCalls(merged, std, mods, opts)
+	}
+	report.Functions = len(merged)
+	return merged, report, nil
+}
+
+// nestedIn returns the module directories strictly below dir.
+func nestedIn(dir string, dirs []string) []string {
+	var out []string
+	for _, d := range dirs {
+		if rel, err := filepath.Rel(dir, d); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// addCrossModuleCalls re-reads each module's files for calls of the form
+// pkg.Func where pkg imports a package of another module, and adds each
+// one whose function exists in that package to graph. It returns how
+// many it added.
+func addCrossModuleCalls(graph map[string]FunctionNode, mods []Module, opts Options) int {
+	added := 0
+	for _, m := range mods {
+		o := opts
+		o.nested = nestedIn(m.Dir, modDirs(mods))
+		_, files, fset, _, err := parseGoFiles(m.Dir, o, &BuildReport{})
+		if err != nil {
+			opts.logger().Warn("skipping cross-module calls", "module", m.Path, "err", err)
+			continue
+		}
+		for _, f := range files {
+			imports := foreignImports(f, m, mods)
+			if len(imports) == 0 {
+				continue
+			}
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Body == nil {
+					continue
+				}
+				caller := m.Path + "/" + fn.Name.Name
+				node, ok := graph[caller]
+				if !ok || node.File != absPath(fset.Position(fn.Pos()).Filename) {
+					continue // another function of that name won
+				}
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					sel, ok := callee(call.Fun).(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					x, ok := sel.X.(*ast.Ident)
+					if !ok || x.Obj != nil {
+						return true
+					}
+					imp, ok := imports[x.Name]
+					if !ok {
+						return true
+					}
+					target := imp.module + "/" + sel.Sel.Name
+					if t, ok := graph[target]; !ok || t.Package != imp.pkg {
+						return true
+					}
+					if _, dup := node.Via[target]; dup {
+						return true
+					}
+					if node.Via == nil {
+						node.Via = make(map[string]string)
+					}
+					node.Callees = append(node.Callees, target)
+					node.Via[target] = ViaImport
+					added++
+					return true
+				})
+				graph[caller] = node
+			}
+		}
+	}
+	return added
+}
+
+// addModuleStdlibCalls is addStdlibCalls for the merged graph of mods.
+func addModuleStdlibCalls(graph, std map[string]FunctionNode, mods []Module, opts Options) int {
+	added := 0
+	for _, m := range mods {
+		o := opts
+		o.nested = nestedIn(m.Dir, modDirs(mods))
+		_, files, fset, _, err := parseGoFiles(m.Dir, o, &BuildReport{})
+		if err != nil {
+			opts.logger().Warn("skipping standard library calls", "module", m.Path, "err", err)
+			continue
+		}
+		added += addStdlibCalls(graph, std, files, declaredIn(graph, fset, m.Path+"/"), opts)
+	}
+	return added
+}
+
+func modDirs(mods []Module) []string {
+	dirs := make([]string, len(mods))
+	for i, m := range mods {
+		dirs[i] = m.Dir
+	}
+	return dirs
+}
+
+// foreignImport is a package of another module that a file imports.
+type foreignImport struct {
+	module string // the module's path
+	pkg    string // the package as Namespace names it: module path joined with its directory
+}
+
+// foreignImports maps the names f refers to its imports by to the
+// packages of modules other than self they import. An import path
+// belongs to the module with the longest path prefixing it.
+func foreignImports(f *ast.File, self Module, mods []Module) map[string]foreignImport {
+	out := make(map[string]foreignImport)
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		var owner *Module
+		for i, m := range mods {
+			if (p == m.Path || strings.HasPrefix(p, m.Path+"/")) && (owner == nil || len(m.Path) > len(owner.Path)) {
+				owner = &mods[i]
+			}
+		}
+		if owner == nil || owner.Path == self.Path {
+			continue
+		}
+		name := path.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, owner.Path), "/")
+		if rel == "" {
+			rel = "."
+		}
+		out[name] = foreignImport{module: owner.Path, pkg: path.Join(owner.Path, rel)}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package callgraph
+
+import "path"
+
+// Namespace returns a copy of graph with every function renamed to
+// prefix/name and moved to package prefix/package, so graphs of separate
+// source trees can be merged into one without their names colliding.
+// The standard library functions of Options.Stdlib are shared by every
+// tree, so they keep their names.
+func Namespace(graph map[string]FunctionNode, prefix string) map[string]FunctionNode {
+	rename := func(name string) string {
+		if isStdlibName(name) {
+			return name
+		}
+		return prefix + "/" + name
+	}
+	out := make(map[string]FunctionNode, len(graph))
+	for name, node := range graph {
+		callees := make([]string, len(node.Callees))
+		for i, c := range node.Callees {
+			callees[i] = rename(c)
+		}
+		node.Callees = callees
+		if node.Via != nil {
+			via := make(map[string]string, len(node.Via))
+			for c, kind := range node.Via {
+				via[rename(c)] = kind
+			}
+			node.Via = via
+		}
+		if node.Kinds != nil {
+			kinds := make(map[string]string, len(node.Kinds))
+			for c, kind := range node.Kinds {
+				kinds[rename(c)] = kind
+			}
+			node.Kinds = kinds
+		}
+		if node.Args != nil {
+			args := make(map[string][][]Arg, len(node.Args))
+			for c, sites := range node.Args {
+				args[rename(c)] = sites
+			}
+			node.Args = args
+		}
+		if !IsStdlib(node.Package) {
+			node.Package = path.Join(prefix, node.Package)
+		}
+		out[rename(name)] = node
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package callgraph
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+
+	"github.com/ishanmadhav/geeparse/pkg/lspclient"
+)
+
+// Backends lists the analysis backends BuildCallGraph accepts.
+var Backends = []string{"gopls", "lsif"}
+
+// Default limits on what a build takes in; see Options.
+const (
+	DefaultMaxFileSize     = 2 << 20
+	DefaultMaxFunctionSize = 64 << 10
+)
+
+// Options tunes how a source tree is analyzed.
+type Options struct {
+	// Exclude holds path.Match patterns for files and directories to
+	// skip. Each is tried against the slash-separated path relative to the
+	// root and against the base name, so "vendor", "*_gen.go" and
+	// "internal/mocks/*" all work.
+	Exclude []string
+	// Backend picks the analyzer; empty means "gopls". "lsif" reads calls
+	// from a pre-built index instead of running gopls.
+	Backend string
+	// Index is the LSIF dump the "lsif" backend reads, e.g. from lsif-go
+	// or "scip convert" in CI.
+	Index string
+	// MaxFileSize skips .go files larger than this many bytes, such as
+	// generated tables that would stall gopls; 0 means
+	// DefaultMaxFileSize and a negative value no limit. Files that look
+	// binary are always skipped.
+	MaxFileSize int
+	// MaxFunctionSize cuts definitions longer than this many bytes short,
+	// keeping the function and its calls without storing and serving
+	// megabytes of source; 0 means DefaultMaxFunctionSize and a negative
+	// value no limit.
+	MaxFunctionSize int
+	// Redact, RedactOmit or RedactHash, keeps function bodies out of the
+	// graph, for sharing it without the code; see Redact. Definitions are
+	// hashed before MaxFunctionSize cuts them.
+	Redact string
+	// Sample, when positive, makes a build analyze only the functions
+	// nearest the entrypoints, for trees too big to analyze whole: it
+	// asks gopls for the calls of those matching SampleRoots, then of the
+	// functions they call, breadth-first, until Sample functions have
+	// been analyzed. The graph holds those and the functions they call;
+	// BuildReport.Unexplored lists the ones whose own calls the budget
+	// left out. Each module of a monorepo gets the whole budget.
+	Sample int
+	// SampleRoots holds path.Match patterns for the function names a
+	// sample starts from; empty means main, init and TestMain.
+	SampleRoots []string
+	// Overlay holds contents to analyze instead of what is on disk, keyed
+	// by file path, such as an editor's unsaved buffers. Only these are
+	// sent to gopls as open documents; it reads every other file from disk
+	// itself. A Builder keeps the overlays it was made with across
+	// rebuilds; watch mode has none, as its edits are saved to disk. The
+	// lsif backend can't use them, since its index was built from the
+	// files on disk.
+	Overlay map[string][]byte
+	// Stdlib adds the standard library functions the code calls to the
+	// graph, as a read-only overlay named under StdlibPrefix, with the
+	// calls into them and between them, instead of leaving those calls
+	// out. See LoadStdlib.
+	Stdlib bool
+	// ArgTypes type-checks the code with go/types to record, on each
+	// call, the static types of its arguments and their parameters (see
+	// FunctionNode.Args). Dependencies are type-checked from source too,
+	// which makes builds slower. Calls into the standard library of
+	// Stdlib, and between modules, go without.
+	ArgTypes bool
+	// Gopls bounds the memory and CPU of the gopls process: past them it
+	// is restarted and the build carries on, and past
+	// Gopls.MaxRestarts restarts the build fails, rather than a runaway
+	// gopls taking the machine down.
+	Gopls lspclient.Limits
+	// Logger receives parse problems, failed LSP queries and gopls's own
+	// output; nil means slog.Default().
+	Logger *slog.Logger
+
+	// When one module of a monorepo is built, excludeRoot is the
+	// monorepo's root, which Exclude patterns stay relative to, and nested
+	// the directories of the modules inside this one, which aren't part of
+	// it.
+	excludeRoot string
+	nested      []string
+}
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.Default()
+	}
+	return o.Logger
+}
+
+// validate rejects unknown backends and redaction modes, malformed
+// exclude and entrypoint patterns, and samples gopls can't take. It keys
+// a copy of Overlay by absolute path, for overlay to look files up in.
+func (o *Options) validate() error {
+	if o.Backend != "" {
+		known := false
+		for _, b := range Backends {
+			known = known || o.Backend == b
+		}
+		if !known {
+			return fmt.Errorf("unknown backend %q (available: %v)", o.Backend, Backends)
+		}
+	}
+	if o.Backend == "lsif" && o.Index == "" {
+		return fmt.Errorf("the lsif backend needs an index file")
+	}
+	if o.Index != "" && o.Backend != "lsif" {
+		return fmt.Errorf("an index file needs the lsif backend, not %q", o.backend())
+	}
+	if len(o.Overlay) > 0 && o.backend() == "lsif" {
+		return fmt.Errorf("overlays need the gopls backend")
+	}
+	if len(o.Overlay) > 0 {
+		overlay := make(map[string][]byte, len(o.Overlay))
+		for p, src := range o.Overlay {
+			overlay[absPath(p)] = src
+		}
+		o.Overlay = overlay
+	}
+	for _, p := range o.Exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("bad exclude pattern %q: %w", p, err)
+		}
+	}
+	if o.Gopls.MaxCPU < 0 {
+		return fmt.Errorf("gopls CPU limit %g is negative", o.Gopls.MaxCPU)
+	}
+	if o.Sample < 0 {
+		return fmt.Errorf("sample budget %d is negative", o.Sample)
+	}
+	if o.Sample > 0 && o.backend() == "lsif" {
+		return fmt.Errorf("sampling needs the gopls backend; an LSIF index has every call already")
+	}
+	for _, p := range o.SampleRoots {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("bad sample entrypoint pattern %q: %w", p, err)
+		}
+	}
+	return ValidateRedact(o.Redact)
+}
+
+// limit resolves a size option: the default for 0, no limit (-1) for
+// negative values.
+func limit(v, def int) int {
+	switch {
+	case v == 0:
+		return def
+	case v < 0:
+		return -1
+	}
+	return v
+}
+
+func (o Options) maxFileSize() int { return limit(o.MaxFileSize, DefaultMaxFileSize) }
+
+func (o Options) maxFunctionSize() int { return limit(o.MaxFunctionSize, DefaultMaxFunctionSize) }
+
+// overlay returns the overlay contents of the file at the absolute path
+// filename, if there are any. validate has made Overlay's keys absolute.
+func (o Options) overlay(filename string) ([]byte, bool) {
+	src, ok := o.Overlay[filename]
+	return src, ok
+}
+
+func (o Options) sampleRoots() []string {
+	if len(o.SampleRoots) == 0 {
+		return defaultSampleRoots
+	}
+	return o.SampleRoots
+}
+
+func (o Options) backend() string {
+	if o.Backend == "" {
+		return "gopls"
+	}
+	return o.Backend
+}
+
+// excluded reports whether the file or directory at filename, under
+// rootDir, matches one of the exclude patterns.
+func (o Options) excluded(rootDir, filename string) bool {
+	if o.excludeRoot != "" {
+		rootDir = o.excludeRoot
+	}
+	rel, err := filepath.Rel(rootDir, filename)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	base := path.Base(rel)
+	for _, p := range o.Exclude {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package callgraph
+
+// How a call was discovered, as recorded in FunctionNode.Via. The gopls
+// and lsif backends find every call they record precisely; the other
+// kinds label edges from other analyzers and ingested graphs.
+const (
+	// ViaCallHierarchy is a call gopls reported from its call hierarchy:
+	// a static call of a function or method.
+	ViaCallHierarchy = "call-hierarchy"
+	// ViaLSIF is a call read from an LSIF index's references.
+	ViaLSIF = "lsif"
+	// ViaImplementation is a call through an interface, expanded to one
+	// of its implementations.
+	ViaImplementation = "implementation"
+	// ViaImport is a call from one module of a monorepo into another, or
+	// into the standard library with Options.Stdlib, matched by the
+	// import path it goes through and the function's name; per-module
+	// analysis can't see these.
+	ViaImport = "import"
+	// ViaForeign is a call from one language into another, such as Go
+	// calling C through cgo, matched by the symbol it names; see
+	// LinkLanguages.
+	ViaForeign = "foreign"
+	// ViaSSA is a call found by an SSA-based analysis, such as a closure
+	// or function value it could resolve.
+	ViaSSA = "ssa"
+	// ViaAST is a call guessed from syntax alone, say by matching names;
+	// it may not happen at run time.
+	ViaAST = "ast"
+)
+
+// Provenances lists the known Via values, most certain first.
+var Provenances = []string{ViaCallHierarchy, ViaLSIF, ViaImplementation, ViaImport, ViaForeign, ViaSSA, ViaAST}
+
+// Heuristic reports whether calls discovered via kind are guesses that
+// strict analyses should leave out.
+func Heuristic(kind string) bool {
+	return kind == ViaAST
+}
+
+// Strict returns graph without the calls Heuristic rejects. Graphs with
+// none are returned as they are.
+func Strict(graph map[string]FunctionNode) map[string]FunctionNode {
+	heuristic := false
+	for _, node := range graph {
+		for _, kind := range node.Via {
+			heuristic = heuristic || Heuristic(kind)
+		}
+	}
+	if !heuristic {
+		return graph
+	}
+	out := make(map[string]FunctionNode, len(graph))
+	for name, node := range graph {
+		callees := []string{}
+		for _, c := range node.Callees {
+			if !Heuristic(node.Via[c]) {
+				callees = append(callees, c)
+			}
+		}
+		node.Callees = callees
+		out[name] = node
+	}
+	return out
+}
+
+// viaAll records every callee as discovered via kind.
+func viaAll(callees []string, kind string) map[string]string {
+	if len(callees) == 0 {
+		return nil
+	}
+	via := make(map[string]string, len(callees))
+	for _, c := range callees {
+		via[c] = kind
+	}
+	return via
+}
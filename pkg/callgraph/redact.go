@@ -0,0 +1,66 @@
+package callgraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Redaction modes, for Options.Redact and export filters: how much of each
+// function's source a graph keeps when it is shared outside the team that
+// owns the code, with a vendor or a hosted instance.
+const (
+	// RedactOmit drops definitions, keeping names, signatures, locations
+	// and calls.
+	RedactOmit = "omit"
+	// RedactHash replaces each definition with "sha256:" and its
+	// BodyHash, so renamed functions and changed bodies still show
+	// between snapshots without the code.
+	RedactHash = "hash"
+)
+
+// RedactModes lists the redaction modes.
+var RedactModes = []string{RedactOmit, RedactHash}
+
+// redactedPrefix starts every definition RedactHash leaves.
+const redactedPrefix = "sha256:"
+
+// ValidateRedact rejects unknown redaction modes; "" means none.
+func ValidateRedact(mode string) error {
+	if mode == "" || mode == RedactOmit || mode == RedactHash {
+		return nil
+	}
+	return fmt.Errorf("unknown redaction %q (want %s)", mode, strings.Join(RedactModes, " or "))
+}
+
+// Redact returns graph with its definitions redacted as mode says, or
+// graph itself for "".
+func Redact(graph map[string]FunctionNode, mode string) (map[string]FunctionNode, error) {
+	if err := ValidateRedact(mode); err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		return graph, nil
+	}
+	out := make(map[string]FunctionNode, len(graph))
+	for name, node := range graph {
+		node.Definition = redactDefinition(name, node, mode)
+		out[name] = node
+	}
+	return out, nil
+}
+
+func redactDefinition(name string, node FunctionNode, mode string) string {
+	switch {
+	case mode == RedactOmit:
+		return ""
+	case mode == RedactHash && node.Definition != "" && !Redacted(node.Definition):
+		return redactedPrefix + BodyHash(name, node)
+	}
+	return node.Definition
+}
+
+// Redacted reports whether def is a hash RedactHash left in place of a
+// definition rather than source code.
+func Redacted(def string) bool {
+	return strings.HasPrefix(def, redactedPrefix)
+}
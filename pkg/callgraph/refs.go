@@ -0,0 +1,149 @@
+package callgraph
+
+import (
+	"go/ast"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// valueReferences finds, in the functions of query, references to
+// functions that aren't calls: method values handed to a router, as in
+// http.HandleFunc("/", s.handleGraph), or stored to call later, as in
+// h := s.Handler; h(). gopls reports only calls, so without these edges
+// every handler registered that way looks unreachable. Matching is by
+// name without type information, so the edges are best effort and
+// recorded ViaAST, and the rules lean towards missing a reference over
+// inventing one: x.Name counts when Name is a method declared in the
+// same directory and no struct field in files (all of them) has that
+// name; pkg.Name when pkg imports one of the packages in files and Name
+// is a function; and a plain Name when it is a function and not a local
+// variable. Names that are also types, variables or constants of any
+// package in files never count.
+func valueReferences(files, query []*ast.File, fset *token.FileSet, names map[string]struct{}) map[string][]string {
+	methods := make(map[string]map[string]bool) // by directory
+	funcs := make(map[string]bool)
+	other := make(map[string]bool) // fields, types, variables and constants
+	pkgs := make(map[string]bool)
+	for _, f := range files {
+		pkgs[f.Name.Name] = true
+		dir := filepath.Dir(fset.Position(f.Package).Filename)
+		if methods[dir] == nil {
+			methods[dir] = make(map[string]bool)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Recv != nil {
+					methods[dir][n.Name.Name] = true
+				} else {
+					funcs[n.Name.Name] = true
+				}
+				return false
+			case *ast.StructType:
+				for _, field := range n.Fields.List {
+					for _, name := range field.Names {
+						other[name.Name] = true
+					}
+				}
+			case *ast.TypeSpec:
+				other[n.Name.Name] = true
+			case *ast.ValueSpec:
+				for _, name := range n.Names {
+					other[name.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	out := make(map[string][]string)
+	for _, f := range query {
+		dir := filepath.Dir(fset.Position(f.Package).Filename)
+		imports := importNames(f, pkgs)
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller := fn.Name.Name
+			seen := make(map[string]bool)
+			add := func(callee string) {
+				if _, ok := names[callee]; ok && !seen[callee] {
+					seen[callee] = true
+					out[caller] = append(out[caller], callee)
+				}
+			}
+			// called functions and the names of struct literal fields
+			// aren't references; selectors handle their own identifiers
+			skip := make(map[ast.Node]bool)
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.CallExpr:
+					skip[callee(n.Fun)] = true
+				case *ast.KeyValueExpr:
+					skip[n.Key] = true
+				case *ast.SelectorExpr:
+					skip[n.Sel] = true
+					name := n.Sel.Name
+					x, isIdent := n.X.(*ast.Ident)
+					qualified := isIdent && x.Obj == nil && imports[x.Name]
+					if qualified {
+						skip[x] = true
+					}
+					switch {
+					case skip[n]:
+					case qualified:
+						if funcs[name] && !other[name] {
+							add(name)
+						}
+					case methods[dir][name] && !other[name]:
+						add(name)
+					}
+				case *ast.Ident:
+					if !skip[n] && funcs[n.Name] && !other[n.Name] && (n.Obj == nil || n.Obj.Kind == ast.Fun) {
+						add(n.Name)
+					}
+				}
+				return true
+			})
+		}
+	}
+	return out
+}
+
+// importNames returns the names f refers to its imports of pkgs by,
+// matching import paths by their last element.
+func importNames(f *ast.File, pkgs map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(f.Imports))
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || !pkgs[path.Base(p)] {
+			continue
+		}
+		if imp.Name != nil {
+			out[imp.Name.Name] = true
+		} else {
+			out[path.Base(p)] = true
+		}
+	}
+	return out
+}
+
+// callee strips parentheses and type arguments from a call's function
+// expression, leaving the identifier or selector that names it.
+func callee(fun ast.Expr) ast.Expr {
+	for {
+		switch f := fun.(type) {
+		case *ast.ParenExpr:
+			fun = f.X
+		case *ast.IndexExpr:
+			fun = f.X
+		case *ast.IndexListExpr:
+			fun = f.X
+		default:
+			return fun
+		}
+	}
+}
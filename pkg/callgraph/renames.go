@@ -0,0 +1,62 @@
+package callgraph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// BodyHash returns a hash of the definition of the function name that a
+// rename alone doesn't change: the name is blanked out wherever it
+// appears as a word, in the declaration and in recursive calls, and runs
+// of white space collapse. Functions without a definition have none, "".
+func BodyHash(name string, node FunctionNode) string {
+	if node.Definition == "" {
+		return ""
+	}
+	base := path.Base(name)
+	def := node.Definition
+	if re, err := regexp.Compile(`\b` + regexp.QuoteMeta(base) + `\b`); err == nil {
+		def = re.ReplaceAllString(def, "_")
+	}
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(def), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// BodyHashes returns the BodyHash of every function of graph, by name.
+func BodyHashes(graph map[string]FunctionNode) map[string]string {
+	out := make(map[string]string, len(graph))
+	for name, node := range graph {
+		out[name] = BodyHash(name, node)
+	}
+	return out
+}
+
+// Renames pairs the functions that went away between two graphs, given
+// as the BodyHashes of each, with the ones that appeared under a new name
+// and the same body hash, keyed by old name. Only unambiguous pairs count:
+// a hash two removed or two added functions share, as trivial bodies
+// often do, renames nothing.
+func Renames(old, new map[string]string) map[string]string {
+	removed := make(map[string][]string)
+	for name, hash := range old {
+		if _, ok := new[name]; !ok && hash != "" {
+			removed[hash] = append(removed[hash], name)
+		}
+	}
+	added := make(map[string][]string)
+	for name, hash := range new {
+		if _, ok := old[name]; !ok && hash != "" {
+			added[hash] = append(added[hash], name)
+		}
+	}
+	out := make(map[string]string)
+	for hash, from := range removed {
+		if to := added[hash]; len(from) == 1 && len(to) == 1 {
+			out[from[0]] = to[0]
+		}
+	}
+	return out
+}
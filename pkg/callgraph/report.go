@@ -0,0 +1,172 @@
+package callgraph
+
+import "time"
+
+// BuildReport describes the most recent build: how much was analyzed,
+// what couldn't be, and where the time went.
+type BuildReport struct {
+	Files     int `json:"files"`   // Go files parsed
+	Queried   int `json:"queried"` // files whose calls were (re)computed
+	Functions int `json:"functions"`
+	// Skipped counts files left out for being over Options.MaxFileSize
+	// or binary, Truncated the definitions cut to MaxFunctionSize.
+	Skipped   int `json:"skipped"`
+	Truncated int `json:"truncated"`
+	// Generated counts the parsed files a code generator wrote; see
+	// FunctionNode.Generated.
+	Generated int `json:"generated"`
+	// Modules counts the modules of a multi-module root, built one by
+	// one, and CrossModule the calls between them; both are 0 for a root
+	// built as one tree.
+	Modules     int `json:"modules"`
+	CrossModule int `json:"crossModule"`
+	// Stdlib counts the calls into the standard library added with
+	// Options.Stdlib.
+	Stdlib int `json:"stdlib,omitempty"`
+	// Sampled counts the functions a sampled build analyzed (see
+	// Options.Sample), and Unexplored names, sorted, those it reached but
+	// had no budget left for: they are in the graph without their calls.
+	Sampled    int      `json:"sampled,omitempty"`
+	Unexplored []string `json:"unexplored,omitempty"`
+	// GoplsRestarts counts the times gopls went over Options.Gopls and
+	// was restarted midway.
+	GoplsRestarts int `json:"goplsRestarts,omitempty"`
+	// Incomplete holds, by function name, the call-hierarchy requests
+	// gopls failed: those functions keep their node but may be missing
+	// some or all of their calls.
+	Incomplete map[string][]Failure `json:"incomplete,omitempty"`
+	Timings    Timings              `json:"timings"`
+}
+
+// Failure is one call-hierarchy request gopls failed for a function.
+type Failure struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Request string `json:"request"` // the LSP method, e.g. callHierarchy/outgoingCalls
+	Error   string `json:"error"`
+}
+
+// IncompleteCount is how many failures Incomplete holds.
+func (r BuildReport) IncompleteCount() int {
+	n := 0
+	for _, fs := range r.Incomplete {
+		n += len(fs)
+	}
+	return n
+}
+
+// addFailure records that request failed for function.
+func (r *BuildReport) addFailure(function string, f Failure) {
+	if r.Incomplete == nil {
+		r.Incomplete = make(map[string][]Failure)
+	}
+	r.Incomplete[function] = append(r.Incomplete[function], f)
+}
+
+// Namespace returns r with the functions it names renamed as Namespace
+// renames those of the graph built, to prefix/name.
+func (r BuildReport) Namespace(prefix string) BuildReport {
+	if r.Unexplored != nil {
+		unexplored := make([]string, len(r.Unexplored))
+		for i, name := range r.Unexplored {
+			unexplored[i] = prefix + "/" + name
+		}
+		r.Unexplored = unexplored
+	}
+	if r.Incomplete != nil {
+		incomplete := make(map[string][]Failure, len(r.Incomplete))
+		for name, fs := range r.Incomplete {
+			incomplete[prefix+"/"+name] = fs
+		}
+		r.Incomplete = incomplete
+	}
+	return r
+}
+
+// Timings break a build down by phase, so slow repositories show which
+// step to tune. Phases that didn't run are zero.
+type Timings struct {
+	Parse   time.Duration `json:"parse"`   // walking the tree and parsing files
+	Details time.Duration `json:"details"` // printing signatures and definitions
+	Init    time.Duration `json:"init"`    // starting gopls; only the first build pays it
+	Sync    time.Duration `json:"sync"`    // sending file contents to gopls
+	// Prepare and Outgoing are the time spent in the two call-hierarchy
+	// requests, textDocument/prepareCallHierarchy and
+	// callHierarchy/outgoingCalls, across every function.
+	Prepare  time.Duration `json:"prepare"`
+	Outgoing time.Duration `json:"outgoing"`
+	Index    time.Duration `json:"index"` // reading an LSIF dump
+	Types    time.Duration `json:"types"` // type-checking call arguments
+	// Persist is saving the result; the builder doesn't save, so callers
+	// that do fill it in.
+	Persist time.Duration `json:"persist"`
+}
+
+// Phase is one named entry of Timings.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Phases lists the timings in pipeline order, skipping phases that
+// didn't run.
+func (t Timings) Phases() []Phase {
+	all := []Phase{
+		{"parse", t.Parse},
+		{"details", t.Details},
+		{"gopls init", t.Init},
+		{"gopls sync", t.Sync},
+		{"prepare call hierarchy", t.Prepare},
+		{"outgoing calls", t.Outgoing},
+		{"lsif index", t.Index},
+		{"type-check arguments", t.Types},
+		{"persist", t.Persist},
+	}
+	var out []Phase
+	for _, p := range all {
+		if p.Duration > 0 {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Total sums every phase.
+func (t Timings) Total() time.Duration {
+	var sum time.Duration
+	for _, p := range t.Phases() {
+		sum += p.Duration
+	}
+	return sum
+}
+
+// Add accumulates o into r, for builds made of several.
+func (r *BuildReport) Add(o BuildReport) {
+	r.Files += o.Files
+	r.Queried += o.Queried
+	r.Functions += o.Functions
+	r.Skipped += o.Skipped
+	r.Truncated += o.Truncated
+	r.Generated += o.Generated
+	r.Modules += o.Modules
+	r.CrossModule += o.CrossModule
+	r.Stdlib += o.Stdlib
+	r.Sampled += o.Sampled
+	r.GoplsRestarts += o.GoplsRestarts
+	r.Unexplored = append(r.Unexplored, o.Unexplored...)
+	for name, fs := range o.Incomplete {
+		for _, f := range fs {
+			r.addFailure(name, f)
+		}
+	}
+	t := &r.Timings
+	t.Parse += o.Timings.Parse
+	t.Details += o.Timings.Details
+	t.Init += o.Timings.Init
+	t.Sync += o.Timings.Sync
+	t.Prepare += o.Timings.Prepare
+	t.Outgoing += o.Timings.Outgoing
+	t.Index += o.Timings.Index
+	t.Types += o.Timings.Types
+	t.Persist += o.Timings.Persist
+}
@@ -0,0 +1,97 @@
+package callgraph
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/lspclient"
+)
+
+// defaultSampleRoots are the entrypoints a sampled build starts from
+// unless Options.SampleRoots names others.
+var defaultSampleRoots = []string{"main", "init", "TestMain"}
+
+// sampleCalls is extractGraphLSP for a sampled build (see Options.Sample):
+// it queries the functions matching roots, then the functions they call,
+// breadth-first, until budget of them have been queried. It returns the
+// calls found, the functions reached, and, sorted, those of them left
+// unqueried.
+func sampleCalls(
+	ctx context.Context,
+	client *lspclient.Client,
+	files []*ast.File,
+	fset *token.FileSet,
+	names map[string]struct{},
+	roots []string,
+	budget int,
+	logger *slog.Logger,
+	report *BuildReport,
+) (map[string][]string, map[string]struct{}, []string, error) {
+	// the same declaration extractDetails keeps for each name
+	decls := make(map[string]*ast.FuncDecl)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				decls[fn.Name.Name] = fn
+			}
+		}
+	}
+	var queue []string
+	for name := range decls {
+		for _, p := range roots {
+			if ok, _ := path.Match(p, name); ok {
+				queue = append(queue, name)
+				break
+			}
+		}
+	}
+	if len(queue) == 0 {
+		return nil, nil, nil, fmt.Errorf("no function matches the sample entrypoints %s", strings.Join(roots, ", "))
+	}
+	sort.Strings(queue)
+
+	graph := make(map[string][]string)
+	seen := make(map[string]struct{}, budget)
+	for _, name := range queue {
+		seen[name] = struct{}{}
+	}
+	queried := 0
+	for ; len(queue) > 0 && queried < budget; queue = queue[1:] {
+		fn := decls[queue[0]]
+		if fn.Body == nil {
+			continue
+		}
+		queried++
+		callees := outgoingCalls(ctx, client, fset, fn, names, logger, report)
+		if len(callees) > 0 {
+			graph[fn.Name.Name] = callees
+		}
+		for _, c := range callees {
+			if _, ok := seen[c]; !ok {
+				seen[c] = struct{}{}
+				queue = append(queue, c)
+			}
+		}
+	}
+	report.Sampled = queried
+	unexplored := append([]string(nil), queue...)
+	sort.Strings(unexplored)
+	return graph, seen, unexplored, nil
+}
+
+// sampledDetails narrows details to the functions a sample reached.
+func sampledDetails(details map[string]funcDetail, reached map[string]struct{}) map[string]funcDetail {
+	out := make(map[string]funcDetail, len(reached))
+	for name := range reached {
+		if det, ok := details[name]; ok {
+			out[name] = det
+		}
+	}
+	return out
+}
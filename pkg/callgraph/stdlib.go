@@ -0,0 +1,405 @@
+package callgraph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StdlibPrefix starts the names and packages of the standard library's
+// functions in a graph built with Options.Stdlib, as Namespace would
+// prefix them: fmt.Println is std/fmt.Println in package std/fmt.
+const StdlibPrefix = "std"
+
+// IsStdlib reports whether pkg is a standard library package of the
+// Options.Stdlib overlay. Its functions are read-only: they come from the
+// toolchain, not the code analyzed.
+func IsStdlib(pkg string) bool {
+	return pkg == StdlibPrefix || strings.HasPrefix(pkg, StdlibPrefix+"/")
+}
+
+// isStdlibName reports whether name is one stdlibName makes.
+func isStdlibName(name string) bool {
+	return strings.HasPrefix(name, StdlibPrefix+"/")
+}
+
+// SplitStdlib separates the standard library overlay of graph from the
+// functions of the code analyzed. Both share graph's nodes.
+func SplitStdlib(graph map[string]FunctionNode) (own, std map[string]FunctionNode) {
+	own = make(map[string]FunctionNode, len(graph))
+	std = make(map[string]FunctionNode)
+	for name, node := range graph {
+		if isStdlibName(name) && IsStdlib(node.Package) {
+			std[name] = node
+		} else {
+			own[name] = node
+		}
+	}
+	return own, std
+}
+
+// stdlibName names the function fn of the standard library package pkg.
+func stdlibName(pkg, fn string) string {
+	return StdlibPrefix + "/" + pkg + "." + fn
+}
+
+// goToolchain is the go command's idea of the standard library to use.
+type goToolchain struct {
+	GOROOT    string
+	GOVERSION string
+	GOOS      string
+	GOARCH    string
+}
+
+var (
+	stdlibMu    sync.Mutex
+	stdlibCache = make(map[goToolchain]map[string]FunctionNode)
+)
+
+// LoadStdlib returns the graph of the standard library of the go command
+// on PATH: its exported package-level functions, outside internal and
+// vendored packages, with their signatures, definitions and the calls
+// between them, matched by name and import path as addCrossModuleCalls
+// does. Building it takes a while, so it's cached under the user's
+// cache directory per Go version, GOOS and GOARCH, and in memory for the
+// rest of the process.
+func LoadStdlib(ctx context.Context, logger *slog.Logger) (map[string]FunctionNode, error) {
+	tc, err := currentToolchain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stdlibMu.Lock()
+	defer stdlibMu.Unlock()
+	if std, ok := stdlibCache[tc]; ok {
+		return std, nil
+	}
+	cache := stdlibCachePath(tc)
+	if cache != "" {
+		if std, err := readStdlibCache(cache); err == nil {
+			stdlibCache[tc] = std
+			return std, nil
+		} else if !os.IsNotExist(err) {
+			logger.Warn("ignoring unreadable standard library cache", "file", cache, "err", err)
+		}
+	}
+	logger.Info("analyzing the standard library", "version", tc.GOVERSION, "goroot", tc.GOROOT)
+	std, err := scanStdlib(tc, logger)
+	if err != nil {
+		return nil, err
+	}
+	if cache != "" {
+		if err := writeStdlibCache(cache, std); err != nil {
+			logger.Warn("couldn't cache the standard library", "file", cache, "err", err)
+		}
+	}
+	stdlibCache[tc] = std
+	return std, nil
+}
+
+func currentToolchain(ctx context.Context) (goToolchain, error) {
+	out, err := exec.CommandContext(ctx, "go", "env", "-json", "GOROOT", "GOVERSION", "GOOS", "GOARCH").Output()
+	if err != nil {
+		return goToolchain{}, fmt.Errorf("find the standard library: go env: %w", err)
+	}
+	var tc goToolchain
+	if err := json.Unmarshal(out, &tc); err != nil {
+		return goToolchain{}, fmt.Errorf("find the standard library: go env: %w", err)
+	}
+	if tc.GOROOT == "" {
+		return goToolchain{}, fmt.Errorf("find the standard library: go env reports no GOROOT")
+	}
+	return tc, nil
+}
+
+// stdlibCachePath is where the graph of tc's standard library is cached,
+// or "" without a user cache directory.
+func stdlibCachePath(tc goToolchain) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "geeparse", "stdlib", fmt.Sprintf("%s-%s-%s.json.gz", tc.GOVERSION, tc.GOOS, tc.GOARCH))
+}
+
+func readStdlibCache(file string) (map[string]FunctionNode, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var std map[string]FunctionNode
+	if err := json.NewDecoder(zr).Decode(&std); err != nil {
+		return nil, err
+	}
+	return std, nil
+}
+
+// writeStdlibCache writes std to file through a temporary file, so
+// concurrent builds never read half of it.
+func writeStdlibCache(file string, std map[string]FunctionNode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".stdlib-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(std); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// scanStdlib parses the standard library under tc.GOROOT, only the files
+// built for tc.GOOS and tc.GOARCH.
+func scanStdlib(tc goToolchain, logger *slog.Logger) (map[string]FunctionNode, error) {
+	bctx := build.Default
+	bctx.GOROOT, bctx.GOOS, bctx.GOARCH = tc.GOROOT, tc.GOOS, tc.GOARCH
+	src := filepath.Join(tc.GOROOT, "src")
+
+	type stdFile struct {
+		pkg  string
+		file *ast.File
+	}
+	fset := token.NewFileSet()
+	var files []stdFile
+	funcs := make(map[string]bool) // by name, as stdlibName makes them
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, e error) error {
+		if e != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(src, p)
+		rel = filepath.ToSlash(rel)
+		name := d.Name()
+		if rel == "cmd" || name == "internal" || name == "vendor" || name == "testdata" ||
+			strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return filepath.SkipDir
+		}
+		if rel == "." {
+			return nil
+		}
+		bp, err := bctx.ImportDir(p, 0)
+		if err != nil || bp.Name == "main" {
+			return nil
+		}
+		for _, name := range bp.GoFiles {
+			f, err := parser.ParseFile(fset, filepath.Join(p, name), nil, 0)
+			if err != nil {
+				logger.Warn("skipping unparsable standard library file", "file", filepath.Join(p, name), "err", err)
+				continue
+			}
+			files = append(files, stdFile{pkg: rel, file: f})
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.IsExported() {
+					funcs[stdlibName(rel, fn.Name.Name)] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	std := make(map[string]FunctionNode, len(funcs))
+	for _, sf := range files {
+		imports := stdImports(sf.file)
+		for _, decl := range sf.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !fn.Name.IsExported() {
+				continue
+			}
+			var sig, def bytes.Buffer
+			printer.Fprint(&sig, fset, fn.Type)
+			printer.Fprint(&def, fset, fn)
+			node := FunctionNode{
+				Callees:    []string{},
+				Signature:  sig.String(),
+				Definition: def.String(),
+				Package:    StdlibPrefix + "/" + sf.pkg,
+				File:       fset.Position(fn.Pos()).Filename,
+				Line:       fset.Position(fn.Pos()).Line,
+				EndLine:    fset.Position(fn.End()).Line,
+				Language:   LanguageGo,
+			}
+			if fn.Body != nil {
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					var target string
+					switch f := callee(call.Fun).(type) {
+					case *ast.Ident:
+						if f.Obj == nil || f.Obj.Kind == ast.Fun {
+							target = stdlibName(sf.pkg, f.Name)
+						}
+					case *ast.SelectorExpr:
+						if x, ok := f.X.(*ast.Ident); ok && x.Obj == nil && imports[x.Name] != "" {
+							target = stdlibName(imports[x.Name], f.Sel.Name)
+						}
+					}
+					if !funcs[target] || target == stdlibName(sf.pkg, fn.Name.Name) {
+						return true
+					}
+					if _, dup := node.Via[target]; dup {
+						return true
+					}
+					if node.Via == nil {
+						node.Via = make(map[string]string)
+					}
+					node.Callees = append(node.Callees, target)
+					node.Via[target] = ViaImport
+					return true
+				})
+			}
+			std[stdlibName(sf.pkg, fn.Name.Name)] = node
+		}
+	}
+	return std, nil
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// stdImports maps the names f refers to its imports by to the import
+// paths of those that may be standard library packages: paths whose
+// first element has no dot.
+func stdImports(f *ast.File) map[string]string {
+	out := make(map[string]string)
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || strings.Contains(strings.SplitN(p, "/", 2)[0], ".") || p == "C" {
+			continue
+		}
+		name := path.Base(p)
+		if majorVersion.MatchString(name) && path.Dir(p) != "." {
+			name = path.Base(path.Dir(p)) // math/rand/v2 is rand
+		}
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		out[name] = p
+	}
+	return out
+}
+
+// addStdlibCalls adds to graph the calls from the functions of files into
+// std, the graph LoadStdlib returns, and the standard library functions
+// they call, with the calls between those. caller names the graph's
+// function for a declaration, if it has one. Each function keeps its
+// definition as opts say. It returns how many calls it added.
+func addStdlibCalls(graph map[string]FunctionNode, std map[string]FunctionNode, files []*ast.File,
+	caller func(*ast.FuncDecl) (string, bool), opts Options) int {
+
+	added := 0
+	used := make(map[string]bool)
+	for _, f := range files {
+		imports := stdImports(f)
+		if len(imports) == 0 {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			name, ok := caller(fn)
+			if !ok {
+				continue
+			}
+			node := graph[name]
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				sel, ok := callee(call.Fun).(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				x, ok := sel.X.(*ast.Ident)
+				if !ok || x.Obj != nil || imports[x.Name] == "" {
+					return true
+				}
+				target := stdlibName(imports[x.Name], sel.Sel.Name)
+				if _, ok := std[target]; !ok {
+					return true
+				}
+				used[target] = true
+				// a Rebuild keeps the Via of functions in files it didn't
+				// requery, though not their calls into std
+				if slices.Contains(node.Callees, target) {
+					return true
+				}
+				if node.Via == nil {
+					node.Via = make(map[string]string)
+				}
+				node.Callees = append(node.Callees, target)
+				node.Via[target] = ViaImport
+				added++
+				return true
+			})
+			graph[name] = node
+		}
+	}
+
+	max := opts.maxFunctionSize()
+	for name := range used {
+		node := std[name]
+		callees := []string{}
+		var via map[string]string
+		for _, c := range node.Callees {
+			if used[c] {
+				callees = append(callees, c)
+				if via == nil {
+					via = make(map[string]string)
+				}
+				via[c] = node.Via[c]
+			}
+		}
+		node.Callees, node.Via = callees, via
+		if opts.Redact != "" {
+			node.Definition = redactDefinition(name, node, opts.Redact)
+		}
+		if max >= 0 && len(node.Definition) > max {
+			node.Definition = truncateDefinition(node.Definition, max)
+		}
+		graph[name] = node
+	}
+	return added
+}
@@ -0,0 +1,103 @@
+package callgraph
+
+import "sort"
+
+// Truncate returns a subgraph holding at most maxNodes functions and
+// maxEdges edges (0 means unlimited). Functions are taken breadth-first from
+// roots, or, when roots is empty, from every function nobody calls followed
+// by whatever is left, so the kept part is still a connected top-down view.
+// The bool reports whether the budget cut anything off.
+func Truncate(graph map[string]FunctionNode, roots []string, maxNodes, maxEdges int) (map[string]FunctionNode, bool) {
+	edges := EdgeCount(graph)
+	if (maxNodes <= 0 || len(graph) <= maxNodes) && (maxEdges <= 0 || edges <= maxEdges) && len(roots) == 0 {
+		return graph, false
+	}
+
+	var order []string
+	seen := make(map[string]bool)
+	cut := false
+	bfs := func(start []string) {
+		queue := append([]string(nil), start...)
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			if seen[name] {
+				continue
+			}
+			node, ok := graph[name]
+			if !ok {
+				continue
+			}
+			if maxNodes > 0 && len(order) >= maxNodes {
+				cut = true
+				return
+			}
+			seen[name] = true
+			order = append(order, name)
+			queue = append(queue, node.Callees...)
+		}
+	}
+	if len(roots) > 0 {
+		bfs(roots)
+	} else {
+		bfs(Roots(graph))
+		bfs(sortedNames(graph))
+	}
+
+	out := make(map[string]FunctionNode, len(order))
+	kept := 0
+	for _, name := range order {
+		node := graph[name]
+		callees := []string{}
+		for _, c := range node.Callees {
+			if !seen[c] {
+				continue
+			}
+			if maxEdges > 0 && kept >= maxEdges {
+				cut = true
+				continue
+			}
+			callees = append(callees, c)
+			kept++
+		}
+		node.Callees = callees
+		out[name] = node
+	}
+	return out, cut
+}
+
+// Roots returns, sorted, the functions that no other function calls.
+func Roots(graph map[string]FunctionNode) []string {
+	called := make(map[string]bool)
+	for _, node := range graph {
+		for _, c := range node.Callees {
+			called[c] = true
+		}
+	}
+	var roots []string
+	for name := range graph {
+		if !called[name] {
+			roots = append(roots, name)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// EdgeCount returns the total number of caller→callee edges.
+func EdgeCount(graph map[string]FunctionNode) int {
+	n := 0
+	for _, node := range graph {
+		n += len(node.Callees)
+	}
+	return n
+}
+
+func sortedNames(graph map[string]FunctionNode) []string {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,184 @@
+// Package churn measures how often each function of a call-graph changed,
+// from the history git keeps of its lines. Functions that change a lot
+// and that much else calls are where bugs tend to land: DangerZones ranks
+// them.
+package churn
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+)
+
+// DefaultSince is the window Measure looks back over by default.
+const DefaultSince = "1 year ago"
+
+// Churn is how one function changed over the window measured.
+type Churn struct {
+	Commits     int       `json:"commits"`
+	Authors     int       `json:"authors"`
+	LastChanged time.Time `json:"lastChanged"`
+}
+
+// Measure counts, for every function in graph whose file lies under
+// repoRoot, the commits since the given date (anything git's --since
+// takes, such as "6 months ago" or "2024-01-01") that touched its lines,
+// following them back with git log -L. Line numbers are those of the
+// graph, so it should have been built from the checked-out revision.
+// Functions untouched in the window, or whose files git doesn't track,
+// are left out.
+func Measure(graph map[string]callgraph.FunctionNode, repoRoot, since string) (map[string]Churn, error) {
+	type job struct{ name, rel string }
+	var jobs []job
+	for name, node := range graph {
+		if node.File == "" || node.Line <= 0 || node.Generated != "" {
+			continue
+		}
+		rel, err := filepath.Rel(repoRoot, node.File)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		jobs = append(jobs, job{name, filepath.ToSlash(rel)})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].name < jobs[j].name })
+
+	var (
+		mu       sync.Mutex
+		out      = make(map[string]Churn)
+		firstErr error
+		wg       sync.WaitGroup
+		next     = make(chan job)
+	)
+	// git log -L is slow on long histories, one function at a time
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				c, err := functionChurn(repoRoot, j.rel, graph[j.name], since)
+				mu.Lock()
+				switch {
+				case err != nil && firstErr == nil:
+					firstErr = err
+				case err == nil && c.Commits > 0:
+					out[j.name] = c
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		next <- j
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// functionChurn runs git log -L over node's lines of rel.
+func functionChurn(repoRoot, rel string, node callgraph.FunctionNode, since string) (Churn, error) {
+	end := node.EndLine
+	if end < node.Line {
+		end = node.Line
+	}
+	args := []string{"log", "-s", "--no-merges", "--format=%H%x09%ae%x09%at",
+		"-L", strconv.Itoa(node.Line) + "," + strconv.Itoa(end) + ":" + rel}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	out, err := vcs.Git(repoRoot, args...)
+	if err != nil {
+		msg := err.Error()
+		// untracked or new files, and functions past the committed end
+		if strings.Contains(msg, "no path") || strings.Contains(msg, "has only") {
+			return Churn{}, nil
+		}
+		return Churn{}, err
+	}
+	var c Churn
+	authors := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || len(fields[0]) < 40 {
+			continue
+		}
+		c.Commits++
+		authors[fields[1]] = true
+		if sec, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			if t := time.Unix(sec, 0).UTC(); t.After(c.LastChanged) {
+				c.LastChanged = t
+			}
+		}
+	}
+	c.Authors = len(authors)
+	return c, nil
+}
+
+// Zone is a function that changes often and is called from many places.
+type Zone struct {
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Commits int    `json:"commits"`
+	Callers int    `json:"callers"`
+	// Score is Commits × Callers: how much a change is likely to break.
+	Score int `json:"score"`
+}
+
+// DangerZones lists the functions with churn, the highest Score first,
+// at most top of them (0 = all). Functions nothing calls are skipped.
+func DangerZones(graph map[string]callgraph.FunctionNode, churn map[string]Churn, top int) []Zone {
+	fanIn := make(map[string]int)
+	for _, node := range graph {
+		for _, c := range node.Callees {
+			fanIn[c]++
+		}
+	}
+	out := []Zone{}
+	for name, c := range churn {
+		node, ok := graph[name]
+		if !ok || fanIn[name] == 0 {
+			continue
+		}
+		out = append(out, Zone{
+			Name:    name,
+			Package: node.Package,
+			File:    node.File,
+			Line:    node.Line,
+			Commits: c.Commits,
+			Callers: fanIn[name],
+			Score:   c.Commits * fanIn[name],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		return a.Name < b.Name
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
@@ -0,0 +1,350 @@
+// Package config loads shared geeparse settings from a geeparse.yaml file
+// and GEEPARSE_* environment variables.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+	"github.com/ishanmadhav/geeparse/pkg/traces"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the config file looked for in the working directory
+// when no path is given.
+const DefaultFile = "geeparse.yaml"
+
+// Config holds every setting a team might want to commit. Zero values
+// (and nil pointers) mean "not set", leaving the command-line default.
+type Config struct {
+	Root    string   `yaml:"root"`
+	Exclude []string `yaml:"exclude"`
+	Backend string   `yaml:"backend"`
+	Index   string   `yaml:"index"` // LSIF dump for the lsif backend
+	// MaxFileSize and MaxFunctionSize bound what a build takes in, in
+	// bytes: larger files are skipped and longer definitions truncated.
+	// -1 lifts a limit.
+	MaxFileSize     *int    `yaml:"max_file_size"`
+	MaxFunctionSize *int    `yaml:"max_function_size"`
+	Gopls           Gopls   `yaml:"gopls"`
+	Server          Server  `yaml:"server"`
+	Storage         Storage `yaml:"storage"`
+	Log             Log     `yaml:"log"`
+	Notify          Notify  `yaml:"notify"`
+
+	Embeddings Embeddings `yaml:"embeddings"`
+
+	// Redact, "omit" or "hash", keeps function bodies out of built and
+	// exported graphs, for sharing them without the code.
+	Redact string `yaml:"redact"`
+
+	// Plugins are external programs offered as extra export formats.
+	Plugins []export.Plugin `yaml:"plugins"`
+
+	// Rules are architecture policies checked by "geeparse check" and
+	// shown in the UI.
+	Rules []policy.Rule `yaml:"rules"`
+
+	// Thresholds are limits on fan-out, call depth and cycle size,
+	// warned about after each build, by "geeparse check", in reports and
+	// at /api/warnings.
+	Thresholds policy.Thresholds `yaml:"thresholds"`
+
+	Traces Traces `yaml:"traces"`
+
+	// Projects are the repositories "geeparse batch" builds.
+	Projects []Project `yaml:"projects"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Addr       string `yaml:"addr"`
+	BasePath   string `yaml:"base_path"`
+	MaxNodes   *int   `yaml:"max_nodes"`
+	MaxEdges   *int   `yaml:"max_edges"`
+	AdminToken string `yaml:"admin_token"`
+	GitHub     GitHub `yaml:"github"`
+
+	// IDLength is how many hex digits stable function IDs have.
+	IDLength *int `yaml:"id_length"`
+
+	// RebuildInterval is how often serve rebuilds the root, as a Go
+	// duration such as "15m".
+	RebuildInterval string `yaml:"rebuild_interval"`
+
+	// CacheSize bounds the response cache in bytes; 0 disables it.
+	// CacheTTL is how long cached responses live, as a Go duration.
+	CacheSize *int   `yaml:"cache_size"`
+	CacheTTL  string `yaml:"cache_ttl"`
+}
+
+// GitHub configures rebuilds triggered by GitHub push webhooks.
+type GitHub struct {
+	Secret string `yaml:"secret"`
+	Branch string `yaml:"branch"`
+}
+
+// Gopls bounds the gopls process builds run; past a limit it is
+// restarted, and past MaxRestarts restarts the build fails.
+type Gopls struct {
+	MaxMemoryMB *int     `yaml:"max_memory_mb"`
+	MaxCPU      *float64 `yaml:"max_cpu"` // cores, sustained
+	MaxRestarts *int     `yaml:"max_restarts"`
+}
+
+// Log configures diagnostic output.
+type Log struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+}
+
+// Notify configures where rebuild summaries are posted.
+type Notify struct {
+	Webhook string `yaml:"webhook"`
+	Format  string `yaml:"format"` // slack, teams or json
+}
+
+// Embeddings configures the provider behind semantic search. API keys
+// come from the environment only, never the file.
+type Embeddings struct {
+	Provider string `yaml:"provider"` // openai, ollama or hash
+	Model    string `yaml:"model"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Traces configures how "geeparse traces" maps spans to functions.
+type Traces struct {
+	// Rules are tried in order before the span's code.function
+	// attributes and name.
+	Rules []traces.Rule `yaml:"rules"`
+}
+
+// Storage configures where graphs are kept.
+type Storage struct {
+	DB string `yaml:"db"`
+}
+
+// Load reads the config file at path, then overlays GEEPARSE_*
+// environment variables. An empty path means DefaultFile, which may be
+// missing; an explicit path must exist. Relative root and storage paths in
+// the file, and project directories, are resolved against the file's
+// directory.
+func Load(path string) (*Config, error) {
+	var c Config
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := c.parse(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := policy.Validate(c.Rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := c.Thresholds.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := traces.ValidateRules(c.Traces.Rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := validateProjects(c.Projects); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		c.resolvePaths(filepath.Dir(path))
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	default:
+		return nil, err
+	}
+
+	if err := c.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// parse decodes YAML, rejecting unknown keys so typos don't go unnoticed.
+func (c *Config) parse(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func (c *Config) resolvePaths(dir string) {
+	if c.Root != "" && !filepath.IsAbs(c.Root) {
+		c.Root = filepath.Join(dir, c.Root)
+	}
+	if c.Index != "" && !filepath.IsAbs(c.Index) {
+		c.Index = filepath.Join(dir, c.Index)
+	}
+	for i, p := range c.Plugins {
+		// bare command names are looked up on PATH
+		if strings.ContainsRune(p.Command, filepath.Separator) && !filepath.IsAbs(p.Command) {
+			// absolute, since exec treats a slash-free path as a PATH lookup
+			if abs, err := filepath.Abs(filepath.Join(dir, p.Command)); err == nil {
+				c.Plugins[i].Command = abs
+			}
+		}
+	}
+	if c.Storage.DB != "" && !filepath.IsAbs(c.Storage.DB) {
+		c.Storage.DB = filepath.Join(dir, c.Storage.DB)
+	}
+	for i, p := range c.Projects {
+		if p.Dir != "" && !filepath.IsAbs(p.Dir) {
+			c.Projects[i].Dir = filepath.Join(dir, p.Dir)
+		}
+	}
+}
+
+// applyEnv overrides settings from the environment. GEEPARSE_EXCLUDE is
+// comma-separated.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok {
+			*dst = v
+		}
+	}
+	num := func(key string, dst **int) error {
+		v, ok := lookup(key)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*dst = &n
+		return nil
+	}
+
+	str("GEEPARSE_ROOT", &c.Root)
+	if v, ok := lookup("GEEPARSE_EXCLUDE"); ok {
+		c.Exclude = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.Exclude = append(c.Exclude, p)
+			}
+		}
+	}
+	str("GEEPARSE_BACKEND", &c.Backend)
+	str("GEEPARSE_INDEX", &c.Index)
+	str("GEEPARSE_REDACT", &c.Redact)
+	str("GEEPARSE_ADDR", &c.Server.Addr)
+	str("GEEPARSE_BASE_PATH", &c.Server.BasePath)
+	str("GEEPARSE_ADMIN_TOKEN", &c.Server.AdminToken)
+	str("GEEPARSE_GITHUB_SECRET", &c.Server.GitHub.Secret)
+	str("GEEPARSE_GITHUB_BRANCH", &c.Server.GitHub.Branch)
+	str("GEEPARSE_REBUILD_INTERVAL", &c.Server.RebuildInterval)
+	str("GEEPARSE_CACHE_TTL", &c.Server.CacheTTL)
+	str("GEEPARSE_DB", &c.Storage.DB)
+	str("GEEPARSE_LOG_LEVEL", &c.Log.Level)
+	str("GEEPARSE_LOG_FORMAT", &c.Log.Format)
+	str("GEEPARSE_WEBHOOK", &c.Notify.Webhook)
+	str("GEEPARSE_WEBHOOK_FORMAT", &c.Notify.Format)
+	str("GEEPARSE_EMBEDDINGS_PROVIDER", &c.Embeddings.Provider)
+	str("GEEPARSE_EMBEDDINGS_MODEL", &c.Embeddings.Model)
+	str("GEEPARSE_EMBEDDINGS_ENDPOINT", &c.Embeddings.Endpoint)
+	if err := num("GEEPARSE_MAX_FILE_SIZE", &c.MaxFileSize); err != nil {
+		return err
+	}
+	if err := num("GEEPARSE_MAX_FUNCTION_SIZE", &c.MaxFunctionSize); err != nil {
+		return err
+	}
+	if err := num("GEEPARSE_GOPLS_MAX_MEMORY_MB", &c.Gopls.MaxMemoryMB); err != nil {
+		return err
+	}
+	if v, ok := lookup("GEEPARSE_GOPLS_MAX_CPU"); ok {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("GEEPARSE_GOPLS_MAX_CPU: %w", err)
+		}
+		c.Gopls.MaxCPU = &n
+	}
+	if err := num("GEEPARSE_GOPLS_MAX_RESTARTS", &c.Gopls.MaxRestarts); err != nil {
+		return err
+	}
+	if err := num("GEEPARSE_MAX_NODES", &c.Server.MaxNodes); err != nil {
+		return err
+	}
+	if err := num("GEEPARSE_ID_LENGTH", &c.Server.IDLength); err != nil {
+		return err
+	}
+	if err := num("GEEPARSE_CACHE_SIZE", &c.Server.CacheSize); err != nil {
+		return err
+	}
+	return num("GEEPARSE_MAX_EDGES", &c.Server.MaxEdges)
+}
+
+// Flags maps command-line flag names to the configured values, for the
+// settings that are set.
+func (c *Config) Flags() map[string]string {
+	out := make(map[string]string)
+	set := func(name, v string) {
+		if v != "" {
+			out[name] = v
+		}
+	}
+	set("root", c.Root)
+	set("exclude", strings.Join(c.Exclude, ","))
+	set("backend", c.Backend)
+	set("index", c.Index)
+	set("redact", c.Redact)
+	set("addr", c.Server.Addr)
+	set("base-path", c.Server.BasePath)
+	set("admin-token", c.Server.AdminToken)
+	set("github-secret", c.Server.GitHub.Secret)
+	set("github-branch", c.Server.GitHub.Branch)
+	set("rebuild-interval", c.Server.RebuildInterval)
+	set("cache-ttl", c.Server.CacheTTL)
+	set("db", c.Storage.DB)
+	set("log-level", c.Log.Level)
+	set("log-format", c.Log.Format)
+	set("webhook", c.Notify.Webhook)
+	set("webhook-format", c.Notify.Format)
+	set("embeddings-provider", c.Embeddings.Provider)
+	set("embeddings-model", c.Embeddings.Model)
+	set("embeddings-endpoint", c.Embeddings.Endpoint)
+	if c.MaxFileSize != nil {
+		out["max-file-size"] = strconv.Itoa(*c.MaxFileSize)
+	}
+	if c.MaxFunctionSize != nil {
+		out["max-function-size"] = strconv.Itoa(*c.MaxFunctionSize)
+	}
+	if c.Gopls.MaxMemoryMB != nil {
+		out["gopls-max-memory"] = strconv.Itoa(*c.Gopls.MaxMemoryMB)
+	}
+	if c.Gopls.MaxCPU != nil {
+		out["gopls-max-cpu"] = strconv.FormatFloat(*c.Gopls.MaxCPU, 'g', -1, 64)
+	}
+	if c.Gopls.MaxRestarts != nil {
+		out["gopls-max-restarts"] = strconv.Itoa(*c.Gopls.MaxRestarts)
+	}
+	if c.Server.MaxNodes != nil {
+		out["max-nodes"] = strconv.Itoa(*c.Server.MaxNodes)
+	}
+	if c.Server.MaxEdges != nil {
+		out["max-edges"] = strconv.Itoa(*c.Server.MaxEdges)
+	}
+	if c.Server.IDLength != nil {
+		out["id-length"] = strconv.Itoa(*c.Server.IDLength)
+	}
+	if c.Server.CacheSize != nil {
+		out["cache-size"] = strconv.Itoa(*c.Server.CacheSize)
+	}
+	return out
+}
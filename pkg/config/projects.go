@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Project is one repository of a fleet that "geeparse batch" builds into
+// a shared store, under its own namespace.
+type Project struct {
+	// Name is the namespace the project's functions are stored under,
+	// as Name/Function.
+	Name string `yaml:"name"`
+	// Dir is a local checkout to analyze; Repo a git URL to shallow-clone
+	// at Ref (default: the remote's HEAD) instead. Exactly one is set.
+	Dir  string `yaml:"dir"`
+	Repo string `yaml:"repo"`
+	Ref  string `yaml:"ref"`
+	// Exclude adds globs of files or directories to skip to the shared
+	// exclude list.
+	Exclude []string `yaml:"exclude"`
+}
+
+// validateProjects checks that every project has a unique namespace and
+// one place to build from.
+func validateProjects(projects []Project) error {
+	seen := make(map[string]bool, len(projects))
+	for i, p := range projects {
+		switch {
+		case p.Name == "" || strings.ContainsAny(p.Name, "/*? \t"):
+			return fmt.Errorf("projects[%d]: bad name %q: names are namespaces, without slashes, spaces or globs", i, p.Name)
+		case seen[p.Name]:
+			return fmt.Errorf("projects[%d]: name %q is used twice", i, p.Name)
+		case (p.Dir == "") == (p.Repo == ""):
+			return fmt.Errorf("project %s: set one of dir and repo", p.Name)
+		case p.Ref != "" && p.Repo == "":
+			return fmt.Errorf("project %s: ref needs repo", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
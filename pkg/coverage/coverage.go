@@ -0,0 +1,219 @@
+// Package coverage reads Go cover profiles (go test -coverprofile) and
+// attributes their statement counts to the functions of a call-graph.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Block is one line of a cover profile: a span of statements and how
+// often it ran.
+type Block struct {
+	File      string // as written in the profile, usually an import path
+	StartLine int
+	EndLine   int
+	NumStmt   int
+	Count     int
+}
+
+// Stats is the statement coverage of one function.
+type Stats struct {
+	Covered    int `json:"covered"`
+	Statements int `json:"statements"`
+}
+
+// Percent returns the share of statements covered, 0-100. Functions
+// without statements count as fully covered.
+func (s Stats) Percent() float64 {
+	if s.Statements == 0 {
+		return 100
+	}
+	return 100 * float64(s.Covered) / float64(s.Statements)
+}
+
+// ParseProfile reads a cover profile in any mode (set, count, atomic).
+func ParseProfile(r io.Reader) ([]Block, error) {
+	var blocks []Block
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		b, err := parseBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, sc.Err()
+}
+
+// parseBlock parses "file.go:12.34,15.2 3 1".
+func parseBlock(line string) (Block, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return Block{}, fmt.Errorf("malformed block %q", line)
+	}
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return Block{}, fmt.Errorf("malformed block %q", line)
+	}
+	start, end, ok := strings.Cut(fields[0], ",")
+	if !ok {
+		return Block{}, fmt.Errorf("malformed range in %q", line)
+	}
+	b := Block{File: line[:colon]}
+	var err error
+	if b.StartLine, err = lineOf(start); err != nil {
+		return Block{}, err
+	}
+	if b.EndLine, err = lineOf(end); err != nil {
+		return Block{}, err
+	}
+	if b.NumStmt, err = strconv.Atoi(fields[1]); err != nil {
+		return Block{}, err
+	}
+	if b.Count, err = strconv.Atoi(fields[2]); err != nil {
+		return Block{}, err
+	}
+	return b, nil
+}
+
+// lineOf takes the line out of a "line.column" position.
+func lineOf(pos string) (int, error) {
+	l, _, _ := strings.Cut(pos, ".")
+	return strconv.Atoi(l)
+}
+
+// Attribute sums the blocks falling inside each function of graph. Profile
+// files are matched to graph files by their package-relative path, so
+// import paths in the profile line up with the analyzed checkout wherever
+// it lives. Functions with no matching blocks are left out; blocks listed
+// more than once (merged profiles) count as covered if any copy ran.
+func Attribute(graph map[string]callgraph.FunctionNode, blocks []Block) map[string]Stats {
+	type key struct {
+		file               string
+		start, end, nstmts int
+	}
+	merged := make(map[key]int)
+	var keys []key
+	for _, b := range blocks {
+		k := key{b.File, b.StartLine, b.EndLine, b.NumStmt}
+		if _, ok := merged[k]; !ok {
+			keys = append(keys, k)
+		}
+		merged[k] = max(merged[k], b.Count)
+	}
+
+	// index functions by the slash path the profile would end with
+	byRel := make(map[string][]string)
+	for name, node := range graph {
+		if node.File == "" {
+			continue
+		}
+		rel := filepath.Base(node.File)
+		if node.Package != "" && node.Package != "." {
+			rel = node.Package + "/" + rel
+		}
+		byRel[rel] = append(byRel[rel], name)
+	}
+	for _, names := range byRel {
+		sort.Slice(names, func(i, j int) bool { return graph[names[i]].Line < graph[names[j]].Line })
+	}
+
+	out := make(map[string]Stats)
+	for _, k := range keys {
+		names := byRel[matchFile(byRel, k.file)]
+		for _, name := range names {
+			node := graph[name]
+			end := node.EndLine
+			if end == 0 {
+				end = node.Line
+			}
+			if k.start < node.Line || k.start > end {
+				continue
+			}
+			st := out[name]
+			st.Statements += k.nstmts
+			if merged[k] > 0 {
+				st.Covered += k.nstmts
+			}
+			out[name] = st
+			break
+		}
+	}
+	return out
+}
+
+// matchFile returns the longest package-relative path that file ends with.
+func matchFile(byRel map[string][]string, file string) string {
+	best := ""
+	for rel := range byRel {
+		if (file == rel || strings.HasSuffix(file, "/"+rel)) && len(rel) > len(best) {
+			best = rel
+		}
+	}
+	return best
+}
+
+// Hotspot is a poorly covered function with many callers.
+type Hotspot struct {
+	Name    string  `json:"name"`
+	Package string  `json:"package"`
+	File    string  `json:"file"`
+	Line    int     `json:"line"`
+	Percent float64 `json:"percent"`
+	Callers int     `json:"callers"`
+}
+
+// Hotspots lists functions covered below the given percentage, the most
+// called first, at most top of them (0 = all). Functions without coverage
+// data are skipped.
+func Hotspots(graph map[string]callgraph.FunctionNode, cov map[string]Stats, below float64, top int) []Hotspot {
+	fanIn := make(map[string]int)
+	for _, node := range graph {
+		for _, c := range node.Callees {
+			fanIn[c]++
+		}
+	}
+	out := []Hotspot{}
+	for name, st := range cov {
+		node, ok := graph[name]
+		if !ok || st.Percent() >= below {
+			continue
+		}
+		out = append(out, Hotspot{
+			Name:    name,
+			Package: node.Package,
+			File:    node.File,
+			Line:    node.Line,
+			Percent: st.Percent(),
+			Callers: fanIn[name],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Callers != b.Callers {
+			return a.Callers > b.Callers
+		}
+		if a.Percent != b.Percent {
+			return a.Percent < b.Percent
+		}
+		return a.Name < b.Name
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
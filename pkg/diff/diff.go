@@ -0,0 +1,287 @@
+// Package diff compares two call-graphs, e.g. two snapshots or two builds.
+package diff
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Edge is one caller→callee call.
+type Edge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+}
+
+func (e Edge) String() string { return e.Caller + " → " + e.Callee }
+
+// EdgeNote is a note someone left on a call, with its review status,
+// as kept with the graph the call belongs to.
+type EdgeNote struct {
+	Edge
+	Note   string `json:"note"`
+	Author string `json:"author,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+func (n EdgeNote) String() string {
+	s := n.Edge.String() + ": " + n.Note
+	switch {
+	case n.Author != "" && n.Status != "":
+		s += " (" + n.Author + ", " + n.Status + ")"
+	case n.Author != "" || n.Status != "":
+		s += " (" + n.Author + n.Status + ")"
+	}
+	return s
+}
+
+// SignatureChange is an exported function whose parameters or results
+// changed, which may break its callers outside the graph.
+type SignatureChange struct {
+	Function string `json:"function"`
+	Old      string `json:"old"`
+	New      string `json:"new"`
+}
+
+func (c SignatureChange) String() string {
+	return c.Function + ": " + c.Old + " → " + c.New
+}
+
+// Rename is a function that went away and came back under a new name
+// with the same body; see callgraph.Renames.
+type Rename struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func (r Rename) String() string { return r.Old + " → " + r.New }
+
+// Result lists what changed between an old and a new graph. Every list is
+// sorted.
+type Result struct {
+	AddedFunctions   []string `json:"addedFunctions"`
+	RemovedFunctions []string `json:"removedFunctions"`
+	// RenamedFunctions are likely renames, which are in neither of the
+	// lists above; calls to and from them count under their new names.
+	RenamedFunctions []Rename `json:"renamedFunctions"`
+	AddedEdges       []Edge   `json:"addedEdges"`
+	RemovedEdges     []Edge   `json:"removedEdges"`
+	// SignatureChanges are the potential breaking API changes: exported
+	// functions in both graphs with a different signature.
+	SignatureChanges []SignatureChange `json:"signatureChanges"`
+	// ChangedFunctions are the other functions in both graphs whose
+	// source changed: body edits, and signature changes of unexported
+	// functions, which only break callers in their own package.
+	ChangedFunctions []string `json:"changedFunctions"`
+	// RemovedNotes are the notes on RemovedEdges, once AttachNotes has
+	// been given them: the hacks that are gone and the reviews that no
+	// longer apply.
+	RemovedNotes []EdgeNote `json:"removedNotes,omitempty"`
+}
+
+// Compare reports the functions and calls present in only one of the
+// graphs, telling renames from removals and additions by body hash.
+func Compare(old, new map[string]callgraph.FunctionNode) Result {
+	r := Result{
+		AddedFunctions:   []string{},
+		RemovedFunctions: []string{},
+		RenamedFunctions: []Rename{},
+		AddedEdges:       []Edge{},
+		RemovedEdges:     []Edge{},
+		SignatureChanges: []SignatureChange{},
+		ChangedFunctions: []string{},
+	}
+	renames := callgraph.Renames(callgraph.BodyHashes(old), callgraph.BodyHashes(new))
+	renamed := make(map[string]bool, len(renames))
+	for from, to := range renames {
+		r.RenamedFunctions = append(r.RenamedFunctions, Rename{Old: from, New: to})
+		renamed[to] = true
+	}
+	for name, fn := range new {
+		prev, ok := old[name]
+		switch {
+		case renamed[name]:
+		case !ok:
+			r.AddedFunctions = append(r.AddedFunctions, name)
+		case normalize(prev.Signature) != normalize(fn.Signature) && Exported(name):
+			r.SignatureChanges = append(r.SignatureChanges, SignatureChange{Function: name, Old: prev.Signature, New: fn.Signature})
+		case prev.Definition != fn.Definition || prev.Signature != fn.Signature:
+			r.ChangedFunctions = append(r.ChangedFunctions, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok && renames[name] == "" {
+			r.RemovedFunctions = append(r.RemovedFunctions, name)
+		}
+	}
+	oldEdges, newEdges := edgeSet(old, renames), edgeSet(new, nil)
+	for e := range newEdges {
+		if !oldEdges[e] {
+			r.AddedEdges = append(r.AddedEdges, e)
+		}
+	}
+	for e := range oldEdges {
+		if !newEdges[e] {
+			r.RemovedEdges = append(r.RemovedEdges, e)
+		}
+	}
+
+	sort.Strings(r.AddedFunctions)
+	sort.Strings(r.RemovedFunctions)
+	sort.Slice(r.RenamedFunctions, func(i, j int) bool { return r.RenamedFunctions[i].Old < r.RenamedFunctions[j].Old })
+	sort.Slice(r.SignatureChanges, func(i, j int) bool { return r.SignatureChanges[i].Function < r.SignatureChanges[j].Function })
+	sort.Strings(r.ChangedFunctions)
+	sortEdges(r.AddedEdges)
+	sortEdges(r.RemovedEdges)
+	return r
+}
+
+// AttachNotes sets RemovedNotes to those of notes on a removed call,
+// matched by caller and callee name. The first note on a call wins.
+func (r *Result) AttachNotes(notes []EdgeNote) {
+	removed := make(map[Edge]bool, len(r.RemovedEdges))
+	for _, e := range r.RemovedEdges {
+		removed[e] = true
+	}
+	r.RemovedNotes = nil
+	for _, n := range notes {
+		if removed[n.Edge] && n.Note != "" {
+			r.RemovedNotes = append(r.RemovedNotes, n)
+			delete(removed, n.Edge)
+		}
+	}
+	sort.Slice(r.RemovedNotes, func(i, j int) bool {
+		a, b := r.RemovedNotes[i].Edge, r.RemovedNotes[j].Edge
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+}
+
+// Exported reports whether the function name, which may be namespaced as
+// prefix/Name, is exported.
+func Exported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(path.Base(name))
+	return unicode.IsUpper(r)
+}
+
+// normalize collapses runs of white space in a signature, so reformatting
+// alone isn't a change.
+func normalize(sig string) string {
+	return strings.Join(strings.Fields(sig), " ")
+}
+
+// Empty reports whether the graphs were identical.
+func (r Result) Empty() bool {
+	return len(r.AddedFunctions) == 0 && len(r.RemovedFunctions) == 0 && len(r.RenamedFunctions) == 0 &&
+		len(r.AddedEdges) == 0 && len(r.RemovedEdges) == 0 &&
+		len(r.SignatureChanges) == 0 && len(r.ChangedFunctions) == 0
+}
+
+// WriteText writes a short +/- listing meant to be pasted into a review
+// comment.
+func (r Result) WriteText(w io.Writer) error {
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "No call-graph changes.")
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Call-graph changes: +%d/-%d functions, %d renamed, +%d/-%d calls, %d signatures and %d bodies changed\n",
+		len(r.AddedFunctions), len(r.RemovedFunctions), len(r.RenamedFunctions), len(r.AddedEdges), len(r.RemovedEdges),
+		len(r.SignatureChanges), len(r.ChangedFunctions)); err != nil {
+		return err
+	}
+	sections := []struct {
+		title string
+		sign  string
+		items []string
+	}{
+		{"Signature changes (possibly breaking)", "!", signatureStrings(r.SignatureChanges)},
+		{"Added functions", "+", r.AddedFunctions},
+		{"Removed functions", "-", r.RemovedFunctions},
+		{"Renamed functions", "=", renameStrings(r.RenamedFunctions)},
+		{"Added calls", "+", edgeStrings(r.AddedEdges)},
+		{"Removed calls", "-", edgeStrings(r.RemovedEdges)},
+		{"Removed calls with notes", "-", noteStrings(r.RemovedNotes)},
+		{"Changed functions", "~", r.ChangedFunctions},
+	}
+	for _, sec := range sections {
+		if len(sec.items) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\n%s:\n", sec.title); err != nil {
+			return err
+		}
+		for _, item := range sec.items {
+			if _, err := fmt.Fprintf(w, "%s %s\n", sec.sign, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// edgeSet returns graph's calls, with the functions in renames under
+// their new names.
+func edgeSet(graph map[string]callgraph.FunctionNode, renames map[string]string) map[Edge]bool {
+	rename := func(name string) string {
+		if to, ok := renames[name]; ok {
+			return to
+		}
+		return name
+	}
+	set := make(map[Edge]bool)
+	for caller, node := range graph {
+		for _, callee := range node.Callees {
+			set[Edge{Caller: rename(caller), Callee: rename(callee)}] = true
+		}
+	}
+	return set
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Caller != edges[j].Caller {
+			return edges[i].Caller < edges[j].Caller
+		}
+		return edges[i].Callee < edges[j].Callee
+	})
+}
+
+func edgeStrings(edges []Edge) []string {
+	out := make([]string, len(edges))
+	for i, e := range edges {
+		out[i] = e.String()
+	}
+	return out
+}
+
+func noteStrings(notes []EdgeNote) []string {
+	out := make([]string, len(notes))
+	for i, n := range notes {
+		out[i] = n.String()
+	}
+	return out
+}
+
+func renameStrings(renames []Rename) []string {
+	out := make([]string, len(renames))
+	for i, r := range renames {
+		out[i] = r.String()
+	}
+	return out
+}
+
+func signatureStrings(changes []SignatureChange) []string {
+	out := make([]string, len(changes))
+	for i, c := range changes {
+		out[i] = c.String()
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Span is a run of consecutive graphs of a Timeline, by index, both ends
+// included.
+type Span [2]int
+
+// Presence is when one function or call existed.
+type Presence struct {
+	Package string `json:"package,omitempty"` // functions only
+	Spans   []Span `json:"spans"`
+}
+
+// Timeline records which functions and calls exist in each of a series of
+// graphs, oldest first, for showing how a graph evolved: the union of
+// every graph, with the spans of graphs each element is in. An element
+// that disappears and comes back has several spans.
+type Timeline struct {
+	Functions map[string]Presence `json:"functions"`
+	Calls     []TimelineCall      `json:"calls"`
+}
+
+// TimelineCall is a call and when it existed.
+type TimelineCall struct {
+	Edge
+	Presence
+}
+
+// NewTimeline builds the Timeline of graphs. Functions take the package
+// they had in the last graph they appear in.
+func NewTimeline(graphs []map[string]callgraph.FunctionNode) Timeline {
+	t := Timeline{Functions: make(map[string]Presence), Calls: []TimelineCall{}}
+	calls := make(map[Edge]*Presence)
+	for i, graph := range graphs {
+		for name, node := range graph {
+			p := t.Functions[name]
+			p.Package = node.Package
+			p.Spans = extend(p.Spans, i)
+			t.Functions[name] = p
+			for _, c := range node.Callees {
+				if _, ok := graph[c]; !ok {
+					continue
+				}
+				e := Edge{Caller: name, Callee: c}
+				if calls[e] == nil {
+					calls[e] = &Presence{}
+				}
+				calls[e].Spans = extend(calls[e].Spans, i)
+			}
+		}
+	}
+	for e, p := range calls {
+		t.Calls = append(t.Calls, TimelineCall{Edge: e, Presence: *p})
+	}
+	sort.Slice(t.Calls, func(i, j int) bool {
+		a, b := t.Calls[i], t.Calls[j]
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+	return t
+}
+
+// extend records presence in graph i, which is never before the last
+// span's end.
+func extend(spans []Span, i int) []Span {
+	if n := len(spans); n > 0 && spans[n-1][1] >= i-1 {
+		spans[n-1][1] = i
+		return spans
+	}
+	return append(spans, Span{i, i})
+}
+
+// Graphs counts the graphs of the timeline p was present in.
+func (p Presence) Graphs() int {
+	n := 0
+	for _, s := range p.Spans {
+		n += s[1] - s[0] + 1
+	}
+	return n
+}
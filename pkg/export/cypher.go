@@ -0,0 +1,52 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Cypher writes graph as Cypher statements that load it into Neo4j: a
+// :Function node per function, carrying its package, location, signature
+// and source, and a :CALLS relationship per call. Pipe it into
+// cypher-shell; re-running it against the same database duplicates the
+// graph, so load into an empty one or first run
+// "MATCH (f:Function) DETACH DELETE f".
+func Cypher(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return cypher(w, graph, nil)
+}
+
+// cypher is Cypher with a weight property on weighted CALLS relationships.
+func cypher(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	ew := &errWriter{w: w}
+	ew.printf("CREATE INDEX function_name IF NOT EXISTS FOR (f:Function) ON (f.name);\n")
+	names := sortedNames(graph)
+	for _, name := range names {
+		node := graph[name]
+		ew.printf("CREATE (:Function {name: %s, package: %s, file: %s, line: %d, endLine: %d, signature: %s, definition: %s});\n",
+			cypherString(name), cypherString(node.Package), cypherString(node.File), node.Line, node.EndLine,
+			cypherString(node.Signature), cypherString(node.Definition))
+	}
+	for _, name := range names {
+		for _, callee := range sortedCallees(graph[name]) {
+			if _, ok := graph[callee]; !ok {
+				continue
+			}
+			props := ""
+			if wt, ok := weights[name][callee]; ok {
+				props = fmt.Sprintf(" {weight: %.4f}", wt)
+			}
+			ew.printf("MATCH (a:Function {name: %s}), (b:Function {name: %s}) CREATE (a)-[:CALLS%s]->(b);\n",
+				cypherString(name), cypherString(callee), props)
+		}
+	}
+	return ew.err
+}
+
+// cypherString quotes s as a Cypher string literal.
+func cypherString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return "'" + r.Replace(s) + "'"
+}
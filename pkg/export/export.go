@@ -0,0 +1,121 @@
+// Package export renders call-graphs in formats other tools understand.
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Weights rates calls from 0 (cold) to 1 (hottest), keyed by caller then
+// callee, e.g. from a runtime profile. Formats that can show it draw hot
+// calls more prominently; missing calls count as 0.
+type Weights map[string]map[string]float64
+
+// DOT writes graph as a Graphviz digraph with one node per function and
+// one edge per call. Output is sorted so exports diff cleanly.
+func DOT(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return dot(w, graph, nil)
+}
+
+// dot is DOT with hot calls drawn with thicker pens.
+func dot(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph callgraph {\n")
+	ew.printf("  rankdir=LR;\n  node [shape=box, fontname=\"sans-serif\"];\n")
+	for _, name := range sortedNames(graph) {
+		ew.printf("  %s;\n", strconv.Quote(name))
+	}
+	for _, name := range sortedNames(graph) {
+		for _, callee := range sortedCallees(graph[name]) {
+			if wt := weights[name][callee]; wt > 0 {
+				ew.printf("  %s -> %s [penwidth=%.2f];\n", strconv.Quote(name), strconv.Quote(callee), 1+5*wt)
+				continue
+			}
+			ew.printf("  %s -> %s;\n", strconv.Quote(name), strconv.Quote(callee))
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+// errWriter remembers the first write error so writers can print freely
+// and check once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+func sortedNames(graph map[string]callgraph.FunctionNode) []string {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedCallees(node callgraph.FunctionNode) []string {
+	callees := append([]string(nil), node.Callees...)
+	sort.Strings(callees)
+	return callees
+}
+
+// Filter narrows a graph before export: to the calls of the listed Kinds
+// (see callgraph.CallKinds), to what Root reaches along them (within
+// Depth calls when Depth > 0) and to the listed Packages, with generated
+// code handled as Generated says. Zero values keep everything.
+type Filter struct {
+	Root     string
+	Depth    int
+	Packages []string
+	Kinds    []string
+	// Generated is GeneratedCollapse, GeneratedHide or empty to keep
+	// generated functions as they are.
+	Generated string
+	// Redact is callgraph.RedactOmit or callgraph.RedactHash to leave
+	// function bodies out, or empty to keep them.
+	Redact string
+}
+
+// Values of Filter.Generated.
+const (
+	// GeneratedCollapse replaces generated functions with one proxy node
+	// per kind and package; see callgraph.CollapseGenerated.
+	GeneratedCollapse = "collapse"
+	// GeneratedHide drops generated functions.
+	GeneratedHide = "hide"
+)
+
+// Apply returns the filtered graph, or an error if Root isn't a function
+// or Generated or Redact isn't known.
+func (f Filter) Apply(graph map[string]callgraph.FunctionNode) (map[string]callgraph.FunctionNode, error) {
+	graph = callgraph.FilterKinds(graph, f.Kinds)
+	if f.Root != "" {
+		graph = callgraph.Subgraph(graph, f.Root, f.Depth)
+		if graph == nil {
+			return nil, fmt.Errorf("unknown root function %q", f.Root)
+		}
+	}
+	graph = callgraph.FilterPackages(graph, f.Packages)
+	switch f.Generated {
+	case "":
+	case GeneratedCollapse:
+		graph = callgraph.CollapseGenerated(graph)
+	case GeneratedHide:
+		graph = callgraph.WithoutGenerated(graph)
+	default:
+		return nil, fmt.Errorf("unknown generated mode %q (want %s or %s)", f.Generated, GeneratedCollapse, GeneratedHide)
+	}
+	return callgraph.Redact(graph, f.Redact)
+}
@@ -0,0 +1,308 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Formats lists every format Write understands, in the order shown to
+// users: the built-in ones, then any added with Register.
+var Formats = []string{"dot", "mermaid", "graphml", "gexf", "csv", "json", "ndjson", "lsif", "cypher", "layers", "matrix", "matrix-json"}
+
+// Write renders graph in the named format.
+func Write(w io.Writer, format string, graph map[string]callgraph.FunctionNode) error {
+	return WriteWeighted(w, format, graph, nil)
+}
+
+// WriteWeighted renders graph in the named format, emphasizing calls by
+// weight where the format allows: thicker DOT and layers pens, thick Mermaid arrows,
+// and a weight on GraphML, GEXF, NDJSON, Cypher and matrix-json edges.
+func WriteWeighted(w io.Writer, format string, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	switch strings.ToLower(format) {
+	case "dot":
+		return dot(w, graph, weights)
+	case "mermaid":
+		return mermaid(w, graph, weights)
+	case "graphml":
+		return graphML(w, graph, weights)
+	case "gexf":
+		return gexf(w, graph, weights)
+	case "csv":
+		return CSV(w, graph)
+	case "json":
+		return JSON(w, graph)
+	case "ndjson":
+		return ndjson(w, graph, weights)
+	case "lsif":
+		return LSIF(w, graph)
+	case "cypher":
+		return cypher(w, graph, weights)
+	case "layers":
+		return layers(w, graph, weights)
+	case "matrix":
+		return Matrix(w, graph)
+	case "matrix-json":
+		return matrixJSON(w, graph, weights)
+	default:
+		if e, ok := registered(format); ok {
+			return e.Export(w, graph, weights)
+		}
+		return fmt.Errorf("unknown export format %q (want one of %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// ContentType returns the MIME type to serve an export format with.
+func ContentType(format string) string {
+	if e, ok := registered(format); ok {
+		return e.ContentType()
+	}
+	switch strings.ToLower(format) {
+	case "dot", "layers":
+		return "text/vnd.graphviz; charset=utf-8"
+	case "graphml", "gexf":
+		return "application/xml; charset=utf-8"
+	case "csv", "matrix":
+		return "text/csv; charset=utf-8"
+	case "json", "matrix-json":
+		return "application/json; charset=utf-8"
+	case "ndjson", "lsif":
+		return "application/x-ndjson; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Extension returns the usual file extension for an export format.
+func Extension(format string) string {
+	if e, ok := registered(format); ok {
+		return e.Extension()
+	}
+	switch strings.ToLower(format) {
+	case "mermaid":
+		return "mmd"
+	case "layers":
+		return "dot"
+	case "matrix":
+		return "csv"
+	case "matrix-json":
+		return "json"
+	}
+	return strings.ToLower(format)
+}
+
+// Mermaid writes graph as a Mermaid flowchart. Functions get short
+// generated IDs since Mermaid IDs can't hold arbitrary names.
+func Mermaid(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return mermaid(w, graph, nil)
+}
+
+// mermaid is Mermaid with calls weighing at least 0.25 drawn as thick
+// arrows.
+func mermaid(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	ew := &errWriter{w: w}
+	names := sortedNames(graph)
+	ids := make(map[string]string, len(names))
+	ew.printf("flowchart LR\n")
+	for i, name := range names {
+		ids[name] = fmt.Sprintf("n%d", i)
+		ew.printf("  %s[\"%s\"]\n", ids[name], strings.ReplaceAll(name, `"`, "#quot;"))
+	}
+	for _, name := range names {
+		for _, callee := range sortedCallees(graph[name]) {
+			if id, ok := ids[callee]; ok {
+				arrow := "-->"
+				if weights[name][callee] >= 0.25 {
+					arrow = "==>"
+				}
+				ew.printf("  %s %s %s\n", ids[name], arrow, id)
+			}
+		}
+	}
+	return ew.err
+}
+
+// GraphML writes graph as GraphML with package, signature, file and line
+// as node data.
+func GraphML(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return graphML(w, graph, nil)
+}
+
+// graphML is GraphML with a "weight" data value on weighted edges.
+func graphML(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	ew := &errWriter{w: w}
+	ew.printf("%s", xml.Header)
+	ew.printf(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	ew.printf(`  <key id="package" for="node" attr.name="package" attr.type="string"/>` + "\n")
+	ew.printf(`  <key id="signature" for="node" attr.name="signature" attr.type="string"/>` + "\n")
+	ew.printf(`  <key id="file" for="node" attr.name="file" attr.type="string"/>` + "\n")
+	ew.printf(`  <key id="line" for="node" attr.name="line" attr.type="int"/>` + "\n")
+	if weights != nil {
+		ew.printf(`  <key id="weight" for="edge" attr.name="weight" attr.type="double"/>` + "\n")
+	}
+	ew.printf(`  <graph id="callgraph" edgedefault="directed">` + "\n")
+	for _, name := range sortedNames(graph) {
+		node := graph[name]
+		ew.printf(`    <node id="%s">`+"\n", xmlEscape(name))
+		ew.printf(`      <data key="package">%s</data>`+"\n", xmlEscape(node.Package))
+		ew.printf(`      <data key="signature">%s</data>`+"\n", xmlEscape(node.Signature))
+		ew.printf(`      <data key="file">%s</data>`+"\n", xmlEscape(node.File))
+		ew.printf(`      <data key="line">%d</data>`+"\n", node.Line)
+		ew.printf("    </node>\n")
+	}
+	for _, name := range sortedNames(graph) {
+		for _, callee := range sortedCallees(graph[name]) {
+			if wt, ok := weights[name][callee]; ok {
+				ew.printf(`    <edge source="%s" target="%s"><data key="weight">%.4f</data></edge>`+"\n",
+					xmlEscape(name), xmlEscape(callee), wt)
+				continue
+			}
+			ew.printf(`    <edge source="%s" target="%s"/>`+"\n", xmlEscape(name), xmlEscape(callee))
+		}
+	}
+	ew.printf("  </graph>\n</graphml>\n")
+	return ew.err
+}
+
+// GEXF writes graph as GEXF 1.3 (Gephi's native format).
+func GEXF(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return gexf(w, graph, nil)
+}
+
+// gexf is GEXF with edge weights set (cold calls get 0) when weights is
+// non-nil.
+func gexf(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	ew := &errWriter{w: w}
+	ew.printf("%s", xml.Header)
+	ew.printf(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	ew.printf(`  <graph defaultedgetype="directed">` + "\n")
+	ew.printf(`    <attributes class="node">` + "\n")
+	ew.printf(`      <attribute id="0" title="package" type="string"/>` + "\n")
+	ew.printf(`      <attribute id="1" title="signature" type="string"/>` + "\n")
+	ew.printf("    </attributes>\n    <nodes>\n")
+	for _, name := range sortedNames(graph) {
+		node := graph[name]
+		ew.printf(`      <node id="%s" label="%s"><attvalues>`, xmlEscape(name), xmlEscape(name))
+		ew.printf(`<attvalue for="0" value="%s"/><attvalue for="1" value="%s"/>`, xmlEscape(node.Package), xmlEscape(node.Signature))
+		ew.printf("</attvalues></node>\n")
+	}
+	ew.printf("    </nodes>\n    <edges>\n")
+	id := 0
+	for _, name := range sortedNames(graph) {
+		for _, callee := range sortedCallees(graph[name]) {
+			if weights != nil {
+				ew.printf(`      <edge id="%d" source="%s" target="%s" weight="%.4f"/>`+"\n",
+					id, xmlEscape(name), xmlEscape(callee), weights[name][callee])
+			} else {
+				ew.printf(`      <edge id="%d" source="%s" target="%s"/>`+"\n", id, xmlEscape(name), xmlEscape(callee))
+			}
+			id++
+		}
+	}
+	ew.printf("    </edges>\n  </graph>\n</gexf>\n")
+	return ew.err
+}
+
+// CSV writes one row per call: caller, callee and both packages.
+func CSV(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"caller", "callee", "caller_package", "callee_package"}); err != nil {
+		return err
+	}
+	for _, name := range sortedNames(graph) {
+		for _, callee := range sortedCallees(graph[name]) {
+			if err := cw.Write([]string{name, callee, graph[name].Package, graph[callee].Package}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// JSON writes graph in the same shape as /graph.json.
+func JSON(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graph)
+}
+
+// ndjsonRecord is one line of NDJSON output: a function (Type "node") or
+// a call (Type "edge").
+type ndjsonRecord struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name,omitempty"`
+	Signature  string  `json:"signature,omitempty"`
+	Definition string  `json:"definition,omitempty"`
+	Package    string  `json:"package,omitempty"`
+	File       string  `json:"file,omitempty"`
+	Line       int     `json:"line,omitempty"`
+	EndLine    int     `json:"endLine,omitempty"`
+	Generated  string  `json:"generated,omitempty"`
+	Language   string  `json:"language,omitempty"`
+	Caller     string  `json:"caller,omitempty"`
+	Callee     string  `json:"callee,omitempty"`
+	Via        string  `json:"via,omitempty"`
+	Kind       string  `json:"kind,omitempty"`
+	Weight     float64 `json:"weight,omitempty"`
+}
+
+// NDJSON writes one JSON object per line: every function as a "node"
+// record, then every call as an "edge" record, so the output can be piped
+// through jq or grep line by line.
+func NDJSON(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return ndjson(w, graph, nil)
+}
+
+// ndjson is NDJSON with a weight on each weighted edge record.
+func ndjson(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	enc := json.NewEncoder(w)
+	names := sortedNames(graph)
+	for _, name := range names {
+		fn := graph[name]
+		rec := ndjsonRecord{
+			Type:       "node",
+			Name:       name,
+			Signature:  fn.Signature,
+			Definition: fn.Definition,
+			Package:    fn.Package,
+			File:       fn.File,
+			Line:       fn.Line,
+			EndLine:    fn.EndLine,
+			Generated:  fn.Generated,
+			Language:   fn.Language,
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		for _, callee := range sortedCallees(graph[name]) {
+			if _, ok := graph[callee]; !ok {
+				continue
+			}
+			if err := enc.Encode(ndjsonRecord{Type: "edge", Caller: name, Callee: callee, Via: graph[name].Via[callee], Kind: graph[name].Kinds[callee], Weight: weights[name][callee]}); err != nil {
+				return err
+			}
+		}
+		for _, call := range graph[name].Foreign {
+			if lang, symbol, ok := callgraph.SplitForeign(call); ok {
+				if err := enc.Encode(ndjsonRecord{Type: "edge", Caller: name, Callee: symbol, Language: lang}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
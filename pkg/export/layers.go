@@ -0,0 +1,52 @@
+package export
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Layers writes graph as a Graphviz digraph drawn top to bottom in
+// horizontal layers, as analysis.Layers arranges them from the functions
+// nothing calls: a quick architecture check, since every call should
+// point down and a layer crowded with unrelated packages stands out.
+// Each row is labelled with its layer number.
+func Layers(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return layers(w, graph, nil)
+}
+
+// layers is Layers with hot calls drawn with thicker pens.
+func layers(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	l := analysis.Layers(graph, nil)
+	ew := &errWriter{w: w}
+	ew.printf("digraph layers {\n")
+	ew.printf("  rankdir=TB;\n  newrank=true;\n  node [shape=box, fontname=\"sans-serif\"];\n")
+	for i, names := range l.Layers {
+		ew.printf("  { rank=same; \"layer %d\" [shape=plaintext];", i)
+		for _, name := range names {
+			ew.printf(" %s;", strconv.Quote(name))
+		}
+		ew.printf(" }\n")
+	}
+	for i := 1; i < len(l.Layers); i++ {
+		ew.printf("  \"layer %d\" -> \"layer %d\" [style=invis];\n", i-1, i)
+	}
+	for _, names := range l.Layers {
+		for _, name := range names {
+			for _, callee := range sortedCallees(graph[name]) {
+				if _, ok := graph[callee]; !ok {
+					continue
+				}
+				if wt := weights[name][callee]; wt > 0 {
+					ew.printf("  %s -> %s [penwidth=%.2f];\n", strconv.Quote(name), strconv.Quote(callee), 1+5*wt)
+					continue
+				}
+				ew.printf("  %s -> %s;\n", strconv.Quote(name), strconv.Quote(callee))
+			}
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
@@ -0,0 +1,266 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/fileuri"
+)
+
+// lsifVersion is the LSIF protocol revision LSIF output follows.
+const lsifVersion = "0.4.3"
+
+// lsifPos is a zero-based line and UTF-16 character offset.
+type lsifPos struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lsifRange is a span of one source line.
+type lsifRange struct {
+	line, start, end int // start and end are UTF-16 offsets
+}
+
+// LSIF writes graph as an LSIF index (https://lsif.dev): one document per
+// source file, a definition range and hover (the signature) for every
+// function, and a reference range at every call site, so Sourcegraph and
+// other LSIF consumers can offer go-to-definition and find-references.
+//
+// Functions only record their line, so exact ranges are found by reading
+// the source files; functions whose file can't be read still get a
+// definition spanning their first line, but no references.
+func LSIF(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	l := &lsifWriter{enc: json.NewEncoder(w), docs: make(map[string]int), ranges: make(map[int][]int)}
+	names := sortedNames(graph)
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if f := graph[name].File; f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+
+	l.vertex("metaData", map[string]any{
+		"version":          lsifVersion,
+		"projectRoot":      fileURI(commonDir(files)),
+		"positionEncoding": "utf-16",
+		"toolInfo":         map[string]any{"name": "geeparse"},
+	})
+	project := l.vertex("project", map[string]any{"kind": "go"})
+	for _, f := range files {
+		l.docs[f] = l.vertex("document", map[string]any{"uri": fileURI(f), "languageId": "go"})
+	}
+
+	sources := make(map[string][]string)
+	for _, f := range files {
+		if data, err := os.ReadFile(f); err == nil {
+			sources[f] = strings.Split(string(data), "\n")
+		}
+	}
+
+	// definitions first, so references can point at their result sets
+	resultSets := make(map[string]int)
+	refResults := make(map[string]int)
+	defRanges := make(map[string]int)
+	for _, name := range names {
+		fn := graph[name]
+		if fn.File == "" || fn.Line == 0 {
+			continue
+		}
+		r, ok := nameRange(sources[fn.File], fn.Line, name)
+		if !ok {
+			r = lsifRange{line: fn.Line - 1}
+			if lines := sources[fn.File]; fn.Line <= len(lines) {
+				r.end = utf16Len(lines[fn.Line-1])
+			}
+		}
+		rng := l.rangeVertex(fn.File, r)
+		set := l.vertex("resultSet", nil)
+		l.edge("next", rng, set)
+
+		def := l.vertex("definitionResult", nil)
+		l.edge("textDocument/definition", set, def)
+		l.items(def, []int{rng}, l.docs[fn.File], "")
+
+		hover := l.vertex("hoverResult", map[string]any{"result": map[string]any{
+			"contents": []map[string]any{{"language": "go", "value": "func " + name + strings.TrimPrefix(fn.Signature, "func")}},
+		}})
+		l.edge("textDocument/hover", set, hover)
+
+		refs := l.vertex("referenceResult", nil)
+		l.edge("textDocument/references", set, refs)
+		resultSets[name], refResults[name], defRanges[name] = set, refs, rng
+	}
+
+	// a function's own definition counts among its references
+	for _, name := range names {
+		if refs, ok := refResults[name]; ok {
+			l.items(refs, []int{defRanges[name]}, l.docs[graph[name].File], "definitions")
+		}
+	}
+
+	for _, caller := range names {
+		fn := graph[caller]
+		lines := sources[fn.File]
+		if lines == nil {
+			continue
+		}
+		for _, callee := range sortedCallees(fn) {
+			set, ok := resultSets[callee]
+			if !ok {
+				continue
+			}
+			var refs []int
+			for _, r := range callSites(lines, fn.Line, fn.EndLine, callee) {
+				rng := l.rangeVertex(fn.File, r)
+				l.edge("next", rng, set)
+				refs = append(refs, rng)
+			}
+			if len(refs) > 0 {
+				l.items(refResults[callee], refs, l.docs[fn.File], "references")
+			}
+		}
+	}
+
+	for _, f := range files {
+		if rs := l.ranges[l.docs[f]]; len(rs) > 0 {
+			l.edgeN("contains", l.docs[f], rs, nil)
+		}
+	}
+	if len(files) > 0 {
+		var docs []int
+		for _, f := range files {
+			docs = append(docs, l.docs[f])
+		}
+		l.edgeN("contains", project, docs, nil)
+	}
+	return l.err
+}
+
+// lsifWriter numbers and writes LSIF vertices and edges, remembering the
+// first write error.
+type lsifWriter struct {
+	enc    *json.Encoder
+	err    error
+	nextID int
+	docs   map[string]int // file → document id
+	ranges map[int][]int  // document id → range ids
+}
+
+func (l *lsifWriter) emit(obj map[string]any) int {
+	l.nextID++
+	obj["id"] = l.nextID
+	if l.err == nil {
+		l.err = l.enc.Encode(obj)
+	}
+	return l.nextID
+}
+
+func (l *lsifWriter) vertex(label string, props map[string]any) int {
+	obj := map[string]any{"type": "vertex", "label": label}
+	for k, v := range props {
+		obj[k] = v
+	}
+	return l.emit(obj)
+}
+
+func (l *lsifWriter) rangeVertex(file string, r lsifRange) int {
+	id := l.vertex("range", map[string]any{
+		"start": lsifPos{r.line, r.start},
+		"end":   lsifPos{r.line, r.end},
+	})
+	doc := l.docs[file]
+	l.ranges[doc] = append(l.ranges[doc], id)
+	return id
+}
+
+func (l *lsifWriter) edge(label string, out, in int) {
+	l.emit(map[string]any{"type": "edge", "label": label, "outV": out, "inV": in})
+}
+
+func (l *lsifWriter) edgeN(label string, out int, in []int, props map[string]any) {
+	obj := map[string]any{"type": "edge", "label": label, "outV": out, "inVs": in}
+	for k, v := range props {
+		obj[k] = v
+	}
+	l.emit(obj)
+}
+
+// items links a definition or reference result to ranges in one document;
+// property is "definitions" or "references" for reference results.
+func (l *lsifWriter) items(out int, ranges []int, doc int, property string) {
+	props := map[string]any{"document": doc}
+	if property != "" {
+		props["property"] = property
+	}
+	l.edgeN("item", out, ranges, props)
+}
+
+// nameRange finds the function name on its declaration line (1-based),
+// after "func" and any receiver.
+func nameRange(lines []string, line int, name string) (lsifRange, bool) {
+	if line < 1 || line > len(lines) {
+		return lsifRange{}, false
+	}
+	text := lines[line-1]
+	re := regexp.MustCompile(`^\s*func\s*(?:\([^)]*\)\s*)?(` + regexp.QuoteMeta(name) + `)\b`)
+	m := re.FindStringSubmatchIndex(text)
+	if m == nil {
+		return lsifRange{}, false
+	}
+	return lsifRange{line: line - 1, start: utf16Len(text[:m[2]]), end: utf16Len(text[:m[3]])}, true
+}
+
+// callSites finds calls of name within lines first..last (1-based) of a
+// function's source: the identifier followed by an opening parenthesis,
+// skipping the declaration's own name.
+func callSites(lines []string, first, last int, name string) []lsifRange {
+	if last < first {
+		last = first
+	}
+	re := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\s*\(`)
+	var out []lsifRange
+	for ln := first; ln <= last && ln <= len(lines); ln++ {
+		text := lines[ln-1]
+		for _, m := range re.FindAllStringIndex(text, -1) {
+			if ln == first {
+				if r, ok := nameRange(lines, ln, name); ok && utf16Len(text[:m[0]]) == r.start {
+					continue
+				}
+			}
+			out = append(out, lsifRange{line: ln - 1, start: utf16Len(text[:m[0]]), end: utf16Len(text[:m[0]+len(name)])})
+		}
+	}
+	return out
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// commonDir returns the deepest directory containing every file.
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return "/"
+	}
+	dir := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for dir != filepath.Dir(dir) && !strings.HasPrefix(f, dir+string(filepath.Separator)) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// fileURI turns an absolute path into a file:// URI.
+func fileURI(path string) string {
+	return fileuri.FromPath(path)
+}
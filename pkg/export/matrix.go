@@ -0,0 +1,108 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Matrix writes graph as a dense adjacency matrix in CSV: a header row
+// and a first column of function names, sorted, and a 1 in the cell of
+// caller's row and callee's column for every call, 0 elsewhere.
+// pandas.read_csv(f, index_col=0) reads it back as a labelled frame. It
+// grows with the square of the functions; prefer MatrixJSON past a few
+// thousand.
+func Matrix(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	names := sortedNames(graph)
+	index := nameIndex(names)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"function"}, names...)); err != nil {
+		return err
+	}
+	row := make([]string, len(names)+1)
+	for _, name := range names {
+		row[0] = name
+		for i := range names {
+			row[i+1] = "0"
+		}
+		for _, callee := range graph[name].Callees {
+			if j, ok := index[callee]; ok {
+				row[j+1] = "1"
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sparseMatrix is the MatrixJSON document: the calls in coordinate (COO)
+// form over the sorted function names, as scipy.sparse.coo_matrix takes
+// them.
+type sparseMatrix struct {
+	// Nodes names the rows and columns; Packages holds their packages.
+	Nodes    []string `json:"nodes"`
+	Packages []string `json:"packages"`
+	Shape    [2]int   `json:"shape"`
+	// Row[i] calls Col[i]; Data[i] is always 1.
+	Row  []int `json:"row"`
+	Col  []int `json:"col"`
+	Data []int `json:"data"`
+	// Weight[i] rates the call Row[i]→Col[i] when weights were given.
+	Weight []float64 `json:"weight,omitempty"`
+}
+
+// MatrixJSON writes graph as a sparse adjacency matrix in JSON, with the
+// index of function names alongside, for numpy and scipy without custom
+// parsing:
+//
+//	m = json.load(f)
+//	a = scipy.sparse.coo_matrix((m["data"], (m["row"], m["col"])), shape=m["shape"])
+func MatrixJSON(w io.Writer, graph map[string]callgraph.FunctionNode) error {
+	return matrixJSON(w, graph, nil)
+}
+
+// matrixJSON is MatrixJSON with a weight per call when weights is
+// non-nil; cold calls get 0.
+func matrixJSON(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	names := sortedNames(graph)
+	index := nameIndex(names)
+	m := sparseMatrix{
+		Nodes:    names,
+		Packages: make([]string, len(names)),
+		Shape:    [2]int{len(names), len(names)},
+		Row:      []int{},
+		Col:      []int{},
+		Data:     []int{},
+	}
+	if weights != nil {
+		m.Weight = []float64{}
+	}
+	for i, name := range names {
+		m.Packages[i] = graph[name].Package
+		for _, callee := range sortedCallees(graph[name]) {
+			j, ok := index[callee]
+			if !ok {
+				continue
+			}
+			m.Row, m.Col, m.Data = append(m.Row, i), append(m.Col, j), append(m.Data, 1)
+			if weights != nil {
+				m.Weight = append(m.Weight, weights[name][callee])
+			}
+		}
+	}
+	return json.NewEncoder(w).Encode(m)
+}
+
+// nameIndex maps each of names to its position.
+func nameIndex(names []string) map[string]int {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	return index
+}
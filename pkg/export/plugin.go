@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Exporter is an output format added to the built-in ones, such as an
+// exec plugin. Its weights may be nil.
+type Exporter interface {
+	Name() string
+	ContentType() string
+	Extension() string
+	Export(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Exporter{}
+)
+
+// Register makes e available to Write and WriteWeighted under its name,
+// and lists it in Formats. Names are case-insensitive and may not shadow
+// a built-in or already registered format. Register during startup,
+// before anything reads Formats.
+func Register(e Exporter) error {
+	name := strings.ToLower(e.Name())
+	if name == "" || strings.ContainsAny(name, " \t/") {
+		return fmt.Errorf("invalid export format name %q", e.Name())
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if slices.Contains(Formats, name) {
+		return fmt.Errorf("export format %q already exists", name)
+	}
+	registry[name] = e
+	Formats = append(Formats, name)
+	return nil
+}
+
+func registered(format string) (Exporter, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	e, ok := registry[strings.ToLower(format)]
+	return e, ok
+}
+
+// PluginProtocol is the version of the input exec plugins are sent.
+const PluginProtocol = 1
+
+// pluginInput is what an exec plugin reads from standard input.
+type pluginInput struct {
+	Protocol  int                               `json:"protocol"`
+	Format    string                            `json:"format"`
+	Functions map[string]callgraph.FunctionNode `json:"functions"`
+	Weights   map[string]map[string]float64     `json:"weights,omitempty"`
+}
+
+// Plugin is an exporter implemented by an external program. geeparse
+// runs Command with Args, writes one JSON document to its standard input
+//
+//	{"protocol": 1, "format": "<name>", "functions": {<as in /graph.json>},
+//	 "weights": {"caller": {"callee": 0.4}}}
+//
+// and copies its standard output through as the export. weights is only
+// present when the caller asked for hot paths. The program's standard
+// error goes to geeparse's; a non-zero exit fails the export. Plugins can
+// produce any text or binary output, so they serve as custom analyses as
+// well as formats.
+type Plugin struct {
+	Format  string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Type and Ext are the MIME type and file extension the server
+	// offers downloads with; defaults text/plain and the format name.
+	Type string `yaml:"content_type"`
+	Ext  string `yaml:"extension"`
+}
+
+func (p *Plugin) Name() string { return p.Format }
+
+func (p *Plugin) ContentType() string {
+	if p.Type == "" {
+		return "text/plain; charset=utf-8"
+	}
+	return p.Type
+}
+
+func (p *Plugin) Extension() string {
+	if p.Ext == "" {
+		return strings.ToLower(p.Format)
+	}
+	return strings.TrimPrefix(p.Ext, ".")
+}
+
+// Export runs the plugin on graph.
+func (p *Plugin) Export(w io.Writer, graph map[string]callgraph.FunctionNode, weights Weights) error {
+	if p.Command == "" {
+		return fmt.Errorf("plugin %s: no command", p.Format)
+	}
+	in, err := json.Marshal(pluginInput{Protocol: PluginProtocol, Format: p.Format, Functions: graph, Weights: weights})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(p.Command, p.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("GEEPARSE_PLUGIN_PROTOCOL=%d", PluginProtocol),
+		"GEEPARSE_FORMAT="+p.Format)
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			if msg := lastLine(stderr.String()); msg != "" {
+				return fmt.Errorf("plugin %s: %s: %s", p.Format, exit, msg)
+			}
+		}
+		return fmt.Errorf("plugin %s: %w", p.Format, err)
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
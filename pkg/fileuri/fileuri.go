@@ -0,0 +1,80 @@
+// Package fileuri converts between local file paths and the file:// URIs
+// that LSP, LSIF and SARIF use for them. Pasting "file://" before a path
+// works for simple Unix paths only: spaces, '#' and '%' must be escaped,
+// and Windows paths need forward slashes, a leading slash before the drive
+// letter ("file:///C:/src") and a host for UNC shares
+// ("file://server/share/src").
+package fileuri
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FromPath returns the file:// URI of path, made absolute first.
+func FromPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return fromPath(path, runtime.GOOS == "windows")
+}
+
+// ToPath returns the local path a file:// URI names. URIs of other schemes
+// and, outside Windows, of other hosts are errors.
+func ToPath(uri string) (string, error) {
+	return toPath(uri, runtime.GOOS == "windows")
+}
+
+// fromPath and toPath do the work for either kind of path, so both can be
+// tested anywhere.
+func fromPath(path string, windows bool) string {
+	if !windows {
+		return (&url.URL{Scheme: "file", Path: path}).String()
+	}
+	path = strings.ReplaceAll(path, `\`, "/")
+	if rest, ok := strings.CutPrefix(path, "//"); ok {
+		host, share, _ := strings.Cut(rest, "/")
+		return (&url.URL{Scheme: "file", Host: host, Path: "/" + share}).String()
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func toPath(uri string, windows bool) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URI: %s", uri)
+	}
+	host := u.Host
+	if host == "localhost" {
+		host = ""
+	}
+	if !windows {
+		if host != "" {
+			return "", fmt.Errorf("file URI on another host: %s", uri)
+		}
+		return u.Path, nil
+	}
+	p := strings.ReplaceAll(u.Path, "/", `\`)
+	if host != "" {
+		return `\\` + host + p, nil
+	}
+	// "/C:/src" names C:\src; the drive letter may also come escaped as
+	// "/c%3A/src", which url.Parse has already decoded
+	if len(p) >= 3 && p[0] == '\\' && p[2] == ':' && isLetter(p[1]) {
+		p = p[1:]
+	}
+	return p, nil
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
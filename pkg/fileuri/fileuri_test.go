@@ -0,0 +1,76 @@
+package fileuri
+
+import "testing"
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		path    string
+		windows bool
+		uri     string
+	}{
+		{"/home/dev/src/main.go", false, "file:///home/dev/src/main.go"},
+		{"/home/dev/my project/main.go", false, "file:///home/dev/my%20project/main.go"},
+		{"/tmp/a#b/100%/x?.go", false, "file:///tmp/a%23b/100%25/x%3F.go"},
+		{"/srv/código/ñ.go", false, "file:///srv/c%C3%B3digo/%C3%B1.go"},
+		{`C:\Users\dev\src\main.go`, true, "file:///C:/Users/dev/src/main.go"},
+		{`C:\Program Files\geeparse\main.go`, true, "file:///C:/Program%20Files/geeparse/main.go"},
+		{`d:\a#b\main.go`, true, "file:///d:/a%23b/main.go"},
+		{`\\server\share\src\main.go`, true, "file://server/share/src/main.go"},
+	}
+	for _, tt := range tests {
+		uri := fromPath(tt.path, tt.windows)
+		if uri != tt.uri {
+			t.Errorf("fromPath(%q, %v) = %q, want %q", tt.path, tt.windows, uri, tt.uri)
+		}
+		path, err := toPath(uri, tt.windows)
+		if err != nil {
+			t.Errorf("toPath(%q, %v): %v", uri, tt.windows, err)
+			continue
+		}
+		if path != tt.path {
+			t.Errorf("toPath(%q, %v) = %q, want %q", uri, tt.windows, path, tt.path)
+		}
+	}
+}
+
+func TestToPathForeignForms(t *testing.T) {
+	tests := []struct {
+		uri     string
+		windows bool
+		path    string
+	}{
+		// VS Code escapes the drive letter's colon
+		{"file:///c%3A/src/main.go", true, `c:\src\main.go`},
+		{"file://localhost/home/dev/main.go", false, "/home/dev/main.go"},
+		{"file://localhost/C:/src/main.go", true, `C:\src\main.go`},
+	}
+	for _, tt := range tests {
+		path, err := toPath(tt.uri, tt.windows)
+		if err != nil || path != tt.path {
+			t.Errorf("toPath(%q, %v) = %q, %v; want %q", tt.uri, tt.windows, path, err, tt.path)
+		}
+	}
+}
+
+func TestToPathRejects(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com/main.go",
+		"file://server/share/main.go", // a UNC share means nothing outside Windows
+		"file:///bad%zzescape",
+	} {
+		if path, err := toPath(uri, false); err == nil {
+			t.Errorf("toPath(%q) = %q, want an error", uri, path)
+		}
+	}
+}
+
+func TestFromPathAbsolute(t *testing.T) {
+	uri := FromPath("main.go")
+	path, err := ToPath(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back := FromPath(path); back != uri {
+		t.Errorf("FromPath(ToPath(%q)) = %q", uri, back)
+	}
+}
@@ -0,0 +1,280 @@
+// Package geeparse is the library entry point to the analyzer: build the
+// call-graph of a Go source tree, query it, and keep it in a database,
+// without wiring the callgraph, analysis, export and persistence packages
+// together by hand the way the geeparse command does.
+//
+//	g, err := geeparse.Analyze(ctx, geeparse.Options{Root: "."})
+//	if err != nil { ... }
+//	fmt.Println(g.Callers("handleGraph"))
+//
+// The types and functions here are kept stable; the packages they wrap
+// may change between releases.
+package geeparse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/query"
+)
+
+// Function is one function of a graph: its signature and source, where it
+// is defined, and the functions it calls.
+type Function = callgraph.FunctionNode
+
+// Location is where a function is defined.
+type Location = analysis.Location
+
+// Footprint is how much of a graph one entrypoint reaches.
+type Footprint = analysis.Footprint
+
+// Layering is a graph arranged in layers, entrypoints first.
+type Layering = analysis.Layering
+
+// Stats summarizes the size and shape of a graph.
+type Stats = analysis.Stats
+
+// Options tunes Analyze.
+type Options struct {
+	// Root is the directory to analyze; empty means the current one.
+	Root string
+	// Exclude holds path.Match patterns for files and directories to
+	// skip, tried against the path relative to Root and the base name.
+	Exclude []string
+	// Backend picks the analyzer; empty means "gopls". "lsif" reads calls
+	// from Index, a pre-built LSIF dump, instead.
+	Backend string
+	Index   string
+	// MaxFileSize and MaxFunctionSize are size limits in bytes: larger
+	// files are skipped and longer definitions truncated. 0 means the
+	// callgraph package's defaults, negative no limit.
+	MaxFileSize     int
+	MaxFunctionSize int
+	// Overlay holds contents to analyze instead of the files on disk, by
+	// path, such as an editor's unsaved buffers. It needs gopls.
+	Overlay map[string][]byte
+}
+
+// Graph is the call-graph of a source tree, keyed by function name.
+type Graph struct {
+	Functions map[string]Function
+}
+
+// NewGraph wraps a function map built elsewhere, e.g. decoded from a JSON
+// export.
+func NewGraph(functions map[string]Function) *Graph {
+	if functions == nil {
+		functions = make(map[string]Function)
+	}
+	return &Graph{Functions: functions}
+}
+
+// Analyze builds the call-graph of the Go code under opts.Root. It needs
+// gopls on PATH unless opts.Backend is "lsif". Cancelling ctx stops gopls
+// and makes Analyze return ctx.Err().
+func Analyze(ctx context.Context, opts Options) (*Graph, error) {
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	b, err := callgraph.NewBuilder(root, callgraph.Options{
+		Exclude:         opts.Exclude,
+		Backend:         opts.Backend,
+		Index:           opts.Index,
+		MaxFileSize:     opts.MaxFileSize,
+		MaxFunctionSize: opts.MaxFunctionSize,
+		Overlay:         opts.Overlay,
+	})
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.Close()
+		case <-done:
+		}
+	}()
+
+	functions, err := b.Build(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	b.Close()
+	if err != nil {
+		return nil, err
+	}
+	return NewGraph(functions), nil
+}
+
+// Function returns the named function and whether the graph has it.
+func (g *Graph) Function(name string) (Function, bool) {
+	fn, ok := g.Functions[name]
+	return fn, ok
+}
+
+// Callers returns, sorted, the functions that call name directly.
+func (g *Graph) Callers(name string) []string {
+	var out []string
+	for caller, fn := range g.Functions {
+		for _, callee := range fn.Callees {
+			if callee == name {
+				out = append(out, caller)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Callees returns, sorted, the functions of the graph name calls directly.
+func (g *Graph) Callees(name string) []string {
+	var out []string
+	for _, callee := range g.Functions[name].Callees {
+		if _, ok := g.Functions[callee]; ok {
+			out = append(out, callee)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Subgraph returns the part of the graph reachable from root, within
+// maxDepth calls when maxDepth > 0, or nil if root isn't a function.
+func (g *Graph) Subgraph(root string, maxDepth int) *Graph {
+	functions := callgraph.Subgraph(g.Functions, root, maxDepth)
+	if functions == nil {
+		return nil
+	}
+	return NewGraph(functions)
+}
+
+// Packages returns the graph restricted to functions in the listed
+// packages or below them.
+func (g *Graph) Packages(pkgs ...string) *Graph {
+	return NewGraph(callgraph.FilterPackages(g.Functions, pkgs))
+}
+
+// Strict returns the graph without the calls only guessed by heuristics,
+// for analyses that must not rely on them; see callgraph.Heuristic.
+func (g *Graph) Strict() *Graph {
+	return NewGraph(callgraph.Strict(g.Functions))
+}
+
+// Select returns, sorted, the functions a query-language expression such
+// as `callers(SaveGraph) & pkg("persistence")` selects; see package query
+// for the language.
+func (g *Graph) Select(expr string) ([]string, error) {
+	return query.Run(g.Functions, expr)
+}
+
+// Path returns a shortest call chain from one function to another, both
+// included, or nil if there is none within maxDepth calls (0 = no limit).
+func (g *Graph) Path(from, to string, maxDepth int) []string {
+	return analysis.ShortestPath(g.Functions, from, to, maxDepth)
+}
+
+// DeadCode returns the functions not reachable from any root, sorted by
+// location. Roots are path.Match patterns over function names; none means
+// main, init and TestMain.
+func (g *Graph) DeadCode(roots ...string) []Location {
+	if len(roots) == 0 {
+		roots = analysis.DefaultRoots
+	}
+	return analysis.DeadCode(g.Functions, roots)
+}
+
+// Layers arranges the graph in layers by distance from the roots, callers
+// above callees; see analysis.Layering. Roots are path.Match patterns
+// over function names; none means the functions nothing calls.
+func (g *Graph) Layers(roots ...string) Layering {
+	return analysis.Layers(g.Functions, roots)
+}
+
+// Entrypoints sizes up what each root reaches, largest first. Roots are
+// path.Match patterns over function names; none means main, init and
+// TestMain.
+func (g *Graph) Entrypoints(roots ...string) []Footprint {
+	if len(roots) == 0 {
+		roots = analysis.DefaultRoots
+	}
+	return analysis.Entrypoints(g.Functions, roots)
+}
+
+// Cycles returns the groups of functions that call each other, directly
+// or not.
+func (g *Graph) Cycles() [][]string {
+	return analysis.Cycles(g.Functions)
+}
+
+// Stats summarizes the graph, listing the top most called and calling
+// functions.
+func (g *Graph) Stats(top int) Stats {
+	return analysis.ComputeStats(g.Functions, top)
+}
+
+// Formats lists the formats Export understands.
+func Formats() []string {
+	return append([]string(nil), export.Formats...)
+}
+
+// Export writes the graph in one of Formats.
+func (g *Graph) Export(w io.Writer, format string) error {
+	return export.Write(w, format, g.Functions)
+}
+
+// Store keeps graphs, snapshots and annotations in a SQLite database, the
+// same one the geeparse command uses.
+type Store struct {
+	store *persistence.Store
+}
+
+// OpenStore opens the database at path, creating it if needed.
+func OpenStore(path string) (*Store, error) {
+	s, err := persistence.NewStore(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	return &Store{store: s}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Save replaces the stored graph with g.
+func (s *Store) Save(g *Graph) error {
+	return s.store.SaveGraph(g.Functions)
+}
+
+// Load returns the stored graph.
+func (s *Store) Load() (*Graph, error) {
+	functions, err := s.store.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	return NewGraph(functions), nil
+}
+
+// Snapshot saves g as a named snapshot, alongside the current graph, so
+// it can be diffed against later.
+func (s *Store) Snapshot(label string, g *Graph) error {
+	_, err := s.store.SaveSnapshot(label, g.Functions, persistence.Source{})
+	return err
+}
+
+// Persistence returns the underlying store, for features the facade
+// doesn't cover.
+func (s *Store) Persistence() *persistence.Store {
+	return s.store
+}
@@ -0,0 +1,241 @@
+// Package ingest reads call-graphs produced outside geeparse, by analyzers
+// for Python, TypeScript or anything else, so they share the store, API
+// and UI with Go graphs.
+//
+// A graph is a JSON document of nodes (functions) and edges (calls):
+//
+//	{
+//	  "version": 1,
+//	  "language": "python",
+//	  "nodes": [
+//	    {"name": "models.User.save", "package": "app/models",
+//	     "file": "app/models.py", "line": 10, "endLine": 24,
+//	     "signature": "(self) -> None", "definition": "def save(self): ..."}
+//	  ],
+//	  "edges": [
+//	    {"caller": "views.signup", "callee": "models.User.save", "via": "ast"}
+//	  ]
+//	}
+//
+// or the same records one per line, as geeparse build --stdout writes
+// them: {"type": "node", "name": ...} and {"type": "edge", "caller": ...}.
+// Only name is required. It identifies the function and must be unique;
+// use whatever qualification the language needs ("module.Class.method").
+// Names, packages and files can't hold control characters.
+// package groups nodes in the UI, slash-separated like a path. Edges to
+// names that aren't nodes, such as library calls, are dropped. via, also
+// optional, says how the analyzer found the call, with the kinds listed
+// in callgraph.Provenances; "ast" marks a guess that strict analyses
+// skip.
+//
+// The document's language is each node's unless the node names its own,
+// so one graph can hold, say, a Python extension's C functions too. An
+// edge whose language differs from its caller's is a call into a graph of
+// that language, stored separately: its callee is the symbol the call
+// names, and the store links it to the function of that name once there
+// is one, as it does cgo calls out of Go graphs (see
+// callgraph.LinkLanguages). The JSON Schema of the document form is
+// Schema.
+package ingest
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Version is the schema version this package reads.
+const Version = 1
+
+// Schema is the JSON Schema of the document form.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Node is one function.
+type Node struct {
+	Name       string `json:"name"`
+	Package    string `json:"package,omitempty"`
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	EndLine    int    `json:"endLine,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Definition string `json:"definition,omitempty"`
+	Generated  string `json:"generated,omitempty"`
+	Language   string `json:"language,omitempty"`
+}
+
+// Edge is one call.
+type Edge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Via    string `json:"via,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+	// Language is the callee's, when it's another than the caller's.
+	Language string `json:"language,omitempty"`
+}
+
+// Document is the document form of a graph.
+type Document struct {
+	Version  int    `json:"version,omitempty"`
+	Language string `json:"language,omitempty"`
+	Nodes    []Node `json:"nodes"`
+	Edges    []Edge `json:"edges"`
+}
+
+// Result is a decoded graph and what was left out of it.
+type Result struct {
+	Graph    map[string]callgraph.FunctionNode
+	Language string
+	// Dropped counts edges whose caller or callee isn't a node.
+	Dropped int
+	// Foreign counts edges kept as calls into other languages.
+	Foreign int
+}
+
+// Read decodes a graph in either form.
+func Read(r io.Reader) (*Result, error) {
+	var doc Document
+	dec := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		// a whole Document or one line of the line form, by its type
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			if i == 1 {
+				return nil, errors.New("ingest: empty input")
+			}
+			break
+		}
+		var rec struct {
+			Type string `json:"type"`
+		}
+		if err == nil {
+			err = json.Unmarshal(raw, &rec)
+		}
+		if err == nil {
+			switch rec.Type {
+			case "node":
+				var n Node
+				err = json.Unmarshal(raw, &n)
+				doc.Nodes = append(doc.Nodes, n)
+			case "edge":
+				var e Edge
+				err = json.Unmarshal(raw, &e)
+				doc.Edges = append(doc.Edges, e)
+			case "":
+				if i > 1 {
+					return nil, fmt.Errorf("ingest: record %d: a graph document must be the only value", i)
+				}
+				err = json.Unmarshal(raw, &doc)
+			default:
+				return nil, fmt.Errorf("ingest: record %d: unknown type %q (want node or edge)", i, rec.Type)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ingest: record %d: %w", i, err)
+		}
+	}
+	return Convert(doc)
+}
+
+// hasControl reports whether s holds a control character, which no
+// function name or path has and a terminal or the UI could be fooled by.
+func hasControl(s string) bool {
+	return strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// CheckGraph makes the checks Convert makes of names, packages and
+// files on a graph read some other way, such as a JSON export.
+func CheckGraph(graph map[string]callgraph.FunctionNode) error {
+	for name, node := range graph {
+		if hasControl(name) || hasControl(node.Package) || hasControl(node.File) {
+			return fmt.Errorf("ingest: function %q: control character in its name, package or file", name)
+		}
+		if i := slices.IndexFunc(node.Callees, hasControl); i >= 0 {
+			return fmt.Errorf("ingest: function %q: control character in callee %q", name, node.Callees[i])
+		}
+	}
+	return nil
+}
+
+// Convert checks doc and turns it into a graph.
+func Convert(doc Document) (*Result, error) {
+	if doc.Version > Version {
+		return nil, fmt.Errorf("ingest: schema version %d is newer than this geeparse reads (%d)", doc.Version, Version)
+	}
+	lang := strings.ToLower(doc.Language)
+	res := &Result{Graph: make(map[string]callgraph.FunctionNode, len(doc.Nodes)), Language: lang}
+	for i, n := range doc.Nodes {
+		if n.Name == "" {
+			return nil, fmt.Errorf("ingest: node %d has no name", i+1)
+		}
+		if _, dup := res.Graph[n.Name]; dup {
+			return nil, fmt.Errorf("ingest: duplicate node %q", n.Name)
+		}
+		if hasControl(n.Name) || hasControl(n.Package) || hasControl(n.File) {
+			return nil, fmt.Errorf("ingest: node %q: control character in its name, package or file", n.Name)
+		}
+		res.Graph[n.Name] = callgraph.FunctionNode{
+			Callees:    []string{},
+			Signature:  n.Signature,
+			Definition: n.Definition,
+			Package:    n.Package,
+			File:       n.File,
+			Line:       n.Line,
+			EndLine:    n.EndLine,
+			Generated:  n.Generated,
+			Language:   cmp.Or(strings.ToLower(n.Language), lang),
+		}
+	}
+	seen := make(map[[2]string]bool, len(doc.Edges))
+	for _, e := range doc.Edges {
+		caller, ok := res.Graph[e.Caller]
+		if lang := strings.ToLower(e.Language); ok && lang != "" && lang != caller.Language {
+			if hasControl(e.Callee) {
+				return nil, fmt.Errorf("ingest: edge %q → %q: control character in callee", e.Caller, e.Callee)
+			}
+			call := callgraph.ForeignCall(lang, e.Callee)
+			if !slices.Contains(caller.Foreign, call) {
+				caller.Foreign = append(caller.Foreign, call)
+				res.Graph[e.Caller] = caller
+				res.Foreign++
+			}
+			continue
+		}
+		if _, known := res.Graph[e.Callee]; !ok || !known {
+			res.Dropped++
+			continue
+		}
+		if seen[[2]string{e.Caller, e.Callee}] {
+			continue
+		}
+		seen[[2]string{e.Caller, e.Callee}] = true
+		caller.Callees = append(caller.Callees, e.Callee)
+		if e.Via != "" {
+			if caller.Via == nil {
+				caller.Via = make(map[string]string)
+			}
+			caller.Via[e.Callee] = e.Via
+		}
+		if e.Kind != "" && e.Kind != callgraph.KindDirect {
+			if _, err := callgraph.ParseKinds(e.Kind); err != nil {
+				return nil, fmt.Errorf("ingest: edge %s → %s: %w", e.Caller, e.Callee, err)
+			}
+			if caller.Kinds == nil {
+				caller.Kinds = make(map[string]string)
+			}
+			caller.Kinds[e.Callee] = e.Kind
+		}
+		res.Graph[e.Caller] = caller
+	}
+	return res, nil
+}
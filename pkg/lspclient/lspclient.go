@@ -2,15 +2,18 @@
 package lspclient
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/ishanmadhav/geeparse/pkg/fileuri"
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
 )
@@ -28,78 +31,230 @@ func (s *stdio) Close() error {
 	return s.out.Close()
 }
 
-// Client manages the gopls subprocess and LSP connection.
+// Client manages the gopls subprocess and LSP connection. With Limits it
+// watches gopls and restarts it when it uses too much; mu guards the
+// session, which the watchdog swaps.
 type Client struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	rootDir   string
-	stream    *stdio
-	conn      jsonrpc2.Conn
-	goplsCmd  *exec.Cmd
+	logger    *slog.Logger
+	limits    Limits
+	mu        sync.Mutex
+	s         *session
 	connected bool
+	gen       int               // bumped by every restart
+	restarts  int               // restarts so far
+	err       error             // set once gopls can't be restarted
+	open      map[string][]byte // documents to send a restarted gopls, by path
+}
+
+// session is one gopls process and the LSP connection to it.
+type session struct {
+	ctx    context.Context // canceled as the session ends, failing its requests
+	cancel context.CancelFunc
+	stream *stdio
+	conn   jsonrpc2.Conn
+	cmd    *exec.Cmd
 }
 
 // New starts gopls and initializes an LSP session rooted at rootDir.
-func New(rootDir string) (*Client, error) {
+// gopls's own stderr output goes to logger at debug level; a nil logger
+// means slog.Default(). gopls is restarted when it goes over limits.
+func New(rootDir string, logger *slog.Logger, limits Limits) (*Client, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	absRoot, err := filepath.Abs(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("resolve root dir: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	stream, cmd, err := startGopls(ctx)
+	s, err := startSession(ctx, absRoot, logger)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 
-	conn := newConn(ctx, stream)
-	if err := initialize(ctx, conn, absRoot); err != nil {
-		_ = stream.Close()
-		_ = cmd.Process.Kill()
-		cancel()
-		return nil, err
-	}
-
-	return &Client{
+	c := &Client{
 		ctx:       ctx,
 		cancel:    cancel,
 		rootDir:   absRoot,
-		stream:    stream,
-		conn:      conn,
-		goplsCmd:  cmd,
+		logger:    logger,
+		limits:    limits,
+		s:         s,
 		connected: true,
-	}, nil
+		open:      make(map[string][]byte),
+	}
+	if limits.enabled() {
+		go c.watch()
+	}
+	return c, nil
+}
+
+// startSession starts gopls and initializes an LSP session with it,
+// ending with parent.
+func startSession(parent context.Context, rootDir string, logger *slog.Logger) (*session, error) {
+	ctx, cancel := context.WithCancel(parent)
+	stream, cmd, err := startGopls(ctx, logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := &session{ctx: ctx, cancel: cancel, stream: stream, conn: newConn(ctx, stream), cmd: cmd}
+	if err := initialize(ctx, s.conn, rootDir); err != nil {
+		s.stop()
+		return nil, err
+	}
+	return s, nil
+}
+
+// stop ends the session: requests waiting on gopls fail and it's killed.
+func (s *session) stop() {
+	s.cancel()
+	_ = s.conn.Close()
+	_ = s.stream.Close()
+	_ = s.cmd.Process.Kill()
+	go s.cmd.Wait()
 }
 
 // Close terminates the gopls subprocess and frees resources.
 func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.connected {
 		return
 	}
 	c.connected = false
-	_ = c.conn.Close()
-	_ = c.stream.Close()
-	_ = c.goplsCmd.Process.Kill()
+	c.s.stop()
 	c.cancel()
 }
 
-// OpenDocument sends a textDocument/didOpen notification.
-func (c *Client) OpenDocument(path string) error {
-	src, err := os.ReadFile(path)
+// restart replaces gopls, which went over its limits for reason, with a
+// new session that has the same documents open. Past
+// Limits.MaxRestarts it stops gopls for good, and Err says why.
+func (c *Client) restart(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected || c.err != nil {
+		return
+	}
+	c.gen++
+	c.s.stop()
+	if c.restarts >= c.limits.maxRestarts() {
+		c.logger.Error("gopls over its limits; giving up", "pid", c.s.cmd.Process.Pid, "reason", reason, "restarts", c.restarts)
+		c.err = fmt.Errorf("gopls went over its limits %d times, the last with %s", c.restarts+1, reason)
+		return
+	}
+	c.restarts++
+	c.logger.Warn("gopls over its limits; restarting", "pid", c.s.cmd.Process.Pid, "reason", reason, "restart", c.restarts)
+	s, err := startSession(c.ctx, c.rootDir, c.logger)
+	if err != nil {
+		c.err = fmt.Errorf("restart gopls: %w", err)
+		return
+	}
+	c.s = s
+	for path, src := range c.open {
+		if err := s.conn.Notify(s.ctx, protocol.MethodTextDocumentDidOpen, didOpen(path, src)); err != nil {
+			c.logger.Warn("reopen document in restarted gopls", "file", path, "err", err)
+		}
+	}
+}
+
+// Restarts is how many times the watchdog restarted gopls.
+func (c *Client) Restarts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restarts
+}
+
+// Err reports why gopls stopped for good: it kept going over its limits
+// or couldn't be restarted. Every request fails with it.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// session returns the current session and its generation.
+func (c *Client) session() (*session, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.s, c.gen, c.err
+}
+
+// call sends a request. One that fails because the watchdog restarted
+// gopls meanwhile is sent again to the new gopls.
+func (c *Client) call(method string, params, result any) error {
+	s, gen, err := c.session()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Call(s.ctx, method, params, result)
+	if err == nil {
+		return nil
+	}
+	// a restart bumps gen before killing gopls, so by the time the
+	// request fails the new session is either up or being started, and
+	// session waits for it
+	again, now, serr := c.session()
+	if serr != nil {
+		return serr
+	}
+	if now == gen {
+		return err
+	}
+	_, err = again.conn.Call(again.ctx, method, params, result)
+	return err
+}
+
+// notify sends a notification to the current gopls.
+func (c *Client) notify(method string, params any) error {
+	s, _, err := c.session()
 	if err != nil {
-		return fmt.Errorf("read file %s: %w", path, err)
+		return err
 	}
-	uri := fileURI(path)
-	params := protocol.DidOpenTextDocumentParams{
+	return s.conn.Notify(s.ctx, method, params)
+}
+
+func didOpen(path string, src []byte) protocol.DidOpenTextDocumentParams {
+	return protocol.DidOpenTextDocumentParams{
 		TextDocument: protocol.TextDocumentItem{
-			URI:        uri,
+			URI:        fileURI(path),
 			LanguageID: "go",
 			Version:    1,
 			Text:       string(src),
 		},
 	}
-	return c.conn.Notify(c.ctx, protocol.MethodTextDocumentDidOpen, params)
+}
+
+// OpenDocument sends a textDocument/didOpen notification with src as the
+// document's contents. gopls answers from them instead of the file on disk
+// for the rest of the session.
+func (c *Client) OpenDocument(path string, src []byte) error {
+	c.mu.Lock()
+	c.open[path] = src
+	c.mu.Unlock()
+	return c.notify(protocol.MethodTextDocumentDidOpen, didOpen(path, src))
+}
+
+// FilesChanged sends workspace/didChangeWatchedFiles so gopls re-reads
+// changed from disk and forgets deleted. Documents that aren't open are
+// read from disk, so this is all it needs to hear about edits to them.
+func (c *Client) FilesChanged(changed, deleted []string) error {
+	var events []*protocol.FileEvent
+	for _, path := range changed {
+		events = append(events, &protocol.FileEvent{URI: fileURI(path), Type: protocol.FileChangeTypeChanged})
+	}
+	for _, path := range deleted {
+		events = append(events, &protocol.FileEvent{URI: fileURI(path), Type: protocol.FileChangeTypeDeleted})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	params := protocol.DidChangeWatchedFilesParams{Changes: events}
+	return c.notify(protocol.MethodWorkspaceDidChangeWatchedFiles, params)
 }
 
 // FetchSymbols requests the document symbols.
@@ -108,7 +263,7 @@ func (c *Client) FetchSymbols(path string) ([]protocol.DocumentSymbol, error) {
 	params := protocol.DocumentSymbolParams{
 		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI(path)},
 	}
-	if _, err := c.conn.Call(c.ctx, protocol.MethodTextDocumentDocumentSymbol, params, &symbols); err != nil {
+	if err := c.call(protocol.MethodTextDocumentDocumentSymbol, params, &symbols); err != nil {
 		return nil, err
 	}
 	return symbols, nil
@@ -125,10 +280,7 @@ func (c *Client) PrepareCallHierarchy(path string,
 		},
 	}
 	var items []protocol.CallHierarchyItem
-	if _, err := c.conn.Call(c.ctx,
-		protocol.MethodTextDocumentPrepareCallHierarchy,
-		params, &items,
-	); err != nil {
+	if err := c.call(protocol.MethodTextDocumentPrepareCallHierarchy, params, &items); err != nil {
 		return nil, err
 	}
 	return items, nil
@@ -140,10 +292,7 @@ func (c *Client) IncomingCalls(
 ) ([]protocol.CallHierarchyIncomingCall, error) {
 	params := protocol.CallHierarchyIncomingCallsParams{Item: item}
 	var calls []protocol.CallHierarchyIncomingCall
-	if _, err := c.conn.Call(c.ctx,
-		protocol.MethodCallHierarchyIncomingCalls,
-		params, &calls,
-	); err != nil {
+	if err := c.call(protocol.MethodCallHierarchyIncomingCalls, params, &calls); err != nil {
 		return nil, err
 	}
 	return calls, nil
@@ -155,10 +304,7 @@ func (c *Client) OutgoingCalls(
 ) ([]protocol.CallHierarchyOutgoingCall, error) {
 	params := protocol.CallHierarchyOutgoingCallsParams{Item: item}
 	var calls []protocol.CallHierarchyOutgoingCall
-	if _, err := c.conn.Call(c.ctx,
-		protocol.MethodCallHierarchyOutgoingCalls,
-		params, &calls,
-	); err != nil {
+	if err := c.call(protocol.MethodCallHierarchyOutgoingCalls, params, &calls); err != nil {
 		return nil, err
 	}
 	return calls, nil
@@ -213,7 +359,7 @@ func initialize(ctx context.Context, conn jsonrpc2.Conn, rootDir string) error {
 	return nil
 }
 
-func startGopls(ctx context.Context) (*stdio, *exec.Cmd, error) {
+func startGopls(ctx context.Context, logger *slog.Logger) (*stdio, *exec.Cmd, error) {
 	cmd := exec.CommandContext(ctx, "gopls", "serve")
 	in, err := cmd.StdinPipe()
 	if err != nil {
@@ -223,11 +369,20 @@ func startGopls(ctx context.Context) (*stdio, *exec.Cmd, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	cmd.Stderr = os.Stderr
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
 	if err := cmd.Start(); err != nil {
 		return nil, nil, err
 	}
-	log.Printf("[lspclient] gopls started (PID %d)", cmd.Process.Pid)
+	logger.Debug("gopls started", "pid", cmd.Process.Pid)
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			logger.Debug("gopls", "output", sc.Text())
+		}
+	}()
 	return &stdio{in: in, out: out}, cmd, nil
 }
 
@@ -239,8 +394,7 @@ func newConn(ctx context.Context, transport *stdio) jsonrpc2.Conn {
 }
 
 func fileURI(path string) protocol.DocumentURI {
-	abs, _ := filepath.Abs(path)
-	return protocol.DocumentURI("file://" + filepath.ToSlash(abs))
+	return protocol.DocumentURI(fileuri.FromPath(path))
 }
 
 func utilFunc() {
@@ -270,7 +424,7 @@ func parseLogs(logs []string) map[string]int {
 		// Split log level and message
 		parts := strings.SplitN(line, ":", 2)
 		if len(parts) < 2 {
-			fmt.Printf("Skipping malformed log line: %s\n", line)
+			slog.Warn("skipping malformed log line", "line", line)
 			continue
 		}
 
@@ -278,7 +432,7 @@ func parseLogs(logs []string) map[string]int {
 		if _, exists := summary[level]; exists {
 			summary[level]++
 		} else {
-			fmt.Printf("Unknown log level found: %s\n", level)
+			slog.Warn("unknown log level", "level", level)
 		}
 	}
 
@@ -306,7 +460,7 @@ func parseLogsCopy(logs []string) map[string]int {
 		// Split log level and message
 		parts := strings.SplitN(line, ":", 2)
 		if len(parts) < 2 {
-			fmt.Printf("Skipping malformed log line: %s\n", line)
+			slog.Warn("skipping malformed log line", "line", line)
 			continue
 		}
 
@@ -314,7 +468,7 @@ func parseLogsCopy(logs []string) map[string]int {
 		if _, exists := summary[level]; exists {
 			summary[level]++
 		} else {
-			fmt.Printf("Unknown log level found: %s\n", level)
+			slog.Warn("unknown log level", "level", level)
 		}
 	}
 
@@ -0,0 +1,192 @@
+package lspclient
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the zero values of Limits.
+const (
+	DefaultCPUWindow   = 30 * time.Second
+	DefaultMaxRestarts = 3
+	watchInterval      = 2 * time.Second
+)
+
+// Limits bound the resources of the gopls process a Client runs. Past
+// them the Client's watchdog restarts gopls, and requests that were in
+// flight are sent again to the new one, so a build carries on. Zero
+// limits aren't enforced.
+type Limits struct {
+	// MaxMemory is the most resident memory gopls may use, in bytes.
+	MaxMemory uint64
+	// MaxCPU is how many cores gopls may keep busy, on average over
+	// CPUWindow (DefaultCPUWindow if zero): loading a large workspace
+	// takes every core for a while, a runaway gopls keeps on.
+	MaxCPU    float64
+	CPUWindow time.Duration
+	// MaxRestarts is how often gopls may be restarted before the Client
+	// gives up and fails every request; 0 means DefaultMaxRestarts.
+	MaxRestarts int
+}
+
+func (l Limits) enabled() bool { return l.MaxMemory > 0 || l.MaxCPU > 0 }
+
+func (l Limits) cpuWindow() time.Duration {
+	if l.CPUWindow <= 0 {
+		return DefaultCPUWindow
+	}
+	return l.CPUWindow
+}
+
+func (l Limits) maxRestarts() int {
+	if l.MaxRestarts <= 0 {
+		return DefaultMaxRestarts
+	}
+	return l.MaxRestarts
+}
+
+// usage is what a process has used: its resident memory now and its CPU
+// time so far.
+type usage struct {
+	rss uint64
+	cpu time.Duration
+}
+
+// watch samples gopls every watchInterval until the Client closes,
+// restarting it when it goes over c.limits.
+func (c *Client) watch() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var (
+		pid       int
+		last      usage
+		lastAt    time.Time
+		busy      time.Duration // CPU time since overSince
+		overSince time.Time     // when gopls went over MaxCPU, or zero
+	)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		p, gaveUp := c.s.cmd.Process.Pid, c.err != nil
+		c.mu.Unlock()
+		if gaveUp {
+			return
+		}
+		u, err := processUsage(p)
+		if err != nil {
+			continue // exited, or being restarted
+		}
+		now := time.Now()
+		if p != pid {
+			pid, last, lastAt, busy, overSince = p, u, now, 0, time.Time{}
+		}
+		if c.limits.MaxMemory > 0 && u.rss > c.limits.MaxMemory {
+			c.restart(fmt.Sprintf("resident memory %d MiB over the limit of %d MiB", u.rss>>20, c.limits.MaxMemory>>20))
+			continue
+		}
+		if c.limits.MaxCPU > 0 && now.After(lastAt) {
+			cores := float64(u.cpu-last.cpu) / float64(now.Sub(lastAt))
+			switch {
+			case cores <= c.limits.MaxCPU:
+				overSince, busy = time.Time{}, 0
+			case overSince.IsZero():
+				overSince, busy = lastAt, u.cpu-last.cpu
+			default:
+				busy += u.cpu - last.cpu
+			}
+			if window := now.Sub(overSince); !overSince.IsZero() && window >= c.limits.cpuWindow() {
+				c.restart(fmt.Sprintf("%.1f cores busy for %s, over the limit of %.1f", float64(busy)/float64(window),
+					window.Round(time.Second), c.limits.MaxCPU))
+				continue
+			}
+		}
+		last, lastAt = u, now
+	}
+}
+
+// processUsage reads pid's usage from /proc where there is one, and asks
+// ps elsewhere.
+func processUsage(pid int) (usage, error) {
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		return procUsage(stat)
+	}
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return usage{}, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return usage{}, fmt.Errorf("ps: unexpected output %q", out)
+	}
+	kib, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return usage{}, fmt.Errorf("ps: %w", err)
+	}
+	cpu, err := parseCPUTime(fields[1])
+	if err != nil {
+		return usage{}, fmt.Errorf("ps: %w", err)
+	}
+	return usage{rss: kib << 10, cpu: cpu}, nil
+}
+
+// procUsage parses /proc/<pid>/stat: utime and stime, in clock ticks of
+// 1/100 s on every Linux geeparse runs on, and rss, in pages.
+func procUsage(stat []byte) (usage, error) {
+	// the command name, in parentheses, may hold spaces
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return usage{}, fmt.Errorf("malformed /proc stat")
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	// fields[0] is the state, field 3 of the file
+	if len(fields) < 22 {
+		return usage{}, fmt.Errorf("malformed /proc stat")
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	pages, err3 := strconv.ParseUint(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return usage{}, fmt.Errorf("malformed /proc stat")
+	}
+	return usage{
+		rss: pages * uint64(os.Getpagesize()),
+		cpu: time.Duration(utime+stime) * 10 * time.Millisecond,
+	}, nil
+}
+
+// parseCPUTime parses ps's cumulative CPU time, [[dd-]hh:]mm:ss[.ss].
+func parseCPUTime(s string) (time.Duration, error) {
+	var days time.Duration
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("bad CPU time %q", s)
+		}
+		days, s = time.Duration(n)*24*time.Hour, rest
+	}
+	parts := strings.Split(s, ":")
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || len(parts) > 3 {
+		return 0, fmt.Errorf("bad CPU time %q", s)
+	}
+	total := days + time.Duration(secs*float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("bad CPU time %q", s)
+		}
+		total += time.Duration(n) * unit
+		unit *= 60
+	}
+	return total, nil
+}
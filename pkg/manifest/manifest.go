@@ -0,0 +1,193 @@
+// Package manifest describes a call-graph in a small, signable document:
+// digests of its functions and calls, the revision it was built from and
+// the geeparse version that built it. With a detached Ed25519 signature,
+// whoever receives a graph, an export or a snapshot can check it is the
+// one built from that revision, unaltered.
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Schema identifies the manifest format, for readers to reject others.
+const Schema = "geeparse-manifest/1"
+
+// SignatureExt is appended to a manifest's path for its detached
+// signature.
+const SignatureExt = ".sig"
+
+// Manifest describes one graph.
+type Manifest struct {
+	Schema    string    `json:"schema"`
+	Tool      string    `json:"tool"` // geeparse version
+	CreatedAt time.Time `json:"createdAt"`
+	Source    Source    `json:"source"`
+	// Snapshot is the ID of the snapshot the graph was saved as, if any.
+	Snapshot  int64     `json:"snapshot,omitempty"`
+	Artifact  *Artifact `json:"artifact,omitempty"`
+	Functions int       `json:"functions"`
+	Calls     int       `json:"calls"`
+	// Nodes and Edges are the Digest of the graph's functions and calls.
+	Nodes string `json:"nodes"`
+	Edges string `json:"edges"`
+}
+
+// Source is the revision a graph was built from. Dirty means the working
+// tree had uncommitted changes, so the commit alone doesn't reproduce it.
+type Source struct {
+	Repo   string `json:"repo,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Dirty  bool   `json:"dirty,omitempty"`
+}
+
+// Artifact is a file the graph was exported to.
+type Artifact struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	SHA256 string `json:"sha256"`
+}
+
+// New returns the manifest of graph, built from src by this geeparse.
+func New(graph map[string]callgraph.FunctionNode, src Source) Manifest {
+	nodes, edges := Digest(graph)
+	return Manifest{
+		Schema:    Schema,
+		Tool:      buildinfo.Version(),
+		CreatedAt: time.Now().UTC(),
+		Source:    src,
+		Functions: len(graph),
+		Calls:     callgraph.EdgeCount(graph),
+		Nodes:     nodes,
+		Edges:     edges,
+	}
+}
+
+// Digest returns SHA-256 digests of graph's functions (name, package,
+// signature, definition, language and generator, leaving out file paths,
+// which differ between checkouts) and of its calls (caller, callee and
+// kind), each over the records sorted.
+func Digest(graph map[string]callgraph.FunctionNode) (nodes, edges string) {
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nh, eh := sha256.New(), sha256.New()
+	for _, name := range names {
+		n := graph[name]
+		record(nh, name, n.Package, n.Signature, n.Definition, n.Language, n.Generated)
+		callees := append([]string(nil), n.Callees...)
+		sort.Strings(callees)
+		for _, callee := range callees {
+			record(eh, name, callee, n.Kinds[callee])
+		}
+	}
+	return "sha256:" + hex.EncodeToString(nh.Sum(nil)), "sha256:" + hex.EncodeToString(eh.Sum(nil))
+}
+
+// record writes fields to w, each NUL-terminated, so no two records
+// hash alike by shifting text between fields.
+func record(w io.Writer, fields ...string) {
+	for _, f := range fields {
+		io.WriteString(w, f)
+		w.Write([]byte{0})
+	}
+}
+
+// Check reports how graph departs from m, or nil if it's the graph m
+// describes.
+func (m Manifest) Check(graph map[string]callgraph.FunctionNode) error {
+	nodes, edges := Digest(graph)
+	var errs []error
+	if n := len(graph); n != m.Functions {
+		errs = append(errs, fmt.Errorf("%d functions, manifest says %d", n, m.Functions))
+	}
+	if n := callgraph.EdgeCount(graph); n != m.Calls {
+		errs = append(errs, fmt.Errorf("%d calls, manifest says %d", n, m.Calls))
+	}
+	if nodes != m.Nodes {
+		errs = append(errs, errors.New("functions differ from the manifest's"))
+	}
+	if edges != m.Edges {
+		errs = append(errs, errors.New("calls differ from the manifest's"))
+	}
+	return errors.Join(errs...)
+}
+
+// FileSHA256 returns the hex SHA-256 of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Write saves m as indented JSON at path and, with a key, its signature
+// at path+SignatureExt.
+func Write(path string, m Manifest, key ed25519.PrivateKey) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n"
+	return os.WriteFile(path+SignatureExt, []byte(sig), 0o644)
+}
+
+// Read loads the manifest at path. With a public key it first checks the
+// signature at path+SignatureExt against the file's exact bytes.
+func Read(path string, pub ed25519.PublicKey) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if pub != nil {
+		enc, err := os.ReadFile(path + SignatureExt)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("signature: %w", err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(enc)))
+		if err != nil {
+			return Manifest{}, fmt.Errorf("signature %s: %w", path+SignatureExt, err)
+		}
+		if !ed25519.Verify(pub, data, sig) {
+			return Manifest{}, fmt.Errorf("%s: signature doesn't match the manifest and key", path)
+		}
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Schema != Schema {
+		return Manifest{}, fmt.Errorf("%s: unknown manifest schema %q (want %s)", path, m.Schema, Schema)
+	}
+	return m, nil
+}
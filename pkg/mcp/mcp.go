@@ -0,0 +1,154 @@
+// Package mcp serves call-graph queries over the Model Context Protocol,
+// so coding assistants can look up functions, their callers and callees
+// and the call chains between them instead of guessing. It speaks the
+// stdio transport: newline-delimited JSON-RPC 2.0 messages.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// ProtocolVersions are the MCP revisions the server speaks, newest first.
+var ProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// Server answers MCP requests from the graph in a store. The graph is
+// read afresh for every call, so a concurrent build or watch shows up
+// without a restart.
+type Server struct {
+	store   *persistence.Store
+	version string
+
+	mu sync.Mutex // serializes writes to the client
+}
+
+// New returns a server reading from store; version is reported to
+// clients as the server's version.
+func New(store *persistence.Store, version string) *Server {
+	return &Server{store: store, version: version}
+}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Serve reads requests from r and writes responses to w until r ends or
+// ctx is cancelled. Notifications get no response.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			if err := s.write(w, response{ID: json.RawMessage("null"), Error: &rpcError{codeParseError, err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.ID == nil {
+			// notifications (initialized, cancelled, ...) need no answer
+			continue
+		}
+		result, err := s.handle(req)
+		resp := response{ID: req.ID, Result: result}
+		if err != nil {
+			var rerr *rpcError
+			if !errors.As(err, &rerr) {
+				rerr = &rpcError{codeInvalidRequest, err.Error()}
+			}
+			resp.Result, resp.Error = nil, rerr
+		}
+		if err := s.write(w, resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (s *Server) write(w io.Writer, resp response) error {
+	resp.JSONRPC = "2.0"
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func (s *Server) handle(req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &p)
+		version := ProtocolVersions[0]
+		if slices.Contains(ProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "geeparse", "version": s.version},
+			"instructions": "Query the call graph of the analyzed Go code. Functions are named " +
+				"without package qualifiers; use find_function to discover exact names first.",
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		return s.callTool(p.Name, p.Arguments)
+	default:
+		return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
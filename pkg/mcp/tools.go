@@ -0,0 +1,269 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// tool describes one tool to clients; InputSchema is a JSON Schema.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+func schema(required []string, props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+var (
+	functionProp = map[string]any{"type": "string", "description": "exact function name, e.g. \"handleGraph\""}
+	depthProp    = map[string]any{"type": "integer", "description": "max number of calls to follow (0 = unlimited)"}
+)
+
+var tools = []tool{
+	{
+		Name:        "find_function",
+		Description: "Find functions whose name or package contains a substring (case-insensitive). Returns name, package, file, line and signature.",
+		InputSchema: schema([]string{"query"}, map[string]any{
+			"query": map[string]any{"type": "string", "description": "substring of the function or package name"},
+			"limit": map[string]any{"type": "integer", "description": "max results (default 20)"},
+		}),
+	},
+	{
+		Name:        "get_definition",
+		Description: "Get a function's signature, location and full source.",
+		InputSchema: schema([]string{"function"}, map[string]any{"function": functionProp}),
+	},
+	{
+		Name:        "get_callers",
+		Description: "List the functions that call a function directly.",
+		InputSchema: schema([]string{"function"}, map[string]any{"function": functionProp}),
+	},
+	{
+		Name:        "get_callees",
+		Description: "List the functions a function calls directly.",
+		InputSchema: schema([]string{"function"}, map[string]any{"function": functionProp}),
+	},
+	{
+		Name:        "find_paths",
+		Description: "Find call chains from one function to another: the shortest, or with all=true every chain that doesn't revisit a function.",
+		InputSchema: schema([]string{"from", "to"}, map[string]any{
+			"from":      functionProp,
+			"to":        functionProp,
+			"all":       map[string]any{"type": "boolean", "description": "return every chain, not just the shortest"},
+			"max_depth": map[string]any{"type": "integer", "description": "max number of calls per chain (0 = unlimited, or 10 when all=true)"},
+			"limit":     map[string]any{"type": "integer", "description": "max chains when all=true (default 20)"},
+		}),
+	},
+}
+
+// callTool runs one tool. Problems with the arguments, such as an unknown
+// function, come back as a tool result flagged isError so the model can
+// correct itself; only failures of the server itself are JSON-RPC errors.
+func (s *Server) callTool(name string, args json.RawMessage) (any, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var out any
+	var err error
+	switch name {
+	case "find_function":
+		out, err = s.findFunction(args)
+	case "get_definition":
+		out, err = s.definition(args)
+	case "get_callers", "get_callees":
+		out, err = s.neighbours(name, args)
+	case "find_paths":
+		out, err = s.paths(args)
+	default:
+		return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", name)}
+	}
+
+	var toolErr toolError
+	if errors.As(err, &toolErr) || errors.Is(err, persistence.ErrNotFound) {
+		return toolResult(err.Error(), true), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return toolResult(string(data), false), nil
+}
+
+// toolError is a mistake in a tool call the model can fix.
+type toolError string
+
+func (e toolError) Error() string { return string(e) }
+
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func decodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return toolError("bad arguments: " + err.Error())
+	}
+	return nil
+}
+
+// match is one find_function result.
+type match struct {
+	analysis.Location
+	Signature string `json:"signature"`
+}
+
+func (s *Server) findFunction(args json.RawMessage) (any, error) {
+	var a struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if a.Limit <= 0 {
+		a.Limit = 20
+	}
+	graph, err := s.store.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	q := strings.ToLower(a.Query)
+	var names []string
+	for name, node := range graph {
+		if strings.Contains(strings.ToLower(name), q) || strings.Contains(strings.ToLower(node.Package), q) {
+			names = append(names, name)
+		}
+	}
+	// exact and prefix matches are what the model most likely wants
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := rank(names[i], q), rank(names[j], q)
+		if ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	total := len(names)
+	if len(names) > a.Limit {
+		names = names[:a.Limit]
+	}
+	matches := []match{}
+	for _, name := range names {
+		matches = append(matches, match{Location: analysis.LocationOf(graph, name), Signature: graph[name].Signature})
+	}
+	return map[string]any{"matches": matches, "total": total}, nil
+}
+
+func rank(name, q string) int {
+	n := strings.ToLower(name)
+	switch {
+	case n == q:
+		return 0
+	case strings.HasPrefix(n, q):
+		return 1
+	case strings.Contains(n, q):
+		return 2
+	}
+	return 3
+}
+
+func (s *Server) definition(args json.RawMessage) (any, error) {
+	var a struct {
+		Function string `json:"function"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	node, err := s.store.Function(a.Function)
+	if err != nil {
+		return nil, fmt.Errorf("function %q: %w", a.Function, err)
+	}
+	return map[string]any{
+		"name":       a.Function,
+		"package":    node.Package,
+		"file":       node.File,
+		"line":       node.Line,
+		"endLine":    node.EndLine,
+		"signature":  node.Signature,
+		"definition": node.Definition,
+	}, nil
+}
+
+func (s *Server) neighbours(tool string, args json.RawMessage) (any, error) {
+	var a struct {
+		Function string `json:"function"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Function(a.Function); err != nil {
+		return nil, fmt.Errorf("function %q: %w", a.Function, err)
+	}
+	var names []string
+	var err error
+	if tool == "get_callers" {
+		names, err = s.store.Callers(a.Function)
+	} else {
+		names, err = s.store.Callees(a.Function)
+	}
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.store.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	locs := []analysis.Location{}
+	for _, name := range names {
+		locs = append(locs, analysis.LocationOf(graph, name))
+	}
+	return map[string]any{"function": a.Function, "results": locs}, nil
+}
+
+func (s *Server) paths(args json.RawMessage) (any, error) {
+	var a struct {
+		From     string `json:"from"`
+		To       string `json:"to"`
+		All      bool   `json:"all"`
+		MaxDepth int    `json:"max_depth"`
+		Limit    int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if a.Limit <= 0 {
+		a.Limit = 20
+	}
+	graph, err := s.store.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range []string{a.From, a.To} {
+		if _, ok := graph[fn]; !ok {
+			return nil, toolError(fmt.Sprintf("unknown function %q; use find_function to look up names", fn))
+		}
+	}
+	paths := [][]string{}
+	truncated := false
+	if a.All {
+		paths, truncated = analysis.AllPaths(graph, a.From, a.To, a.MaxDepth, a.Limit)
+	} else if p := analysis.ShortestPath(graph, a.From, a.To, a.MaxDepth); p != nil {
+		paths = [][]string{p}
+	}
+	if paths == nil {
+		paths = [][]string{}
+	}
+	return map[string]any{"from": a.From, "to": a.To, "paths": paths, "truncated": truncated}, nil
+}
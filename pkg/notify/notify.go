@@ -0,0 +1,263 @@
+// Package notify tells a chat channel or other webhook what changed when a
+// graph is rebuilt: functions added and removed, exported signatures that
+// changed, cycles that appeared and architecture rules newly broken.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+)
+
+// Formats are the payload shapes a Webhook can post.
+var Formats = []string{"slack", "teams", "json"}
+
+// Summary is what changed in one rebuild. Every list is sorted.
+type Summary struct {
+	Label            string                 `json:"label,omitempty"`
+	Functions        int                    `json:"functions"`
+	Calls            int                    `json:"calls"`
+	AddedFunctions   []string               `json:"addedFunctions"`
+	RemovedFunctions []string               `json:"removedFunctions"`
+	RenamedFunctions []diff.Rename          `json:"renamedFunctions"`
+	SignatureChanges []diff.SignatureChange `json:"signatureChanges"`
+	NewCycles        [][]string             `json:"newCycles"`
+	NewViolations    []policy.Violation     `json:"newViolations"`
+	TotalViolations  int                    `json:"totalViolations"`
+}
+
+// Summarize compares the graph before and after a rebuild. A cycle is new
+// if its exact set of functions wasn't a cycle before; a violation is new
+// if the same rule wasn't already broken by the same call.
+func Summarize(label string, old, new map[string]callgraph.FunctionNode, rules []policy.Rule) Summary {
+	d := diff.Compare(old, new)
+	s := Summary{
+		Label:            label,
+		Functions:        len(new),
+		Calls:            callgraph.EdgeCount(new),
+		AddedFunctions:   d.AddedFunctions,
+		RemovedFunctions: d.RemovedFunctions,
+		RenamedFunctions: d.RenamedFunctions,
+		SignatureChanges: d.SignatureChanges,
+		NewCycles:        [][]string{},
+		NewViolations:    []policy.Violation{},
+	}
+
+	before := make(map[string]bool)
+	for _, c := range analysis.Cycles(old) {
+		before[cycleKey(c)] = true
+	}
+	for _, c := range analysis.Cycles(new) {
+		if !before[cycleKey(c)] {
+			s.NewCycles = append(s.NewCycles, c)
+		}
+	}
+
+	if len(rules) > 0 {
+		type call struct{ rule, caller, callee string }
+		broken := make(map[call]bool)
+		for _, v := range policy.Check(old, rules) {
+			broken[call{v.Rule, v.Caller, v.Callee}] = true
+		}
+		violations := policy.Check(new, rules)
+		s.TotalViolations = len(violations)
+		for _, v := range violations {
+			if !broken[call{v.Rule, v.Caller, v.Callee}] {
+				s.NewViolations = append(s.NewViolations, v)
+			}
+		}
+	}
+	return s
+}
+
+func cycleKey(members []string) string {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "\x00")
+}
+
+// Empty reports whether there is nothing worth telling anyone: calls may
+// have moved and bodies changed, but no function, cycle or violation came,
+// went or was renamed and no exported signature changed.
+func (s Summary) Empty() bool {
+	return len(s.AddedFunctions) == 0 && len(s.RemovedFunctions) == 0 && len(s.RenamedFunctions) == 0 &&
+		len(s.SignatureChanges) == 0 && len(s.NewCycles) == 0 && len(s.NewViolations) == 0
+}
+
+// maxListed caps how many names each line of a message spells out.
+const maxListed = 10
+
+// Title is the one-line headline of a message.
+func (s Summary) Title() string {
+	label := s.Label
+	if label == "" {
+		label = "call graph"
+	}
+	return fmt.Sprintf("geeparse: %s rebuilt (%d functions, %d calls)", label, s.Functions, s.Calls)
+}
+
+// Lines are the body of a message, one change per line.
+func (s Summary) Lines() []string {
+	var out []string
+	if n := len(s.AddedFunctions); n > 0 {
+		out = append(out, fmt.Sprintf("+%d %s: %s", n, plural(n, "function"), list(s.AddedFunctions)))
+	}
+	if n := len(s.RemovedFunctions); n > 0 {
+		out = append(out, fmt.Sprintf("-%d %s: %s", n, plural(n, "function"), list(s.RemovedFunctions)))
+	}
+	if n := len(s.RenamedFunctions); n > 0 {
+		renames := make([]string, n)
+		for i, r := range s.RenamedFunctions {
+			renames[i] = r.String()
+		}
+		out = append(out, fmt.Sprintf("%d %s renamed: %s", n, plural(n, "function"), list(renames)))
+	}
+	if n := len(s.SignatureChanges); n > 0 {
+		names := make([]string, n)
+		for i, c := range s.SignatureChanges {
+			names[i] = c.Function
+		}
+		out = append(out, fmt.Sprintf("%d exported %s changed (possibly breaking): %s", n, plural(n, "signature"), list(names)))
+	}
+	for i, c := range s.NewCycles {
+		if i == maxListed {
+			out = append(out, fmt.Sprintf("... and %d more new cycles", len(s.NewCycles)-i))
+			break
+		}
+		out = append(out, fmt.Sprintf("new cycle through %d %s: %s", len(c), plural(len(c), "function"), list(c)))
+	}
+	if n := len(s.NewViolations); n > 0 {
+		out = append(out, fmt.Sprintf("%d new policy %s (%d in total):", n, plural(n, "violation"), s.TotalViolations))
+		for i, v := range s.NewViolations {
+			if i == maxListed {
+				out = append(out, fmt.Sprintf("... and %d more", n-i))
+				break
+			}
+			out = append(out, fmt.Sprintf("%s: %s → %s (%s:%d)", v.Rule, v.Caller, v.Callee, v.File, v.Line))
+		}
+	}
+	return out
+}
+
+func list(names []string) string {
+	if len(names) <= maxListed {
+		return strings.Join(names, ", ")
+	}
+	return strings.Join(names[:maxListed], ", ") + fmt.Sprintf(", ... and %d more", len(names)-maxListed)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// Webhook posts summaries to a URL.
+type Webhook struct {
+	URL string
+	// Format is slack, teams or json. Empty picks slack or teams for
+	// their webhook hosts and json for anything else.
+	Format string
+	// Client defaults to one with a ten-second timeout.
+	Client *http.Client
+}
+
+// Validate checks the URL and format before anything is posted.
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %q: want an http or https URL", w.URL)
+	}
+	if w.format() == "" {
+		return fmt.Errorf("unknown webhook format %q (want %s)", w.Format, strings.Join(Formats, ", "))
+	}
+	return nil
+}
+
+func (w *Webhook) format() string {
+	for _, f := range Formats {
+		if strings.EqualFold(w.Format, f) {
+			return f
+		}
+	}
+	if w.Format != "" {
+		return ""
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return "json"
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return "slack"
+	case strings.HasSuffix(host, ".webhook.office.com") || strings.HasSuffix(host, ".logic.azure.com"):
+		return "teams"
+	}
+	return "json"
+}
+
+// Post sends s to the webhook. Any response other than 2xx is an error.
+func (w *Webhook) Post(ctx context.Context, s Summary) error {
+	body, err := w.payload(s)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("post webhook: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (w *Webhook) payload(s Summary) ([]byte, error) {
+	switch w.format() {
+	case "slack":
+		return json.Marshal(map[string]any{
+			"text": "*" + s.Title() + "*\n" + strings.Join(s.Lines(), "\n"),
+		})
+	case "teams":
+		// Teams markdown needs a blank line to break a line
+		return json.Marshal(map[string]any{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  s.Title(),
+			"title":    s.Title(),
+			"text":     strings.Join(s.Lines(), "\n\n"),
+		})
+	case "json":
+		return json.Marshal(map[string]any{
+			"event":   "graph.rebuilt",
+			"text":    s.Title() + "\n" + strings.Join(s.Lines(), "\n"),
+			"summary": s,
+		})
+	}
+	return nil, fmt.Errorf("unknown webhook format %q (want %s)", w.Format, strings.Join(Formats, ", "))
+}
@@ -0,0 +1,229 @@
+// Package ownership works out who owns each function of a call-graph, from
+// a CODEOWNERS file or, failing that, from git blame.
+package ownership
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/vcs"
+)
+
+// Sources of an owner.
+const (
+	SourceCodeowners = "codeowners"
+	SourceBlame      = "blame"
+)
+
+// Owner is who owns one function and how we know.
+type Owner struct {
+	Owner  string `json:"owner"`  // e.g. "@org/team" or an author's email
+	Source string `json:"source"` // SourceCodeowners or SourceBlame
+}
+
+// CodeownersLocations are where GitHub and GitLab look for the file,
+// relative to the repository root.
+var CodeownersLocations = []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// Codeowners is a parsed CODEOWNERS file. As on GitHub, the last matching
+// rule wins.
+type Codeowners struct {
+	rules []rule
+}
+
+type rule struct {
+	re     *regexp.Regexp
+	owners []string
+}
+
+// FindCodeowners loads the CODEOWNERS file of the repository at root, or
+// returns nil if there is none.
+func FindCodeowners(root string) (*Codeowners, error) {
+	for _, loc := range CodeownersLocations {
+		f, err := os.Open(filepath.Join(root, loc))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		co, err := ParseCodeowners(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc, err)
+		}
+		return co, nil
+	}
+	return nil, nil
+}
+
+// ParseCodeowners reads CODEOWNERS rules: a gitignore-style pattern
+// followed by owners, one per line. GitLab [Section] headers are ignored.
+func ParseCodeowners(r io.Reader) (*Codeowners, error) {
+	co := &Codeowners{}
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		re, err := patternRegexp(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		co.rules = append(co.rules, rule{re: re, owners: fields[1:]})
+	}
+	return co, sc.Err()
+}
+
+// patternRegexp translates a gitignore-style pattern into a regexp over
+// slash-separated paths relative to the repository root.
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/")
+	p := strings.Trim(pattern, "/")
+	if strings.Contains(p, "/") {
+		anchored = true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					b.WriteString("/?")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	prefix := "^"
+	if !anchored {
+		prefix = "^(?:.*/)?"
+	}
+	// a match on a directory covers everything inside it
+	return regexp.Compile(prefix + b.String() + "(?:/.*)?$")
+}
+
+// Owners returns the owners of the file at rel (slash-separated, relative
+// to the repository root), or nil if no rule matches or the matching rule
+// lists nobody.
+func (co *Codeowners) Owners(rel string) []string {
+	for i := len(co.rules) - 1; i >= 0; i-- {
+		if co.rules[i].re.MatchString(rel) {
+			return co.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// Assign works out an owner for every function in graph whose file lies
+// under repoRoot: the first CODEOWNERS owner of its file when co has a
+// rule for it, otherwise, with blame set, the author of most of its lines.
+func Assign(graph map[string]callgraph.FunctionNode, repoRoot string, co *Codeowners, blame bool) (map[string]Owner, error) {
+	out := make(map[string]Owner)
+	byFile := make(map[string][]string)
+	for name, node := range graph {
+		if node.File == "" {
+			continue
+		}
+		rel, err := filepath.Rel(repoRoot, node.File)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if co != nil {
+			if owners := co.Owners(filepath.ToSlash(rel)); len(owners) > 0 {
+				out[name] = Owner{Owner: owners[0], Source: SourceCodeowners}
+				continue
+			}
+		}
+		byFile[node.File] = append(byFile[node.File], name)
+	}
+	if !blame {
+		return out, nil
+	}
+
+	files := make([]string, 0, len(byFile))
+	for f := range byFile {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		authors, err := blameLines(repoRoot, file)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range byFile[file] {
+			node := graph[name]
+			end := node.EndLine
+			if end == 0 {
+				end = node.Line
+			}
+			if a := primaryAuthor(authors, node.Line, end); a != "" {
+				out[name] = Owner{Owner: a, Source: SourceBlame}
+			}
+		}
+	}
+	return out, nil
+}
+
+// blameLines returns the author email of every line of file, indexed from
+// 1. Untracked files have no authors.
+func blameLines(repoRoot, file string) ([]string, error) {
+	out, err := vcs.Git(repoRoot, "blame", "--line-porcelain", "--", file)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such path") || strings.Contains(err.Error(), "not tracked") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	authors := []string{""}
+	var author string
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "author-mail "):
+			author = strings.Trim(strings.TrimPrefix(line, "author-mail "), "<>")
+		case strings.HasPrefix(line, "\t"):
+			// the content line closes each per-line header block
+			authors = append(authors, author)
+		}
+	}
+	return authors, nil
+}
+
+// primaryAuthor returns whoever wrote most of lines start..end, the
+// alphabetically first on a tie.
+func primaryAuthor(authors []string, start, end int) string {
+	counts := make(map[string]int)
+	for l := start; l <= end && l < len(authors); l++ {
+		if a := authors[l]; a != "" && a != "not.committed.yet" {
+			counts[a]++
+		}
+	}
+	best := ""
+	for a, n := range counts {
+		if n > counts[best] || (n == counts[best] && a < best) {
+			best = a
+		}
+	}
+	return best
+}
@@ -0,0 +1,201 @@
+// Package perf overlays runtime cost from pprof CPU or heap profiles on a
+// call-graph: how much time or memory each function and call accounts for.
+// It decodes the parts of the profile.proto format it needs itself, so
+// geeparse doesn't depend on the pprof tool.
+package perf
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Profile is the cost of the functions and calls of one graph, taken from
+// one sample type of a pprof profile.
+type Profile struct {
+	SampleType string `json:"sampleType"` // e.g. "cpu", "inuse_space"
+	Unit       string `json:"unit"`       // e.g. "nanoseconds", "bytes"
+	Total      int64  `json:"total"`      // sum over all samples, ours or not
+	// Nodes holds per-function cost: Flat while the function itself was
+	// running, Cum including everything it called.
+	Nodes map[string]Cost `json:"nodes"`
+	// Edges holds the cost of samples passing through each call, hottest
+	// first.
+	Edges []EdgeCost `json:"edges"`
+}
+
+// Cost is the flat and cumulative sample value of one function.
+type Cost struct {
+	Flat int64 `json:"flat"`
+	Cum  int64 `json:"cum"`
+}
+
+// EdgeCost is the sample value flowing through one caller→callee call.
+type EdgeCost struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Value  int64  `json:"value"`
+}
+
+// Load reads a pprof profile and maps its samples of sampleType (empty
+// means the profile's default, e.g. "cpu" or "inuse_space") onto graph.
+// Frames are matched to functions by name and by the file they live in,
+// so standard-library functions sharing a name with one of ours don't
+// count as ours.
+func Load(r io.Reader, sampleType string, graph map[string]callgraph.FunctionNode) (*Profile, error) {
+	raw, err := parsePprof(r)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := raw.sampleIndex(sampleType)
+	if err != nil {
+		return nil, err
+	}
+	vt := raw.sampleTypes[idx]
+	out := &Profile{
+		SampleType: raw.str(vt.typ),
+		Unit:       raw.str(vt.unit),
+		Nodes:      make(map[string]Cost),
+	}
+
+	// resolve each pprof function once
+	names := make(map[uint64]string)
+	for id, fn := range raw.functions {
+		if name, ok := graphFunction(graph, raw.str(fn.name), raw.str(fn.filename)); ok {
+			names[id] = name
+		}
+	}
+
+	edges := make(map[[2]string]int64)
+	for _, s := range raw.samples {
+		if idx >= len(s.values) {
+			continue
+		}
+		v := s.values[idx]
+		out.Total += v
+
+		// flatten the stack, leaf first, dropping frames that aren't ours
+		// but keeping a gap marker so calls through them aren't invented
+		var frames []string
+		for _, locID := range s.locations {
+			for _, l := range raw.locations[locID] {
+				frames = append(frames, names[l.function])
+			}
+		}
+		seen := make(map[string]bool)
+		seenEdge := make(map[[2]string]bool)
+		for i, name := range frames {
+			if name == "" {
+				continue
+			}
+			if i == 0 {
+				c := out.Nodes[name]
+				c.Flat += v
+				out.Nodes[name] = c
+			}
+			if !seen[name] {
+				seen[name] = true
+				c := out.Nodes[name]
+				c.Cum += v
+				out.Nodes[name] = c
+			}
+			if i+1 < len(frames) && frames[i+1] != "" {
+				e := [2]string{frames[i+1], name}
+				if !seenEdge[e] {
+					seenEdge[e] = true
+					edges[e] += v
+				}
+			}
+		}
+	}
+
+	for e, v := range edges {
+		out.Edges = append(out.Edges, EdgeCost{Caller: e[0], Callee: e[1], Value: v})
+	}
+	sort.Slice(out.Edges, func(i, j int) bool {
+		a, b := out.Edges[i], out.Edges[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+	return out, nil
+}
+
+// sampleIndex picks the value column for sampleType.
+func (p *rawProfile) sampleIndex(sampleType string) (int, error) {
+	if sampleType == "" {
+		for i, vt := range p.sampleTypes {
+			if p.defaultSampleType != 0 && vt.typ == p.defaultSampleType {
+				return i, nil
+			}
+		}
+		// pprof's convention: the last sample type is the default
+		return len(p.sampleTypes) - 1, nil
+	}
+	var avail []string
+	for i, vt := range p.sampleTypes {
+		if p.str(vt.typ) == sampleType {
+			return i, nil
+		}
+		avail = append(avail, p.str(vt.typ))
+	}
+	return 0, fmt.Errorf("profile has no %q samples (available: %s)", sampleType, strings.Join(avail, ", "))
+}
+
+// closureSuffix matches the parts the compiler appends to names of
+// closures and go-statement wrappers: "func1", "gowrap2", "1".
+var closureSuffix = regexp.MustCompile(`^(func|gowrap|deferwrap)?\d+$`)
+
+// graphFunction maps a pprof function name such as
+// "github.com/x/y/pkg/server.(*Server).handleGraph.func1" defined in
+// filename to the graph function it belongs to ("handleGraph").
+func graphFunction(graph map[string]callgraph.FunctionNode, full, filename string) (string, bool) {
+	// drop the import path, then the package name
+	short := full[strings.LastIndex(full, "/")+1:]
+	_, short, _ = strings.Cut(short, ".")
+	parts := strings.Split(short, ".")
+	for len(parts) > 1 && closureSuffix.MatchString(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+	name := parts[len(parts)-1]
+
+	node, ok := graph[name]
+	if !ok {
+		return "", false
+	}
+	if node.File == "" || filename == "" {
+		return name, true
+	}
+	rel := filepath.Base(node.File)
+	if node.Package != "" && node.Package != "." {
+		rel = node.Package + "/" + rel
+	}
+	filename = filepath.ToSlash(filename)
+	return name, filename == rel || strings.HasSuffix(filename, "/"+rel)
+}
+
+// EdgeWeights scales each call's cost to 0-1 relative to the hottest call,
+// keyed by caller then callee.
+func (p *Profile) EdgeWeights() map[string]map[string]float64 {
+	out := make(map[string]map[string]float64)
+	if len(p.Edges) == 0 || p.Edges[0].Value <= 0 {
+		return out
+	}
+	top := float64(p.Edges[0].Value)
+	for _, e := range p.Edges {
+		if out[e.Caller] == nil {
+			out[e.Caller] = make(map[string]float64)
+		}
+		out[e.Caller][e.Callee] = float64(e.Value) / top
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package perf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// rawProfile holds the parts of a pprof profile.proto message we use.
+type rawProfile struct {
+	sampleTypes       []valueType
+	samples           []sample
+	locations         map[uint64][]line // id → lines, innermost inlined call first
+	functions         map[uint64]function
+	strings           []string
+	defaultSampleType int64
+}
+
+type valueType struct{ typ, unit int64 }
+
+type sample struct {
+	locations []uint64 // leaf first
+	values    []int64
+}
+
+type line struct {
+	function uint64
+	line     int64
+}
+
+type function struct {
+	name, filename int64
+}
+
+func (p *rawProfile) str(i int64) string {
+	if i < 0 || int(i) >= len(p.strings) {
+		return ""
+	}
+	return p.strings[i]
+}
+
+// parsePprof decodes a (possibly gzipped) profile.proto message.
+func parsePprof(r io.Reader) (*rawProfile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("decompress profile: %w", err)
+		}
+	}
+
+	p := &rawProfile{locations: make(map[uint64][]line), functions: make(map[uint64]function)}
+	err = eachField(data, func(num int, wire int, v uint64, b []byte) error {
+		switch num {
+		case 1: // sample_type
+			var vt valueType
+			err := eachField(b, func(num, _ int, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					vt.typ = int64(v)
+				case 2:
+					vt.unit = int64(v)
+				}
+				return nil
+			})
+			p.sampleTypes = append(p.sampleTypes, vt)
+			return err
+		case 2: // sample
+			var s sample
+			err := eachField(b, func(num, wire int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					return appendPacked(&s.locations, wire, v, b, func(x uint64) uint64 { return x })
+				case 2:
+					return appendPacked(&s.values, wire, v, b, func(x uint64) int64 { return int64(x) })
+				}
+				return nil
+			})
+			p.samples = append(p.samples, s)
+			return err
+		case 4: // location
+			var id uint64
+			var lines []line
+			err := eachField(b, func(num, _ int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					id = v
+				case 4:
+					var l line
+					err := eachField(b, func(num, _ int, v uint64, _ []byte) error {
+						switch num {
+						case 1:
+							l.function = v
+						case 2:
+							l.line = int64(v)
+						}
+						return nil
+					})
+					lines = append(lines, l)
+					return err
+				}
+				return nil
+			})
+			p.locations[id] = lines
+			return err
+		case 5: // function
+			var id uint64
+			var fn function
+			err := eachField(b, func(num, _ int, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					id = v
+				case 2:
+					fn.name = int64(v)
+				case 4:
+					fn.filename = int64(v)
+				}
+				return nil
+			})
+			p.functions[id] = fn
+			return err
+		case 6: // string_table
+			p.strings = append(p.strings, string(b))
+		case 14: // default_sample_type
+			p.defaultSampleType = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decode profile: %w", err)
+	}
+	if len(p.sampleTypes) == 0 {
+		return nil, errors.New("decode profile: no sample types; is this a pprof profile?")
+	}
+	return p, nil
+}
+
+// eachField walks the fields of one protobuf message. Varint and fixed
+// fields arrive in v, length-delimited ones in b.
+func eachField(data []byte, fn func(num, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("bad field key")
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+		var v uint64
+		var b []byte
+		switch wire {
+		case 0:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("bad varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return io.ErrUnexpectedEOF
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		case 5:
+			if len(data) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPacked appends a repeated varint field, which may be encoded
+// packed (one length-delimited run) or as individual values.
+func appendPacked[T any](dst *[]T, wire int, v uint64, b []byte, conv func(uint64) T) error {
+	if wire != 2 {
+		*dst = append(*dst, conv(v))
+		return nil
+	}
+	for len(b) > 0 {
+		x, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("bad packed varint")
+		}
+		*dst = append(*dst, conv(x))
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Annotation is a free-form note attached to a function. Annotations are
+// keyed by function name and survive SaveGraph, so notes carry over
+// across rebuilds as long as the function keeps its name.
+type Annotation struct {
+	Function  string    `json:"function"`
+	Note      string    `json:"note"`
+	Author    string    `json:"author"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Annotations returns every stored annotation keyed by function name.
+func (s *Store) Annotations() (map[string]Annotation, error) {
+	rows, err := s.db.Query(`SELECT function, note, author, updated_at FROM annotations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]Annotation)
+	for rows.Next() {
+		var a Annotation
+		if err := rows.Scan(&a.Function, &a.Note, &a.Author, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out[a.Function] = a
+	}
+	return out, rows.Err()
+}
+
+// Annotation returns the annotation for one function, or ErrNotFound.
+func (s *Store) Annotation(function string) (Annotation, error) {
+	a := Annotation{Function: function}
+	err := s.db.QueryRow(
+		`SELECT note, author, updated_at FROM annotations WHERE function = ?`, function,
+	).Scan(&a.Note, &a.Author, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+// SetAnnotation creates or replaces the annotation for function.
+func (s *Store) SetAnnotation(function, note, author string) (Annotation, error) {
+	a := Annotation{Function: function, Note: note, Author: author, UpdatedAt: time.Now().UTC()}
+	_, err := s.db.Exec(
+		`INSERT INTO annotations(function, note, author, updated_at) VALUES(?,?,?,?)
+		 ON CONFLICT(function) DO UPDATE SET note = excluded.note,
+		   author = excluded.author, updated_at = excluded.updated_at`,
+		a.Function, a.Note, a.Author, a.UpdatedAt,
+	)
+	if err != nil {
+		return a, fmt.Errorf("set annotation %s: %w", function, err)
+	}
+	return a, nil
+}
+
+// DeleteAnnotation removes the annotation for function, if any.
+func (s *Store) DeleteAnnotation(function string) error {
+	if _, err := s.db.Exec(`DELETE FROM annotations WHERE function = ?`, function); err != nil {
+		return fmt.Errorf("delete annotation %s: %w", function, err)
+	}
+	return nil
+}
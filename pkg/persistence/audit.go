@@ -0,0 +1,93 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Where audited changes come from, for AuditEntry.Source.
+const (
+	AuditAPI      = "api"      // a request to the server
+	AuditCLI      = "cli"      // a geeparse command
+	AuditSchedule = "schedule" // serve's scheduled rebuilds
+	AuditWebhook  = "webhook"  // rebuilds on GitHub pushes
+	AuditSignal   = "signal"   // signals sent to serve, such as SIGHUP
+)
+
+// AuditEntry records one change made to the store: who made it, through
+// what, and what it was.
+type AuditEntry struct {
+	ID      int64     `json:"id"`
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+	Source  string    `json:"source"`
+	Action  string    `json:"action"`
+	Summary string    `json:"summary,omitempty"`
+}
+
+// AuditQuery narrows AuditLog; zero values match everything.
+type AuditQuery struct {
+	Actor  string
+	Action string
+	Source string
+	Since  time.Time
+	// Limit caps the entries returned, newest first; 0 means all.
+	Limit int
+}
+
+// RecordAudit appends e to the audit log, stamping it with the current
+// time unless it has one.
+func (s *Store) RecordAudit(e AuditEntry) error {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if _, err := s.db.Exec(
+		`INSERT INTO audit(at, actor, source, action, summary) VALUES(?,?,?,?,?)`,
+		e.At, e.Actor, e.Source, e.Action, e.Summary,
+	); err != nil {
+		return fmt.Errorf("record %s in audit log: %w", e.Action, err)
+	}
+	return nil
+}
+
+// AuditLog returns the audit entries q selects, newest first.
+func (s *Store) AuditLog(q AuditQuery) ([]AuditEntry, error) {
+	var where []string
+	var args []any
+	for _, f := range []struct{ column, value string }{
+		{"actor", q.Actor}, {"action", q.Action}, {"source", q.Source},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "at >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	query := `SELECT id, at, actor, source, action, summary FROM audit`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Source, &e.Action, &e.Summary); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// SaveBuildReport stores r as the report of the build that produced the
+// current graph, replacing the previous one.
+func (s *Store) SaveBuildReport(r callgraph.BuildReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode build report: %w", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO build_report(id, updated_at, data) VALUES(1, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		time.Now().UTC(), data,
+	)
+	if err != nil {
+		return fmt.Errorf("save build report: %w", err)
+	}
+	return nil
+}
+
+// BuildReport returns the report of the last build saved, or ErrNotFound
+// if no build was, as when every graph came from ingests.
+func (s *Store) BuildReport() (*callgraph.BuildReport, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM build_report WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r callgraph.BuildReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("decode build report: %w", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,120 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+)
+
+// Review statuses of a CallAnnotation; empty means not reviewed.
+const (
+	// ReviewPending is a call waiting on a decision, such as a shortcut
+	// to revisit.
+	ReviewPending = "pending"
+	// ReviewApproved is a call reviewed and accepted as it is.
+	ReviewApproved = "approved"
+	// ReviewRejected is a call that should go, such as a temporary hack
+	// to remove after a migration.
+	ReviewRejected = "rejected"
+)
+
+// ReviewStatuses lists the review statuses.
+var ReviewStatuses = []string{ReviewPending, ReviewApproved, ReviewRejected}
+
+// ValidReviewStatus reports whether status is "" or one of
+// ReviewStatuses.
+func ValidReviewStatus(status string) bool {
+	return status == "" || status == ReviewPending || status == ReviewApproved || status == ReviewRejected
+}
+
+// CallAnnotation is a note attached to one call, with a review status.
+// Like function annotations they survive SaveGraph, and outlive the call
+// itself, so a diff can say which annotated calls went away.
+type CallAnnotation struct {
+	Caller    string    `json:"caller"`
+	Callee    string    `json:"callee"`
+	Note      string    `json:"note"`
+	Author    string    `json:"author"`
+	Status    string    `json:"status,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CallAnnotations returns every stored call annotation, by caller and
+// then callee.
+func (s *Store) CallAnnotations() ([]CallAnnotation, error) {
+	rows, err := s.db.Query(
+		`SELECT caller, callee, note, author, status, updated_at FROM call_annotations ORDER BY caller, callee`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []CallAnnotation{}
+	for rows.Next() {
+		var a CallAnnotation
+		if err := rows.Scan(&a.Caller, &a.Callee, &a.Note, &a.Author, &a.Status, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// CallAnnotation returns the annotation of caller's call of callee, or
+// ErrNotFound.
+func (s *Store) CallAnnotation(caller, callee string) (CallAnnotation, error) {
+	a := CallAnnotation{Caller: caller, Callee: callee}
+	err := s.db.QueryRow(
+		`SELECT note, author, status, updated_at FROM call_annotations WHERE caller = ? AND callee = ?`, caller, callee,
+	).Scan(&a.Note, &a.Author, &a.Status, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+// SetCallAnnotation creates or replaces the annotation of caller's call
+// of callee.
+func (s *Store) SetCallAnnotation(caller, callee, note, author, status string) (CallAnnotation, error) {
+	if !ValidReviewStatus(status) {
+		return CallAnnotation{}, fmt.Errorf("unknown review status %q", status)
+	}
+	a := CallAnnotation{Caller: caller, Callee: callee, Note: note, Author: author, Status: status, UpdatedAt: time.Now().UTC()}
+	_, err := s.db.Exec(
+		`INSERT INTO call_annotations(caller, callee, note, author, status, updated_at) VALUES(?,?,?,?,?,?)
+		 ON CONFLICT(caller, callee) DO UPDATE SET note = excluded.note, author = excluded.author,
+		   status = excluded.status, updated_at = excluded.updated_at`,
+		a.Caller, a.Callee, a.Note, a.Author, a.Status, a.UpdatedAt,
+	)
+	if err != nil {
+		return a, fmt.Errorf("set annotation of %s → %s: %w", caller, callee, err)
+	}
+	return a, nil
+}
+
+// DeleteCallAnnotation removes the annotation of caller's call of callee,
+// if any.
+func (s *Store) DeleteCallAnnotation(caller, callee string) error {
+	if _, err := s.db.Exec(`DELETE FROM call_annotations WHERE caller = ? AND callee = ?`, caller, callee); err != nil {
+		return fmt.Errorf("delete annotation of %s → %s: %w", caller, callee, err)
+	}
+	return nil
+}
+
+// EdgeNotes returns the call annotations as notes for diff.Result's
+// AttachNotes.
+func (s *Store) EdgeNotes() ([]diff.EdgeNote, error) {
+	anns, err := s.CallAnnotations()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]diff.EdgeNote, len(anns))
+	for i, a := range anns {
+		out[i] = diff.EdgeNote{Edge: diff.Edge{Caller: a.Caller, Callee: a.Callee}, Note: a.Note, Author: a.Author, Status: a.Status}
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/churn"
+)
+
+// Churn returns the stored churn keyed by function name. Like coverage it
+// survives SaveGraph.
+func (s *Store) Churn() (map[string]churn.Churn, error) {
+	rows, err := s.db.Query(`SELECT function, commits, authors, last_changed FROM churn`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]churn.Churn)
+	for rows.Next() {
+		var name string
+		var c churn.Churn
+		var last sql.NullTime
+		if err := rows.Scan(&name, &c.Commits, &c.Authors, &last); err != nil {
+			return nil, err
+		}
+		c.LastChanged = last.Time
+		out[name] = c
+	}
+	return out, rows.Err()
+}
+
+// ReplaceChurn discards any stored churn and saves churn instead.
+func (s *Store) ReplaceChurn(churn map[string]churn.Churn) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM churn`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO churn(function, commits, authors, last_changed, updated_at) VALUES(?,?,?,?,?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC()
+	for name, c := range churn {
+		last := sql.NullTime{Time: c.LastChanged, Valid: !c.LastChanged.IsZero()}
+		if _, err := insert.Exec(name, c.Commits, c.Authors, last, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert churn %s: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/coverage"
+)
+
+// Coverage is the test coverage last imported for a function. Like
+// annotations it is keyed by function name and survives SaveGraph.
+type Coverage struct {
+	Function string `json:"function"`
+	coverage.Stats
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Coverage returns the stored coverage keyed by function name.
+func (s *Store) Coverage() (map[string]Coverage, error) {
+	rows, err := s.db.Query(`SELECT function, covered, statements, updated_at FROM coverage`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]Coverage)
+	for rows.Next() {
+		var c Coverage
+		if err := rows.Scan(&c.Function, &c.Covered, &c.Statements, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out[c.Function] = c
+	}
+	return out, rows.Err()
+}
+
+// ReplaceCoverage discards any stored coverage and saves stats instead.
+func (s *Store) ReplaceCoverage(stats map[string]coverage.Stats) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM coverage`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO coverage(function, covered, statements, updated_at) VALUES(?,?,?,?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC()
+	for name, st := range stats {
+		if _, err := insert.Exec(name, st.Covered, st.Statements, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert coverage %s: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/semantic"
+)
+
+// Embeddings returns the stored function embeddings keyed by function
+// name. Like annotations they survive SaveGraph; semantic.Update skips
+// functions whose text hasn't changed.
+func (s *Store) Embeddings() (map[string]semantic.Embedding, error) {
+	rows, err := s.db.Query(`SELECT function, model, hash, vector FROM embeddings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]semantic.Embedding)
+	for rows.Next() {
+		var e semantic.Embedding
+		var blob []byte
+		if err := rows.Scan(&e.Function, &e.Model, &e.Hash, &blob); err != nil {
+			return nil, err
+		}
+		e.Vector = decodeVector(blob)
+		out[e.Function] = e
+	}
+	return out, rows.Err()
+}
+
+// SaveEmbeddings stores embeddings, replacing any earlier ones for the
+// same functions, and drops those of functions keep rejects, such as
+// functions no longer in the graph.
+func (s *Store) SaveEmbeddings(embeddings []semantic.Embedding, keep func(function string) bool) error {
+	have, err := s.Embeddings()
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for name := range have {
+		if !keep(name) {
+			if _, err := tx.Exec(`DELETE FROM embeddings WHERE function = ?`, name); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	upsert, err := tx.Prepare(`INSERT INTO embeddings(function, model, hash, vector, updated_at) VALUES(?,?,?,?,?)
+		ON CONFLICT(function) DO UPDATE SET model = excluded.model, hash = excluded.hash,
+		  vector = excluded.vector, updated_at = excluded.updated_at`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer upsert.Close()
+
+	now := time.Now().UTC()
+	for _, e := range embeddings {
+		if _, err := upsert.Exec(e.Function, e.Model, e.Hash, encodeVector(e.Vector), now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save embedding %s: %w", e.Function, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// encodeVector packs a vector as little-endian float32s.
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
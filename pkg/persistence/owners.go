@@ -0,0 +1,56 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/ownership"
+)
+
+// Owners returns the stored function owners keyed by function name. Like
+// annotations they survive SaveGraph.
+func (s *Store) Owners() (map[string]ownership.Owner, error) {
+	rows, err := s.db.Query(`SELECT function, owner, source FROM owners`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]ownership.Owner)
+	for rows.Next() {
+		var name string
+		var o ownership.Owner
+		if err := rows.Scan(&name, &o.Owner, &o.Source); err != nil {
+			return nil, err
+		}
+		out[name] = o
+	}
+	return out, rows.Err()
+}
+
+// ReplaceOwners discards any stored owners and saves owners instead.
+func (s *Store) ReplaceOwners(owners map[string]ownership.Owner) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM owners`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO owners(function, owner, source, updated_at) VALUES(?,?,?,?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC()
+	for name, o := range owners {
+		if _, err := insert.Exec(name, o.Owner, o.Source, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert owner %s: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -1,49 +1,268 @@
 package persistence
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	// CGO sqlite3 driver; embeds SQLite in your binary.
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Store provides methods to persist and load call-graphs from an embedded SQLite DB.
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	ctx    context.Context // parent of the spans traced for whole-graph operations
+	logger *slog.Logger
 }
 
-// NewStore opens (or creates) the SQLite file at dbPath,
-// ensures the schema is in place, and returns a Store.
-func NewStore(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("open sqlite db: %w", err)
+// SetContext makes the spans of later whole-graph reads and writes
+// children of the span in ctx.
+func (s *Store) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// span starts a span for a store operation.
+func (s *Store) span(name string, attrs ...attribute.KeyValue) trace.Span {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	_, span := telemetry.Start(ctx, name, attrs...)
+	return span
+}
 
-	schema := `
+// schema creates every table of a store that doesn't exist yet.
+const schema = `
 	PRAGMA foreign_keys = ON;
 	CREATE TABLE IF NOT EXISTS functions (
 	  name TEXT PRIMARY KEY,
 	  signature TEXT NOT NULL,
-	  definition TEXT NOT NULL
+	  definition TEXT NOT NULL,
+	  package TEXT NOT NULL DEFAULT '',
+	  file TEXT NOT NULL DEFAULT '',
+	  line INTEGER NOT NULL DEFAULT 0,
+	  end_line INTEGER NOT NULL DEFAULT 0,
+	  generated TEXT NOT NULL DEFAULT '',
+	  body_hash TEXT NOT NULL DEFAULT '',
+	  language TEXT NOT NULL DEFAULT '',
+	  foreign_calls TEXT NOT NULL DEFAULT '',
+	  statements INTEGER NOT NULL DEFAULT 0,
+	  nesting INTEGER NOT NULL DEFAULT 0
 	);
 	CREATE TABLE IF NOT EXISTS calls (
 	  caller TEXT NOT NULL,
 	  callee TEXT NOT NULL,
+	  via TEXT NOT NULL DEFAULT '',
+	  kind TEXT NOT NULL DEFAULT '',
+	  args TEXT NOT NULL DEFAULT '',
 	  PRIMARY KEY (caller, callee),
 	  FOREIGN KEY (caller) REFERENCES functions(name) ON DELETE CASCADE,
 	  FOREIGN KEY (callee) REFERENCES functions(name) ON DELETE CASCADE
 	);
-	`
+	CREATE TABLE IF NOT EXISTS annotations (
+	  function TEXT PRIMARY KEY,
+	  note TEXT NOT NULL,
+	  author TEXT NOT NULL DEFAULT '',
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS call_annotations (
+	  caller TEXT NOT NULL,
+	  callee TEXT NOT NULL,
+	  note TEXT NOT NULL,
+	  author TEXT NOT NULL DEFAULT '',
+	  status TEXT NOT NULL DEFAULT '',
+	  updated_at TIMESTAMP NOT NULL,
+	  PRIMARY KEY (caller, callee)
+	);
+	CREATE TABLE IF NOT EXISTS tags (
+	  function TEXT NOT NULL,
+	  callee TEXT NOT NULL DEFAULT '',
+	  tag TEXT NOT NULL,
+	  source TEXT NOT NULL DEFAULT '',
+	  updated_at TIMESTAMP NOT NULL,
+	  PRIMARY KEY (function, callee, tag)
+	);
+	CREATE TABLE IF NOT EXISTS coverage (
+	  function TEXT PRIMARY KEY,
+	  covered INTEGER NOT NULL,
+	  statements INTEGER NOT NULL,
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS churn (
+	  function TEXT PRIMARY KEY,
+	  commits INTEGER NOT NULL,
+	  authors INTEGER NOT NULL,
+	  last_changed TIMESTAMP,
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS owners (
+	  function TEXT PRIMARY KEY,
+	  owner TEXT NOT NULL,
+	  source TEXT NOT NULL,
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS embeddings (
+	  function TEXT PRIMARY KEY,
+	  model TEXT NOT NULL,
+	  hash TEXT NOT NULL,
+	  vector BLOB NOT NULL,
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS profile (
+	  id INTEGER PRIMARY KEY CHECK (id = 1),
+	  updated_at TIMESTAMP NOT NULL,
+	  data BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS build_report (
+	  id INTEGER PRIMARY KEY CHECK (id = 1),
+	  updated_at TIMESTAMP NOT NULL,
+	  data BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS traces (
+	  id INTEGER PRIMARY KEY CHECK (id = 1),
+	  updated_at TIMESTAMP NOT NULL,
+	  data BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS positions (
+	  snapshot INTEGER NOT NULL DEFAULT 0,
+	  user_name TEXT NOT NULL DEFAULT '',
+	  node TEXT NOT NULL,
+	  x REAL NOT NULL,
+	  y REAL NOT NULL,
+	  updated_at TIMESTAMP NOT NULL,
+	  PRIMARY KEY (snapshot, user_name, node)
+	);
+	CREATE TABLE IF NOT EXISTS views (
+	  name TEXT PRIMARY KEY,
+	  description TEXT NOT NULL DEFAULT '',
+	  filter TEXT NOT NULL DEFAULT '',
+	  layout TEXT NOT NULL DEFAULT '',
+	  roots TEXT NOT NULL DEFAULT '',
+	  author TEXT NOT NULL DEFAULT '',
+	  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS snapshots (
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  label TEXT NOT NULL,
+	  created_at TIMESTAMP NOT NULL,
+	  nodes INTEGER NOT NULL,
+	  edges INTEGER NOT NULL,
+	  repo TEXT NOT NULL DEFAULT '',
+	  ref TEXT NOT NULL DEFAULT '',
+	  revision TEXT NOT NULL DEFAULT '',
+	  geeparse_version TEXT NOT NULL DEFAULT '',
+	  graph BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS audit (
+	  id INTEGER PRIMARY KEY AUTOINCREMENT,
+	  at TIMESTAMP NOT NULL,
+	  actor TEXT NOT NULL,
+	  source TEXT NOT NULL,
+	  action TEXT NOT NULL,
+	  summary TEXT NOT NULL DEFAULT ''
+	);
+`
+
+// NewStore opens (or creates) the SQLite file at dbPath,
+// ensures the schema is in place, and returns a Store. Schema migrations
+// and graph writes are logged to logger; nil means slog.Default().
+func NewStore(dbPath string, logger *slog.Logger) (*Store, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite db: %w", err)
+	}
+
 	if _, err := db.Exec(schema); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("init schema: %w", err)
 	}
+	if err := migrate(db, logger.With("db", dbPath)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate schema: %w", err)
+	}
+
+	return &Store{db: db, logger: logger}, nil
+}
 
-	return &Store{db: db}, nil
+// columnMigrations lists columns added after a table was first released.
+// CREATE TABLE IF NOT EXISTS leaves older DB files untouched, so each of
+// these is added on open when missing.
+var columnMigrations = []struct {
+	table, column, decl string
+}{
+	{"functions", "package", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "file", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "line", "INTEGER NOT NULL DEFAULT 0"},
+	{"functions", "end_line", "INTEGER NOT NULL DEFAULT 0"},
+	{"functions", "generated", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "body_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "language", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "foreign_calls", "TEXT NOT NULL DEFAULT ''"},
+	{"functions", "statements", "INTEGER NOT NULL DEFAULT 0"},
+	{"functions", "nesting", "INTEGER NOT NULL DEFAULT 0"},
+	{"calls", "via", "TEXT NOT NULL DEFAULT ''"},
+	{"calls", "kind", "TEXT NOT NULL DEFAULT ''"},
+	{"calls", "args", "TEXT NOT NULL DEFAULT ''"},
+	{"snapshots", "repo", "TEXT NOT NULL DEFAULT ''"},
+	{"snapshots", "ref", "TEXT NOT NULL DEFAULT ''"},
+	{"snapshots", "revision", "TEXT NOT NULL DEFAULT ''"},
+	{"snapshots", "geeparse_version", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// migrate brings an existing DB file up to the current schema.
+func migrate(db *sql.DB, logger *slog.Logger) error {
+	for _, m := range columnMigrations {
+		ok, err := hasColumn(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.decl)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", m.table, m.column, err)
+		}
+		logger.Info("migrated store schema", "table", m.table, "column", m.column)
+	}
+	return nil
+}
+
+// hasColumn reports whether table already has the named column.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 // Close closes the underlying database connection.
@@ -52,13 +271,24 @@ func (s *Store) Close() error {
 }
 
 // SaveGraph writes the entire call-graph into the DB,
-// wiping any previous contents.
-func (s *Store) SaveGraph(graph map[string]callgraph.FunctionNode) error {
+// wiping any previous contents. Annotations and tags of functions it
+// finds renamed follow them to their new names; see carryRenames.
+func (s *Store) SaveGraph(graph map[string]callgraph.FunctionNode) (err error) {
+	span := s.span("store.SaveGraph", attribute.Int("functions", len(graph)))
+	defer func() { telemetry.End(span, err) }()
+	start := time.Now()
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 
+	old, err := bodyHashes(tx, "")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// clear existing data
 	if _, err := tx.Exec(`DELETE FROM calls`); err != nil {
 		tx.Rollback()
@@ -68,30 +298,108 @@ func (s *Store) SaveGraph(graph map[string]callgraph.FunctionNode) error {
 		tx.Rollback()
 		return err
 	}
+	if err := insertGraph(tx, graph); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := linkLanguages(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	renamed, err := carryRenames(tx, old, graph)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.logger.Debug("saved graph", "functions", len(graph), "calls", callgraph.EdgeCount(graph), "renamed", renamed, "duration", time.Since(start))
+	return nil
+}
+
+// MergeGraph merges graph into the stored one with callgraph.Merge and
+// strategy, the stored graph first, saves the result as SaveGraph does
+// and returns it.
+func (s *Store) MergeGraph(graph map[string]callgraph.FunctionNode, strategy string) (map[string]callgraph.FunctionNode, error) {
+	stored, err := s.LoadGraph()
+	if err != nil {
+		return nil, err
+	}
+	merged, err := callgraph.Merge(stored, graph, strategy)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SaveGraph(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// bodyHashes reads the body hash of every stored function whose name
+// starts with prefix.
+func bodyHashes(tx *sql.Tx, prefix string) (map[string]string, error) {
+	rows, err := tx.Query(`SELECT name, body_hash FROM functions WHERE substr(name, 1, ?) = ?`, len([]rune(prefix)), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var name, hash string
+		if err := rows.Scan(&name, &hash); err != nil {
+			return nil, err
+		}
+		out[name] = hash
+	}
+	return out, rows.Err()
+}
 
-	// prepare statements
+// carryRenames moves the annotations, call notes and tags of the functions
+// renamed between the stored body hashes old and graph (see
+// callgraph.Renames) to their new names, so notes survive a rename, and
+// returns how many functions were renamed. Notes already on the new name win.
+func carryRenames(tx *sql.Tx, old map[string]string, graph map[string]callgraph.FunctionNode) (int, error) {
+	renames := callgraph.Renames(old, callgraph.BodyHashes(graph))
+	for from, to := range renames {
+		for _, stmt := range []string{
+			`UPDATE OR IGNORE annotations SET function = ? WHERE function = ?`,
+			`UPDATE OR IGNORE tags SET function = ? WHERE function = ?`,
+			`UPDATE OR IGNORE tags SET callee = ? WHERE callee = ?`,
+			`UPDATE OR IGNORE call_annotations SET caller = ? WHERE caller = ?`,
+			`UPDATE OR IGNORE call_annotations SET callee = ? WHERE callee = ?`,
+		} {
+			if _, err := tx.Exec(stmt, to, from); err != nil {
+				return 0, fmt.Errorf("rename %s to %s: %w", from, to, err)
+			}
+		}
+	}
+	return len(renames), nil
+}
+
+// insertGraph adds graph's functions and calls in tx.
+func insertGraph(tx *sql.Tx, graph map[string]callgraph.FunctionNode) error {
 	insertFn, err := tx.Prepare(
-		`INSERT INTO functions(name, signature, definition) VALUES(?,?,?)`,
+		`INSERT INTO functions(name, signature, definition, package, file, line, end_line, generated, body_hash, language, foreign_calls, statements, nesting) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 	)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer insertFn.Close()
 
 	insertCall, err := tx.Prepare(
-		`INSERT OR IGNORE INTO calls(caller, callee) VALUES(?,?)`,
+		`INSERT OR IGNORE INTO calls(caller, callee, via, kind, args) VALUES(?,?,?,?,?)`,
 	)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer insertCall.Close()
 
 	// 1) insert all function nodes
 	for name, node := range graph {
-		if _, err := insertFn.Exec(name, node.Signature, node.Definition); err != nil {
-			tx.Rollback()
+		if _, err := insertFn.Exec(name, node.Signature, node.Definition, node.Package, node.File, node.Line, node.EndLine, node.Generated, callgraph.BodyHash(name, node),
+			node.Language, strings.Join(node.Foreign, "\n"), node.Statements, node.Nesting); err != nil {
 			return fmt.Errorf("insert function %s: %w", name, err)
 		}
 	}
@@ -99,21 +407,150 @@ func (s *Store) SaveGraph(graph map[string]callgraph.FunctionNode) error {
 	// 2) insert all call edges
 	for caller, node := range graph {
 		for _, callee := range node.Callees {
-			if _, err := insertCall.Exec(caller, callee); err != nil {
-				tx.Rollback()
+			var args []byte
+			if sites, ok := node.Args[callee]; ok {
+				if args, err = json.Marshal(sites); err != nil {
+					return fmt.Errorf("encode arguments of %s→%s: %w", caller, callee, err)
+				}
+			}
+			if _, err := insertCall.Exec(caller, callee, node.Via[callee], node.Kinds[callee], string(args)); err != nil {
 				return fmt.Errorf("insert call %s→%s: %w", caller, callee, err)
 			}
 		}
 	}
+	return nil
+}
+
+// linkLanguages stores the calls between languages callgraph.LinkLanguages
+// can link in the whole stored graph, so they are walked like any other.
+// Run after every write, it links the new functions' calls out as well as
+// older ones' calls into them, such as a Go graph's cgo calls once the C
+// graph is ingested.
+func linkLanguages(tx *sql.Tx) error {
+	var foreign bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM functions WHERE foreign_calls != '')`).Scan(&foreign); err != nil || !foreign {
+		return err
+	}
+	rows, err := tx.Query(`SELECT name, language, foreign_calls FROM functions WHERE language != '' OR foreign_calls != ''`)
+	if err != nil {
+		return err
+	}
+	graph := make(map[string]callgraph.FunctionNode)
+	for rows.Next() {
+		var name, calls string
+		node := callgraph.FunctionNode{}
+		if err := rows.Scan(&name, &node.Language, &calls); err != nil {
+			rows.Close()
+			return err
+		}
+		if calls != "" {
+			node.Foreign = strings.Split(calls, "\n")
+		}
+		graph[name] = node
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	callgraph.LinkLanguages(graph)
+	for caller, node := range graph {
+		for _, callee := range node.Callees {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO calls(caller, callee, via, kind) VALUES(?,?,?,'')`,
+				caller, callee, callgraph.ViaForeign); err != nil {
+				return fmt.Errorf("link call %s→%s: %w", caller, callee, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ReplaceNamespace swaps the functions named namespace/... for graph,
+// whose names must all carry that prefix, leaving the rest of the stored
+// graph alone. It's how graphs from other languages and tools join one
+// built from Go source.
+func (s *Store) ReplaceNamespace(namespace string, graph map[string]callgraph.FunctionNode) (err error) {
+	span := s.span("store.ReplaceNamespace", attribute.String("namespace", namespace), attribute.Int("functions", len(graph)))
+	defer func() { telemetry.End(span, err) }()
 
+	prefix := namespace + "/"
+	for name := range graph {
+		if !strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("function %s is outside namespace %s", name, namespace)
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	old, err := bodyHashes(tx, prefix)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n := len([]rune(prefix))
+	if _, err := tx.Exec(`DELETE FROM calls WHERE substr(caller, 1, ?) = ?`, n, prefix); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM functions WHERE substr(name, 1, ?) = ?`, n, prefix); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertGraph(tx, graph); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// calls into the namespace from outside stay if their callee still exists
+	if _, err := tx.Exec(`DELETE FROM calls WHERE callee NOT IN (SELECT name FROM functions)`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := linkLanguages(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := carryRenames(tx, old, graph); err != nil {
+		tx.Rollback()
+		return err
+	}
 	return tx.Commit()
 }
 
 // LoadGraph reads back the call-graph from the DB into the same
 // map[string]FunctionNode form.
 func (s *Store) LoadGraph() (map[string]callgraph.FunctionNode, error) {
-	// load all functions
-	rows, err := s.db.Query(`SELECT name, signature, definition FROM functions`)
+	return s.loadGraph(
+		`SELECT `+functionColumns+` FROM functions`,
+		`SELECT caller, callee, via, kind, args FROM calls`,
+	)
+}
+
+// functionColumns is the column list scanFunction expects, in order.
+const functionColumns = `name, signature, definition, package, file, line, end_line, generated, language, foreign_calls, statements, nesting`
+
+// scanFunction reads one row selected with functionColumns.
+func scanFunction(row interface{ Scan(...any) error }) (string, callgraph.FunctionNode, error) {
+	var name string
+	node := callgraph.FunctionNode{Callees: []string{}}
+	var foreign string
+	err := row.Scan(&name, &node.Signature, &node.Definition, &node.Package, &node.File, &node.Line, &node.EndLine, &node.Generated,
+		&node.Language, &foreign, &node.Statements, &node.Nesting)
+	if foreign != "" {
+		node.Foreign = strings.Split(foreign, "\n")
+	}
+	return name, node, err
+}
+
+// loadGraph builds a graph from a query selecting functionColumns and a
+// query selecting (caller, callee, via, kind, args) rows; both get the
+// same query args.
+// Edges whose caller wasn't selected are dropped.
+func (s *Store) loadGraph(fnQuery, edgeQuery string, args ...any) (_ map[string]callgraph.FunctionNode, err error) {
+	span := s.span("store.LoadGraph")
+	defer func() { telemetry.End(span, err) }()
+
+	// load functions
+	rows, err := s.db.Query(fnQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -121,34 +558,52 @@ func (s *Store) LoadGraph() (map[string]callgraph.FunctionNode, error) {
 
 	graph := make(map[string]callgraph.FunctionNode)
 	for rows.Next() {
-		var name, sig, def string
-		if err := rows.Scan(&name, &sig, &def); err != nil {
+		name, node, err := scanFunction(rows)
+		if err != nil {
 			return nil, err
 		}
-		graph[name] = callgraph.FunctionNode{
-			Signature:  sig,
-			Definition: def,
-			Callees:    []string{},
-		}
+		graph[name] = node
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	// load edges
-	edgeRows, err := s.db.Query(`SELECT caller, callee FROM calls`)
+	edgeRows, err := s.db.Query(edgeQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer edgeRows.Close()
 
 	for edgeRows.Next() {
-		var caller, callee string
-		if err := edgeRows.Scan(&caller, &callee); err != nil {
+		var caller, callee, via, kind, args string
+		if err := edgeRows.Scan(&caller, &callee, &via, &kind, &args); err != nil {
 			return nil, err
 		}
 		if node, ok := graph[caller]; ok {
 			node.Callees = append(node.Callees, callee)
+			if via != "" {
+				if node.Via == nil {
+					node.Via = make(map[string]string)
+				}
+				node.Via[callee] = via
+			}
+			if kind != "" {
+				if node.Kinds == nil {
+					node.Kinds = make(map[string]string)
+				}
+				node.Kinds[callee] = kind
+			}
+			if args != "" {
+				var sites [][]callgraph.Arg
+				if err := json.Unmarshal([]byte(args), &sites); err != nil {
+					return nil, fmt.Errorf("arguments of %s→%s: %w", caller, callee, err)
+				}
+				if node.Args == nil {
+					node.Args = make(map[string][][]callgraph.Arg)
+				}
+				node.Args[callee] = sites
+			}
 			graph[caller] = node
 		}
 	}
@@ -0,0 +1,76 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Position is where someone dragged a node of the UI's layout to. Nodes
+// are the layout's own ids: function names, or "pkg:" and a package for
+// a collapsed package.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Positions returns the node positions user saved for the graph of
+// snapshot, 0 meaning the current graph, keyed by node. Users are free
+// text, like annotation authors; "" is everyone who didn't give a name.
+func (s *Store) Positions(snapshot int64, user string) (map[string]Position, error) {
+	rows, err := s.db.Query(`SELECT node, x, y FROM positions WHERE snapshot = ? AND user_name = ?`, snapshot, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]Position)
+	for rows.Next() {
+		var node string
+		var p Position
+		if err := rows.Scan(&node, &p.X, &p.Y); err != nil {
+			return nil, err
+		}
+		out[node] = p
+	}
+	return out, rows.Err()
+}
+
+// SavePositions stores positions for user's layout of snapshot, replacing
+// those of the same nodes and keeping the rest. Like annotations they
+// survive SaveGraph; positions of nodes gone from the graph are ignored
+// by the UI.
+func (s *Store) SavePositions(snapshot int64, user string, positions map[string]Position) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	upsert, err := tx.Prepare(
+		`INSERT INTO positions(snapshot, user_name, node, x, y, updated_at) VALUES(?,?,?,?,?,?)
+		 ON CONFLICT(snapshot, user_name, node) DO UPDATE SET x = excluded.x, y = excluded.y,
+		   updated_at = excluded.updated_at`,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer upsert.Close()
+
+	now := time.Now().UTC()
+	for node, p := range positions {
+		if _, err := upsert.Exec(snapshot, user, node, p.X, p.Y, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save position of %s: %w", node, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ResetPositions deletes user's positions for snapshot, returning the
+// layout to automatic, and reports how many there were.
+func (s *Store) ResetPositions(snapshot int64, user string) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM positions WHERE snapshot = ? AND user_name = ?`, snapshot, user)
+	if err != nil {
+		return 0, fmt.Errorf("reset positions: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/perf"
+)
+
+// SaveProfile stores p as the runtime profile overlaid on the graph,
+// replacing the previous one. Like annotations it survives SaveGraph.
+func (s *Store) SaveProfile(p *perf.Profile) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encode profile: %w", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO profile(id, updated_at, data) VALUES(1, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		time.Now().UTC(), data,
+	)
+	if err != nil {
+		return fmt.Errorf("save profile: %w", err)
+	}
+	return nil
+}
+
+// Profile returns the stored runtime profile, or ErrNotFound if none was
+// imported.
+func (s *Store) Profile() (*perf.Profile, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM profile WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p perf.Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode profile: %w", err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,117 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Function returns one stored function, or ErrNotFound.
+func (s *Store) Function(name string) (callgraph.FunctionNode, error) {
+	_, node, err := scanFunction(s.db.QueryRow(
+		`SELECT `+functionColumns+` FROM functions WHERE name = ?`, name,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return node, ErrNotFound
+	}
+	if err != nil {
+		return node, err
+	}
+	node.Callees, err = s.Callees(name)
+	return node, err
+}
+
+// Callers returns, sorted, the functions that call name directly.
+func (s *Store) Callers(name string) ([]string, error) {
+	return s.names(`SELECT caller FROM calls WHERE callee = ? ORDER BY caller`, name)
+}
+
+// Callees returns, sorted, the functions name calls directly.
+func (s *Store) Callees(name string) ([]string, error) {
+	return s.names(`SELECT callee FROM calls WHERE caller = ? ORDER BY callee`, name)
+}
+
+// FunctionNames returns, sorted, up to limit stored function names
+// starting with prefix; limit <= 0 means all of them.
+func (s *Store) FunctionNames(prefix string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	return s.names(`SELECT name FROM functions WHERE substr(name, 1, ?) = ? ORDER BY name LIMIT ?`,
+		len([]rune(prefix)), prefix, limit)
+}
+
+// Reachable returns, sorted, every function reachable from root by
+// following calls, root included. maxDepth > 0 limits the number of hops.
+func (s *Store) Reachable(root string, maxDepth int) ([]string, error) {
+	if err := s.exists(root); err != nil {
+		return nil, err
+	}
+	cte, args := reachCTE(root, maxDepth)
+	return s.names(cte+`SELECT name FROM reach ORDER BY name`, args...)
+}
+
+// Subgraph returns the part of the graph reachable from root (see
+// Reachable), with only the edges between those functions.
+func (s *Store) Subgraph(root string, maxDepth int) (map[string]callgraph.FunctionNode, error) {
+	if err := s.exists(root); err != nil {
+		return nil, err
+	}
+	cte, args := reachCTE(root, maxDepth)
+	return s.loadGraph(
+		cte+`SELECT `+functionColumns+` FROM functions WHERE name IN (SELECT name FROM reach)`,
+		cte+`SELECT caller, callee, via, kind, args FROM calls
+		     WHERE caller IN (SELECT name FROM reach) AND callee IN (SELECT name FROM reach)`,
+		args...,
+	)
+}
+
+// reachCTE returns a WITH clause defining a "reach" table of the function
+// names reachable from root, plus its query arguments. Bounded walks carry a
+// depth column; unbounded ones don't, so UNION's de-duplication ends cycles.
+func reachCTE(root string, maxDepth int) (string, []any) {
+	if maxDepth <= 0 {
+		return `WITH RECURSIVE reach(name) AS (
+		  SELECT ?
+		  UNION
+		  SELECT c.callee FROM calls c JOIN reach r ON c.caller = r.name
+		) `, []any{root}
+	}
+	return `WITH RECURSIVE walk(name, depth) AS (
+	  SELECT ?, 0
+	  UNION
+	  SELECT c.callee, w.depth + 1 FROM calls c JOIN walk w ON c.caller = w.name
+	  WHERE w.depth < ?
+	), reach(name) AS (SELECT DISTINCT name FROM walk) `, []any{root, maxDepth}
+}
+
+// exists returns ErrNotFound unless a function called name is stored.
+func (s *Store) exists(name string) error {
+	var one int
+	err := s.db.QueryRow(`SELECT 1 FROM functions WHERE name = ?`, name).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("function %s: %w", name, ErrNotFound)
+	}
+	return err
+}
+
+// names runs a query selecting a single text column.
+func (s *Store) names(query string, args ...any) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,183 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Snapshot describes one saved copy of a call-graph. The graph itself is
+// stored alongside as JSON and only loaded on demand.
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"createdAt"`
+	Nodes     int       `json:"nodes"`
+	Edges     int       `json:"edges"`
+	// Version is the geeparse version that built the snapshot; empty for
+	// snapshots older than the column.
+	Version string `json:"geeparseVersion,omitempty"`
+	Source
+}
+
+// Source records which revision of which repository a snapshot was built
+// from. All fields are empty for builds of a local directory.
+type Source struct {
+	Repo   string `json:"repo,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// snapshotColumns is the column list scanSnapshot expects, in order.
+const snapshotColumns = `id, label, created_at, nodes, edges, geeparse_version, repo, ref, revision`
+
+// scanSnapshot reads one row selected with snapshotColumns.
+func scanSnapshot(row interface{ Scan(...any) error }) (Snapshot, error) {
+	var snap Snapshot
+	err := row.Scan(&snap.ID, &snap.Label, &snap.CreatedAt, &snap.Nodes, &snap.Edges, &snap.Version,
+		&snap.Repo, &snap.Ref, &snap.Commit)
+	return snap, err
+}
+
+// SaveSnapshot stores a copy of graph under label, noting where it was
+// built from and by which geeparse version, and returns its metadata.
+func (s *Store) SaveSnapshot(label string, graph map[string]callgraph.FunctionNode, src Source) (_ Snapshot, err error) {
+	span := s.span("store.SaveSnapshot", attribute.String("label", label))
+	defer func() { telemetry.End(span, err) }()
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("encode snapshot: %w", err)
+	}
+	snap := Snapshot{
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+		Nodes:     len(graph),
+		Edges:     callgraph.EdgeCount(graph),
+		Version:   buildinfo.Version(),
+		Source:    src,
+	}
+	res, err := s.db.Exec(
+		`INSERT INTO snapshots(label, created_at, nodes, edges, geeparse_version, repo, ref, revision, graph) VALUES(?,?,?,?,?,?,?,?,?)`,
+		snap.Label, snap.CreatedAt, snap.Nodes, snap.Edges, snap.Version, src.Repo, src.Ref, src.Commit, data,
+	)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("insert snapshot %s: %w", label, err)
+	}
+	snap.ID, err = res.LastInsertId()
+	if err == nil {
+		s.logger.Debug("saved snapshot", "id", snap.ID, "label", label, "bytes", len(data))
+	}
+	return snap, err
+}
+
+// Snapshots lists all snapshots, newest first.
+func (s *Store) Snapshots() ([]Snapshot, error) {
+	rows, err := s.db.Query(
+		`SELECT ` + snapshotColumns + ` FROM snapshots ORDER BY id DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snaps := []Snapshot{}
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, rows.Err()
+}
+
+// Info summarizes a store, for telling which geeparse versions wrote it.
+type Info struct {
+	Snapshots int `json:"snapshots"`
+	// BuiltBy is the geeparse version that built the newest snapshot.
+	BuiltBy string `json:"builtBy,omitempty"`
+}
+
+// Info returns the store's summary.
+func (s *Store) Info() (Info, error) {
+	var info Info
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM snapshots`).Scan(&info.Snapshots); err != nil {
+		return info, err
+	}
+	err := s.db.QueryRow(`SELECT geeparse_version FROM snapshots ORDER BY id DESC LIMIT 1`).Scan(&info.BuiltBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return info, err
+}
+
+// LoadSnapshot returns the graph saved in the snapshot with the given id,
+// or ErrNotFound.
+func (s *Store) LoadSnapshot(id int64) (map[string]callgraph.FunctionNode, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT graph FROM snapshots WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var graph map[string]callgraph.FunctionNode
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return nil, fmt.Errorf("decode snapshot %d: %w", id, err)
+	}
+	return graph, nil
+}
+
+// DeleteSnapshot removes the snapshot with the given id, and the layout
+// positions saved for it, or returns ErrNotFound.
+func (s *Store) DeleteSnapshot(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM snapshots WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete snapshot %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := s.db.Exec(`DELETE FROM positions WHERE snapshot = ?`, id); err != nil {
+		return fmt.Errorf("delete positions of snapshot %d: %w", id, err)
+	}
+	return nil
+}
+
+// Compact rebuilds the DB file to reclaim space left by deleted snapshots.
+func (s *Store) Compact() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
+
+// FindSnapshot resolves ref to a snapshot: "#12" or "12" selects by ID,
+// anything else by label (the newest snapshot wins when labels repeat).
+func (s *Store) FindSnapshot(ref string) (Snapshot, error) {
+	var row *sql.Row
+	if id, err := strconv.ParseInt(strings.TrimPrefix(ref, "#"), 10, 64); err == nil {
+		row = s.db.QueryRow(
+			`SELECT `+snapshotColumns+` FROM snapshots WHERE id = ?`, id)
+	} else {
+		row = s.db.QueryRow(
+			`SELECT `+snapshotColumns+` FROM snapshots
+			 WHERE label = ? ORDER BY id DESC LIMIT 1`, ref)
+	}
+	snap, err := scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return snap, fmt.Errorf("snapshot %s: %w", ref, ErrNotFound)
+	}
+	return snap, err
+}
@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tag is a short label on a function, or on one of its calls when Callee
+// is set. Unlike annotations, which hold one free-form note per function
+// for people to read, tags are many per function and meant for tools:
+// enrichers such as coverage, profile or ownership imports write them
+// under their own Source, and the query language selects on them with
+// tag(). Like annotations they are keyed by name and survive SaveGraph.
+type Tag struct {
+	Function  string    `json:"function"`
+	Callee    string    `json:"callee,omitempty"`
+	Tag       string    `json:"tag"`
+	Source    string    `json:"source,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Tags returns every stored tag, ordered by function, callee and tag.
+func (s *Store) Tags() ([]Tag, error) {
+	return s.queryTags(`SELECT function, callee, tag, source, updated_at FROM tags
+		ORDER BY function, callee, tag`)
+}
+
+// TagsOf returns the tags on function and on the calls it makes.
+func (s *Store) TagsOf(function string) ([]Tag, error) {
+	return s.queryTags(`SELECT function, callee, tag, source, updated_at FROM tags
+		WHERE function = ? ORDER BY callee, tag`, function)
+}
+
+func (s *Store) queryTags(query string, args ...any) ([]Tag, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Function, &t.Callee, &t.Tag, &t.Source, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// FunctionTags returns the tags on functions, not calls, keyed by function
+// name: the lookup the query language's tag() needs.
+func (s *Store) FunctionTags() (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT function, tag FROM tags WHERE callee = '' ORDER BY function, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]string)
+	for rows.Next() {
+		var name, tag string
+		if err := rows.Scan(&name, &tag); err != nil {
+			return nil, err
+		}
+		out[name] = append(out[name], tag)
+	}
+	return out, rows.Err()
+}
+
+// SetTag adds tag to function, or to its call of callee when callee isn't
+// empty. Setting a tag that is already there updates its source.
+func (s *Store) SetTag(function, callee, tag, source string) (Tag, error) {
+	t := Tag{Function: function, Callee: callee, Tag: tag, Source: source, UpdatedAt: time.Now().UTC()}
+	_, err := s.db.Exec(
+		`INSERT INTO tags(function, callee, tag, source, updated_at) VALUES(?,?,?,?,?)
+		 ON CONFLICT(function, callee, tag) DO UPDATE SET source = excluded.source,
+		   updated_at = excluded.updated_at`,
+		t.Function, t.Callee, t.Tag, t.Source, t.UpdatedAt,
+	)
+	if err != nil {
+		return t, fmt.Errorf("set tag %s on %s: %w", tag, function, err)
+	}
+	return t, nil
+}
+
+// DeleteTag removes tag from function, or from its call of callee, if
+// there.
+func (s *Store) DeleteTag(function, callee, tag string) error {
+	_, err := s.db.Exec(`DELETE FROM tags WHERE function = ? AND callee = ? AND tag = ?`, function, callee, tag)
+	if err != nil {
+		return fmt.Errorf("delete tag %s on %s: %w", tag, function, err)
+	}
+	return nil
+}
+
+// ReplaceTags discards the tags written by source and saves tags under it
+// instead, so an enricher can rerun without leaving stale tags behind or
+// touching anyone else's.
+func (s *Store) ReplaceTags(source string, tags []Tag) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tags WHERE source = ?`, source); err != nil {
+		tx.Rollback()
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO tags(function, callee, tag, source, updated_at) VALUES(?,?,?,?,?)
+		ON CONFLICT(function, callee, tag) DO UPDATE SET source = excluded.source,
+		  updated_at = excluded.updated_at`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC()
+	for _, t := range tags {
+		if _, err := insert.Exec(t.Function, t.Callee, t.Tag, source, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert tag %s on %s: %w", t.Tag, t.Function, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/traces"
+)
+
+// SaveTraces stores o as the trace overlay shown on the graph, replacing
+// the previous one. Like the profile it survives SaveGraph.
+func (s *Store) SaveTraces(o *traces.Overlay) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("encode traces: %w", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO traces(id, updated_at, data) VALUES(1, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		time.Now().UTC(), data,
+	)
+	if err != nil {
+		return fmt.Errorf("save traces: %w", err)
+	}
+	return nil
+}
+
+// Traces returns the stored trace overlay, or ErrNotFound if no traces
+// were imported.
+func (s *Store) Traces() (*traces.Overlay, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM traces WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var o traces.Overlay
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("decode traces: %w", err)
+	}
+	return &o, nil
+}
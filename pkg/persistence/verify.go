@@ -0,0 +1,496 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Checks Verify makes, as Issue.Check names them.
+const (
+	// CheckIntegrity is SQLite's own check of the file; Verify can't
+	// repair what it finds.
+	CheckIntegrity = "integrity"
+	// CheckSchema is a table whose columns differ from what this version
+	// creates, say after a downgrade or hand edits; fixed by rebuilding
+	// the table, which keeps the columns both have.
+	CheckSchema = "schema-drift"
+	// CheckDanglingCall is a call from a function that isn't stored;
+	// fixed by deleting the call.
+	CheckDanglingCall = "dangling-call"
+	// CheckOrphanCallee is a call to a function that isn't stored; fixed
+	// by deleting the call.
+	CheckOrphanCallee = "orphan-callee"
+	// CheckDuplicate is a declaration stored under several names, found
+	// by file and line; fixed by merging the names into the one with the
+	// most calls, moving calls, annotations and tags along.
+	CheckDuplicate = "duplicate-function"
+	// CheckBodyHash is a function whose stored body hash isn't the one
+	// its definition has, so renames would be missed; fixed by
+	// recomputing it.
+	CheckBodyHash = "stale-body-hash"
+	// CheckCallKind is a call of an unknown kind; fixed by clearing it,
+	// leaving the call to count as direct.
+	CheckCallKind = "unknown-call-kind"
+)
+
+// Issue is one inconsistency Verify found in the store.
+type Issue struct {
+	Check   string `json:"check"`
+	Detail  string `json:"detail"`
+	Fixable bool   `json:"fixable"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// Verify checks the store for what the graph model can't represent and
+// tools reading it would trip over: a damaged file, schema drift, calls
+// from or to missing functions, duplicate functions, stale body hashes
+// and unknown call kinds. With fix, it repairs what it can, each fixable
+// issue coming back Fixed; other issues are left for a person to look
+// at.
+func (s *Store) Verify(fix bool) (_ []Issue, err error) {
+	span := s.span("store.Verify", attribute.Bool("fix", fix))
+	defer func() { telemetry.End(span, err) }()
+
+	var issues []Issue
+	rows, err := s.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if msg != "ok" {
+			issues = append(issues, Issue{Check: CheckIntegrity, Detail: msg})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(issues) > 0 {
+		// nothing else can be trusted in a damaged file
+		return issues, nil
+	}
+
+	drift, err := s.schemaDrift()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range drift {
+		issue := Issue{Check: CheckSchema, Detail: d.table + ": " + strings.Join(d.diffs, "; "), Fixable: true}
+		if fix {
+			if err := s.rebuildTable(d.table, d.expected); err != nil {
+				return nil, fmt.Errorf("rebuild %s: %w", d.table, err)
+			}
+			issue.Fixed = true
+		}
+		issues = append(issues, issue)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, check := range []func(*sql.Tx, bool) ([]Issue, error){danglingCalls, duplicateFunctions, staleBodyHashes, unknownCallKinds} {
+		found, err := check(tx, fix)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	if fix {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
+
+// tableDrift is how a table differs from the one schema creates.
+type tableDrift struct {
+	table    string
+	expected string // the CREATE TABLE statement of the expected table
+	diffs    []string
+}
+
+// schemaDrift compares the store's tables, column by column, with the
+// ones schema creates in a scratch database.
+func (s *Store) schemaDrift() ([]tableDrift, error) {
+	mem, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+	mem.SetMaxOpenConns(1) // every connection would get its own database
+	if _, err := mem.Exec(schema); err != nil {
+		return nil, err
+	}
+	rows, err := mem.Query(`SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[string]string)
+	var tables []string
+	for rows.Next() {
+		var name, stmt string
+		if err := rows.Scan(&name, &stmt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expected[name] = stmt
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	var out []tableDrift
+	for _, table := range tables {
+		want, err := tableColumns(mem, table)
+		if err != nil {
+			return nil, err
+		}
+		got, err := tableColumns(s.db, table)
+		if err != nil {
+			return nil, err
+		}
+		var diffs []string
+		for name, decl := range want {
+			switch have, ok := got[name]; {
+			case !ok:
+				diffs = append(diffs, "missing column "+name)
+			case have != decl:
+				diffs = append(diffs, fmt.Sprintf("column %s is %s, want %s", name, have, decl))
+			}
+		}
+		for name := range got {
+			if _, ok := want[name]; !ok {
+				diffs = append(diffs, "unknown column "+name)
+			}
+		}
+		if len(diffs) > 0 {
+			sort.Strings(diffs)
+			out = append(out, tableDrift{table: table, expected: expected[table], diffs: diffs})
+		}
+	}
+	return out, nil
+}
+
+// tableColumns describes each column of table by type, constraints and
+// default, for comparing.
+func tableColumns(db *sql.DB, table string) (map[string]string, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		decl := strings.ToUpper(typ)
+		if notNull != 0 {
+			decl += " NOT NULL"
+		}
+		if dflt.Valid {
+			decl += " DEFAULT " + dflt.String
+		}
+		if pk != 0 {
+			decl += " PRIMARY KEY"
+		}
+		out[name] = decl
+	}
+	return out, rows.Err()
+}
+
+// rebuildTable recreates table from its expected CREATE TABLE statement,
+// copying over the columns the old and new tables share, as SQLite's
+// documented way of changing a table goes.
+func (s *Store) rebuildTable(table, create string) error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// foreign keys can only be switched off outside a transaction, and
+	// must be for the old table to be dropped
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tmp := table + "_verify"
+	stmt, ok := strings.CutPrefix(create, "CREATE TABLE "+table)
+	if !ok {
+		return fmt.Errorf("unexpected table definition %q", create)
+	}
+	if _, err := tx.Exec(`CREATE TABLE ` + tmp + stmt); err != nil {
+		return err
+	}
+	var shared []string
+	rows, err := tx.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s') WHERE name IN (SELECT name FROM pragma_table_info('%s'))`, tmp, table))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		shared = append(shared, name)
+	}
+	rows.Close()
+	cols := strings.Join(shared, ", ")
+	for _, stmt := range []string{
+		// REPLACE fills NULLs in columns now NOT NULL with their default
+		fmt.Sprintf(`INSERT OR REPLACE INTO %s(%s) SELECT %s FROM %s`, tmp, cols, cols, table),
+		`DROP TABLE ` + table,
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, tmp, table),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// danglingCalls finds calls from and to functions that aren't stored.
+func danglingCalls(tx *sql.Tx, fix bool) ([]Issue, error) {
+	var issues []Issue
+	for _, c := range []struct{ check, column, detail string }{
+		{CheckDanglingCall, "caller", "caller %s isn't stored"},
+		{CheckOrphanCallee, "callee", "callee %s isn't stored"},
+	} {
+		rows, err := tx.Query(fmt.Sprintf(
+			`SELECT caller, callee, %[1]s FROM calls WHERE %[1]s NOT IN (SELECT name FROM functions) ORDER BY caller, callee`, c.column))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var caller, callee, missing string
+			if err := rows.Scan(&caller, &callee, &missing); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			issues = append(issues, Issue{
+				Check:   c.check,
+				Detail:  fmt.Sprintf("%s → %s: "+c.detail, caller, callee, missing),
+				Fixable: true,
+				Fixed:   fix,
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if fix {
+			if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM calls WHERE %s NOT IN (SELECT name FROM functions)`, c.column)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return issues, nil
+}
+
+// duplicateFunctions finds declarations, by file and line, stored under
+// more than one name.
+func duplicateFunctions(tx *sql.Tx, fix bool) ([]Issue, error) {
+	rows, err := tx.Query(`
+		SELECT f.file, f.line, f.name,
+		       (SELECT count(*) FROM calls WHERE caller = f.name OR callee = f.name)
+		  FROM functions f
+		 WHERE f.file != '' AND f.line > 0 AND (f.file, f.line) IN (
+		       SELECT file, line FROM functions WHERE file != '' AND line > 0
+		        GROUP BY file, line HAVING count(*) > 1)
+		 ORDER BY f.file, f.line`)
+	if err != nil {
+		return nil, err
+	}
+	type fn struct {
+		name  string
+		calls int
+	}
+	groups := make(map[string][]fn)
+	var order []string
+	for rows.Next() {
+		var (
+			file, name string
+			line, n    int
+		)
+		if err := rows.Scan(&file, &line, &name, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		at := fmt.Sprintf("%s:%d", file, line)
+		if groups[at] == nil {
+			order = append(order, at)
+		}
+		groups[at] = append(groups[at], fn{name, n})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, at := range order {
+		fns := groups[at]
+		// keep the name with the most calls, then the shortest
+		sort.Slice(fns, func(i, j int) bool {
+			if fns[i].calls != fns[j].calls {
+				return fns[i].calls > fns[j].calls
+			}
+			if len(fns[i].name) != len(fns[j].name) {
+				return len(fns[i].name) < len(fns[j].name)
+			}
+			return fns[i].name < fns[j].name
+		})
+		var names []string
+		for _, f := range fns {
+			names = append(names, f.name)
+		}
+		issues = append(issues, Issue{
+			Check:   CheckDuplicate,
+			Detail:  fmt.Sprintf("%s is stored as %s", at, strings.Join(names, ", ")),
+			Fixable: true,
+			Fixed:   fix,
+		})
+		if !fix {
+			continue
+		}
+		keep := names[0]
+		for _, dup := range names[1:] {
+			if err := mergeFunction(tx, dup, keep, names); err != nil {
+				return nil, fmt.Errorf("merge %s into %s: %w", dup, keep, err)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// mergeFunction folds the function from into into: its calls, other than
+// those within group, the names of one declaration, become into's, as do
+// its annotation and tags where into has none, and from is deleted.
+func mergeFunction(tx *sql.Tx, from, into string, group []string) error {
+	quoted := make([]string, len(group))
+	for i, name := range group {
+		quoted[i] = "'" + strings.ReplaceAll(name, "'", "''") + "'"
+	}
+	in := strings.Join(quoted, ", ")
+	for _, stmt := range []string{
+		`DELETE FROM calls WHERE caller = ?1 AND callee IN (` + in + `)`,
+		`DELETE FROM calls WHERE callee = ?1 AND caller IN (` + in + `)`,
+		`UPDATE OR IGNORE calls SET caller = ?2 WHERE caller = ?1`,
+		`UPDATE OR IGNORE calls SET callee = ?2 WHERE callee = ?1`,
+		`DELETE FROM calls WHERE caller = ?1 OR callee = ?1`,
+		`UPDATE OR IGNORE annotations SET function = ?2 WHERE function = ?1`,
+		`UPDATE OR IGNORE tags SET function = ?2 WHERE function = ?1`,
+		`UPDATE OR IGNORE tags SET callee = ?2 WHERE callee = ?1`,
+		`DELETE FROM functions WHERE name = ?1`,
+	} {
+		if _, err := tx.Exec(stmt, from, into); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleBodyHashes finds functions whose stored body hash isn't
+// callgraph.BodyHash of their definition, as in stores written before
+// hashes were, and with fix recomputes them.
+func staleBodyHashes(tx *sql.Tx, fix bool) ([]Issue, error) {
+	rows, err := tx.Query(`SELECT name, definition, body_hash FROM functions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	stale := make(map[string]string)
+	var names []string
+	for rows.Next() {
+		var name, def, hash string
+		if err := rows.Scan(&name, &def, &hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if want := callgraph.BodyHash(name, callgraph.FunctionNode{Definition: def}); want != hash {
+			stale[name] = want
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var issues []Issue
+	for _, name := range names {
+		issues = append(issues, Issue{Check: CheckBodyHash, Detail: name, Fixable: true, Fixed: fix})
+		if fix {
+			if _, err := tx.Exec(`UPDATE functions SET body_hash = ? WHERE name = ?`, stale[name], name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return issues, nil
+}
+
+// unknownCallKinds finds calls of a kind not in callgraph.CallKinds.
+func unknownCallKinds(tx *sql.Tx, fix bool) ([]Issue, error) {
+	rows, err := tx.Query(`SELECT caller, callee, kind FROM calls WHERE kind != '' ORDER BY caller, callee`)
+	if err != nil {
+		return nil, err
+	}
+	var issues []Issue
+	type call struct{ caller, callee string }
+	var bad []call
+	for rows.Next() {
+		var caller, callee, kind string
+		if err := rows.Scan(&caller, &callee, &kind); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if slices.Contains(callgraph.CallKinds, kind) {
+			continue
+		}
+		issues = append(issues, Issue{
+			Check:   CheckCallKind,
+			Detail:  fmt.Sprintf("%s → %s: %q", caller, callee, kind),
+			Fixable: true,
+			Fixed:   fix,
+		})
+		bad = append(bad, call{caller, callee})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if fix {
+		for _, c := range bad {
+			if _, err := tx.Exec(`UPDATE calls SET kind = '' WHERE caller = ? AND callee = ?`, c.caller, c.callee); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return issues, nil
+}
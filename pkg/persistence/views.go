@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// View is a named way of looking at the graph, saved for the whole team:
+// the UI's filter, a substring or a query-language expression, its layout
+// and the functions the graph is rooted at. Like annotations views
+// survive SaveGraph; roots gone from the graph are ignored.
+type View struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Filter      string    `json:"filter,omitempty"`
+	Layout      string    `json:"layout,omitempty"`
+	Roots       []string  `json:"roots,omitempty"`
+	Author      string    `json:"author"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Views returns every saved view, by name.
+func (s *Store) Views() ([]View, error) {
+	rows, err := s.db.Query(`SELECT ` + viewColumns + ` FROM views ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []View{}
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// View returns the view saved as name, or ErrNotFound.
+func (s *Store) View(name string) (View, error) {
+	v, err := scanView(s.db.QueryRow(`SELECT `+viewColumns+` FROM views WHERE name = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return View{Name: name}, ErrNotFound
+	}
+	return v, err
+}
+
+// SaveView creates or replaces the view called v.Name, stamping it with
+// the time, and returns it as stored.
+func (s *Store) SaveView(v View) (View, error) {
+	if v.Name == "" {
+		return v, errors.New("save view: no name")
+	}
+	v.UpdatedAt = time.Now().UTC()
+	_, err := s.db.Exec(
+		`INSERT INTO views(name, description, filter, layout, roots, author, updated_at) VALUES(?,?,?,?,?,?,?)
+		 ON CONFLICT(name) DO UPDATE SET description = excluded.description, filter = excluded.filter,
+		   layout = excluded.layout, roots = excluded.roots, author = excluded.author, updated_at = excluded.updated_at`,
+		v.Name, v.Description, v.Filter, v.Layout, strings.Join(v.Roots, ","), v.Author, v.UpdatedAt,
+	)
+	if err != nil {
+		return v, fmt.Errorf("save view %s: %w", v.Name, err)
+	}
+	return v, nil
+}
+
+// DeleteView removes the view called name, if any.
+func (s *Store) DeleteView(name string) error {
+	if _, err := s.db.Exec(`DELETE FROM views WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete view %s: %w", name, err)
+	}
+	return nil
+}
+
+const viewColumns = `name, description, filter, layout, roots, author, updated_at`
+
+func scanView(row interface{ Scan(...any) error }) (View, error) {
+	var (
+		v     View
+		roots string
+	)
+	if err := row.Scan(&v.Name, &v.Description, &v.Filter, &v.Layout, &roots, &v.Author, &v.UpdatedAt); err != nil {
+		return v, err
+	}
+	if roots != "" {
+		v.Roots = strings.Split(roots, ",")
+	}
+	return v, nil
+}
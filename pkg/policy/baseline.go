@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Baseline is what a repository tolerates for now, committed next to
+// its code so checks fail only on new violations while old ones are
+// cleaned up, ratcheting the allowance down as they go. It is either a
+// list of accepted violations, as WriteBaseline records them, or a whole
+// graph, as export --format json writes it, all of whose calls are
+// accepted.
+type Baseline struct {
+	Violations []BaselineEntry `json:"violations"`
+
+	calls map[[2]string]bool // the calls of a graph baseline
+}
+
+// BaselineEntry is one accepted violation. Its file and line aren't
+// recorded, so edits elsewhere in a file don't invalidate it.
+type BaselineEntry struct {
+	Rule   string `json:"rule"`
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+}
+
+func (e BaselineEntry) String() string {
+	return fmt.Sprintf("%s → %s (%s)", e.Caller, e.Callee, e.Rule)
+}
+
+// NewBaseline accepts violations.
+func NewBaseline(violations []Violation) Baseline {
+	b := Baseline{Violations: []BaselineEntry{}}
+	for _, v := range violations {
+		b.Violations = append(b.Violations, entry(v))
+	}
+	sort.Slice(b.Violations, func(i, j int) bool {
+		x, y := b.Violations[i], b.Violations[j]
+		if x.Rule != y.Rule {
+			return x.Rule < y.Rule
+		}
+		if x.Caller != y.Caller {
+			return x.Caller < y.Caller
+		}
+		return x.Callee < y.Callee
+	})
+	return b
+}
+
+func entry(v Violation) BaselineEntry {
+	return BaselineEntry{Rule: v.Rule, Caller: v.Caller, Callee: v.Callee}
+}
+
+// ReadBaseline reads a baseline of either kind.
+func ReadBaseline(r io.Reader) (Baseline, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Baseline{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Baseline{}, fmt.Errorf("decode baseline: %w", err)
+	}
+	// a graph may well have a function named "violations", but not one
+	// that is a list
+	if v, ok := fields["violations"]; ok && bytes.HasPrefix(bytes.TrimSpace(v), []byte("[")) {
+		var b Baseline
+		if err := json.Unmarshal(data, &b); err != nil {
+			return Baseline{}, fmt.Errorf("decode baseline: %w", err)
+		}
+		return b, nil
+	}
+	var graph map[string]callgraph.FunctionNode
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return Baseline{}, fmt.Errorf("decode baseline graph: %w", err)
+	}
+	b := Baseline{calls: make(map[[2]string]bool)}
+	for caller, fn := range graph {
+		for _, callee := range fn.Callees {
+			b.calls[[2]string{caller, callee}] = true
+		}
+	}
+	return b, nil
+}
+
+// Write writes b as JSON for committing.
+func (b Baseline) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Apply splits violations into those b doesn't accept, the new ones a
+// check should fail on, and returns as well the accepted violations that
+// no longer occur, which can come out of the baseline. A graph baseline
+// accepts violations by call, whatever the rule, and has nothing to come
+// out.
+func (b Baseline) Apply(violations []Violation) (fresh []Violation, gone []BaselineEntry) {
+	if b.calls != nil {
+		for _, v := range violations {
+			if !b.calls[[2]string{v.Caller, v.Callee}] {
+				fresh = append(fresh, v)
+			}
+		}
+		return fresh, nil
+	}
+	accepted := make(map[BaselineEntry]bool, len(b.Violations))
+	for _, e := range b.Violations {
+		accepted[e] = true
+	}
+	seen := make(map[BaselineEntry]bool)
+	for _, v := range violations {
+		e := entry(v)
+		seen[e] = true
+		if !accepted[e] {
+			fresh = append(fresh, v)
+		}
+	}
+	for _, e := range b.Violations {
+		if !seen[e] {
+			gone = append(gone, e)
+		}
+	}
+	return fresh, gone
+}
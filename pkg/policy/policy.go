@@ -0,0 +1,110 @@
+// Package policy checks a call-graph against architecture rules such as
+// "pkg/server must not call pkg/persistence directly".
+package policy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Rule forbids functions in the From packages from calling functions in
+// the To packages. Both are package paths as stored on FunctionNode
+// ("pkg/server"), matching that package and everything below it, or
+// path.Match patterns ("pkg/*/internal").
+type Rule struct {
+	Name   string `yaml:"name" json:"name"`
+	From   string `yaml:"from" json:"from"`
+	To     string `yaml:"to" json:"to"`
+	Reason string `yaml:"reason" json:"reason,omitempty"`
+}
+
+// String names the rule, falling back to a description of it.
+func (r Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.From + " must not call " + r.To
+}
+
+// Violation is one call that breaks a rule.
+type Violation struct {
+	Rule          string `json:"rule"`
+	Reason        string `json:"reason,omitempty"`
+	Caller        string `json:"caller"`
+	CallerPackage string `json:"callerPackage"`
+	Callee        string `json:"callee"`
+	CalleePackage string `json:"calleePackage"`
+	File          string `json:"file"`
+	Line          int    `json:"line"`
+}
+
+// Validate reports the first rule that is missing a side or has a
+// malformed pattern.
+func Validate(rules []Rule) error {
+	for i, r := range rules {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("rule %d (%s): both from and to are required", i+1, r)
+		}
+		for _, p := range []string{r.From, r.To} {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("rule %d (%s): bad pattern %q: %w", i+1, r, p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns every call in graph that breaks one of rules, ordered by
+// rule, caller and callee. Calls made from inside the To packages
+// themselves never count, so "pkg must not call pkg/persistence" doesn't
+// flag persistence calling its own helpers.
+func Check(graph map[string]callgraph.FunctionNode, rules []Rule) []Violation {
+	var out []Violation
+	for _, r := range rules {
+		for caller, fn := range graph {
+			if !matches(r.From, fn.Package) || matches(r.To, fn.Package) {
+				continue
+			}
+			for _, callee := range fn.Callees {
+				target, ok := graph[callee]
+				if !ok || !matches(r.To, target.Package) {
+					continue
+				}
+				out = append(out, Violation{
+					Rule:          r.String(),
+					Reason:        r.Reason,
+					Caller:        caller,
+					CallerPackage: fn.Package,
+					Callee:        callee,
+					CalleePackage: target.Package,
+					File:          fn.File,
+					Line:          fn.Line,
+				})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+	return out
+}
+
+// matches reports whether pkg is pattern, lies below it, or matches it as
+// a glob.
+func matches(pattern, pkg string) bool {
+	if callgraph.InPackages(pkg, []string{pattern}) {
+		return true
+	}
+	ok, _ := path.Match(pattern, pkg)
+	return ok
+}
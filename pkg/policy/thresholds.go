@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Thresholds are limits on the shape of the graph. Unlike rules they
+// don't fail a check: crossing one is a warning that a function or cycle
+// is growing unwieldy. A zero limit is not checked.
+type Thresholds struct {
+	// MaxFanOut is how many distinct functions one function may call.
+	MaxFanOut int `yaml:"max_fan_out" json:"maxFanOut,omitempty"`
+	// MaxDepth is how long a call chain from an entrypoint may be,
+	// counting the entrypoint, with cycles collapsed.
+	MaxDepth int `yaml:"max_depth" json:"maxDepth,omitempty"`
+	// MaxCycleSize is how many functions one call cycle may span.
+	MaxCycleSize int `yaml:"max_cycle_size" json:"maxCycleSize,omitempty"`
+	// Entrypoints are the function name patterns MaxDepth is measured
+	// from; default analysis.DefaultRoots.
+	Entrypoints []string `yaml:"entrypoints" json:"entrypoints,omitempty"`
+}
+
+// Set reports whether any limit is configured.
+func (t Thresholds) Set() bool {
+	return t.MaxFanOut > 0 || t.MaxDepth > 0 || t.MaxCycleSize > 0
+}
+
+// Validate reports a negative limit.
+func (t Thresholds) Validate() error {
+	switch {
+	case t.MaxFanOut < 0:
+		return fmt.Errorf("thresholds: max_fan_out must not be negative")
+	case t.MaxDepth < 0:
+		return fmt.Errorf("thresholds: max_depth must not be negative")
+	case t.MaxCycleSize < 0:
+		return fmt.Errorf("thresholds: max_cycle_size must not be negative")
+	}
+	return nil
+}
+
+// Warning kinds.
+const (
+	FanOut    = "fan-out"
+	Depth     = "depth"
+	CycleSize = "cycle-size"
+)
+
+// Warning is one threshold a function crosses.
+type Warning struct {
+	Kind     string `json:"kind"`
+	Function string `json:"function"`
+	Package  string `json:"package"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Value    int    `json:"value"`
+	Limit    int    `json:"limit"`
+	// Functions are the chain for depth warnings and the members of the
+	// cycle for cycle-size ones.
+	Functions []string `json:"functions,omitempty"`
+	Message   string   `json:"message"`
+}
+
+// Warn returns every threshold graph crosses, ordered by kind, then worst
+// first. Depth and cycle-size warnings are reported once per entrypoint
+// and cycle rather than for every function on them.
+func Warn(graph map[string]callgraph.FunctionNode, t Thresholds) []Warning {
+	var out []Warning
+	warn := func(kind, name string, value, limit int, fns []string, msg string) {
+		node := graph[name]
+		out = append(out, Warning{
+			Kind: kind, Function: name, Package: node.Package, File: node.File, Line: node.Line,
+			Value: value, Limit: limit, Functions: fns, Message: msg,
+		})
+	}
+
+	if t.MaxFanOut > 0 {
+		for name, node := range graph {
+			if n := len(node.Callees); n > t.MaxFanOut {
+				warn(FanOut, name, n, t.MaxFanOut, nil,
+					fmt.Sprintf("%s calls %d functions, more than %d", name, n, t.MaxFanOut))
+			}
+		}
+	}
+	if t.MaxDepth > 0 {
+		roots := t.Entrypoints
+		if len(roots) == 0 {
+			roots = analysis.DefaultRoots
+		}
+		names := analysis.MatchRoots(graph, roots)
+		for i, chain := range analysis.DeepestChainsFrom(graph, names) {
+			if len(chain) > t.MaxDepth {
+				warn(Depth, names[i], len(chain), t.MaxDepth, chain,
+					fmt.Sprintf("call chain from %s is %d deep, more than %d: %s", names[i], len(chain), t.MaxDepth, strings.Join(chain, " → ")))
+			}
+		}
+	}
+	if t.MaxCycleSize > 0 {
+		for _, c := range analysis.Cycles(graph) {
+			if len(c) <= t.MaxCycleSize {
+				continue
+			}
+			c = append([]string(nil), c...)
+			sort.Strings(c)
+			warn(CycleSize, c[0], len(c), t.MaxCycleSize, c,
+				fmt.Sprintf("call cycle through %d functions, more than %d: %s", len(c), t.MaxCycleSize, strings.Join(c, ", ")))
+		}
+	}
+
+	kinds := map[string]int{FanOut: 0, Depth: 1, CycleSize: 2}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Kind != b.Kind {
+			return kinds[a.Kind] < kinds[b.Kind]
+		}
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Function < b.Function
+	})
+	return out
+}
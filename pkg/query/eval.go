@@ -0,0 +1,407 @@
+package query
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Eval returns the functions of graph the query selects, sorted. tag()
+// selects nothing; use EvalTagged to supply tags.
+func (q *Query) Eval(graph map[string]callgraph.FunctionNode) ([]string, error) {
+	return q.EvalTagged(graph, nil)
+}
+
+// EvalTagged is Eval with the functions' tags, keyed by function name, for
+// tag() to match.
+func (q *Query) EvalTagged(graph map[string]callgraph.FunctionNode, tags map[string][]string) ([]string, error) {
+	s, err := q.root.eval(&env{graph: graph, tags: tags})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Run parses src and evaluates it against graph.
+func Run(graph map[string]callgraph.FunctionNode, src string) ([]string, error) {
+	return RunTagged(graph, nil, src)
+}
+
+// RunTagged parses src and evaluates it against graph and tags.
+func RunTagged(graph map[string]callgraph.FunctionNode, tags map[string][]string, src string) ([]string, error) {
+	q, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return q.EvalTagged(graph, tags)
+}
+
+type set map[string]bool
+
+// env is the graph a query runs against and its functions' tags, with the
+// caller index built on first use.
+type env struct {
+	graph   map[string]callgraph.FunctionNode
+	tags    map[string][]string
+	callers map[string][]string
+}
+
+func (e *env) where(keep func(name string, node callgraph.FunctionNode) bool) set {
+	s := make(set)
+	for name, node := range e.graph {
+		if keep(name, node) {
+			s[name] = true
+		}
+	}
+	return s
+}
+
+func (e *env) callersOf(name string) []string {
+	if e.callers == nil {
+		e.callers = make(map[string][]string)
+		for caller, node := range e.graph {
+			for _, c := range node.Callees {
+				e.callers[c] = append(e.callers[c], caller)
+			}
+		}
+	}
+	return e.callers[name]
+}
+
+// walk collects what next leads to from start within depth steps (0 =
+// unlimited), not counting start itself unless a path returns to it.
+func (e *env) walk(start set, depth int, next func(string) []string) set {
+	out := make(set)
+	frontier := make([]string, 0, len(start))
+	for name := range start {
+		frontier = append(frontier, name)
+	}
+	for step := 1; len(frontier) > 0 && (depth == 0 || step <= depth); step++ {
+		var more []string
+		for _, name := range frontier {
+			for _, n := range next(name) {
+				if _, ok := e.graph[n]; ok && !out[n] {
+					out[n] = true
+					more = append(more, n)
+				}
+			}
+		}
+		frontier = more
+	}
+	return out
+}
+
+type expr interface {
+	eval(e *env) (set, error)
+}
+
+type binary struct {
+	op   string
+	x, y expr
+}
+
+func (b binary) eval(e *env) (set, error) {
+	x, err := b.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	y, err := b.y.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	out := make(set)
+	switch b.op {
+	case "&":
+		for n := range x {
+			if y[n] {
+				out[n] = true
+			}
+		}
+	case "|":
+		for n := range x {
+			out[n] = true
+		}
+		for n := range y {
+			out[n] = true
+		}
+	case "-":
+		for n := range x {
+			if !y[n] {
+				out[n] = true
+			}
+		}
+	}
+	return out, nil
+}
+
+type complement struct{ x expr }
+
+func (c complement) eval(e *env) (set, error) {
+	x, err := c.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return e.where(func(name string, _ callgraph.FunctionNode) bool { return !x[name] }), nil
+}
+
+// function is a function named outright, or every function matching a
+// pattern.
+type function struct {
+	name string
+	pos  int
+}
+
+func (f function) eval(e *env) (set, error) {
+	if strings.ContainsAny(f.name, "*?") {
+		if _, err := path.Match(f.name, ""); err != nil {
+			return nil, &Error{f.pos, fmt.Sprintf("bad pattern %q", f.name)}
+		}
+		return e.where(func(name string, _ callgraph.FunctionNode) bool {
+			ok, _ := path.Match(f.name, name)
+			return ok
+		}), nil
+	}
+	if _, ok := e.graph[f.name]; !ok {
+		return nil, &Error{f.pos, fmt.Sprintf("unknown function %q", f.name)}
+	}
+	return set{f.name: true}, nil
+}
+
+type call struct {
+	name string
+	pos  int
+	b    builtin
+	args []any // set expressions, strings and ints as the builtin's params say
+}
+
+func (c call) eval(e *env) (set, error) {
+	args := make([]any, len(c.args))
+	for i, a := range c.args {
+		if x, ok := a.(expr); ok {
+			s, err := x.eval(e)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = s
+		} else {
+			args[i] = a
+		}
+	}
+	s, err := c.b.eval(e, args)
+	if err != nil {
+		return nil, &Error{c.pos, err.Error()}
+	}
+	return s, nil
+}
+
+type kind int
+
+const (
+	kindSet kind = iota
+	kindString
+	kindInt
+)
+
+// builtin is a function of the language. Arguments are checked against
+// params when parsing; those past required may be left out.
+type builtin struct {
+	params   []kind
+	required int
+	usage    string
+	eval     func(e *env, args []any) (set, error)
+}
+
+var builtins map[string]builtin
+
+func init() {
+	depthArg := func(args []any) int {
+		if len(args) > 1 {
+			return args[1].(int)
+		}
+		return 1
+	}
+	// kindsArg returns whether to follow a call, by the kinds argument
+	kindsArg := func(args []any) (func(node callgraph.FunctionNode, callee string) bool, error) {
+		if len(args) < 3 {
+			return func(callgraph.FunctionNode, string) bool { return true }, nil
+		}
+		kinds, err := callgraph.ParseKinds(args[2].(string))
+		if err != nil {
+			return nil, err
+		}
+		return func(node callgraph.FunctionNode, callee string) bool {
+			return slices.Contains(kinds, node.Kind(callee))
+		}, nil
+	}
+	builtins = map[string]builtin{
+		"all": {usage: "all()", eval: func(e *env, _ []any) (set, error) {
+			return e.where(func(string, callgraph.FunctionNode) bool { return true }), nil
+		}},
+		"name": {params: []kind{kindString}, required: 1, usage: `name("pattern")`, eval: func(e *env, args []any) (set, error) {
+			pattern := args[0].(string)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("bad pattern %q", pattern)
+			}
+			return e.where(func(name string, _ callgraph.FunctionNode) bool {
+				ok, _ := path.Match(pattern, name)
+				return ok
+			}), nil
+		}},
+		"pkg": {params: []kind{kindString}, required: 1, usage: `pkg("path")`, eval: func(e *env, args []any) (set, error) {
+			p := strings.Trim(args[0].(string), "/")
+			return e.where(func(_ string, node callgraph.FunctionNode) bool {
+				return callgraph.InPackages(node.Package, []string{p}) ||
+					strings.HasSuffix(node.Package, "/"+p) || strings.Contains(node.Package, "/"+p+"/")
+			}), nil
+		}},
+		"file": {params: []kind{kindString}, required: 1, usage: `file("text or pattern")`, eval: func(e *env, args []any) (set, error) {
+			f := args[0].(string)
+			glob := strings.ContainsAny(f, "*?[")
+			return e.where(func(_ string, node callgraph.FunctionNode) bool {
+				if glob {
+					ok, _ := path.Match(f, filepath.Base(node.File))
+					return ok
+				}
+				return strings.Contains(filepath.ToSlash(node.File), f)
+			}), nil
+		}},
+		"lang": {params: []kind{kindString}, required: 1, usage: `lang("go")`, eval: func(e *env, args []any) (set, error) {
+			lang := args[0].(string)
+			return e.where(func(_ string, node callgraph.FunctionNode) bool {
+				return strings.EqualFold(node.Language, lang)
+			}), nil
+		}},
+		"tag": {params: []kind{kindString}, required: 1, usage: `tag("name")`, eval: func(e *env, args []any) (set, error) {
+			pattern := args[0].(string)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("bad pattern %q", pattern)
+			}
+			return e.where(func(name string, _ callgraph.FunctionNode) bool {
+				for _, t := range e.tags[name] {
+					if ok, _ := path.Match(pattern, t); ok {
+						return true
+					}
+				}
+				return false
+			}), nil
+		}},
+		"callers": {params: []kind{kindSet, kindInt, kindString}, required: 1, usage: `callers(set, depth, "kinds")`, eval: func(e *env, args []any) (set, error) {
+			keep, err := kindsArg(args)
+			if err != nil {
+				return nil, err
+			}
+			return e.walk(args[0].(set), depthArg(args), func(name string) []string {
+				var out []string
+				for _, caller := range e.callersOf(name) {
+					if keep(e.graph[caller], name) {
+						out = append(out, caller)
+					}
+				}
+				return out
+			}), nil
+		}},
+		"callees": {params: []kind{kindSet, kindInt, kindString}, required: 1, usage: `callees(set, depth, "kinds")`, eval: func(e *env, args []any) (set, error) {
+			keep, err := kindsArg(args)
+			if err != nil {
+				return nil, err
+			}
+			return e.walk(args[0].(set), depthArg(args), func(name string) []string {
+				node := e.graph[name]
+				var out []string
+				for _, c := range node.Callees {
+					if keep(node, c) {
+						out = append(out, c)
+					}
+				}
+				return out
+			}), nil
+		}},
+		"passes": {params: []kind{kindSet, kindString, kindString}, required: 2, usage: `passes(set, "param type", "argument type")`, eval: func(e *env, args []any) (set, error) {
+			patterns := []string{args[1].(string), "*"}
+			if len(args) > 2 {
+				patterns[1] = args[2].(string)
+			}
+			for _, p := range patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("bad pattern %q", p)
+				}
+			}
+			match := func(p, t string) bool {
+				ok, _ := path.Match(p, t)
+				return ok || p == t
+			}
+			targets := args[0].(set)
+			return e.where(func(_ string, node callgraph.FunctionNode) bool {
+				for callee, sites := range node.Args {
+					if !targets[callee] {
+						continue
+					}
+					for _, site := range sites {
+						for _, a := range site {
+							if match(patterns[0], a.Param) && match(patterns[1], a.Type) {
+								return true
+							}
+						}
+					}
+				}
+				return false
+			}), nil
+		}},
+		"tests": {usage: "tests()", eval: func(e *env, _ []any) (set, error) {
+			return e.where(func(name string, node callgraph.FunctionNode) bool {
+				return strings.HasSuffix(node.File, "_test.go") || isTestName(name)
+			}), nil
+		}},
+		"roots": {usage: "roots()", eval: func(e *env, _ []any) (set, error) {
+			return e.where(func(name string, _ callgraph.FunctionNode) bool { return len(e.callersOf(name)) == 0 }), nil
+		}},
+		"leaves": {usage: "leaves()", eval: func(e *env, _ []any) (set, error) {
+			return e.where(func(_ string, node callgraph.FunctionNode) bool {
+				for _, c := range node.Callees {
+					if _, ok := e.graph[c]; ok {
+						return false
+					}
+				}
+				return true
+			}), nil
+		}},
+		"cycles": {usage: "cycles()", eval: func(e *env, _ []any) (set, error) {
+			s := make(set)
+			for _, c := range analysis.Cycles(e.graph) {
+				for _, name := range c {
+					s[name] = true
+				}
+			}
+			return s, nil
+		}},
+		"dead": {usage: "dead()", eval: func(e *env, _ []any) (set, error) {
+			s := make(set)
+			for _, loc := range analysis.DeadCode(e.graph, analysis.DefaultRoots) {
+				s[loc.Name] = true
+			}
+			return s, nil
+		}},
+	}
+}
+
+func isTestName(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && (rest == "" || !isLower(rest[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLower(b byte) bool { return 'a' <= b && b <= 'z' }
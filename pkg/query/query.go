@@ -0,0 +1,311 @@
+// Package query implements a small language for selecting functions from
+// a call-graph, e.g.
+//
+//	callers(SaveGraph) & pkg("persistence") - tests()
+//
+// An expression denotes a set of functions. A bare name is that function;
+// a name containing * or ? is every function it matches (path.Match
+// syntax). Sets combine with & (intersection), | (union) and - (difference),
+// ! complements a set, and parentheses group; ! binds tightest, then &,
+// then | and - from left to right.
+//
+// Functions:
+//
+//	all()                   every function
+//	name("Save*")           functions whose name matches the pattern
+//	pkg("persistence")      functions in a package with that path, below it,
+//	                        or whose path ends in that element
+//	file("server")          functions in files whose path contains the text,
+//	                        or whose base name matches it if it has * or ?
+//	lang("c")               functions in that source language
+//	tag("hot-path")         functions carrying a matching tag, when the
+//	                        graph's tags are supplied (EvalTagged)
+//	callers(set, depth, kinds)
+//	                        functions calling into set within depth calls
+//	callees(set, depth, kinds)
+//	                        functions set calls within depth calls; depth is
+//	                        optional, defaulting to 1, and 0 means unlimited;
+//	                        kinds, as in "go,defer", follows only calls of
+//	                        those kinds (see callgraph.CallKinds)
+//	passes(set, param, arg) functions calling into set with an argument
+//	                        for a parameter whose type matches param and
+//	                        of a type matching arg, which is optional; as
+//	                        in passes(all(), "context.Context", nil), the
+//	                        callers passing a nil context. The graph needs
+//	                        the argument types of callgraph.Options.ArgTypes
+//	tests()                 functions in _test.go files and Test, Benchmark,
+//	                        Fuzz and Example functions
+//	roots()                 functions nothing calls
+//	leaves()                functions that call nothing
+//	cycles()                functions on a call cycle
+//	dead()                  functions main, init and TestMain can't reach
+//
+// String arguments may be quoted or bare names. Names may contain slashes,
+// as functions from a multi-root build do ("api/SaveGraph"); * doesn't
+// match across them.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Error is a problem with a query, at a 1-based column of its text.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("query: column %d: %s", e.Pos, e.Msg) }
+
+// Query is a parsed expression, ready to evaluate against any graph.
+type Query struct {
+	src  string
+	root expr
+}
+
+// String returns the query's source text.
+func (q *Query) String() string { return q.src }
+
+// Parse parses src, checking that every built-in function it calls exists
+// and gets the arguments it takes. Bare function names are only looked up
+// by Eval, in the graph at hand.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.union()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{t.pos, fmt.Sprintf("unexpected %s", t)}
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokName
+	tokString
+	tokNumber
+	tokOp // one of & | - ! ( ) ,
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == '*' || r == '?' || r == '.' || r == '/' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r, pos := rs[i], i+1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("&|-!(),", r):
+			toks = append(toks, token{tokOp, string(r), pos})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				return nil, &Error{pos, "unterminated string"}
+			}
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, &Error{pos, "bad string: " + err.Error()}
+			}
+			toks = append(toks, token{tokString, s, pos})
+			i = j + 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			if j < len(rs) && isNameRune(rs[j]) {
+				return nil, &Error{pos, "names can't start with a digit"}
+			}
+			toks = append(toks, token{tokNumber, string(rs[i:j]), pos})
+			i = j
+		case isNameRune(r):
+			j := i
+			for j < len(rs) && isNameRune(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{tokName, string(rs[i:j]), pos})
+			i = j
+		default:
+			return nil, &Error{pos, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(rs) + 1}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokOp || t.text != op {
+		return &Error{t.pos, fmt.Sprintf("expected '%s', found %s", op, t)}
+	}
+	return nil
+}
+
+// union := intersect { ('|' | '-') intersect }
+func (p *parser) union() (expr, error) {
+	x, err := p.intersect()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") || p.isOp("-") {
+		op := p.next().text
+		y, err := p.intersect()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+// intersect := unary { '&' unary }
+func (p *parser) intersect() (expr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&") {
+		p.next()
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op: "&", x: x, y: y}
+	}
+	return x, nil
+}
+
+// unary := '!' unary | '(' union ')' | call | name | string
+func (p *parser) unary() (expr, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokOp && t.text == "!":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return complement{x}, nil
+	case t.kind == tokOp && t.text == "(":
+		x, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case t.kind == tokName && p.isOp("("):
+		return p.call(t)
+	case t.kind == tokName || t.kind == tokString:
+		return function{name: t.text, pos: t.pos}, nil
+	}
+	return nil, &Error{t.pos, fmt.Sprintf("expected a function name or set, found %s", t)}
+}
+
+// call := name '(' [arg { ',' arg }] ')'
+func (p *parser) call(name token) (expr, error) {
+	b, ok := builtins[name.text]
+	if !ok {
+		return nil, &Error{name.pos, fmt.Sprintf("unknown function %s()", name.text)}
+	}
+	p.next() // (
+	c := call{name: name.text, pos: name.pos, b: b}
+	for !p.isOp(")") {
+		if len(c.args) > 0 {
+			if t := p.next(); t.kind != tokOp || t.text != "," {
+				return nil, &Error{t.pos, fmt.Sprintf("expected ',' or ')', found %s", t)}
+			}
+		}
+		if len(c.args) == len(b.params) {
+			if t := p.peek(); t.kind == tokEOF {
+				return nil, &Error{t.pos, "expected ')', found end of query"}
+			}
+			return nil, &Error{p.peek().pos, fmt.Sprintf("too many arguments; usage: %s", b.usage)}
+		}
+		arg, err := p.arg(b.params[len(c.args)], b.usage)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	p.next() // )
+	if len(c.args) < b.required {
+		return nil, &Error{name.pos, fmt.Sprintf("missing arguments; usage: %s", b.usage)}
+	}
+	return c, nil
+}
+
+func (p *parser) arg(k kind, usage string) (any, error) {
+	switch k {
+	case kindString:
+		t := p.next()
+		if t.kind != tokString && t.kind != tokName {
+			return nil, &Error{t.pos, fmt.Sprintf("expected a string, found %s; usage: %s", t, usage)}
+		}
+		return t.text, nil
+	case kindInt:
+		t := p.next()
+		if t.kind != tokNumber {
+			return nil, &Error{t.pos, fmt.Sprintf("expected a number, found %s; usage: %s", t, usage)}
+		}
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, &Error{t.pos, err.Error()}
+		}
+		return n, nil
+	}
+	return p.union()
+}
@@ -0,0 +1,203 @@
+// Package report renders an architectural overview of a call-graph as a
+// standalone HTML page or a Markdown document, for sharing with people who
+// don't run geeparse themselves.
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+)
+
+// Formats are the report formats Write accepts.
+var Formats = []string{"html", "markdown"}
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+//go:embed report.md.tmpl
+var markdownTemplate string
+
+// Options tunes what a report covers.
+type Options struct {
+	Title string
+	// Top is how many hubs and cycles to list; default 10.
+	Top int
+	// Roots are the entrypoint patterns dead code is measured from;
+	// default analysis.DefaultRoots.
+	Roots []string
+	// MaxDead caps the dead functions listed (all are counted); default 50.
+	MaxDead int
+	// Thresholds, if set, are checked and crossings listed as warnings.
+	Thresholds policy.Thresholds
+}
+
+// Report is everything a template can show. Custom templates see the same
+// fields.
+type Report struct {
+	Title     string
+	Generated time.Time
+	Stats     analysis.Stats
+	// Warnings are the thresholds crossed; files relative to Root.
+	Warnings []policy.Warning
+	// Cycles are the largest call cycles, each sorted by name.
+	Cycles    [][]string
+	DeadCode  []analysis.Location // the first MaxDead; files relative to Root
+	DeadTotal int
+	Root      string // deepest directory holding every source file
+	Coupling  analysis.Coupling
+	// PackageDiagram is a Mermaid flowchart of the calls between packages.
+	PackageDiagram string
+}
+
+// Build analyzes graph for a report.
+func Build(graph map[string]callgraph.FunctionNode, opts Options) *Report {
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+	if opts.MaxDead <= 0 {
+		opts.MaxDead = 50
+	}
+	if len(opts.Roots) == 0 {
+		opts.Roots = analysis.DefaultRoots
+	}
+	if opts.Title == "" {
+		opts.Title = "Call-graph report"
+	}
+	r := &Report{
+		Title:     opts.Title,
+		Generated: time.Now().UTC(),
+		Stats:     analysis.ComputeStats(graph, opts.Top),
+		Coupling:  analysis.PackageCoupling(graph),
+	}
+	for i, c := range analysis.Cycles(graph) {
+		if i == opts.Top {
+			break
+		}
+		c = append([]string(nil), c...)
+		sort.Strings(c)
+		r.Cycles = append(r.Cycles, c)
+	}
+	dead := analysis.DeadCode(graph, opts.Roots)
+	r.DeadTotal = len(dead)
+	if len(dead) > opts.MaxDead {
+		dead = dead[:opts.MaxDead]
+	}
+	r.Root = sourceRoot(graph)
+	for _, d := range dead {
+		d.File = r.relative(d.File)
+		r.DeadCode = append(r.DeadCode, d)
+	}
+	for _, w := range policy.Warn(graph, opts.Thresholds) {
+		w.File = r.relative(w.File)
+		r.Warnings = append(r.Warnings, w)
+	}
+	r.PackageDiagram = packageDiagram(r.Coupling)
+	return r
+}
+
+// relative returns file relative to r.Root.
+func (r *Report) relative(file string) string {
+	if rel, err := filepath.Rel(r.Root, file); err == nil && file != "" {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// sourceRoot returns the deepest directory containing every function's
+// file, so reports don't leak the absolute path they were built at.
+func sourceRoot(graph map[string]callgraph.FunctionNode) string {
+	root := ""
+	for _, node := range graph {
+		if node.File == "" {
+			continue
+		}
+		dir := filepath.Dir(node.File)
+		if root == "" {
+			root = dir
+			continue
+		}
+		for root != filepath.Dir(root) && dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// packageDiagram draws the coupling matrix as a Mermaid flowchart, one
+// node per package and one arrow, labelled with its call count, per
+// package pair that calls across.
+func packageDiagram(c analysis.Coupling) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, p := range c.Packages {
+		fmt.Fprintf(&b, "  p%d[\"%s\"]\n", i, strings.ReplaceAll(p, `"`, "#quot;"))
+	}
+	for i, row := range c.Calls {
+		for j, n := range row {
+			if i != j && n > 0 {
+				fmt.Fprintf(&b, "  p%d -->|%d| p%d\n", i, n, j)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Write renders r in format with the built-in template.
+func Write(w io.Writer, format string, r *Report) error {
+	switch strings.ToLower(format) {
+	case "html":
+		return WriteTemplate(w, "html", htmlTemplate, r)
+	case "markdown", "md":
+		return WriteTemplate(w, "markdown", markdownTemplate, r)
+	}
+	return fmt.Errorf("unknown report format %q (want %s)", format, strings.Join(Formats, " or "))
+}
+
+// WriteTemplate renders r with a custom template in Go template syntax.
+// HTML templates escape what they insert for its context; Markdown ones
+// insert it verbatim.
+func WriteTemplate(w io.Writer, format, text string, r *Report) error {
+	switch strings.ToLower(format) {
+	case "html":
+		t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap(funcs)).Parse(text)
+		if err != nil {
+			return fmt.Errorf("report template: %w", err)
+		}
+		return t.Execute(w, r)
+	case "markdown", "md":
+		t, err := template.New("report").Funcs(funcs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("report template: %w", err)
+		}
+		return t.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q (want %s)", format, strings.Join(Formats, " or "))
+}
+
+// funcs are the helpers templates may call.
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+	// shade is an opacity from 0 to 1 for a count relative to max
+	"shade": func(n, max int) string {
+		if max == 0 || n == 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%.2f", 0.15+0.85*float64(n)/float64(max))
+	},
+	// cell escapes a value for a Markdown table cell
+	"cell": func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+	},
+}
@@ -0,0 +1,243 @@
+// Package sarif reports geeparse findings (dead code, call cycles, policy
+// violations and threshold warnings) as SARIF 2.1.0, the format code-scanning services
+// accept for inline pull-request annotations.
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/fileuri"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+)
+
+// Rule IDs used in reports.
+const (
+	RuleDeadCode  = "dead-code"
+	RuleCycle     = "call-cycle"
+	RulePolicy    = "policy-violation"
+	RuleThreshold = "threshold-exceeded"
+)
+
+// srcRoot is the uriBaseId relative artifact paths are resolved against.
+const srcRoot = "%SRCROOT%"
+
+var rules = map[string]reportingDescriptor{
+	RuleDeadCode: {
+		ID:                   RuleDeadCode,
+		Name:                 "UnreachableFunction",
+		ShortDescription:     message{Text: "Function is unreachable from every entrypoint"},
+		DefaultConfiguration: configuration{Level: "warning"},
+	},
+	RuleCycle: {
+		ID:                   RuleCycle,
+		Name:                 "CallCycle",
+		ShortDescription:     message{Text: "Functions call each other in a cycle"},
+		DefaultConfiguration: configuration{Level: "note"},
+	},
+	RulePolicy: {
+		ID:                   RulePolicy,
+		Name:                 "ForbiddenDependency",
+		ShortDescription:     message{Text: "Call breaks an architecture rule"},
+		DefaultConfiguration: configuration{Level: "error"},
+	},
+	RuleThreshold: {
+		ID:                   RuleThreshold,
+		Name:                 "ThresholdExceeded",
+		ShortDescription:     message{Text: "Fan-out, call depth or cycle size is over its configured limit"},
+		DefaultConfiguration: configuration{Level: "warning"},
+	},
+}
+
+// Report collects findings for one SARIF run. Source paths are written
+// relative to root when they lie inside it.
+type Report struct {
+	root    string
+	results []result
+	used    map[string]bool
+}
+
+// NewReport starts an empty report for code checked out at root.
+func NewReport(root string) *Report {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &Report{root: root, used: make(map[string]bool)}
+}
+
+// AddDeadCode records one finding per unreachable function.
+func (r *Report) AddDeadCode(dead []analysis.Location) {
+	for _, d := range dead {
+		r.add(RuleDeadCode, fmt.Sprintf("%s is unreachable from every entrypoint", d.Name), d.File, d.Line)
+	}
+}
+
+// AddCycles records one finding per cycle, located at its alphabetically
+// first function.
+func (r *Report) AddCycles(graph map[string]callgraph.FunctionNode, cycles [][]string) {
+	for _, c := range cycles {
+		members := append([]string(nil), c...)
+		sort.Strings(members)
+		first := graph[members[0]]
+		text := fmt.Sprintf("%s calls itself", members[0])
+		if len(members) > 1 {
+			text = fmt.Sprintf("call cycle through %d functions: %s", len(members), strings.Join(members, ", "))
+		}
+		r.add(RuleCycle, text, first.File, first.Line)
+	}
+}
+
+// AddViolations records one finding per policy violation.
+func (r *Report) AddViolations(violations []policy.Violation) {
+	for _, v := range violations {
+		text := fmt.Sprintf("%s (%s) calls %s (%s), breaking rule %q", v.Caller, v.CallerPackage, v.Callee, v.CalleePackage, v.Rule)
+		if v.Reason != "" {
+			text += ": " + v.Reason
+		}
+		r.add(RulePolicy, text, v.File, v.Line)
+	}
+}
+
+// AddWarnings records one finding per threshold warning.
+func (r *Report) AddWarnings(warnings []policy.Warning) {
+	for _, w := range warnings {
+		r.add(RuleThreshold, w.Message, w.File, w.Line)
+	}
+}
+
+func (r *Report) add(ruleID, text, file string, line int) {
+	r.used[ruleID] = true
+	res := result{
+		RuleID:  ruleID,
+		Level:   rules[ruleID].DefaultConfiguration.Level,
+		Message: message{Text: text},
+	}
+	if file != "" {
+		loc := physicalLocation{ArtifactLocation: r.artifact(file)}
+		if line > 0 {
+			loc.Region = &region{StartLine: line}
+		}
+		res.Locations = []location{{PhysicalLocation: loc}}
+	}
+	r.results = append(r.results, res)
+}
+
+// artifact returns a root-relative location for file when possible, and
+// an absolute file URI otherwise.
+func (r *Report) artifact(file string) artifactLocation {
+	if rel, err := filepath.Rel(r.root, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return artifactLocation{URI: filepath.ToSlash(rel), URIBaseID: srcRoot}
+	}
+	return artifactLocation{URI: fileuri.FromPath(file)}
+}
+
+// Len returns the number of findings recorded.
+func (r *Report) Len() int {
+	return len(r.results)
+}
+
+// Write encodes the report as an indented SARIF log.
+func (r *Report) Write(w io.Writer) error {
+	ids := make([]string, 0, len(r.used))
+	for id := range r.used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	descriptors := make([]reportingDescriptor, len(ids))
+	for i, id := range ids {
+		descriptors[i] = rules[id]
+	}
+	results := r.results
+	if results == nil {
+		results = []result{}
+	}
+
+	doc := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []run{{
+			Tool: tool{Driver: driver{
+				Name:           "geeparse",
+				InformationURI: "https://github.com/ishanmadhav/geeparse",
+				Rules:          descriptors,
+			}},
+			OriginalURIBaseIDs: map[string]artifactLocation{
+				srcRoot: {URI: strings.TrimSuffix(fileuri.FromPath(r.root), "/") + "/"},
+			},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// The types below mirror the subset of the SARIF 2.1.0 schema we emit.
+
+type sarifLog struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []run  `json:"runs"`
+}
+
+type run struct {
+	Tool               tool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]artifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []result                    `json:"results"`
+}
+
+type tool struct {
+	Driver driver `json:"driver"`
+}
+
+type driver struct {
+	Name           string                `json:"name"`
+	InformationURI string                `json:"informationUri,omitempty"`
+	Rules          []reportingDescriptor `json:"rules"`
+}
+
+type reportingDescriptor struct {
+	ID                   string        `json:"id"`
+	Name                 string        `json:"name"`
+	ShortDescription     message       `json:"shortDescription"`
+	DefaultConfiguration configuration `json:"defaultConfiguration"`
+}
+
+type configuration struct {
+	Level string `json:"level"`
+}
+
+type message struct {
+	Text string `json:"text"`
+}
+
+type result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   message    `json:"message"`
+	Locations []location `json:"locations,omitempty"`
+}
+
+type location struct {
+	PhysicalLocation physicalLocation `json:"physicalLocation"`
+}
+
+type physicalLocation struct {
+	ArtifactLocation artifactLocation `json:"artifactLocation"`
+	Region           *region          `json:"region,omitempty"`
+}
+
+type artifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type region struct {
+	StartLine int `json:"startLine"`
+}
@@ -0,0 +1,188 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Providers are the embedding providers NewProvider knows.
+var Providers = []string{"openai", "ollama", "hash"}
+
+// Config selects and configures a provider.
+type Config struct {
+	// Provider is "openai" (or any OpenAI-compatible /embeddings API),
+	// "ollama", or "hash", a local lexical stand-in that needs no model.
+	Provider string
+	Model    string
+	Endpoint string // API base URL; defaults per provider
+	APIKey   string
+}
+
+// NewProvider returns the provider c selects.
+func NewProvider(c Config) (Provider, error) {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	switch strings.ToLower(c.Provider) {
+	case "openai":
+		if c.Model == "" {
+			c.Model = "text-embedding-3-small"
+		}
+		if c.Endpoint == "" {
+			c.Endpoint = "https://api.openai.com/v1"
+		}
+		return &openAI{cfg: c, client: client}, nil
+	case "ollama":
+		if c.Model == "" {
+			c.Model = "nomic-embed-text"
+		}
+		if c.Endpoint == "" {
+			c.Endpoint = "http://localhost:11434"
+		}
+		return &ollama{cfg: c, client: client}, nil
+	case "hash":
+		return hashed{}, nil
+	case "":
+		return nil, fmt.Errorf("no embeddings provider configured (want one of %s)", strings.Join(Providers, ", "))
+	}
+	return nil, fmt.Errorf("unknown embeddings provider %q (want one of %s)", c.Provider, strings.Join(Providers, ", "))
+}
+
+// postJSON sends body to url and decodes the JSON reply into out.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("embeddings: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("embeddings: decode reply: %w", err)
+	}
+	return nil
+}
+
+type openAI struct {
+	cfg    Config
+	client *http.Client
+}
+
+func (p *openAI) Model() string { return "openai:" + p.cfg.Model }
+
+func (p *openAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var reply struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	url := strings.TrimSuffix(p.cfg.Endpoint, "/") + "/embeddings"
+	if err := postJSON(ctx, p.client, url, p.cfg.APIKey, map[string]any{"model": p.cfg.Model, "input": texts}, &reply); err != nil {
+		return nil, err
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range reply.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embeddings: reply index %d out of range", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	return out, nil
+}
+
+type ollama struct {
+	cfg    Config
+	client *http.Client
+}
+
+func (p *ollama) Model() string { return "ollama:" + p.cfg.Model }
+
+func (p *ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var reply struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	url := strings.TrimSuffix(p.cfg.Endpoint, "/") + "/api/embed"
+	if err := postJSON(ctx, p.client, url, p.cfg.APIKey, map[string]any{"model": p.cfg.Model, "input": texts}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Embeddings, nil
+}
+
+// hashDims is the size of hashed vectors.
+const hashDims = 512
+
+// hashed embeds texts as hashed bags of words: identifiers are split into
+// their camelCase and snake_case parts, so "BeginTx" shares terms with
+// "begin a transaction". It understands no synonyms, but works offline
+// and makes a usable keyword search.
+type hashed struct{}
+
+func (hashed) Model() string { return "hash:v1" }
+
+func (hashed) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, hashDims)
+		for _, w := range words(text) {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			sum := h.Sum32()
+			sign := float32(1)
+			if sum&1 == 1 {
+				sign = -1
+			}
+			v[(sum>>1)%hashDims] += sign
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// words splits text into lower-case words, breaking identifiers at case
+// changes, digits and underscores, and drops very short ones.
+func words(text string) []string {
+	var out []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 1 {
+			out = append(out, strings.ToLower(string(cur)))
+		}
+		cur = cur[:0]
+	}
+	rs := []rune(text)
+	for i, r := range rs {
+		switch {
+		case !unicode.IsLetter(r):
+			flush()
+		case unicode.IsUpper(r) && len(cur) > 0 &&
+			(unicode.IsLower(cur[len(cur)-1]) || i+1 < len(rs) && unicode.IsLower(rs[i+1])):
+			flush()
+			cur = append(cur, r)
+		default:
+			cur = append(cur, r)
+		}
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,170 @@
+// Package semantic finds functions by meaning rather than name: each
+// function's signature and body are turned into an embedding vector by a
+// pluggable provider, and a search embeds the question and ranks functions
+// by cosine similarity, so "functions that open a DB transaction" finds
+// the ones calling db.Begin.
+package semantic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Provider turns texts into embedding vectors, one per text, in order.
+type Provider interface {
+	// Model identifies the provider and model. Vectors from different
+	// models aren't comparable, so stored ones are only used with the
+	// model that made them.
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Embedding is one function's vector, with the model that computed it and
+// a hash of the text it was computed from, so unchanged functions aren't
+// embedded again.
+type Embedding struct {
+	Function string
+	Model    string
+	Hash     string
+	Vector   []float32
+}
+
+// maxText caps how much of a function is embedded, keeping long functions
+// within provider input limits.
+const maxText = 8000
+
+// Text is what gets embedded for a function: its name, package and
+// source, falling back to the signature for functions without one.
+func Text(name string, fn callgraph.FunctionNode) string {
+	body := fn.Definition
+	if body == "" || callgraph.Redacted(body) {
+		body = "func " + name + fn.Signature
+	}
+	text := "package " + fn.Package + "\n" + body
+	if len(text) > maxText {
+		text = text[:maxText]
+	}
+	return text
+}
+
+// Hash fingerprints an embedded text.
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:12])
+}
+
+// BatchSize is how many functions Update sends to the provider at once.
+const BatchSize = 64
+
+// Update embeds every function of graph that has no embedding in have
+// for p's model, or whose text changed since, and returns the new
+// embeddings. progress, if not nil, is called after each batch.
+func Update(ctx context.Context, p Provider, graph map[string]callgraph.FunctionNode, have map[string]Embedding, progress func(done, total int)) ([]Embedding, error) {
+	model := p.Model()
+	var todo []Embedding
+	var texts []string
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		text := Text(name, graph[name])
+		hash := Hash(text)
+		if e, ok := have[name]; ok && e.Model == model && e.Hash == hash {
+			continue
+		}
+		todo = append(todo, Embedding{Function: name, Model: model, Hash: hash})
+		texts = append(texts, text)
+	}
+
+	for start := 0; start < len(todo); start += BatchSize {
+		end := min(start+BatchSize, len(todo))
+		vecs, err := p.Embed(ctx, texts[start:end])
+		if err != nil {
+			return todo[:start], err
+		}
+		if len(vecs) != end-start {
+			return todo[:start], fmt.Errorf("embeddings: %s returned %d vectors for %d texts", model, len(vecs), end-start)
+		}
+		for i, v := range vecs {
+			todo[start+i].Vector = normalize(v)
+		}
+		if progress != nil {
+			progress(end, len(todo))
+		}
+	}
+	return todo, nil
+}
+
+// Match is a search result: a function and its similarity to the query,
+// from -1 to 1.
+type Match struct {
+	Function string  `json:"function"`
+	Score    float64 `json:"score"`
+}
+
+// Search embeds query with p and returns the limit functions whose
+// embeddings are most similar, best first. Embeddings from other models,
+// and functions with nothing in common with the query, are skipped.
+func Search(ctx context.Context, p Provider, query string, embeddings map[string]Embedding, limit int) ([]Match, error) {
+	vecs, err := p.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != 1 {
+		return nil, fmt.Errorf("embeddings: %s returned %d vectors for 1 text", p.Model(), len(vecs))
+	}
+	q := normalize(vecs[0])
+	matches := []Match{}
+	for name, e := range embeddings {
+		if e.Model != p.Model() || len(e.Vector) != len(q) {
+			continue
+		}
+		if score := dot(q, e.Vector); score > 0 {
+			matches = append(matches, Match{Function: name, Score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Function < matches[j].Function
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// normalize scales v to unit length, so cosine similarity is a dot
+// product.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(1 / math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x * n
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// requireAdmin rejects requests that don't carry the configured admin
+// token. With no token configured the admin endpoints don't exist.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.checkAdmin(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// checkAdmin reports whether r carries the admin token, answering it
+// with 404 or 401 if not, for handlers where only some requests need it.
+func (s *Server) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.options().AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	if !s.hasAdminToken(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="geeparse admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	snaps, err := s.store.Snapshots()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, snaps)
+}
+
+func (s *Server) handleDeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid snapshot id", http.StatusBadRequest)
+		return
+	}
+	err = s.store.DeleteSnapshot(id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.opts.Logger.Info("admin deleted snapshot", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Compact(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.opts.Logger.Info("admin compacted the store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReload re-reads the current graph from the store and starts serving
+// it, picking up a rebuild written by another process.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	graph, err := s.store.LoadGraph()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.SetGraph(graph)
+	s.opts.Logger.Info("admin reloaded the graph", "functions", len(graph))
+	writeJSON(w, map[string]int{"nodes": len(graph)})
+}
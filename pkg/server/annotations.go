@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// annotationRequest is the body accepted by PUT /api/functions/{name}/annotation.
+type annotationRequest struct {
+	Note   string `json:"note"`
+	Author string `json:"author"`
+}
+
+func (s *Server) handleListAnnotations(w http.ResponseWriter, r *http.Request) {
+	anns, err := s.store.Annotations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, anns)
+}
+
+func (s *Server) handleGetAnnotation(w http.ResponseWriter, r *http.Request) {
+	ann, err := s.store.Annotation(r.PathValue("name"))
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ann)
+}
+
+func (s *Server) handlePutAnnotation(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.currentGraph()[name]; !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+	var req annotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "decode annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ann, err := s.store.SetAnnotation(name, req.Note, req.Author)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ann)
+}
+
+func (s *Server) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteAnnotation(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// callAnnotationRequest is the body accepted by
+// PUT /api/functions/{name}/calls/{callee}/annotation.
+type callAnnotationRequest struct {
+	Note   string `json:"note"`
+	Author string `json:"author"`
+	Status string `json:"status"`
+}
+
+func (s *Server) handleListCallAnnotations(w http.ResponseWriter, r *http.Request) {
+	anns, err := s.store.CallAnnotations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, anns)
+}
+
+func (s *Server) handleGetCallAnnotation(w http.ResponseWriter, r *http.Request) {
+	ann, err := s.store.CallAnnotation(r.PathValue("name"), r.PathValue("callee"))
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ann)
+}
+
+// handlePutCallAnnotation annotates one of the calls a function makes;
+// the call has to be in the current graph, though the note outlives it.
+func (s *Server) handlePutCallAnnotation(w http.ResponseWriter, r *http.Request) {
+	name, callee := r.PathValue("name"), r.PathValue("callee")
+	node, ok := s.currentGraph()[name]
+	if !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+	if !slices.Contains(node.Callees, callee) {
+		http.Error(w, name+" doesn't call "+callee, http.StatusNotFound)
+		return
+	}
+	var req callAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "decode annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !persistence.ValidReviewStatus(req.Status) {
+		http.Error(w, "unknown review status "+req.Status+" (want "+strings.Join(persistence.ReviewStatuses, ", ")+" or none)", http.StatusBadRequest)
+		return
+	}
+	ann, err := s.store.SetCallAnnotation(name, callee, req.Note, req.Author, req.Status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ann)
+}
+
+func (s *Server) handleDeleteCallAnnotation(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteCallAnnotation(r.PathValue("name"), r.PathValue("callee")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
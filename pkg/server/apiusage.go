@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+)
+
+// handleAPIUsage serves, per package, which exported functions other
+// packages call and by whom, limited like /api/coupling to ?package=a,b
+// and the packages below them. ?unused=true lists only the exported
+// functions no other package calls.
+func (s *Server) handleAPIUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var pkgs []string
+	for _, p := range q["package"] {
+		pkgs = append(pkgs, strings.Split(p, ",")...)
+	}
+	usage := analysis.APIUsage(s.currentGraph(), pkgs)
+	if v := q.Get("unused"); v != "" {
+		unused, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "unused must be true or false", http.StatusBadRequest)
+			return
+		}
+		if unused {
+			usage = analysis.UnusedAPI(usage)
+		}
+	}
+	writeJSON(w, usage)
+}
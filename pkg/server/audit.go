@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// defaultAuditLimit is how many entries /api/audit returns without a
+// ?limit=.
+const defaultAuditLimit = 100
+
+// audited records, after next has succeeded, the request in the audit log
+// as action, for routes that always change the store or the graph.
+func (s *Server) audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status < 400 {
+			summary := r.Method + " " + r.URL.Path
+			if r.URL.RawQuery != "" {
+				summary += "?" + r.URL.RawQuery
+			}
+			s.audit(s.actor(r, s.hasAdminToken(r)), persistence.AuditAPI, action, summary)
+		}
+	}
+}
+
+// audit appends an entry to the audit log. Failing to is only logged:
+// the change it records has already been made.
+func (s *Server) audit(who, source, action, summary string) {
+	err := s.store.RecordAudit(persistence.AuditEntry{Actor: who, Source: source, Action: action, Summary: summary})
+	if err != nil {
+		s.opts.Logger.Error("audit", "action", action, "err", err)
+	}
+}
+
+// actor names who sent r. Names clients send are only taken from
+// requests that come through one of Options.TrustedProxies or carry the
+// admin token, since anyone can send the headers: the user the proxy
+// vouches for in X-Forwarded-User or X-Forwarded-Email, else the name the
+// UI signs changes with in X-Geeparse-User (percent-encoded). Otherwise
+// it's "admin" for requests carrying the admin token, else the client's
+// address.
+func (s *Server) actor(r *http.Request, admin bool) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !admin && !s.trustedProxy(host) {
+		return host
+	}
+	for _, h := range []string{"X-Forwarded-User", "X-Forwarded-Email"} {
+		if v := strings.TrimSpace(r.Header.Get(h)); v != "" {
+			return v
+		}
+	}
+	// percent-encoded, since header values can't hold any name
+	if v, err := url.PathUnescape(r.Header.Get("X-Geeparse-User")); err == nil && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	if admin {
+		return "admin"
+	}
+	return host
+}
+
+// trustedProxy reports whether host, a client address, is in one of
+// Options.TrustedProxies.
+func (s *Server) trustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.opts.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAdminToken reports whether r carries the configured admin token.
+func (s *Server) hasAdminToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	admin := s.options().AdminToken
+	return ok && admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+}
+
+// handleAudit lists the audit log, newest first, narrowed by ?actor=,
+// ?action=, ?source= and ?since= (RFC 3339, or a duration back from now
+// such as 24h) and capped by ?limit=.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	q := persistence.AuditQuery{Actor: v.Get("actor"), Action: v.Get("action"), Source: v.Get("source"), Limit: defaultAuditLimit}
+	if since := v.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else {
+			http.Error(w, "invalid since "+since+": want RFC 3339 time or duration", http.StatusBadRequest)
+			return
+		}
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit "+l, http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	entries, err := s.store.AuditLog(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
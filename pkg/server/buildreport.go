@@ -0,0 +1,24 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// handleBuildReport serves the report of the build behind the current
+// graph, whose "incomplete" member lists the functions gopls failed on,
+// or 404 if the graph wasn't built here.
+func (s *Server) handleBuildReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.store.BuildReport()
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
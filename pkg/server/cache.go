@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for the response cache, as serve's flags set them.
+const (
+	DefaultCacheSize = 32 << 20
+	DefaultCacheTTL  = 5 * time.Minute
+)
+
+// responseCache is an LRU of rendered responses, bounded by the bytes of
+// their bodies and by age, so repeated subgraph, query and export
+// requests from many browsers cost one render per graph. Entries are keyed
+// by the graph generation as well as the request, and SetGraph purges
+// them, so a swapped graph is never answered from the old one.
+type responseCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	size    int
+	order   *list.List // of *cachedResponse, most recently used first
+	entries map[string]*list.Element
+}
+
+type cachedResponse struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(maxSize int, ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &responseCache{maxSize: maxSize, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := el.Value.(*cachedResponse)
+	if time.Now().After(resp.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return resp, true
+}
+
+// put adds resp, evicting the least recently used entries to make room.
+// Responses bigger than the whole cache aren't kept.
+func (c *responseCache) put(resp *cachedResponse) {
+	if len(resp.body) > c.maxSize {
+		return
+	}
+	resp.expires = time.Now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[resp.key]; ok {
+		c.remove(el)
+	}
+	c.entries[resp.key] = c.order.PushFront(resp)
+	c.size += len(resp.body)
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *responseCache) remove(el *list.Element) {
+	resp := c.order.Remove(el).(*cachedResponse)
+	delete(c.entries, resp.key)
+	c.size -= len(resp.body)
+}
+
+// purge drops every entry.
+func (c *responseCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.size = 0
+}
+
+// purgeCache empties the response cache, for changes other than a new
+// graph that cached responses depend on, such as tags.
+func (s *Server) purgeCache() {
+	if s.cache != nil {
+		s.cache.purge()
+	}
+}
+
+// cached serves next's successful responses from the cache, keyed by path
+// and query, rendering them once per graph, TTL and eviction. The
+// X-Geeparse-Cache header says whether a response was a hit or a miss.
+// With no cache configured it is next.
+func (s *Server) cached(next http.HandlerFunc) http.HandlerFunc {
+	if s.cache == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		gen := s.gen
+		s.mu.RUnlock()
+		key := strconv.Itoa(gen) + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+		if resp, ok := s.cache.get(key); ok {
+			resp.write(w, "hit")
+			return
+		}
+		rec := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		next(rec, r)
+		resp := &cachedResponse{key: key, status: rec.status, header: rec.header, body: rec.body.Bytes()}
+		if resp.status == http.StatusOK {
+			s.cache.put(resp)
+		}
+		resp.write(w, "miss")
+	}
+}
+
+func (resp *cachedResponse) write(w http.ResponseWriter, outcome string) {
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("X-Geeparse-Cache", outcome)
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+// bufferedResponse holds a response until it's known whether to cache it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wrote {
+		b.status, b.wrote = status, true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
@@ -0,0 +1,13 @@
+package server
+
+import "net/http"
+
+// handleChurn serves the measured churn keyed by function name.
+func (s *Server) handleChurn(w http.ResponseWriter, r *http.Request) {
+	churn, err := s.store.Churn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, churn)
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+)
+
+// handleClones serves the duplicated function bodies of the current
+// graph, longest first. ?minTokens= and ?threshold= tune the search as
+// the clones command's flags do; ?crossPackage=1 keeps only clones
+// spanning several packages.
+func (s *Server) handleClones(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var opts analysis.CloneOptions
+	if v := q.Get("minTokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid minTokens", http.StatusBadRequest)
+			return
+		}
+		opts.MinTokens = n
+	}
+	if v := q.Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > 1 {
+			http.Error(w, "invalid threshold", http.StatusBadRequest)
+			return
+		}
+		opts.Threshold = t
+	}
+	opts.CrossPackage = q.Get("crossPackage") == "1" || q.Get("crossPackage") == "true"
+	writeJSON(w, analysis.Clones(s.currentGraph(), opts))
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// handleCoupling serves the package coupling matrix of the current graph,
+// limited like /api/export to ?package=a,b and the packages below them.
+func (s *Server) handleCoupling(w http.ResponseWriter, r *http.Request) {
+	var pkgs []string
+	for _, p := range r.URL.Query()["package"] {
+		pkgs = append(pkgs, strings.Split(p, ",")...)
+	}
+	writeJSON(w, analysis.PackageCoupling(callgraph.FilterPackages(s.currentGraph(), pkgs)))
+}
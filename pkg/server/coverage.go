@@ -0,0 +1,13 @@
+package server
+
+import "net/http"
+
+// handleCoverage serves the imported test coverage keyed by function name.
+func (s *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	cov, err := s.store.Coverage()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, cov)
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+)
+
+// handleEntrypoints serves the footprint of each entrypoint, largest
+// first: those matching ?roots=a,b (path.Match patterns), or main, init
+// and TestMain.
+func (s *Server) handleEntrypoints(w http.ResponseWriter, r *http.Request) {
+	roots := analysis.DefaultRoots
+	if v := r.URL.Query().Get("roots"); v != "" {
+		roots = strings.Split(v, ",")
+	}
+	writeJSON(w, analysis.Entrypoints(s.currentGraph(), roots))
+}
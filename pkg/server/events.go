@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// event is pushed to browsers over /api/events.
+type event struct {
+	Type  string `json:"type"`
+	Nodes int    `json:"nodes,omitempty"`
+	Edges int    `json:"edges,omitempty"`
+	// Job and State report a job's progress in "job" events.
+	Job   int64  `json:"job,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// broker fans events out to every connected /api/events stream.
+type broker struct {
+	mu   sync.Mutex
+	subs map[chan event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: make(map[chan event]struct{})}
+}
+
+func (b *broker) subscribe() chan event {
+	ch := make(chan event, 8)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broker) unsubscribe(ch chan event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+}
+
+// publish delivers ev to every subscriber, dropping it for subscribers
+// that are too far behind rather than blocking the publisher.
+func (b *broker) publish(ev event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// handleEvents streams server-sent events until the client goes away.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev := <-ch:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
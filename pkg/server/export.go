@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// handleExport serves the graph in any export format:
+// /api/export?format=dot&root=main&depth=3&package=pkg/server&hot
+// It takes the same filters as the export command.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	out, format, status, err := s.renderExport(q)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	if q.Has("download") {
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="callgraph.%s"`, export.Extension(format)))
+	}
+	w.Write(out)
+}
+
+// renderExport renders the export q asks for, as /api/export and export
+// jobs take it, and returns it with its format, or an error with the HTTP
+// status it calls for.
+func (s *Server) renderExport(q url.Values) ([]byte, string, int, error) {
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	graph, err := s.filteredGraph(q)
+	if err != nil {
+		return nil, format, http.StatusBadRequest, err
+	}
+
+	var weights export.Weights
+	if q.Has("hot") {
+		prof, err := s.store.Profile()
+		if errors.Is(err, persistence.ErrNotFound) {
+			return nil, format, http.StatusNotFound, errors.New("no runtime profile imported")
+		}
+		if err != nil {
+			return nil, format, http.StatusInternalServerError, err
+		}
+		weights = prof.EdgeWeights()
+	}
+
+	// render fully first so format errors still produce a clean 400
+	var buf bytes.Buffer
+	if err := export.WriteWeighted(&buf, format, graph, weights); err != nil {
+		return nil, format, http.StatusBadRequest, err
+	}
+	return buf.Bytes(), format, http.StatusOK, nil
+}
+
+// filteredGraph returns the current graph cut down by the export filters
+// in q: root, depth, package, kinds, generated and redact.
+func (s *Server) filteredGraph(q url.Values) (map[string]callgraph.FunctionNode, error) {
+	depth, _ := strconv.Atoi(q.Get("depth"))
+	var pkgs []string
+	for _, p := range q["package"] {
+		pkgs = append(pkgs, strings.Split(p, ",")...)
+	}
+	kinds, err := callgraph.ParseKinds(q["kinds"]...)
+	if err != nil {
+		return nil, err
+	}
+	return export.Filter{Root: q.Get("root"), Depth: depth, Packages: pkgs, Kinds: kinds, Generated: q.Get("generated"), Redact: q.Get("redact")}.Apply(s.currentGraph())
+}
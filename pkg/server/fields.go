@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// jsonFields lists the JSON names of struct type t's fields.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+var (
+	nodeFields    = append(jsonFields(reflect.TypeFor[callgraph.FunctionNode]()), "name")
+	summaryFields = jsonFields(reflect.TypeFor[FunctionSummary]())
+)
+
+// parseFields reads ?fields=a,b: the fields of each function a client
+// wants, so one that only draws the topology doesn't download every
+// definition. It returns nil, for all of them, without the parameter, and
+// rejects fields not in known.
+func parseFields(r *http.Request, known []string) ([]string, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !slices.Contains(known, f) {
+			return nil, fmt.Errorf("unknown field %q (want any of %s)", f, strings.Join(known, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// pick returns v as a JSON object holding only fields. Fields v leaves
+// out (omitempty ones that are empty) stay out.
+func pick(v any, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if raw, ok := all[f]; ok {
+			out[f] = raw
+		}
+	}
+	return out, nil
+}
+
+// sparseGraph is graph with each function cut down to fields. Functions
+// are keyed by name, so "name" adds nothing.
+func sparseGraph(graph map[string]callgraph.FunctionNode, fields []string) (map[string]map[string]json.RawMessage, error) {
+	out := make(map[string]map[string]json.RawMessage, len(graph))
+	for name, fn := range graph {
+		obj, err := pick(fn, fields)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = obj
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Page sizes for the function listings.
+const (
+	DefaultPageSize = 500
+	MaxPageSize     = 5000
+)
+
+// FunctionSummary is one entry of /api/functions: where a function is and
+// what it looks like, without its definition.
+type FunctionSummary struct {
+	Name      string `json:"name"`
+	Package   string `json:"package"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Signature string `json:"signature"`
+	Callees   int    `json:"callees"`
+}
+
+// FunctionPage is one page of /api/functions. NextCursor, when set, is
+// passed back as ?cursor= for the following page.
+type FunctionPage struct {
+	Functions  []FunctionSummary `json:"functions"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// handleFunctions lists the functions of the current graph by name, a
+// page at a time (?limit=, default DefaultPageSize; ?cursor=), optionally
+// only those in ?package= or below it. ?fields=line,signature keeps only
+// those fields of each, besides the name.
+func (s *Server) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r, summaryFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	graph, names := s.sortedGraph()
+	if pkg := r.URL.Query().Get("package"); pkg != "" {
+		var in []string
+		for _, name := range names {
+			if callgraph.InPackages(graph[name].Package, []string{pkg}) {
+				in = append(in, name)
+			}
+		}
+		names = in
+	}
+	page, next, err := paginate(names, r, DefaultPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := FunctionPage{Functions: make([]FunctionSummary, len(page)), NextCursor: next}
+	for i, name := range page {
+		fn := graph[name]
+		out.Functions[i] = FunctionSummary{
+			Name:      name,
+			Package:   fn.Package,
+			File:      fn.File,
+			Line:      fn.Line,
+			Signature: fn.Signature,
+			Callees:   len(fn.Callees),
+		}
+	}
+	if fields == nil {
+		writeJSON(w, out)
+		return
+	}
+	if !slices.Contains(fields, "name") {
+		fields = append(fields, "name")
+	}
+	sparse := make([]map[string]json.RawMessage, len(out.Functions))
+	for i, fn := range out.Functions {
+		if sparse[i], err = pick(fn, fields); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, struct {
+		Functions  []map[string]json.RawMessage `json:"functions"`
+		NextCursor string                       `json:"nextCursor,omitempty"`
+	}{sparse, out.NextCursor})
+}
+
+// paginate returns the page of sorted names that ?cursor= and ?limit=
+// select, and the cursor of the page after it ("" on the last page). A
+// cursor encodes the last name returned rather than an offset, so walking
+// a graph that is swapped midway neither skips nor repeats the functions
+// both versions have. Without ?limit= pages hold def names; def 0 means
+// everything.
+func paginate(names []string, r *http.Request, def int) ([]string, string, error) {
+	q := r.URL.Query()
+	limit := def
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, "", errors.New("limit must be a positive number")
+		}
+		limit = min(n, MaxPageSize)
+	}
+	start := 0
+	if c := q.Get("cursor"); c != "" {
+		after, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil {
+			return nil, "", errors.New("malformed cursor")
+		}
+		start = sort.Search(len(names), func(i int) bool { return names[i] > string(after) })
+	}
+	names = names[start:]
+	if limit <= 0 || len(names) <= limit {
+		return names, "", nil
+	}
+	return names[:limit], base64.RawURLEncoding.EncodeToString([]byte(names[limit-1])), nil
+}
+
+// sortedGraph returns the current graph with its function names sorted,
+// sorting once per graph.
+func (s *Server) sortedGraph() (map[string]callgraph.FunctionNode, []string) {
+	s.mu.RLock()
+	graph, names, gen := s.graph, s.names, s.gen
+	s.mu.RUnlock()
+	if names != nil {
+		return graph, names
+	}
+	names = make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.mu.Lock()
+	if s.gen == gen {
+		s.names = names
+	}
+	s.mu.Unlock()
+	return graph, names
+}
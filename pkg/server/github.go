@@ -0,0 +1,164 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// Push is a push to the tracked branch, as reported by a GitHub webhook.
+type Push struct {
+	Repo   string // clone URL
+	Branch string
+	Commit string // head commit after the push
+	Pusher string // GitHub login of who pushed
+}
+
+// maxHookBody caps webhook payloads; GitHub's own limit is 25 MB.
+const maxHookBody = 25 << 20
+
+// handleGitHubHook accepts GitHub webhook deliveries, verifying their
+// X-Hub-Signature-256 against the shared secret. A push to the tracked
+// branch starts a rebuild in the background, since GitHub gives up on a
+// delivery after ten seconds; other pushes and events are acknowledged
+// and ignored.
+func (s *Server) handleGitHubHook(w http.ResponseWriter, r *http.Request) {
+	secret := s.options().GitHubSecret
+	if secret == "" || s.opts.Rebuild == nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		writeJSON(w, map[string]string{"status": "pong"})
+		return
+	case "push":
+	default:
+		writeAccepted(w, map[string]string{"status": "ignored", "reason": "event " + event})
+		return
+	}
+
+	var p struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Deleted    bool   `json:"deleted"`
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+		} `json:"repository"`
+		Pusher struct {
+			Name string `json:"name"`
+		} `json:"pusher"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, "invalid push payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	branch, _ := strings.CutPrefix(p.Ref, "refs/heads/")
+	if branch != s.hookBranch() || p.Deleted {
+		writeAccepted(w, map[string]string{"status": "ignored", "reason": "not a push to " + s.hookBranch()})
+		return
+	}
+
+	push := Push{Repo: p.Repository.CloneURL, Branch: branch, Commit: p.After, Pusher: p.Pusher.Name}
+	s.opts.Logger.Info("github push; rebuilding", "branch", branch, "commit", p.After,
+		"delivery", r.Header.Get("X-GitHub-Delivery"))
+	s.hooks.queue(push, s.rebuildFromPush)
+	writeAccepted(w, map[string]string{"status": "rebuilding", "commit": p.After})
+}
+
+// writeAccepted answers 202 Accepted with v as JSON.
+func writeAccepted(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) hookBranch() string {
+	return cmp.Or(s.options().GitHubBranch, "main")
+}
+
+// validSignature checks GitHub's "sha256=<hex HMAC of the body>" header.
+func validSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func (s *Server) rebuildFromPush(p Push) {
+	s.rebuilding.Lock()
+	defer s.rebuilding.Unlock()
+	start := time.Now()
+	graph, err := s.opts.Rebuild(context.Background(), p)
+	if err != nil {
+		s.opts.Logger.Error("rebuild after push failed", "commit", p.Commit, "err", err)
+		return
+	}
+	s.SetGraph(graph)
+	s.audit(cmp.Or(p.Pusher, "github"), persistence.AuditWebhook, "rebuild",
+		fmt.Sprintf("push to %s at %s: %d functions, %d calls", p.Branch, p.Commit, len(graph), callgraph.EdgeCount(graph)))
+	s.opts.Logger.Info("rebuilt graph after push", "commit", p.Commit, "duration", time.Since(start).Round(time.Millisecond),
+		"functions", len(graph), "calls", callgraph.EdgeCount(graph))
+}
+
+// hookQueue runs one rebuild at a time. Pushes arriving meanwhile
+// collapse into a single follow-up rebuild of the latest one.
+type hookQueue struct {
+	mu      sync.Mutex
+	running bool
+	next    *Push
+}
+
+func (q *hookQueue) queue(p Push, run func(Push)) {
+	q.mu.Lock()
+	if q.running {
+		q.next = &p
+		q.mu.Unlock()
+		return
+	}
+	q.running = true
+	q.mu.Unlock()
+
+	go func() {
+		for {
+			run(p)
+			q.mu.Lock()
+			if q.next == nil {
+				q.running = false
+				q.mu.Unlock()
+				return
+			}
+			p, q.next = *q.next, nil
+			q.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// idIndex returns the current graph's table of IDs to names (see
+// callgraph.ID), computing it once per graph.
+func (s *Server) idIndex() (map[string]callgraph.FunctionNode, map[string]string) {
+	s.mu.RLock()
+	graph, ids, gen := s.graph, s.ids, s.gen
+	s.mu.RUnlock()
+	if ids != nil {
+		return graph, ids
+	}
+	ids = callgraph.IDs(graph, s.opts.IDLength)
+	s.mu.Lock()
+	if s.gen == gen {
+		s.ids = ids
+	}
+	s.mu.Unlock()
+	return graph, ids
+}
+
+// handleIDs serves the lookup table from every function's ID to where it
+// is now.
+func (s *Server) handleIDs(w http.ResponseWriter, r *http.Request) {
+	graph, ids := s.idIndex()
+	out := make(map[string]analysis.Location, len(ids))
+	for id, name := range ids {
+		out[id] = analysis.LocationOf(graph, name)
+	}
+	writeJSON(w, out)
+}
+
+// handleID serves where the function with the given ID is now.
+func (s *Server) handleID(w http.ResponseWriter, r *http.Request) {
+	graph, ids := s.idIndex()
+	name, ok := ids[r.PathValue("id")]
+	if !ok {
+		http.Error(w, "unknown function ID "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, analysis.LocationOf(graph, name))
+}
+
+// handlePermalink redirects /f/{id} to the UI with that function
+// selected. The Location is relative, so it works under any base path.
+func (s *Server) handlePermalink(w http.ResponseWriter, r *http.Request) {
+	_, ids := s.idIndex()
+	name, ok := ids[r.PathValue("id")]
+	if !ok {
+		http.Error(w, "unknown function ID "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Location", "../#"+url.Values{"sel": {name}}.Encode())
+	w.WriteHeader(http.StatusFound)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/ingest"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// maxIngestBytes caps the size of an ingested graph.
+const maxIngestBytes = 512 << 20
+
+// handleIngest stores a graph produced by another tool (see package
+// ingest for the format). With ?namespace= its functions are renamed
+// namespace/name and replace only that namespace's previous ones, so a
+// Python graph can sit beside the Go one; without, it replaces the whole
+// graph, or with ?merge= (callgraph.MergeStrategies) is merged into it.
+// Either way a snapshot is recorded, labelled ?label= if given.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	ns := strings.Trim(r.URL.Query().Get("namespace"), "/")
+	if strings.ContainsAny(ns, "*? ") {
+		http.Error(w, "namespace may not contain *, ? or spaces", http.StatusBadRequest)
+		return
+	}
+	merge := r.URL.Query().Get("merge")
+	if merge != "" {
+		if ns != "" {
+			http.Error(w, "merge can't be used with namespace", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(callgraph.MergeStrategies, merge) {
+			http.Error(w, "merge must be one of "+strings.Join(callgraph.MergeStrategies, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	res, err := ingest.Read(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	graph := res.Graph
+	switch {
+	case ns != "":
+		graph = callgraph.Namespace(graph, ns)
+		err = s.store.ReplaceNamespace(ns, graph)
+	case merge != "":
+		_, err = s.store.MergeGraph(graph, merge)
+	default:
+		err = s.store.SaveGraph(graph)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	full, err := s.store.LoadGraph()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = strings.TrimSpace("ingest " + ns + " " + time.Now().UTC().Format(time.RFC3339))
+	}
+	snap, err := s.store.SaveSnapshot(label, full, persistence.Source{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.SetGraph(full)
+	s.opts.Logger.Info("ingested graph", "namespace", ns, "language", res.Language,
+		"functions", len(graph), "dropped", res.Dropped, "snapshot", snap.ID)
+	writeJSON(w, map[string]any{
+		"namespace": ns,
+		"functions": len(graph),
+		"calls":     callgraph.EdgeCount(graph),
+		"dropped":   res.Dropped,
+		"foreign":   res.Foreign,
+		"snapshot":  snap,
+	})
+}
+
+// handleSchema serves the JSON Schema of ingested graphs.
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(ingest.Schema)
+}
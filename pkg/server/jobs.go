@@ -0,0 +1,417 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// Job kinds: a rebuild through Options.Refresh, a diff between snapshots,
+// and an export in any format.
+const (
+	JobBuild  = "build"
+	JobDiff   = "diff"
+	JobExport = "export"
+)
+
+// Job states. Queued and running jobs are active; the others are final.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+const (
+	jobWorkers  = 2   // jobs run at once
+	maxJobs     = 100 // finished jobs kept, oldest forgotten first
+	maxJobQueue = 100 // jobs waiting to run
+)
+
+// Job is a long analysis run in the background for a POST /api/jobs, so
+// the request that started it returns at once. Clients poll
+// /api/jobs/{id}, or watch /api/events for "job" events, and fetch the
+// output from /api/jobs/{id}/result once it has succeeded. Jobs live in
+// memory and are gone when the server restarts.
+type Job struct {
+	ID    int64  `json:"id"`
+	Kind  string `json:"kind"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+	// Params are the kind's parameters: for a diff, "from" and optionally
+	// "to", snapshot references as in "geeparse diff" ("to" defaults to
+	// the served graph); for an export, the query parameters of
+	// /api/export. Builds take none.
+	Params   map[string]string `json:"params,omitempty"`
+	Log      []string          `json:"log,omitempty"`
+	Created  time.Time         `json:"created"`
+	Started  *time.Time        `json:"started,omitempty"`
+	Finished *time.Time        `json:"finished,omitempty"`
+}
+
+type job struct {
+	Job
+	ctx         context.Context
+	cancel      context.CancelFunc
+	result      []byte
+	contentType string
+}
+
+// jobQueue holds the server's jobs, oldest first, and feeds the active
+// ones to a few workers started with the first job.
+type jobQueue struct {
+	mu      sync.Mutex
+	lastID  int64
+	jobs    []*job
+	pending chan *job
+	start   sync.Once
+}
+
+// logf adds a timestamped line to j's log.
+func (q *jobQueue) logf(j *job, format string, args ...any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.Log = append(j.Log, time.Now().UTC().Format("15:04:05.000")+" "+fmt.Sprintf(format, args...))
+}
+
+// find returns the job with the given id, or nil.
+func (q *jobQueue) find(id int64) *job {
+	for _, j := range q.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// prune forgets the oldest finished jobs beyond maxJobs.
+func (q *jobQueue) prune() {
+	finished := 0
+	for _, j := range q.jobs {
+		if j.Finished != nil {
+			finished++
+		}
+	}
+	kept := q.jobs[:0]
+	for _, j := range q.jobs {
+		if j.Finished != nil && finished > maxJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	q.jobs = kept
+}
+
+// submit queues a job, starting the workers on first use.
+func (s *Server) submit(kind string, params map[string]string) (Job, error) {
+	q := &s.jobs
+	q.start.Do(func() {
+		q.pending = make(chan *job, maxJobQueue)
+		for range jobWorkers {
+			go s.work()
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.lastID++
+	j := &job{
+		Job:    Job{ID: q.lastID, Kind: kind, State: JobQueued, Params: params, Log: []string{}, Created: time.Now().UTC()},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	select {
+	case q.pending <- j:
+	default:
+		q.lastID--
+		q.mu.Unlock()
+		cancel()
+		return Job{}, errors.New("too many queued jobs")
+	}
+	q.jobs = append(q.jobs, j)
+	snapshot := j.copy()
+	q.mu.Unlock()
+	s.publishJob(snapshot)
+	return snapshot, nil
+}
+
+// copy returns j's public fields, safe to use without the lock.
+func (j *job) copy() Job {
+	c := j.Job
+	c.Log = append([]string{}, j.Log...)
+	return c
+}
+
+func (s *Server) publishJob(j Job) {
+	s.events.publish(event{Type: "job", Job: j.ID, State: j.State})
+}
+
+// work runs queued jobs until the process exits.
+func (s *Server) work() {
+	q := &s.jobs
+	for j := range q.pending {
+		q.mu.Lock()
+		if j.State != JobQueued { // canceled while waiting
+			q.mu.Unlock()
+			continue
+		}
+		started := time.Now().UTC()
+		j.State, j.Started = JobRunning, &started
+		snapshot := j.copy()
+		q.mu.Unlock()
+		s.publishJob(snapshot)
+		q.logf(j, "started %s", j.Kind)
+
+		result, contentType, err := s.runJob(j)
+
+		q.mu.Lock()
+		finished := time.Now().UTC()
+		j.Finished = &finished
+		switch {
+		case j.ctx.Err() != nil:
+			j.State = JobCanceled
+		case err != nil:
+			j.State, j.Error = JobFailed, err.Error()
+		default:
+			j.State, j.result, j.contentType = JobSucceeded, result, contentType
+		}
+		j.cancel()
+		q.mu.Unlock()
+		q.logf(j, "%s after %s", j.State, finished.Sub(started).Round(time.Millisecond))
+		q.mu.Lock()
+		snapshot = j.copy()
+		q.prune()
+		q.mu.Unlock()
+		s.publishJob(snapshot)
+		s.opts.Logger.Info("job finished", "id", snapshot.ID, "kind", snapshot.Kind, "state", snapshot.State, "err", snapshot.Error)
+	}
+}
+
+// runJob does j's work and returns its output.
+func (s *Server) runJob(j *job) ([]byte, string, error) {
+	logf := func(format string, args ...any) { s.jobs.logf(j, format, args...) }
+	switch j.Kind {
+	case JobBuild:
+		s.rebuilding.Lock()
+		defer s.rebuilding.Unlock()
+		graph, err := s.opts.Refresh(j.ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		summary := map[string]any{"changed": graph != nil}
+		if graph == nil {
+			logf("no changes")
+		} else {
+			s.SetGraph(graph)
+			summary["functions"], summary["calls"] = len(graph), callgraph.EdgeCount(graph)
+			logf("rebuilt: %d functions, %d calls", len(graph), callgraph.EdgeCount(graph))
+		}
+		data, err := json.Marshal(summary)
+		return data, "application/json; charset=utf-8", err
+
+	case JobDiff:
+		old, err := s.snapshotGraph(j.Params["from"])
+		if err != nil {
+			return nil, "", err
+		}
+		graph := s.currentGraph()
+		if to := j.Params["to"]; to != "" {
+			if graph, err = s.snapshotGraph(to); err != nil {
+				return nil, "", err
+			}
+		}
+		res := diff.Compare(old, graph)
+		notes, err := s.store.EdgeNotes()
+		if err != nil {
+			return nil, "", err
+		}
+		res.AttachNotes(notes)
+		logf("%d functions added, %d removed, %d renamed; %d calls added, %d removed",
+			len(res.AddedFunctions), len(res.RemovedFunctions), len(res.RenamedFunctions), len(res.AddedEdges), len(res.RemovedEdges))
+		data, err := json.Marshal(res)
+		return data, "application/json; charset=utf-8", err
+
+	case JobExport:
+		q := make(url.Values, len(j.Params))
+		for k, v := range j.Params {
+			q.Set(k, v)
+		}
+		out, format, _, err := s.renderExport(q)
+		if err != nil {
+			return nil, "", err
+		}
+		logf("rendered %d bytes of %s", len(out), format)
+		return out, export.ContentType(format), nil
+	}
+	return nil, "", fmt.Errorf("unknown job kind %q", j.Kind)
+}
+
+// snapshotGraph loads the graph of the snapshot ref names.
+func (s *Server) snapshotGraph(ref string) (map[string]callgraph.FunctionNode, error) {
+	snap, err := s.store.FindSnapshot(ref)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.LoadSnapshot(snap.ID)
+}
+
+// handleCreateJob starts a job from a {"kind": ..., "params": {...}}
+// body and answers 202 Accepted with it. Builds change what is served, so
+// they take the admin token.
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind   string            `json:"kind"`
+		Params map[string]string `json:"params"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch req.Kind {
+	case JobBuild:
+		if !s.checkAdmin(w, r) {
+			return
+		}
+		if s.opts.Refresh == nil {
+			http.Error(w, "this server has no build configured", http.StatusBadRequest)
+			return
+		}
+	case JobDiff:
+		if req.Params["from"] == "" {
+			http.Error(w, "a diff job needs a from snapshot", http.StatusBadRequest)
+			return
+		}
+	case JobExport:
+	default:
+		http.Error(w, fmt.Sprintf("unknown job kind %q (available: %s, %s, %s)", req.Kind, JobBuild, JobDiff, JobExport), http.StatusBadRequest)
+		return
+	}
+	j, err := s.submit(req.Kind, req.Params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if req.Kind == JobBuild {
+		s.audit(s.actor(r, true), persistence.AuditAPI, "rebuild", fmt.Sprintf("build job #%d", j.ID))
+	}
+	w.Header().Set("Location", "api/jobs/"+strconv.FormatInt(j.ID, 10))
+	writeAccepted(w, j)
+}
+
+// handleListJobs lists the jobs, newest first, optionally only those in
+// ?state=. Logs are left out; fetch a job for its log.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	s.jobs.mu.Lock()
+	out := []Job{}
+	for i := len(s.jobs.jobs) - 1; i >= 0; i-- {
+		if j := s.jobs.jobs[i]; state == "" || j.State == state {
+			c := j.Job
+			c.Log = nil
+			out = append(out, c)
+		}
+	}
+	s.jobs.mu.Unlock()
+	writeJSON(w, out)
+}
+
+// jobFromPath returns the job named by the {id} path parameter, or
+// answers 404 and returns false.
+func (s *Server) jobFromPath(w http.ResponseWriter, r *http.Request) (*job, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.jobs.mu.Lock()
+	j := s.jobs.find(id)
+	s.jobs.mu.Unlock()
+	if err != nil || j == nil {
+		http.Error(w, "unknown job "+r.PathValue("id"), http.StatusNotFound)
+		return nil, false
+	}
+	return j, true
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobFromPath(w, r)
+	if !ok {
+		return
+	}
+	s.jobs.mu.Lock()
+	c := j.copy()
+	s.jobs.mu.Unlock()
+	writeJSON(w, c)
+}
+
+// handleJobResult serves a succeeded job's output: the diff or build
+// summary as JSON, an export in its format (as an attachment with
+// ?download). Other jobs answer 409 Conflict.
+func (s *Server) handleJobResult(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobFromPath(w, r)
+	if !ok {
+		return
+	}
+	s.jobs.mu.Lock()
+	state, result, contentType := j.State, j.result, j.contentType
+	s.jobs.mu.Unlock()
+	if state != JobSucceeded {
+		http.Error(w, fmt.Sprintf("job %d is %s", j.ID, state), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if j.Kind == JobExport && r.URL.Query().Has("download") {
+		format := j.Params["format"]
+		if format == "" {
+			format = "json"
+		}
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="callgraph.%s"`, export.Extension(format)))
+	}
+	w.Write(result)
+}
+
+// handleDeleteJob cancels a queued or running job, or forgets a finished
+// one. A running diff or export can't be interrupted; it finishes and is
+// marked canceled.
+func (s *Server) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobFromPath(w, r)
+	if !ok {
+		return
+	}
+	q := &s.jobs
+	q.mu.Lock()
+	var snapshot *Job
+	state := j.State
+	switch state {
+	case JobQueued:
+		now := time.Now().UTC()
+		j.State, j.Finished = JobCanceled, &now
+		j.cancel()
+		c := j.copy()
+		snapshot = &c
+	case JobRunning:
+		j.cancel()
+	default:
+		for i, other := range q.jobs {
+			if other == j {
+				q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	q.mu.Unlock()
+	if snapshot != nil {
+		s.publishJob(*snapshot)
+	}
+	s.opts.Logger.Info("admin deleted job", "id", j.ID, "state", state)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+)
+
+// handleOutliers serves the functions longer than ?maxStatements= or
+// nested deeper than ?maxNesting= (analysis.DefaultMaxStatements and
+// DefaultMaxNesting; 0 turns a limit off), limited like /api/coupling to
+// ?package=a,b and the packages below them.
+func (s *Server) handleOutliers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limits := map[string]int{"maxStatements": analysis.DefaultMaxStatements, "maxNesting": analysis.DefaultMaxNesting}
+	for param := range limits {
+		if v := q.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid "+param, http.StatusBadRequest)
+				return
+			}
+			limits[param] = n
+		}
+	}
+	var pkgs []string
+	for _, p := range q["package"] {
+		pkgs = append(pkgs, strings.Split(p, ",")...)
+	}
+	writeJSON(w, analysis.Outliers(s.currentGraph(), limits["maxStatements"], limits["maxNesting"], pkgs))
+}
@@ -0,0 +1,13 @@
+package server
+
+import "net/http"
+
+// handleOwners serves the assigned function owners keyed by function name.
+func (s *Server) handleOwners(w http.ResponseWriter, r *http.Request) {
+	owners, err := s.store.Owners()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, owners)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// maxLayoutBytes bounds the body of PUT /api/layout.
+const maxLayoutBytes = 4 << 20
+
+// layoutKey reads whose layout of which graph a /api/layout request is
+// about: ?user= (free text, as annotation authors are) and ?snapshot=, 0
+// or absent for the current graph.
+func layoutKey(r *http.Request) (snapshot int64, user string, err error) {
+	q := r.URL.Query()
+	if v := q.Get("snapshot"); v != "" {
+		snapshot, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || snapshot < 0 {
+			return 0, "", fmt.Errorf("invalid snapshot id %q", v)
+		}
+	}
+	return snapshot, q.Get("user"), nil
+}
+
+// handleLayout serves the node positions saved for a layout, by node id.
+func (s *Server) handleLayout(w http.ResponseWriter, r *http.Request) {
+	snapshot, user, err := layoutKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pos, err := s.store.Positions(snapshot, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, pos)
+}
+
+// handlePutLayout saves the positions in the body, {"node": {"x": 1,
+// "y": 2}, ...}, over those of the same nodes.
+func (s *Server) handlePutLayout(w http.ResponseWriter, r *http.Request) {
+	snapshot, user, err := layoutKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var pos map[string]persistence.Position
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLayoutBytes)).Decode(&pos); err != nil {
+		http.Error(w, "decode positions: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := pos[""]; ok {
+		http.Error(w, "position without a node id", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SavePositions(snapshot, user, pos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResetLayout deletes a layout's positions, back to automatic.
+func (s *Server) handleResetLayout(w http.ResponseWriter, r *http.Request) {
+	snapshot, user, err := layoutKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.ResetPositions(snapshot, user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
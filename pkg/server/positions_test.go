@@ -0,0 +1,50 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+func TestLayoutChangesAreAudited(t *testing.T) {
+	store, err := persistence.NewStore(filepath.Join(t.TempDir(), "graph.db"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	graph := map[string]callgraph.FunctionNode{"main": {Callees: []string{}}}
+	if err := store.SaveGraph(graph); err != nil {
+		t.Fatal(err)
+	}
+	h := New(graph, store, Options{}).handler()
+
+	for _, tt := range []struct {
+		method, body, action string
+	}{
+		{http.MethodPut, `{"main": {"x": 1, "y": 2}}`, "layout.set"},
+		{http.MethodDelete, "", "layout.reset"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/api/layout?user=ana", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s /api/layout: status %d: %s", tt.method, rec.Code, rec.Body)
+		}
+		entries, err := store.AuditLog(persistence.AuditQuery{Action: tt.action})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("%s /api/layout: %d %s audit entries, want 1", tt.method, len(entries), tt.action)
+		}
+		if e := entries[0]; e.Source != persistence.AuditAPI || !strings.HasPrefix(e.Summary, tt.method+" /api/layout") {
+			t.Errorf("%s /api/layout: audit entry %+v", tt.method, e)
+		}
+	}
+}
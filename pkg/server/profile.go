@@ -0,0 +1,23 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// handleProfile serves the imported runtime profile, or 404 if there is
+// none.
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	prof, err := s.store.Profile()
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, prof)
+}
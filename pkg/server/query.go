@@ -0,0 +1,44 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/query"
+)
+
+// handleQuery evaluates ?q=, an expression in the query language, against
+// the current graph. Mistakes in the query are a 400 whose JSON body gives
+// the message and column, so the UI can point at them. Results are all
+// returned at once unless ?limit= asks for pages, walked with ?cursor= as
+// in /api/functions. tag() matches the stored function tags.
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	tags, err := s.store.FunctionTags()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names, err := query.RunTagged(s.currentGraph(), tags, q)
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": qerr.Msg, "pos": qerr.Pos})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, next, err := paginate(names, r, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := map[string]any{"query": q, "results": page}
+	if next != "" {
+		out["nextCursor"] = next
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// options returns the server's options as they stand; Reconfigure may
+// change some while it serves.
+func (s *Server) options() Options {
+	s.optsMu.RLock()
+	defer s.optsMu.RUnlock()
+	return s.opts
+}
+
+// Reconfigure switches the server to the settings of opts that can
+// change while it serves: MaxNodes, MaxEdges, AdminToken, Rules,
+// Thresholds, GitHubSecret, GitHubBranch and RebuildInterval, 0 pausing
+// scheduled rebuilds. Connections stay open and requests already running
+// finish as they started; the other options need a restart and are
+// ignored. It returns the names of the settings that changed.
+func (s *Server) Reconfigure(opts Options) []string {
+	s.optsMu.Lock()
+	defer s.optsMu.Unlock()
+	cur := &s.opts
+	changed := []string{}
+	for _, c := range []struct {
+		name string
+		same bool
+	}{
+		{"MaxNodes", cur.MaxNodes == opts.MaxNodes},
+		{"MaxEdges", cur.MaxEdges == opts.MaxEdges},
+		{"AdminToken", cur.AdminToken == opts.AdminToken},
+		{"Rules", reflect.DeepEqual(cur.Rules, opts.Rules)},
+		{"Thresholds", reflect.DeepEqual(cur.Thresholds, opts.Thresholds)},
+		{"GitHubSecret", cur.GitHubSecret == opts.GitHubSecret},
+		{"GitHubBranch", cur.GitHubBranch == opts.GitHubBranch},
+		{"RebuildInterval", cur.RebuildInterval == opts.RebuildInterval},
+	} {
+		if !c.same {
+			changed = append(changed, c.name)
+		}
+	}
+	cur.MaxNodes, cur.MaxEdges = opts.MaxNodes, opts.MaxEdges
+	cur.AdminToken = opts.AdminToken
+	cur.Rules, cur.Thresholds = opts.Rules, opts.Thresholds
+	cur.GitHubSecret, cur.GitHubBranch = opts.GitHubSecret, opts.GitHubBranch
+	cur.RebuildInterval = opts.RebuildInterval
+	if len(changed) > 0 {
+		// cached graphs were cut to the old budgets
+		s.purgeCache()
+	}
+	if cur.Refresh != nil {
+		// only the latest interval matters to rebuildEvery
+		select {
+		case <-s.reschedule:
+		default:
+		}
+		s.reschedule <- cur.RebuildInterval
+	}
+	return changed
+}
+
+// ReloadConfig re-reads the options through Options.Reconfigure and
+// applies them with Reconfigure.
+func (s *Server) ReloadConfig() ([]string, error) {
+	if s.opts.Reconfigure == nil {
+		return nil, errors.New("this server can't reload its configuration")
+	}
+	opts, err := s.opts.Reconfigure()
+	if err != nil {
+		return nil, err
+	}
+	changed := s.Reconfigure(opts)
+	s.opts.Logger.Info("reloaded configuration", "changed", changed)
+	return changed, nil
+}
+
+// handleReloadConfig reloads the configuration, as SIGHUP does, and
+// lists the settings that changed. A configuration that fails to load
+// leaves the running one in place.
+func (s *Server) handleReloadConfig(w http.ResponseWriter, r *http.Request) {
+	changed, err := s.ReloadConfig()
+	if err != nil {
+		http.Error(w, "reload configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, map[string][]string{"changed": changed})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// rebuildEvery calls Refresh every interval for as long as the process
+// runs, swapping in each changed graph. Reconfigure sends it new
+// intervals; 0 pauses it.
+func (s *Server) rebuildEvery(interval time.Duration) {
+	var (
+		t    *time.Ticker
+		tick <-chan time.Time
+	)
+	for {
+		if t != nil {
+			t.Stop()
+			t, tick = nil, nil
+		}
+		if interval > 0 {
+			s.opts.Logger.Info("rebuilding on a schedule", "interval", interval)
+			t = time.NewTicker(interval)
+			tick = t.C
+		}
+		for changed := false; !changed; {
+			select {
+			case <-tick:
+				s.rebuildOnSchedule()
+			case next := <-s.reschedule:
+				changed = next != interval
+				if changed && next <= 0 {
+					s.opts.Logger.Info("scheduled rebuilds paused")
+				}
+				interval = next
+			}
+		}
+	}
+}
+
+func (s *Server) rebuildOnSchedule() {
+	if !s.rebuilding.TryLock() {
+		s.opts.Logger.Info("scheduled rebuild skipped; another rebuild is running")
+		return
+	}
+	defer s.rebuilding.Unlock()
+	start := time.Now()
+	graph, err := s.opts.Refresh(context.Background())
+	if err != nil {
+		s.opts.Logger.Error("scheduled rebuild failed", "err", err)
+		return
+	}
+	if graph == nil {
+		s.opts.Logger.Debug("scheduled rebuild found no changes", "duration", time.Since(start).Round(time.Millisecond))
+		return
+	}
+	s.SetGraph(graph)
+	s.audit("schedule", persistence.AuditSchedule, "rebuild",
+		fmt.Sprintf("%d functions, %d calls", len(graph), callgraph.EdgeCount(graph)))
+	s.opts.Logger.Info("rebuilt graph on schedule", "duration", time.Since(start).Round(time.Millisecond),
+		"functions", len(graph), "calls", callgraph.EdgeCount(graph))
+}
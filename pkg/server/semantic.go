@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/semantic"
+)
+
+// searchResult is one /api/semantic-search hit.
+type searchResult struct {
+	analysis.Location
+	Score float64 `json:"score"`
+}
+
+// handleSemanticSearch ranks functions by how closely their embeddings
+// match ?q=, a description in plain words; ?limit= caps the results
+// (default 10). It needs an embeddings provider and embeddings computed
+// with the same model by geeparse embed.
+func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Embedder == nil {
+		http.Error(w, "semantic search is off; start the server with --embeddings-provider", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	embeddings, err := s.store.Embeddings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	graph := s.currentGraph()
+	model := s.opts.Embedder.Model()
+	usable := make(map[string]semantic.Embedding)
+	for name, e := range embeddings {
+		if _, ok := graph[name]; ok && e.Model == model {
+			usable[name] = e
+		}
+	}
+	if len(usable) == 0 {
+		http.Error(w, fmt.Sprintf("no %s embeddings stored; run geeparse embed first", model), http.StatusServiceUnavailable)
+		return
+	}
+
+	matches, err := semantic.Search(r.Context(), s.opts.Embedder, q, usable, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	results := []searchResult{}
+	for _, m := range matches {
+		results = append(results, searchResult{Location: analysis.LocationOf(graph, m.Function), Score: m.Score})
+	}
+	writeJSON(w, map[string]any{"query": q, "model": model, "results": results})
+}
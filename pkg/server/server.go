@@ -2,24 +2,387 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
 	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/export"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/policy"
+	"github.com/ishanmadhav/geeparse/pkg/semantic"
 )
 
-// StartServer registers HTTP routes and starts listening on addr (e.g. ":8080").
-func StartServer(addr string, graph map[string]callgraph.FunctionNode) error {
+// Default budgets for a single /graph.json response; large enough for most
+// repos, small enough that the browser stays responsive.
+const (
+	DefaultMaxNodes = 3000
+	DefaultMaxEdges = 10000
+)
+
+// Options configures the HTTP server.
+type Options struct {
+	// MaxNodes and MaxEdges cap how much of the graph one /graph.json
+	// response may carry; bigger graphs are truncated. 0 means unlimited.
+	MaxNodes int
+	MaxEdges int
+
+	// BasePath mounts every route under a prefix (e.g. "/geeparse/") for
+	// serving behind a reverse proxy that doesn't rewrite URLs.
+	BasePath string
+
+	// AdminToken enables the /api/admin/ endpoints and /api/ingest for
+	// requests carrying "Authorization: Bearer <token>". Empty disables
+	// them.
+	AdminToken string
+
+	// TrustedProxies are the networks of the authenticating proxies in
+	// front of the server. The audit log takes the user a request names
+	// in its headers only from these, or with the admin token; other
+	// requests are recorded by client address.
+	TrustedProxies []net.IPNet
+
+	// Rules are the architecture policies whose violations /api/violations
+	// reports and the UI badges.
+	Rules []policy.Rule
+
+	// Thresholds are the limits whose crossings /api/warnings reports.
+	Thresholds policy.Thresholds
+
+	// GitHubSecret enables POST /hooks/github, which accepts GitHub
+	// webhook deliveries signed with this secret and calls Rebuild for
+	// pushes to GitHubBranch (default "main"). The result is served as
+	// soon as it's ready.
+	GitHubSecret string
+	GitHubBranch string
+	Rebuild      func(context.Context, Push) (map[string]callgraph.FunctionNode, error)
+
+	// RebuildInterval makes the server call Refresh on a timer and serve
+	// what it returns; a nil graph means nothing changed. Scheduled,
+	// webhook and job rebuilds never overlap: a tick that finds one
+	// running is skipped. 0 disables it. Refresh also runs build jobs,
+	// which need it.
+	RebuildInterval time.Duration
+	Refresh         func(context.Context) (map[string]callgraph.FunctionNode, error)
+
+	// Reconfigure re-reads the options from wherever they came from, for
+	// ReloadConfig: on SIGHUP and POST /api/admin/config. Nil means the
+	// server can't reload its configuration.
+	Reconfigure func() (Options, error)
+
+	// CacheSize bounds, in bytes, the cache of rendered /graph.json,
+	// /api/query and /api/export responses, which saves re-rendering
+	// them for every browser looking at the same part of the graph.
+	// Entries live at most CacheTTL (0 means DefaultCacheTTL) and never
+	// outlive the graph they were rendered from. 0 disables the cache.
+	CacheSize int
+	CacheTTL  time.Duration
+
+	// IDLength is how many hex digits the stable function IDs of /api/ids
+	// and /f/{id} permalinks have; 0 means callgraph.DefaultIDLength.
+	IDLength int
+	// Embedder enables /api/semantic-search, embedding queries with the
+	// same model as the stored function embeddings. Nil disables it.
+	Embedder semantic.Provider
+
+	// ReadOnly refuses every request that would change the store or the
+	// graph, anything but GET, HEAD and OPTIONS, with 405 Method Not
+	// Allowed: for serving a graph no one is meant to edit, like the
+	// file of serve --from.
+	ReadOnly bool
+
+	// Logger receives startup, admin and (at debug level) request logs;
+	// nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// Server serves the UI and JSON API for one call-graph, backed by the store
+// for anything users can edit (annotations). The graph can be swapped while
+// serving, e.g. when an admin reloads it from disk.
+type Server struct {
+	mu     sync.RWMutex
+	graph  map[string]callgraph.FunctionNode
+	gen    int               // bumped by SetGraph
+	names  []string          // graph's names, sorted on first use
+	ids    map[string]string // graph's IDs to names, on first use
+	cache  *responseCache    // nil without Options.CacheSize
+	store  *persistence.Store
+	opts   Options
+	optsMu sync.RWMutex // guards the fields of opts Reconfigure changes
+	events *broker
+	hooks  hookQueue
+	jobs   jobQueue
+
+	rebuilding sync.Mutex         // held while a webhook or scheduled rebuild runs
+	reschedule chan time.Duration // new RebuildIntervals for rebuildEvery
+}
+
+// New returns a Server for graph. Call ListenAndServe to start it.
+func New(graph map[string]callgraph.FunctionNode, store *persistence.Store, opts Options) *Server {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	s := &Server{graph: graph, store: store, opts: opts, events: newBroker(), reschedule: make(chan time.Duration, 1)}
+	if opts.CacheSize > 0 {
+		s.cache = newResponseCache(opts.CacheSize, opts.CacheTTL)
+	}
+	return s
+}
+
+// StartServer registers HTTP routes and starts listening on addr, either a
+// TCP address (e.g. ":8080") or a unix socket path prefixed with "unix:"
+// (e.g. "unix:/run/geeparse.sock").
+func StartServer(addr string, graph map[string]callgraph.FunctionNode, store *persistence.Store, opts Options) error {
+	return New(graph, store, opts).ListenAndServe(addr)
+}
+
+// ListenAndServe listens on addr (see StartServer) and serves until the
+// listener fails.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	if s.opts.Refresh != nil {
+		go s.rebuildEvery(s.options().RebuildInterval)
+	}
+	base := basePath(s.opts.BasePath)
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		s.opts.Logger.Info("serving call-graph UI", "socket", path, "base", base)
+	} else {
+		s.opts.Logger.Info("serving call-graph UI", "url", "http://localhost"+addr+base)
+	}
+	return http.Serve(ln, s.logRequests(versionHeader(s.readOnly(s.handler()))))
+}
+
+// listen opens a TCP or "unix:" socket listener. A stale socket file left
+// behind by a previous run is removed first.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on unix socket: %w", err)
+	}
+	return ln, nil
+}
+
+// basePath normalises a configured prefix to the "/prefix/" form.
+func basePath(p string) string {
+	p = "/" + strings.Trim(p, "/") + "/"
+	if p == "//" {
+		return "/"
+	}
+	return p
+}
+
+// handler returns the routes mounted under the configured base path. The UI
+// only uses relative URLs, so it works unchanged under any prefix.
+func (s *Server) handler() http.Handler {
+	base := basePath(s.opts.BasePath)
+	if base == "/" {
+		return s.routes()
+	}
 	mux := http.NewServeMux()
+	mux.Handle(base, http.StripPrefix(strings.TrimSuffix(base, "/"), s.routes()))
+	return mux
+}
 
-	// JSON endpoint
-	mux.HandleFunc("/graph.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := json.NewEncoder(w).Encode(graph); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+// readOnly enforces Options.ReadOnly.
+func (s *Server) readOnly(next http.Handler) http.Handler {
+	if !s.opts.ReadOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			http.Error(w, "this server is read-only", http.StatusMethodNotAllowed)
 		}
 	})
+}
+
+// versionHeader stamps every response with the server's version.
+func versionHeader(next http.Handler) http.Handler {
+	v := buildinfo.Version()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Geeparse-Version", v)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequests logs every request at debug level once it's answered.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.opts.Logger.Debug("request", "method", r.Method, "path", r.URL.Path,
+			"status", rec.status, "duration", time.Since(start))
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps server-sent events streaming through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// JSON endpoint
+	mux.HandleFunc("/graph.json", s.cached(s.handleGraph))
+
+	// annotation API
+	mux.HandleFunc("GET /api/annotations", s.handleListAnnotations)
+	mux.HandleFunc("GET /api/functions", s.handleFunctions)
+	mux.HandleFunc("GET /api/functions/{name}/source", s.handleSource)
+
+	// stable function IDs and permalinks by them
+	mux.HandleFunc("GET /api/ids", s.handleIDs)
+	mux.HandleFunc("GET /api/ids/{id}", s.handleID)
+	mux.HandleFunc("GET /f/{id}", s.handlePermalink)
+	mux.HandleFunc("GET /api/functions/{name}/annotation", s.handleGetAnnotation)
+	mux.HandleFunc("PUT /api/functions/{name}/annotation", s.audited("annotation.set", s.handlePutAnnotation))
+	mux.HandleFunc("DELETE /api/functions/{name}/annotation", s.audited("annotation.delete", s.handleDeleteAnnotation))
+	// notes and review status on calls, kept after the call goes so diffs
+	// can report them
+	mux.HandleFunc("GET /api/call-annotations", s.handleListCallAnnotations)
+	mux.HandleFunc("GET /api/functions/{name}/calls/{callee}/annotation", s.handleGetCallAnnotation)
+	mux.HandleFunc("PUT /api/functions/{name}/calls/{callee}/annotation", s.audited("call-annotation.set", s.handlePutCallAnnotation))
+	mux.HandleFunc("DELETE /api/functions/{name}/calls/{callee}/annotation", s.audited("call-annotation.delete", s.handleDeleteCallAnnotation))
+
+	// tags on functions and calls, for people and enrichers alike
+	mux.HandleFunc("GET /api/tags", s.handleListTags)
+	mux.HandleFunc("GET /api/functions/{name}/tags", s.handleGetTags)
+	mux.HandleFunc("PUT /api/functions/{name}/tags/{tag}", s.audited("tag.set", s.handlePutTag))
+	mux.HandleFunc("DELETE /api/functions/{name}/tags/{tag}", s.audited("tag.delete", s.handleDeleteTag))
+	mux.HandleFunc("PUT /api/functions/{name}/calls/{callee}/tags/{tag}", s.audited("tag.set", s.handlePutTag))
+	mux.HandleFunc("DELETE /api/functions/{name}/calls/{callee}/tags/{tag}", s.audited("tag.delete", s.handleDeleteTag))
+
+	// node positions arranged by hand, per user and snapshot
+	mux.HandleFunc("GET /api/layout", s.handleLayout)
+	mux.HandleFunc("PUT /api/layout", s.audited("layout.set", s.handlePutLayout))
+	mux.HandleFunc("DELETE /api/layout", s.audited("layout.reset", s.handleResetLayout))
+
+	// named filters, layouts and roots saved for the whole team
+	mux.HandleFunc("GET /api/views", s.handleListViews)
+	mux.HandleFunc("GET /api/views/{name}", s.handleGetView)
+	mux.HandleFunc("PUT /api/views/{name}", s.audited("view.set", s.handlePutView))
+	mux.HandleFunc("DELETE /api/views/{name}", s.audited("view.delete", s.handleDeleteView))
+
+	// imported test coverage
+	mux.HandleFunc("GET /api/coverage", s.handleCoverage)
+
+	// commits per function (geeparse churn)
+	mux.HandleFunc("GET /api/churn", s.handleChurn)
+
+	// function owners (geeparse owners assign)
+	mux.HandleFunc("GET /api/owners", s.handleOwners)
+
+	// imported runtime profile
+	mux.HandleFunc("GET /api/profile", s.handleProfile)
+
+	// imported trace overlay (geeparse traces)
+	mux.HandleFunc("GET /api/traces", s.handleTraces)
+
+	// live updates
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+
+	// exports in every supported format
+	mux.HandleFunc("GET /api/export", s.cached(s.handleExport))
+
+	// the graph as NDJSON, written as it goes
+	mux.HandleFunc("GET /api/stream", s.handleStream)
+
+	// architecture policy violations
+	mux.HandleFunc("GET /api/violations", s.handleViolations)
+
+	// threshold warnings
+	mux.HandleFunc("GET /api/warnings", s.handleWarnings)
+
+	// what the last build analyzed, and the functions gopls failed on
+	mux.HandleFunc("GET /api/build-report", s.handleBuildReport)
+
+	// calls between packages
+	mux.HandleFunc("GET /api/coupling", s.handleCoupling)
+
+	// exported functions by whether other packages call them
+	mux.HandleFunc("GET /api/api-usage", s.handleAPIUsage)
+
+	// functions too long or too deeply nested
+	mux.HandleFunc("GET /api/outliers", s.handleOutliers)
+
+	// what each entrypoint reaches
+	mux.HandleFunc("GET /api/entrypoints", s.handleEntrypoints)
+
+	// duplicated function bodies
+	mux.HandleFunc("GET /api/clones", s.handleClones)
+
+	// function selection with the query language
+	mux.HandleFunc("GET /api/query", s.cached(s.handleQuery))
+
+	// search by meaning over stored embeddings
+	mux.HandleFunc("GET /api/semantic-search", s.handleSemanticSearch)
+
+	// build information of this server and its store
+	mux.HandleFunc("GET /api/version", s.handleVersion)
+
+	// graphs from other languages and tools, and their schema
+	mux.HandleFunc("POST /api/ingest", s.requireAdmin(s.audited("ingest", s.handleIngest)))
+	mux.HandleFunc("GET /api/schema", s.handleSchema)
+
+	// long-running builds, diffs and exports
+	mux.HandleFunc("POST /api/jobs", s.handleCreateJob)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /api/jobs/{id}/result", s.handleJobResult)
+	mux.HandleFunc("DELETE /api/jobs/{id}", s.requireAdmin(s.audited("job.delete", s.handleDeleteJob)))
+
+	// snapshot listing and admin maintenance
+	mux.HandleFunc("GET /api/snapshots", s.handleListSnapshots)
+	mux.HandleFunc("GET /api/timeline", s.handleTimeline)
+	mux.HandleFunc("DELETE /api/admin/snapshots/{id}", s.requireAdmin(s.audited("snapshot.delete", s.handleDeleteSnapshot)))
+	mux.HandleFunc("POST /api/admin/compact", s.requireAdmin(s.audited("compact", s.handleCompact)))
+	mux.HandleFunc("POST /api/admin/reload", s.requireAdmin(s.audited("reload", s.handleReload)))
+	mux.HandleFunc("POST /api/admin/config", s.requireAdmin(s.audited("config.reload", s.handleReloadConfig)))
+
+	// who changed what, through the API, the CLI and rebuilds
+	mux.HandleFunc("GET /api/audit", s.handleAudit)
+
+	// rebuilds on pushes to GitHub
+	mux.HandleFunc("POST /hooks/github", s.handleGitHubHook)
 
 	// UI endpoint
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -27,8 +390,125 @@ func StartServer(addr string, graph map[string]callgraph.FunctionNode) error {
 		fmt.Fprint(w, indexHTML)
 	})
 
-	fmt.Printf("Serving call-graph UI at http://localhost%s/\n", addr)
-	return http.ListenAndServe(addr, mux)
+	return mux
+}
+
+// currentGraph returns the graph being served right now.
+func (s *Server) currentGraph() map[string]callgraph.FunctionNode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.graph
+}
+
+// SetGraph atomically replaces the graph being served and tells connected
+// browsers to reload it.
+func (s *Server) SetGraph(graph map[string]callgraph.FunctionNode) {
+	s.mu.Lock()
+	s.graph, s.names, s.ids = graph, nil, nil
+	s.gen++
+	s.mu.Unlock()
+	s.purgeCache()
+	s.events.publish(event{Type: "graph", Nodes: len(graph), Edges: callgraph.EdgeCount(graph)})
+}
+
+// handleGraph serves the graph, truncated to the node/edge budget. Clients
+// may ask for a smaller budget (?maxNodes=&maxEdges=) or for the subgraph
+// below specific functions (?roots=a,b) but never exceed the server's limits.
+// Truncation is reported in X-Geeparse-* headers so the body keeps its shape.
+// With ?definitions=false every definition is left empty, typically most of
+// the payload; clients fetch the ones they show from
+// /api/functions/{name}/source. ?generated=collapse or hide collapses or
+// drops generated code, and ?kinds=go,defer keeps only calls of those
+// kinds, before roots are followed and the graph truncated, as
+// export.Filter does. ?fields=callees,signature keeps only those fields of
+// each function.
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fields, err := parseFields(r, nodeFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := s.options()
+	maxNodes := budget(opts.MaxNodes, q.Get("maxNodes"))
+	maxEdges := budget(opts.MaxEdges, q.Get("maxEdges"))
+	var roots []string
+	if v := q.Get("roots"); v != "" {
+		roots = strings.Split(v, ",")
+	}
+
+	kinds, err := callgraph.ParseKinds(q["kinds"]...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	graph, err := export.Filter{Kinds: kinds, Generated: q.Get("generated")}.Apply(s.currentGraph())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, truncated := callgraph.Truncate(graph, roots, maxNodes, maxEdges)
+	if full, err := strconv.ParseBool(q.Get("definitions")); err == nil && !full {
+		trimmed := make(map[string]callgraph.FunctionNode, len(out))
+		for name, fn := range out {
+			fn.Definition = ""
+			trimmed[name] = fn
+		}
+		out = trimmed
+	}
+	w.Header().Set("X-Geeparse-Total-Nodes", strconv.Itoa(len(graph)))
+	w.Header().Set("X-Geeparse-Total-Edges", strconv.Itoa(callgraph.EdgeCount(graph)))
+	w.Header().Set("X-Geeparse-Truncated", strconv.FormatBool(truncated))
+	if fields == nil {
+		writeJSON(w, out)
+		return
+	}
+	sparse, err := sparseGraph(out, fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, sparse)
+}
+
+// handleViolations checks the current graph against the configured rules.
+func (s *Server) handleViolations(w http.ResponseWriter, r *http.Request) {
+	violations := policy.Check(s.currentGraph(), s.options().Rules)
+	if violations == nil {
+		violations = []policy.Violation{}
+	}
+	writeJSON(w, violations)
+}
+
+// handleWarnings checks the current graph against the configured
+// thresholds.
+func (s *Server) handleWarnings(w http.ResponseWriter, r *http.Request) {
+	warnings := policy.Warn(s.currentGraph(), s.options().Thresholds)
+	if warnings == nil {
+		warnings = []policy.Warning{}
+	}
+	writeJSON(w, warnings)
+}
+
+// budget returns the smaller of the server limit and a client-requested
+// one, treating 0 (or an unparsable request) as "no limit".
+func budget(limit int, requested string) int {
+	n, err := strconv.Atoi(requested)
+	if err != nil || n <= 0 {
+		return limit
+	}
+	if limit > 0 && n > limit {
+		return limit
+	}
+	return n
+}
+
+// writeJSON encodes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // indexHTML is our D3-based browser UI, with cycle detection baked in.
@@ -41,75 +521,1435 @@ const indexHTML = `<!DOCTYPE html>
   <title>Call Hierarchy</title>
   <script src="https://d3js.org/d3.v7.min.js"></script>
   <style>
-    .node circle { fill: #fff; stroke: steelblue; stroke-width: 3px; }
-    .link { fill: none; stroke: #ccc; stroke-width: 2px; }
-    text { font: 12px sans-serif; }
+    /* Theme variables: override these (or add a [data-theme] block) to restyle the UI. */
+    :root, [data-theme="light"] {
+      --bg: #fff; --fg: #222; --muted: #666;
+      --panel-bg: #f9f9f9; --panel-border: #ccc;
+      --node-fill: #fff; --node-stroke: steelblue;
+      --link: #ccc; --arrow: #999; --accent: orange;
+      --danger: #c62828; --traced: #00897b; --noted: #8e24aa;
+      --font: 12px sans-serif;
+    }
+    [data-theme="dark"] {
+      --bg: #1e1f22; --fg: #ddd; --muted: #999;
+      --panel-bg: #2b2d31; --panel-border: #444;
+      --node-fill: #1e1f22; --node-stroke: #6ea8dc;
+      --link: #555; --arrow: #888; --accent: #f0a030;
+      --danger: #ef5350; --traced: #4db6ac; --noted: #ba68c8;
+    }
+    body { margin:0; overflow:hidden; background: var(--bg); color: var(--fg); }
+    .node circle { fill: var(--node-fill); stroke: var(--node-stroke); stroke-width: 3px; }
+    .link { fill: none; stroke: var(--link); stroke-width: 2px; }
+    .arrow { fill: var(--arrow); }
+    .hull { fill-opacity: 0.12; stroke-opacity: 0.5; stroke-width: 1.5px; cursor: pointer; }
+    .selected circle { stroke: var(--accent) !important; stroke-width: 4px; }
+    .cluster circle { fill-opacity: 0.85; stroke: var(--bg); stroke-width: 2px; cursor: pointer; }
+    text { font: var(--font); fill: var(--fg); }
+    #filter.invalid { border-color: var(--danger); outline-color: var(--danger); }
+    .badge { background: var(--danger); color: #fff; border: none; border-radius: 9px; padding: 1px 8px; cursor: pointer; }
+    .link.violation { stroke: var(--danger); }
+    .link.heuristic { stroke-dasharray: 4 3; }
+    .link.traced { stroke: var(--traced); }
+    .node.incomplete circle { stroke-dasharray: 2 2; }
+    .warn { color: var(--danger); }
+    .link.untraced { stroke-opacity: 0.25; }
+    .link.noted { stroke: var(--noted); cursor: pointer; }
+    .link.foreign { stroke-dasharray: 1 4; stroke-linecap: round; stroke-width: 3px; }
+    #language-legend span { margin-right: 6px; cursor: pointer; }
+    .node:focus, .cluster:focus { outline: none; }
+    .node:focus circle, .cluster:focus circle { stroke: var(--accent); stroke-width: 5px; stroke-dasharray: 3 2; }
+    :focus-visible { outline: 2px solid var(--accent); outline-offset: 2px; }
+    input, select, button { background: var(--bg); color: var(--fg); border: 1px solid var(--panel-border); }
+    #toolbar {
+      position:absolute; top:10px; left:10px;
+      background: var(--panel-bg); padding:6px 10px; border:1px solid var(--panel-border);
+      font: var(--font);
+    }
+    #banner {
+      position:absolute; bottom:10px; left:10px; right:330px;
+      background: #fff3cd; color: #664d03; padding:6px 10px; border:1px solid #e6c65c;
+      font: var(--font); display:none;
+    }
+    #timeline {
+      position:absolute; bottom:10px; left:10px; right:330px;
+      background: var(--panel-bg); padding:6px 10px; border:1px solid var(--panel-border);
+      font: var(--font); display:none;
+    }
+    #tl-slider { width: 40%; vertical-align: middle; }
+    .tl .node circle, .tl .link { transition: opacity 0.6s, stroke 0.6s; }
+    .tl .appeared circle { stroke: #2e7d32; }
+    .tl .link.appeared { stroke: #2e7d32; }
+    .tl .vanished circle { stroke: var(--danger); }
+    .tl .link.vanished { stroke: var(--danger); }
+    #coupling {
+      position:absolute; top:60px; left:10px; right:330px; bottom:10px; overflow:auto;
+      background: var(--panel-bg); padding:6px 10px; border:1px solid var(--panel-border);
+      font: var(--font); display:none;
+    }
+    #coupling table { border-collapse: collapse; font-size: 11px; }
+    #coupling td { text-align: right; min-width: 1.8em; padding: 1px 3px; border: 1px solid var(--panel-border); }
+    #coupling td.diag { color: var(--muted); }
+    #coupling th { font-weight: normal; text-align: left; white-space: nowrap; padding: 1px 4px; }
+    #coupling th.col { writing-mode: vertical-rl; transform: rotate(180deg); }
     #info-panel {
       position:absolute; top:10px; right:10px;
       width:300px; max-height:90vh; overflow:auto;
-      background:#f9f9f9; padding:10px; border:1px solid #ccc;
+      background: var(--panel-bg); padding:10px; border:1px solid var(--panel-border);
     }
   </style>
 </head>
 <body>
-<div id="info-panel"><i>Click a node to see details</i></div>
+<div id="toolbar" role="toolbar" aria-label="Graph controls">
+  <label>Layout
+    <select id="layout">
+      <option value="tree">Call tree</option>
+      <option value="packages">Packages</option>
+    </select>
+  </label>
+  <label id="direction-control" title="Follow calls from the roots to their callees, or from a function back to its callers">Show
+    <select id="direction">
+      <option value="callees">Callees</option>
+      <option value="callers">Callers</option>
+    </select>
+  </label>
+  <label title="Filters, layouts and roots the team saved">View
+    <select id="views">
+      <option value="">None</option>
+    </select>
+  </label>
+  <button id="save-view" title="Save the current filter, layout and roots as a view for everyone">Save view…</button>
+  <button id="delete-view" style="display:none">Delete view</button>
+  <input id="filter" type="search" placeholder="Filter functions (/)" size="16" aria-label="Filter functions"
+    aria-describedby="filter-error">
+  <span id="filter-error" role="status" style="color: var(--danger)"></span>
+  <label>Depth <input id="depth" type="number" min="0" value="0" style="width:3em"></label>
+  <button id="expand-all">Expand all</button>
+  <button id="collapse-all">Collapse all</button>
+  <button id="reset-layout" style="display:none" title="Forget where you dragged nodes and lay them out automatically again">Reset layout</button>
+  <label>Theme
+    <select id="theme">
+      <option value="auto">Auto</option>
+      <option value="light">Light</option>
+      <option value="dark">Dark</option>
+    </select>
+  </label>
+  <label>Editor
+    <select id="editor">
+      <option value="vscode">VS Code</option>
+      <option value="jetbrains">JetBrains</option>
+      <option value="custom">Custom…</option>
+    </select>
+  </label>
+  <span>Export
+    <button id="export-svg">SVG</button>
+    <button id="export-png">PNG</button>
+  </span>
+  <label id="coverage-control" style="display:none" title="Color functions by test coverage"><input id="coverage-toggle" type="checkbox"> Coverage</label>
+  <label id="churn-control" style="display:none" title="Ring functions by how many commits changed them; the much-called ones are the danger zones"><input id="churn-toggle" type="checkbox"> Churn</label>
+  <label id="hot-control" style="display:none" title="Draw calls thicker the more runtime cost flows through them"><input id="hot-toggle" type="checkbox"> Hot paths</label>
+  <label id="traced-control" style="display:none" title="Highlight the calls imported traces observed and dim the rest"><input id="traced-toggle" type="checkbox"> Traced paths</label>
+  <label id="languages-control" style="display:none" title="Ring functions by source language; click a language to show only its functions"><input id="languages-toggle" type="checkbox"> Languages <span id="language-legend"></span></label>
+  <label id="generated-control" style="display:none" title="Show each package's generated protobuf, mock or other code as one node"><input id="generated-toggle" type="checkbox"> Collapse generated</label>
+  <button id="coupling-open" title="Calls between packages as a heatmap">Coupling</button>
+  <button id="timeline-open" style="display:none" title="Animate the graph across the stored snapshots">Timeline</button>
+  <button id="violations" class="badge" style="display:none" aria-live="polite"></button>
+  <span title="Keys: arrows move between callers/callees/siblings, / search, f fit, Enter select, Esc clear">⌨</span>
+</div>
+<div id="banner" role="alert"></div>
+<div id="timeline" role="region" aria-label="Snapshot timeline">
+  <button id="tl-play" aria-label="Play">▶</button>
+  <input id="tl-slider" type="range" min="0" max="0" value="0" step="1" aria-label="Snapshot">
+  <span id="tl-label" aria-live="polite"></span>
+  <label title="Show packages instead of functions"><input id="tl-packages" type="checkbox"> Packages</label>
+  <button id="tl-close">Close</button>
+</div>
+<div id="coupling" role="dialog" aria-label="Package coupling">
+  <button id="coupling-close" style="float:right">Close</button>
+  <div>Calls from each row's package to each column's; darker cells couple more tightly.</div>
+  <div id="coupling-matrix"></div>
+</div>
+<div id="info-panel" role="region" aria-label="Function details" aria-live="polite"><i>Click a node to see details</i></div>
+<svg id="canvas" role="application" aria-label="Call graph. Tab to a node, then use arrow keys to move between callers and callees."></svg>
 <script>
-fetch('/graph.json')
-  .then(r => r.json())
-  .then(graph => drawTree(graph))
+// state is the whole view, mirrored into location.hash so a copied URL
+// reopens the same selection, filters, layout and zoom.
+const state = { layout: 'tree', dir: 'callees', target: null, collapsed: new Set(), selected: null, filter: '', depth: 0, roots: '', coverage: false, churn: false, hot: false, traced: false, langs: false, gen: false, zoom: d3.zoomIdentity };
+let graph = {};
+let annotations = {};
+// callNotes holds the notes left on calls, by callKey.
+let callNotes = {};
+let coverage = {};
+let churn = {};
+let owners = {};
+let heat = {};
+let traced = {};
+let callers = {};
+let viewport = null;
+let navParent = null;
+let truncation = null;
+let violations = [];
+let incomplete = {};
+let unexplored = new Set();
+// positions holds where this user dragged nodes of the packages view, by
+// node id; dragged nodes stay put.
+let positions = {};
+let queryHits = null;
+let queryTimer = null;
+let timeline = null;
+let views = [];
+
+// generated code is collapsed server-side, so the hash has to say so
+// before the first fetch
+state.gen = new URLSearchParams(location.hash.slice(1)).get('gen') === '1';
+Promise.all([
+  fetchGraph(new URLSearchParams(location.hash.slice(1)).get('roots')),
+  fetch('api/annotations').then(r => r.ok ? r.json() : {}),
+  fetch('api/coverage').then(r => r.ok ? r.json() : {}),
+  fetch('api/profile').then(r => r.ok ? r.json() : null),
+  fetch('api/owners').then(r => r.ok ? r.json() : {}),
+  fetch('api/traces').then(r => r.ok ? r.json() : null),
+  fetch('api/churn').then(r => r.ok ? r.json() : {}),
+  fetch(layoutURL()).then(r => r.ok ? r.json() : {}),
+  fetch('api/call-annotations').then(r => r.ok ? r.json() : []),
+])
+  .then(([g, anns, cov, prof, own, tr, ch, pos, notes]) => {
+    graph = g;
+    annotations = anns;
+    notes.forEach(a => { callNotes[callKey(a.caller, a.callee)] = a; });
+    coverage = cov;
+    owners = own;
+    churn = ch;
+    positions = pos;
+    d3.select('#coverage-control').style('display', Object.keys(cov).length ? null : 'none');
+    d3.select('#churn-control').style('display', Object.keys(ch).length ? null : 'none');
+    indexHeat(prof);
+    indexTraces(tr);
+    indexCallers();
+    readHash();
+    render();
+    if (isQuery(state.filter)) runQuery();
+  })
   .catch(err => { document.body.innerText = 'Error loading graph: ' + err; });
+fetchViolations();
+fetchBuildReport();
+fetchViews();
+fetch('api/snapshots').then(r => r.ok ? r.json() : []).then(snaps => {
+  d3.select('#timeline-open').style('display', snaps.length > 1 ? null : 'none');
+});
 
-function drawTree(graph) {
+// fetchViolations loads the architecture rule violations for the badge and
+// re-renders so offending calls are highlighted.
+function fetchViolations() {
+  return fetch('api/violations')
+    .then(r => r.ok ? r.json() : [])
+    .then(v => {
+      violations = v;
+      d3.select('#violations')
+        .style('display', v.length ? null : 'none')
+        .text(v.length + (v.length === 1 ? ' violation' : ' violations'))
+        .attr('title', 'Calls breaking architecture rules (click for the list)');
+      if (viewport) render();
+    });
+}
+
+// fetchBuildReport loads the functions gopls failed on in the last
+// build, and those a sampled build left unanalyzed: their calls may be
+// incomplete, so their nodes are drawn dashed.
+function fetchBuildReport() {
+  return fetch('api/build-report')
+    .then(r => r.ok ? r.json() : {})
+    .then(rep => {
+      incomplete = rep.incomplete || {};
+      unexplored = new Set(rep.unexplored || []);
+      if (viewport) render();
+    });
+}
+
+// fetchViews lists the views saved on the server in the view menu.
+function fetchViews() {
+  return fetch('api/views')
+    .then(r => r.ok ? r.json() : [])
+    .then(v => {
+      views = v;
+      d3.select('#views').selectAll('option.view').data(views).join('option')
+        .attr('class', 'view')
+        .attr('value', v => v.name)
+        .attr('title', v => v.description || null)
+        .text(v => v.name);
+    });
+}
+
+// applyView switches to a saved view's filter and layout, reloading the
+// graph when the view is rooted elsewhere.
+function applyView(v) {
+  state.layout = v.layout || 'tree';
+  state.dir = 'callees';
+  state.target = null;
+  state.filter = v.filter || '';
+  state.zoom = d3.zoomIdentity;
+  queryHits = null;
+  const roots = (v.roots || []).join(',');
+  if (roots === state.roots) {
+    runQuery();
+    return;
+  }
+  refocus(roots).then(() => { if (isQuery(state.filter)) runQuery(); });
+}
+
+function isViolation(caller, callee) {
+  return violations.some(v => v.caller === caller && v.callee === callee);
+}
+
+function showViolations() {
+  d3.select('#info-panel').html(
+    '<h3>' + violations.length + ' rule violations</h3>' +
+    '<ul>' + violations.map((v, i) =>
+      '<li><a href="#" data-i="' + i + '">' + esc(v.caller) + ' → ' + esc(v.callee) + '</a><br><small>' +
+      esc(v.rule) + (v.reason ? ': ' + esc(v.reason) : '') + '</small></li>').join('') + '</ul>');
+  d3.selectAll('#info-panel a[data-i]').on('click', function(e) {
+    e.preventDefault();
+    const v = violations[+this.dataset.i];
+    if (graph[v.caller]) focusNode(v.caller);
+  });
+}
+d3.select('#violations').on('click', showViolations);
+
+// fetchGraph loads /graph.json (optionally only below roots) and raises the
+// truncation banner when the server cut the graph down to its budget.
+// Definitions are left out; showFunction fetches the one it shows, and
+// generated code comes collapsed into proxy nodes when state.gen is set.
+function fetchGraph(roots) {
+  state.roots = roots || '';
+  return fetch('graph.json?definitions=false' + (roots ? '&roots=' + encodeURIComponent(roots) : '') +
+    (state.gen ? '&generated=collapse' : ''))
+    .then(r => r.json().then(g => {
+      truncation = r.headers.get('X-Geeparse-Truncated') === 'true' ? {
+        nodes: Object.keys(g).length,
+        totalNodes: +r.headers.get('X-Geeparse-Total-Nodes'),
+        edges: Object.values(g).reduce((n, f) => n + f.callees.length, 0),
+        totalEdges: +r.headers.get('X-Geeparse-Total-Edges'),
+      } : null;
+      return g;
+    }));
+}
+
+function updateBanner() {
+  const banner = d3.select('#banner');
+  if (timeline || (!truncation && !state.roots)) {
+    banner.style('display', 'none');
+    return;
+  }
+  banner.style('display', null).html(
+    (truncation
+      ? 'Graph truncated to the server budget: showing ' + truncation.nodes + ' of ' + truncation.totalNodes +
+        ' functions and ' + truncation.edges + ' of ' + truncation.totalEdges + ' edges. '
+      : 'Showing only functions reachable from ' + esc(state.roots) + '. ') +
+    (state.selected && state.selected !== state.roots ? '<button id="banner-focus">Focus on ' + esc(state.selected) + '</button> ' : '') +
+    (state.roots ? '<button id="banner-all">Show whole graph</button>' : ''));
+  banner.select('#banner-focus').on('click', () => refocus(state.selected));
+  banner.select('#banner-all').on('click', () => refocus(''));
+}
+
+// refocus reloads the graph rooted at roots ('' for the default view).
+function refocus(roots) {
+  return fetchGraph(roots).then(g => {
+    graph = g;
+    indexCallers();
+    if (state.selected && !graph[state.selected]) state.selected = null;
+    state.collapsed = new Set(packages());
+    render();
+  });
+}
+
+// reload refetches the graph but keeps the current view state.
+function reload() {
+  return fetchGraph(state.roots).then(g => {
+    graph = g;
+    indexCallers();
+    if (state.selected && !graph[state.selected]) state.selected = null;
+    render();
+    if (isQuery(state.filter)) runQuery();
+  });
+}
+
+// live rebuilds (watch mode, admin reload) push a "graph" event
+if (window.EventSource) {
+  new EventSource('api/events').addEventListener('graph', () => {
+    reload();
+    fetchViolations();
+    fetchBuildReport();
+  });
+}
+
+// indexHeat turns the runtime profile's per-call cost into 0-1 weights
+// relative to the hottest call.
+function indexHeat(prof) {
+  heat = {};
+  const edges = prof && prof.edges || [];
+  d3.select('#hot-control').style('display', edges.length ? null : 'none');
+  if (!edges.length || edges[0].value <= 0) return;
+  edges.forEach(e => { (heat[e.caller] = heat[e.caller] || {})[e.callee] = e.value / edges[0].value; });
+}
+
+function heatOf(caller, callee) {
+  return state.hot && heat[caller] ? heat[caller][callee] || 0 : 0;
+}
+
+// indexTraces keeps the imported traces' observed calls and span counts;
+// traced.calls[caller][callee] is how often a call was seen.
+function indexTraces(tr) {
+  traced = { calls: {}, functions: tr && tr.functions || {} };
+  const calls = tr && tr.calls || [];
+  d3.select('#traced-control').style('display', calls.length ? null : 'none');
+  calls.forEach(c => { (traced.calls[c.caller] = traced.calls[c.caller] || {})[c.callee] = c.count; });
+}
+
+// tracedClass says how the traced-paths view draws a call: 'traced' if
+// the traces observed it, 'untraced' if not, null with the view off.
+function tracedClass(caller, callee) {
+  if (!state.traced) return null;
+  return traced.calls[caller] && traced.calls[caller][callee] ? 'traced' : 'untraced';
+}
+
+function indexCallers() {
+  callers = {};
+  Object.entries(graph).forEach(([caller, n]) => n.callees.forEach(c => (callers[c] = callers[c] || []).push(caller)));
+}
+
+d3.select('#layout').on('change', function() { state.layout = this.value; state.zoom = d3.zoomIdentity; render(); });
+d3.select('#direction').on('change', function() {
+  state.dir = this.value;
+  state.target = state.dir === 'callers' ? state.selected : null;
+  state.zoom = d3.zoomIdentity;
+  render();
+});
+d3.select('#filter').on('input', function() {
+  state.filter = this.value;
+  clearTimeout(queryTimer);
+  if (isQuery(state.filter)) {
+    queryTimer = setTimeout(runQuery, 250);
+  } else {
+    runQuery();
+  }
+});
+d3.select('#views').on('change', function() {
+  const v = views.find(v => v.name === this.value);
+  d3.select('#delete-view').style('display', v ? null : 'none');
+  if (v) applyView(v);
+});
+d3.select('#save-view').on('click', () => {
+  const name = prompt('Save the current filter, layout and roots as the view:', d3.select('#views').property('value'));
+  if (!name) return;
+  const old = views.find(v => v.name === name);
+  const description = prompt('What the view shows (optional):', old ? old.description || '' : '');
+  if (description === null) return;
+  fetch('api/views/' + encodeURIComponent(name), {
+    method: 'PUT',
+    headers: signed({ 'Content-Type': 'application/json' }),
+    body: JSON.stringify({
+      description: description,
+      filter: state.filter,
+      layout: state.layout,
+      roots: state.roots ? state.roots.split(',') : [],
+      author: localStorage.getItem('geeparse-author') || '',
+    }),
+  })
+    .then(r => r.ok ? fetchViews() : r.text().then(t => Promise.reject(t)))
+    .then(() => {
+      d3.select('#views').property('value', name);
+      d3.select('#delete-view').style('display', null);
+    })
+    .catch(err => alert('Saving view failed: ' + err));
+});
+d3.select('#delete-view').on('click', () => {
+  const name = d3.select('#views').property('value');
+  if (!name || !confirm('Delete the view ' + name + ' for everyone?')) return;
+  fetch('api/views/' + encodeURIComponent(name), { method: 'DELETE', headers: signed({}) })
+    .then(r => r.ok ? fetchViews() : Promise.reject(r.statusText))
+    .then(() => {
+      d3.select('#views').property('value', '');
+      d3.select('#delete-view').style('display', 'none');
+    })
+    .catch(err => alert('Deleting view failed: ' + err));
+});
+d3.select('#depth').on('input', function() { state.depth = Math.max(0, +this.value || 0); render(); });
+d3.select('#hot-toggle').on('change', function() { state.hot = this.checked; render(); });
+d3.select('#traced-toggle').on('change', function() { state.traced = this.checked; render(); });
+d3.select('#coverage-toggle').on('change', function() { state.coverage = this.checked; render(); });
+d3.select('#churn-toggle').on('change', function() { state.churn = this.checked; render(); });
+d3.select('#languages-toggle').on('change', function() { state.langs = this.checked; render(); });
+d3.select('#generated-toggle').on('change', function() { state.gen = this.checked; reload(); });
+d3.select('#expand-all').on('click', () => { state.collapsed.clear(); render(); });
+d3.select('#collapse-all').on('click', () => { state.collapsed = new Set(packages()); render(); });
+d3.select('#reset-layout').on('click', () => {
+  fetch(layoutURL(), { method: 'DELETE' }).then(r => {
+    if (!r.ok) return;
+    positions = {};
+    render();
+  });
+});
+
+// signed adds the name this user signs their notes with to the headers
+// of a change, for the server's audit log.
+function signed(headers) {
+  const name = localStorage.getItem('geeparse-author');
+  if (name) headers['X-Geeparse-User'] = encodeURIComponent(name);
+  return headers;
+}
+
+// layoutURL is where the positions of this user's layout are kept; users
+// are the names they sign annotations with.
+function layoutURL() { return 'api/layout?user=' + encodeURIComponent(localStorage.getItem('geeparse-author') || ''); }
+
+// savePosition pins a dragged node where it was dropped, for this user.
+function savePosition(d) {
+  positions[d.id] = { x: d.fx, y: d.fy };
+  fetch(layoutURL(), { method: 'PUT', body: JSON.stringify({ [d.id]: positions[d.id] }) });
+  d3.select('#reset-layout').style('display', null);
+}
+// theme preference is per browser rather than part of the shared permalink
+const darkQuery = matchMedia('(prefers-color-scheme: dark)');
+function applyTheme() {
+  const pref = localStorage.getItem('geeparse-theme') || 'auto';
+  d3.select('#theme').property('value', pref);
+  document.documentElement.dataset.theme = pref === 'auto' ? (darkQuery.matches ? 'dark' : 'light') : pref;
+}
+d3.select('#theme').on('change', function() { localStorage.setItem('geeparse-theme', this.value); applyTheme(); });
+darkQuery.addEventListener('change', applyTheme);
+applyTheme();
+
+// editor links are built from a URL template with {file} and {line}
+// placeholders; "custom" lets each user supply their own.
+const editorTemplates = {
+  vscode: 'vscode://file{file}:{line}',
+  jetbrains: 'idea://open?file={file}&line={line}',
+};
+function editorURL(file, line) {
+  const kind = localStorage.getItem('geeparse-editor') || 'vscode';
+  const tpl = kind === 'custom' ? localStorage.getItem('geeparse-editor-template') || '' : editorTemplates[kind];
+  if (!tpl || !file) return null;
+  // Windows paths need a leading slash to form a valid URL path
+  const path = /^[A-Za-z]:/.test(file) ? '/' + file.replace(/\\/g, '/') : file;
+  return tpl.split('{file}').join(encodeURI(path)).split('{line}').join(line || 1);
+}
+d3.select('#editor')
+  .property('value', localStorage.getItem('geeparse-editor') || 'vscode')
+  .on('change', function() {
+    if (this.value === 'custom') {
+      const tpl = prompt('Editor URL template ({file} and {line} are substituted):',
+        localStorage.getItem('geeparse-editor-template') || 'myeditor://open?path={file}&line={line}');
+      if (tpl === null) { this.value = localStorage.getItem('geeparse-editor') || 'vscode'; return; }
+      localStorage.setItem('geeparse-editor-template', tpl);
+    }
+    localStorage.setItem('geeparse-editor', this.value);
+    if (state.selected) showFunction(state.selected);
+  });
+
+window.addEventListener('hashchange', () => {
+  if (location.hash.slice(1) === hashString()) return;
+  const gen = state.gen;
+  readHash();
+  if (state.gen !== gen) {
+    reload();
+    return;
+  }
+  render();
+  if (isQuery(state.filter)) runQuery();
+});
+
+function readHash() {
+  const p = new URLSearchParams(location.hash.slice(1));
+  state.layout = p.get('layout') === 'packages' ? 'packages' : 'tree';
+  state.dir = p.get('dir') === 'callers' ? 'callers' : 'callees';
+  state.target = state.dir === 'callers' && graph[p.get('of')] ? p.get('of') : null;
+  state.selected = graph[p.get('sel')] ? p.get('sel') : null;
+  state.filter = p.get('filter') || '';
+  state.depth = Math.max(0, +p.get('depth') || 0);
+  state.coverage = p.get('cov') === '1';
+  state.churn = p.get('churn') === '1';
+  state.hot = p.get('hot') === '1';
+  state.traced = p.get('traced') === '1';
+  state.langs = p.get('langs') === '1';
+  state.gen = p.get('gen') === '1';
+  // packages view starts fully collapsed: packages first, then functions
+  const open = new Set((p.get('open') || '').split(',').filter(Boolean));
+  state.collapsed = new Set(packages().filter(pkg => !open.has(pkg)));
+  const z = (p.get('zoom') || '').split(',').map(Number);
+  state.zoom = z.length === 3 && z.every(isFinite) && z[0] > 0
+    ? d3.zoomIdentity.translate(z[1], z[2]).scale(z[0])
+    : d3.zoomIdentity;
+}
+
+function hashString() {
+  const p = new URLSearchParams();
+  p.set('layout', state.layout);
+  if (state.dir === 'callers') p.set('dir', 'callers');
+  if (state.target) p.set('of', state.target);
+  if (state.selected) p.set('sel', state.selected);
+  if (state.filter) p.set('filter', state.filter);
+  if (state.depth) p.set('depth', state.depth);
+  if (state.coverage) p.set('cov', '1');
+  if (state.churn) p.set('churn', '1');
+  if (state.hot) p.set('hot', '1');
+  if (state.traced) p.set('traced', '1');
+  if (state.langs) p.set('langs', '1');
+  if (state.gen) p.set('gen', '1');
+  const open = packages().filter(pkg => !state.collapsed.has(pkg));
+  if (open.length) p.set('open', open.join(','));
+  if (state.roots) p.set('roots', state.roots);
+  const t = state.zoom;
+  if (t.k !== 1 || t.x || t.y) p.set('zoom', [+t.k.toFixed(3), Math.round(t.x), Math.round(t.y)].join(','));
+  return p.toString();
+}
+
+function writeHash() {
+  history.replaceState(null, '', '#' + hashString());
+}
+
+// isQuery tells a query-language expression, such as
+// callers(SaveGraph) & pkg(persistence), from a plain substring filter.
+function isQuery(f) { return /[()&|!]/.test(f); }
+
+// runQuery has the server evaluate a query-language filter, then draws
+// what it selects. Replies to queries the user has since edited are
+// dropped, and a broken query leaves the last good selection showing.
+function runQuery() {
+  const q = state.filter;
+  if (!isQuery(q)) {
+    queryHits = null;
+    showFilterError('');
+    render();
+    return;
+  }
+  fetch('api/query?q=' + encodeURIComponent(q))
+    .then(r => r.json().then(body => ({ ok: r.ok, body: body })))
+    .then(res => {
+      if (state.filter !== q) return;
+      if (!res.ok) {
+        showFilterError(res.body.error + ' (column ' + res.body.pos + ')');
+        return;
+      }
+      queryHits = new Set(res.body.results);
+      showFilterError('');
+      render();
+    });
+}
+
+function showFilterError(msg) {
+  d3.select('#filter').classed('invalid', !!msg).attr('aria-invalid', msg ? 'true' : null);
+  d3.select('#filter-error').text(msg);
+}
+
+// matches reports whether name passes the filter box: a substring of the
+// function or package name, "owner:NAME" for functions NAME owns,
+// "lang:NAME" for functions in language NAME, or a query-language
+// expression.
+function matches(name) {
+  if (isQuery(state.filter)) return !queryHits || queryHits.has(name);
+  const f = state.filter.toLowerCase();
+  if (f.startsWith('owner:')) {
+    const o = owners[name];
+    return !!o && o.owner.toLowerCase().includes(f.slice(6));
+  }
+  if (f.startsWith('lang:')) return !!graph[name] && (graph[name].language || '') === f.slice(5);
+  return !f || name.toLowerCase().includes(f) || pkgOf(name).toLowerCase().includes(f);
+}
+
+function select(name) {
+  state.selected = name;
+  d3.selectAll('#canvas .node').classed('selected', d => nodeName(d) === name);
+  showFunction(name);
+  updateBanner();
+  writeHash();
+}
+
+function nodeName(d) { return d.data ? d.data.name : d.id; }
+
+// makeFocusable puts every rendered node in the tab order with an
+// accessible name, and lets Enter/Space activate it like a click.
+function makeFocusable(view) {
+  view.selectAll('.node, .cluster')
+    .attr('tabindex', 0)
+    .attr('role', 'button')
+    .attr('aria-label', d => d.proxy
+      ? 'package ' + d.pkg + ', ' + d.size + ' functions, collapsed'
+      : graph[nodeName(d)] ? 'function ' + nodeName(d) + ' in package ' + pkgOf(nodeName(d)) : nodeName(d))
+    .on('keydown', function(e) {
+      if (e.key === 'Enter' || e.key === ' ') {
+        e.preventDefault();
+        this.dispatchEvent(new MouseEvent('click'));
+      }
+    })
+    .on('focus', (e, d) => { if (graph[nodeName(d)] && state.selected !== nodeName(d)) select(nodeName(d)); });
+}
+
+// focusNode moves keyboard focus to a rendered node for name, expanding its
+// package first if the packages view has it folded away.
+function focusNode(name) {
+  if (state.layout === 'packages' && state.collapsed.has(pkgOf(name))) {
+    state.collapsed.delete(pkgOf(name));
+    state.selected = name;
+    render();
+  }
+  const el = d3.selectAll('#canvas .node').filter(d => nodeName(d) === name).node();
+  if (!el) {
+    select(name);
+    return;
+  }
+  el.focus();
+  select(name);
+  const box = el.getBoundingClientRect();
+  if (box.right < 0 || box.left > innerWidth || box.bottom < 0 || box.top > innerHeight) {
+    const t = d3.zoomTransform(viewport.svg.node());
+    viewport.svg.transition().call(viewport.zoom.translateBy,
+      (innerWidth / 2 - (box.left + box.right) / 2) / t.k, (innerHeight / 2 - (box.top + box.bottom) / 2) / t.k);
+  }
+}
+
+function fitView() {
+  const b = viewport.view.node().getBBox();
+  if (!b.width || !b.height) return;
+  const k = Math.min(8, 0.9 * Math.min(innerWidth / b.width, innerHeight / b.height));
+  const t = d3.zoomIdentity.translate(innerWidth / 2 - k * (b.x + b.width / 2), innerHeight / 2 - k * (b.y + b.height / 2)).scale(k);
+  viewport.svg.transition().call(viewport.zoom.transform, t).on('end', writeHash);
+}
+
+document.addEventListener('keydown', e => {
+  const typing = /^(INPUT|TEXTAREA|SELECT)$/.test(e.target.tagName);
+  if (e.key === 'Escape') {
+    if (typing) { e.target.blur(); return; }
+    if (timeline) { closeTimeline(); return; }
+    if (couplingOpen()) { closeCoupling(); return; }
+    state.selected = null;
+    navParent = null;
+    render();
+    return;
+  }
+  if (typing || e.ctrlKey || e.metaKey || e.altKey) return;
+  if (e.key === '/') {
+    e.preventDefault();
+    document.getElementById('filter').focus();
+    return;
+  }
+  if (e.key === 'f') {
+    fitView();
+    return;
+  }
+  const cur = state.selected;
+  if (!cur || !e.key.startsWith('Arrow')) return;
+  e.preventDefault();
+  let next = null;
+  if (e.key === 'ArrowRight') {
+    next = graph[cur].callees.find(c => graph[c]);
+    if (next) navParent = cur;
+  } else if (e.key === 'ArrowLeft') {
+    next = (callers[cur] || [])[0];
+    navParent = next ? (callers[next] || [])[0] || null : null;
+  } else {
+    // siblings are the other callees of whichever caller we arrived from
+    const parent = navParent && graph[navParent] ? navParent : (callers[cur] || [])[0];
+    const sibs = parent ? graph[parent].callees.filter(c => graph[c]) : [];
+    const i = sibs.indexOf(cur);
+    if (sibs.length > 1 && i >= 0) {
+      next = sibs[(i + (e.key === 'ArrowDown' ? 1 : sibs.length - 1)) % sibs.length];
+      navParent = parent;
+    }
+  }
+  if (next) focusNode(next);
+});
+
+d3.select('#export-svg').on('click', () => download(new Blob([serializeView()], { type: 'image/svg+xml' }), 'callgraph.svg'));
+d3.select('#export-png').on('click', exportPNG);
+
+function pkgOf(name) { return graph[name].package || '.'; }
+function packages() { return Array.from(new Set(Object.keys(graph).map(pkgOf))).sort(); }
+const pkgColor = d3.scaleOrdinal(d3.schemeTableau10);
+
+function render() {
+  if (timeline) {
+    drawTimeline();
+    return;
+  }
+  const svg = d3.select('#canvas').attr('width', innerWidth).attr('height', innerHeight);
+  svg.selectAll('*').remove();
+  const view = svg.append('g');
+  const zoom = d3.zoom().scaleExtent([0.1, 8]).on('zoom', e => {
+    view.attr('transform', e.transform);
+    state.zoom = e.transform;
+    if (e.sourceEvent) writeHash();
+  });
+  svg.call(zoom).call(zoom.transform, state.zoom);
+  viewport = { svg: svg, zoom: zoom, view: view };
+
+  d3.select('#layout').property('value', state.layout);
+  d3.select('#direction').property('value', state.dir);
+  d3.select('#direction-control').style('display', state.layout === 'tree' ? null : 'none');
+  d3.select('#filter').property('value', state.filter);
+  d3.select('#depth').property('value', state.depth);
+  d3.select('#coverage-toggle').property('checked', state.coverage);
+  d3.select('#churn-toggle').property('checked', state.churn);
+  d3.select('#hot-toggle').property('checked', state.hot);
+  d3.select('#traced-toggle').property('checked', state.traced);
+  d3.select('#languages-toggle').property('checked', state.langs);
+  showLanguages();
+  d3.select('#generated-toggle').property('checked', state.gen);
+  d3.select('#generated-control').style('display', state.gen || Object.values(graph).some(f => f.generated) ? null : 'none');
+  d3.selectAll('#expand-all, #collapse-all').style('display', state.layout === 'packages' ? null : 'none');
+  d3.select('#reset-layout').style('display', state.layout === 'packages' && Object.keys(positions).length ? null : 'none');
+  if (state.layout === 'packages') {
+    drawClusters(view);
+  } else {
+    drawTree(view);
+  }
+  makeFocusable(view);
+  view.selectAll('.node').classed('incomplete', d => !!incomplete[nodeName(d)] || unexplored.has(nodeName(d)))
+    .filter(d => incomplete[nodeName(d)] || unexplored.has(nodeName(d)))
+    .append('title').text(d => incomplete[nodeName(d)]
+      ? 'Calls may be incomplete: gopls failed on this function'
+      : 'Calls not analyzed: outside the sampled build\'s budget');
+  if (state.coverage) paintCoverage(view);
+  if (state.churn) paintChurn(view);
+  if (state.langs) paintLanguages(view);
+  if (state.selected) {
+    select(state.selected);
+  } else {
+    d3.select('#info-panel').html('<i>Click a node to see details</i>');
+    updateBanner();
+    writeHash();
+  }
+}
+
+// paintCoverage fills function nodes red (untested) to green (fully
+// covered); functions the profile didn't mention keep their normal color.
+function paintCoverage(view) {
+  view.selectAll('.node circle')
+    .style('fill', d => coverage[nodeName(d)] ? d3.interpolateRdYlGn(coveredShare(nodeName(d))) : null);
+}
+
+// paintChurn rings function nodes yellow to red by the commits that
+// changed them, relative to the most changed, and thickens the ring of
+// those with callers: high churn with high fan-in is where changes break
+// things.
+function paintChurn(view) {
+  const most = d3.max(Object.values(churn), c => c.commits) || 1;
+  view.selectAll('.node circle')
+    .style('stroke', d => churn[nodeName(d)] ? d3.interpolateYlOrRd(0.2 + 0.8 * Math.sqrt(churn[nodeName(d)].commits / most)) : null)
+    .style('stroke-width', d => churn[nodeName(d)] && (callers[nodeName(d)] || []).length ? 3 + Math.min(4, Math.log2(1 + (callers[nodeName(d)] || []).length)) + 'px' : null);
+}
+
+function languages() { return Array.from(new Set(Object.values(graph).map(f => f.language || ''))).sort(); }
+const langColor = d3.scaleOrdinal(d3.schemeSet2);
+
+// showLanguages offers the languages view once functions of more than one
+// language share the graph, with a legend that filters by language.
+function showLanguages() {
+  const langs = languages();
+  d3.select('#languages-control').style('display', langs.length > 1 ? null : 'none');
+  d3.select('#language-legend').style('display', state.langs ? null : 'none')
+    .selectAll('span').data(langs.filter(Boolean)).join('span')
+    .style('color', l => langColor(l))
+    .text(l => '● ' + l)
+    .on('click', (e, l) => {
+      e.preventDefault();
+      state.filter = 'lang:' + l;
+      runQuery();
+    });
+}
+
+// paintLanguages rings function nodes by their language; calls between
+// languages are drawn dotted whatever the view.
+function paintLanguages(view) {
+  view.selectAll('.node circle')
+    .style('stroke', d => graph[nodeName(d)] && graph[nodeName(d)].language ? langColor(graph[nodeName(d)].language) : null);
+}
+
+function foreignCall(caller, callee) { return !!graph[caller] && (graph[caller].via || {})[callee] === 'foreign'; }
+
+function callKey(caller, callee) { return caller + ' \u2192 ' + callee; }
+
+// callTitle is the hover text of a call: the call and the note on it.
+function callTitle(caller, callee) {
+  const a = callNotes[callKey(caller, callee)];
+  return callKey(caller, callee) + (a ? '\n' + a.note + '\n\u2014 ' + (a.author || 'anonymous') + ', ' +
+    new Date(a.updatedAt).toLocaleString() + (a.status ? ' (' + a.status + ')' : '') : '');
+}
+
+function coveredShare(name) {
+  const c = coverage[name];
+  return c.statements ? c.covered / c.statements : 1;
+}
+
+function showFunction(name) {
+  const n = graph[name];
+  const url = editorURL(n.file, n.line);
+  const cov = coverage[name];
+  const own = owners[name];
+  const obs = traced.functions && traced.functions[name];
+  const ch = churn[name];
+  const fails = incomplete[name] || [];
+  d3.select('#info-panel').html(
+    '<h3>' + esc(name) + '</h3>' +
+    '<div>package ' + esc(pkgOf(name)) + (n.language ? ' (' + esc(n.language) + ')' : '') + '</div>' +
+    (n.foreign ? '<div>calls ' + n.foreign.map(esc).join(', ') + '</div>' : '') +
+    (own ? '<div>owner ' + esc(own.owner) + ' (' + esc(own.source) + ')</div>' : '') +
+    (cov ? '<div>coverage ' + Math.round(100 * coveredShare(name)) + '% (' + cov.covered + '/' + cov.statements + ' statements)</div>' : '') +
+    fails.map(f => '<div class="warn">calls may be incomplete: ' + esc(f.request) + ' failed (' + esc(f.error) + ')</div>').join('') +
+    (unexplored.has(name) ? '<div class="warn">calls not analyzed: the sampled build ran out of budget first</div>' : '') +
+    (ch ? '<div>churn ' + ch.commits + ' commits by ' + ch.authors + ' authors, last ' + ch.lastChanged.slice(0, 10) + '</div>' : '') +
+    (obs ? '<div>traced ' + obs.count + ' spans, ' + (obs.duration / 1e6 / obs.count).toFixed(1) + ' ms on average</div>' : '') +
+    (n.file ? '<div>' + esc(n.file) + ':' + esc(n.line) + '</div>' : '') +
+    (url ? '<div id="open-editor"></div>' : '') +
+    ((callers[name] || []).length && !(state.layout === 'tree' && state.target === name)
+      ? '<div><a href="#" id="show-callers">Show who calls it</a></div>' : '') +
+    '<div id="annotation"></div>' +
+    '<pre>' + esc(n.signature) + '</pre>' +
+    '<pre id="definition"><i>Loading source...</i></pre>'
+  );
+  d3.select('#open-editor').append('a').attr('href', url).text('Open in editor');
+  d3.select('#show-callers').on('click', e => {
+    e.preventDefault();
+    showCallerTree(name);
+  });
+  showAnnotation(name);
+  fetch('api/functions/' + encodeURIComponent(name) + '/source?context=3')
+    .then(r => r.ok ? r.json() : Promise.reject(r.statusText))
+    .then(src => { if (state.selected === name) showSource(src); })
+    .catch(err => { if (state.selected === name) d3.select('#definition').text('Source unavailable: ' + err); });
+}
+
+// showSource fills the source panel with the definition between its
+// context lines, dimmed, and flags a file edited since the build.
+function showSource(src) {
+  const dim = lines => lines && lines.length ? '<span style="color:#999">' + esc(lines.join('\n')) + '</span>\n' : '';
+  d3.select('#definition').html(
+    (src.id ? '<a href="f/' + src.id + '" title="Link that survives edits and moves within the package">Permalink</a>\n' : '') +
+    (src.stale ? '<i>The file has changed since this graph was built.</i>\n' : '') +
+    dim(src.before) + esc(src.definition) + (src.after && src.after.length ? '\n' : '') + dim(src.after)
+  );
+}
+
+function esc(s) {
+  return String(s).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+}
+
+// showAnnotation renders the stored note for name with an inline edit form
+// that writes back through /api/functions/{name}/annotation.
+function showAnnotation(name) {
+  const a = annotations[name];
+  const box = d3.select('#annotation').html(
+    '<h4>Notes</h4>' +
+    (a ? '<div style="white-space:pre-wrap">' + esc(a.note) + '</div>' +
+         '<small>' + esc(a.author || 'anonymous') + ', ' + new Date(a.updatedAt).toLocaleString() + '</small>'
+       : '<small><i>No notes yet</i></small>') +
+    '<form><textarea rows="4" style="width:100%"></textarea>' +
+    '<input name="author" placeholder="Your name" size="12"> ' +
+    '<button type="submit">Save</button> ' +
+    (a ? '<button type="button" class="delete">Delete</button>' : '') +
+    '</form>'
+  );
+  box.select('textarea').property('value', a ? a.note : '');
+  box.select('input[name=author]').property('value', localStorage.getItem('geeparse-author') || '');
+  const url = 'api/functions/' + encodeURIComponent(name) + '/annotation';
+  box.select('form').on('submit', e => {
+    e.preventDefault();
+    const author = box.select('input[name=author]').property('value');
+    localStorage.setItem('geeparse-author', author);
+    fetch(url, {
+      method: 'PUT',
+      headers: signed({ 'Content-Type': 'application/json' }),
+      body: JSON.stringify({ note: box.select('textarea').property('value'), author: author }),
+    })
+      .then(r => r.ok ? r.json() : r.text().then(t => Promise.reject(t)))
+      .then(saved => { annotations[name] = saved; showAnnotation(name); })
+      .catch(err => alert('Saving note failed: ' + err));
+  });
+  box.select('.delete').on('click', () => {
+    fetch(url, { method: 'DELETE', headers: signed({}) })
+      .then(r => { if (!r.ok) return Promise.reject(r.statusText); delete annotations[name]; showAnnotation(name); })
+      .catch(err => alert('Deleting note failed: ' + err));
+  });
+}
+
+// showCalls lists calls in the info panel, each with its note and an
+// edit form like the function's.
+function showCalls(pairs) {
+  const panel = d3.select('#info-panel').html('<h3>' + (pairs.length === 1 ? 'Call' : pairs.length + ' calls') + '</h3>');
+  pairs.forEach(p => showCallNote(panel.append('div'), p[0], p[1]));
+}
+
+// showCallNote renders the note on caller's call of callee into box, with
+// an inline form writing back through
+// /api/functions/{name}/calls/{callee}/annotation.
+function showCallNote(box, caller, callee) {
+  const key = callKey(caller, callee);
+  const a = callNotes[key];
+  box.html(
+    '<h4>' + esc(key) + '</h4>' +
+    (a ? '<div style="white-space:pre-wrap">' + esc(a.note) + '</div>' +
+         '<small>' + esc(a.author || 'anonymous') + ', ' + new Date(a.updatedAt).toLocaleString() +
+         (a.status ? ', ' + esc(a.status) : '') + '</small>'
+       : '<small><i>No notes yet</i></small>') +
+    '<form><textarea rows="3" style="width:100%"></textarea>' +
+    '<input name="author" placeholder="Your name" size="12"> ' +
+    '<select name="status"><option value="">not reviewed</option><option>pending</option>' +
+    '<option>approved</option><option>rejected</option></select> ' +
+    '<button type="submit">Save</button> ' +
+    (a ? '<button type="button" class="delete">Delete</button>' : '') +
+    '</form>'
+  );
+  box.select('textarea').property('value', a ? a.note : '');
+  box.select('input[name=author]').property('value', localStorage.getItem('geeparse-author') || '');
+  box.select('select').property('value', a ? a.status || '' : '');
+  const url = 'api/functions/' + encodeURIComponent(caller) + '/calls/' + encodeURIComponent(callee) + '/annotation';
+  box.select('form').on('submit', e => {
+    e.preventDefault();
+    const author = box.select('input[name=author]').property('value');
+    localStorage.setItem('geeparse-author', author);
+    fetch(url, {
+      method: 'PUT',
+      headers: signed({ 'Content-Type': 'application/json' }),
+      body: JSON.stringify({ note: box.select('textarea').property('value'), author: author, status: box.select('select').property('value') }),
+    })
+      .then(r => r.ok ? r.json() : r.text().then(t => Promise.reject(t)))
+      .then(saved => { callNotes[key] = saved; render(); showCallNote(box, caller, callee); })
+      .catch(err => alert('Saving note failed: ' + err));
+  });
+  box.select('.delete').on('click', () => {
+    fetch(url, { method: 'DELETE', headers: signed({}) })
+      .then(r => { if (!r.ok) return Promise.reject(r.statusText); delete callNotes[key]; render(); showCallNote(box, caller, callee); })
+      .catch(err => alert('Deleting note failed: ' + err));
+  });
+}
+
+function showPackage(pkg) {
+  const fns = Object.keys(graph).filter(name => pkgOf(name) === pkg).sort();
+  d3.select('#info-panel').html(
+    '<h3>' + esc(pkg) + '</h3>' +
+    '<div>' + fns.length + ' functions</div>' +
+    '<ul>' + fns.map(f => '<li>' + esc(f) + '</li>').join('') + '</ul>'
+  );
+}
+
+// serializeView clones the rendered SVG with computed styles inlined, so the
+// exported file looks the same outside this page's stylesheet.
+function serializeView() {
+  const src = document.getElementById('canvas');
+  const clone = src.cloneNode(true);
+  const props = ['fill', 'fill-opacity', 'stroke', 'stroke-width', 'stroke-opacity', 'font-family', 'font-size', 'text-anchor', 'opacity'];
+  const srcEls = src.querySelectorAll('*'), dstEls = clone.querySelectorAll('*');
+  srcEls.forEach((el, i) => {
+    const cs = getComputedStyle(el);
+    dstEls[i].setAttribute('style', props.map(p => p + ':' + cs.getPropertyValue(p)).join(';'));
+  });
+  clone.setAttribute('xmlns', 'http://www.w3.org/2000/svg');
+  clone.setAttribute('style', 'background:' + getComputedStyle(document.body).backgroundColor);
+  return new XMLSerializer().serializeToString(clone);
+}
+
+function exportPNG() {
+  const svg = document.getElementById('canvas');
+  const img = new Image();
+  img.onload = () => {
+    const scale = window.devicePixelRatio || 1;
+    const c = document.createElement('canvas');
+    c.width = svg.clientWidth * scale;
+    c.height = svg.clientHeight * scale;
+    const ctx = c.getContext('2d');
+    ctx.fillStyle = getComputedStyle(document.body).backgroundColor;
+    ctx.fillRect(0, 0, c.width, c.height);
+    ctx.scale(scale, scale);
+    ctx.drawImage(img, 0, 0);
+    c.toBlob(blob => download(blob, 'callgraph.png'), 'image/png');
+  };
+  img.src = 'data:image/svg+xml;charset=utf-8,' + encodeURIComponent(serializeView());
+}
+
+function download(blob, filename) {
+  const a = document.createElement('a');
+  a.href = URL.createObjectURL(blob);
+  a.download = filename;
+  a.click();
+  setTimeout(() => URL.revokeObjectURL(a.href), 1000);
+}
+
+// drawTree renders calls as a tree: from the roots down to their callees,
+// or, showing callers, from a function back up through everything that
+// calls it, drawn right to left so calls still run left to right.
+function drawTree(view) {
+  const up = state.dir === 'callers';
+  const next = name => up ? (callers[name] || []) : graph[name].callees;
   const toTree = obj => {
-    const all = new Set(Object.keys(obj));
-    Object.values(obj).forEach(n => n.callees.forEach(c => all.delete(c)));
-    const build = (name, vis = new Set()) => {
-      if (vis.has(name)) {
-        return { name: name, signature: obj[name].signature, definition: obj[name].definition, children: [] };
+    // with a filter the matching functions become the roots; otherwise
+    // roots are the functions nobody calls, or for callers the function
+    // asked about, else those that call nothing
+    let roots = Object.keys(obj).filter(matches);
+    if (up && state.target && !state.filter) {
+      roots = [state.target];
+    } else if (!state.filter) {
+      const all = new Set(roots);
+      Object.keys(obj).forEach(name => next(name).forEach(c => all.delete(c)));
+      roots = Array.from(all);
+    }
+    const build = (name, vis = new Set(), depth = 1) => {
+      if (vis.has(name) || (state.depth && depth >= state.depth) || !obj[name]) {
+        return { name: name, children: [] };
       }
       vis.add(name);
       return {
         name: name,
-        signature: obj[name].signature,
-        definition: obj[name].definition,
-        children: obj[name].callees.map(c => build(c, new Set(vis))),
+        children: next(name).map(c => build(c, new Set(vis), depth + 1)),
       };
     };
-    return { name: 'root', children: Array.from(all).map(r => build(r)) };
+    return { name: 'root', children: roots.sort().map(r => build(r)) };
   };
 
   const data = toTree(graph);
   const W = innerWidth, H = innerHeight;
   const M = { top:20, right:120, bottom:20, left:120 };
-  const svg = d3.select('body').append('svg')
-    .attr('width', W).attr('height', H)
-    .append('g').attr('transform','translate(' + M.left + ',' + M.top + ')');
+  const svg = view.append('g').attr('transform','translate(' + M.left + ',' + M.top + ')');
 
   const root = d3.hierarchy(data);
   d3.tree().size([H - M.top - M.bottom, W - M.left - M.right])(root);
+  const x = d => up ? W - M.left - M.right - d.y : d.y;
+  // call is the [caller, callee] a tree link stands for
+  const call = d => up ? [d.target.data.name, d.source.data.name] : [d.source.data.name, d.target.data.name];
 
   svg.selectAll('.link').data(root.links()).join('path')
     .attr('class','link')
-    .attr('d', d3.linkHorizontal().x(d=>d.y).y(d=>d.x));
+    .classed('noted', d => !!callNotes[callKey(...call(d))])
+    .classed('violation', d => isViolation(...call(d)))
+    .classed('traced', d => tracedClass(...call(d)) === 'traced')
+    .classed('untraced', d => tracedClass(...call(d)) === 'untraced')
+    .classed('foreign', d => foreignCall(...call(d)))
+    .style('stroke-width', d => heatOf(...call(d)) ? 2 + 8 * heatOf(...call(d)) + 'px' : null)
+    .attr('d', d3.linkHorizontal().x(x).y(d=>d.x))
+    .on('click', (e, d) => { if (graph[call(d)[0]]) showCalls([call(d)]); })
+    .append('title').text(d => callTitle(...call(d)));
 
   const node = svg.selectAll('.node').data(root.descendants()).join('g')
     .attr('class','node')
-    .attr('transform', d=>'translate(' + d.y + ',' + d.x + ')')
-    .on('click', (e, d) => {
-      d3.select('#info-panel').html(
-        '<h3>' + d.data.name + '</h3>' +
-        '<pre>' + d.data.signature + '</pre>' +
-        '<pre>' + d.data.definition + '</pre>'
-      );
-    });
+    .attr('transform', d=>'translate(' + x(d) + ',' + d.x + ')')
+    .on('click', (e, d) => { if (graph[d.data.name]) select(d.data.name); });
 
   node.append('circle').attr('r',4);
   node.append('text')
     .attr('dy',3)
-    .attr('x', d => d.children ? -8 : 8)
-    .style('text-anchor', d => d.children ? 'end' : 'start')
+    .attr('x', d => !d.children === up ? -8 : 8)
+    .style('text-anchor', d => !d.children === up ? 'end' : 'start')
     .text(d => d.data.name);
 }
+
+// showCallerTree switches to the tree of everything that calls name.
+function showCallerTree(name) {
+  state.layout = 'tree';
+  state.dir = 'callers';
+  state.target = name;
+  state.filter = '';
+  queryHits = null;
+  state.zoom = d3.zoomIdentity;
+  render();
+}
+
+// drawClusters renders a force layout where every function of a collapsed
+// package is folded into one proxy node, and expanded packages are wrapped
+// in a hull that collapses the package again when clicked.
+function drawClusters(view) {
+  const idOf = name => state.collapsed.has(pkgOf(name)) ? 'pkg:' + pkgOf(name) : name;
+
+  const nodes = new Map();
+  Object.keys(graph).filter(matches).forEach(name => {
+    const id = idOf(name);
+    if (!nodes.has(id)) {
+      nodes.set(id, { id: id, pkg: pkgOf(name), label: id === name ? name : pkgOf(name), proxy: id !== name, size: 0 });
+    }
+    nodes.get(id).size++;
+  });
+
+  const links = new Map();
+  Object.entries(graph).forEach(([caller, n]) => n.callees.forEach(callee => {
+    if (!graph[callee] || !matches(caller) || !matches(callee)) return;
+    const s = idOf(caller), t = idOf(callee);
+    if (s === t) return;
+    const key = s + '>' + t;
+    if (!links.has(key)) links.set(key, { source: s, target: t, count: 0, pairs: [] });
+    links.get(key).count++;
+    links.get(key).pairs.push([caller, callee]);
+  }));
+
+  const nodeList = Array.from(nodes.values());
+  const linkList = Array.from(links.values());
+  const radius = d => d.proxy ? 8 + 2 * Math.sqrt(d.size) : 5;
+  nodeList.forEach(d => {
+    const p = positions[d.id];
+    if (p) { d.x = d.fx = p.x; d.y = d.fy = p.y; }
+  });
+
+  view.append('defs').append('marker')
+    .attr('id', 'arrow').attr('viewBox', '0 -4 8 8').attr('refX', 14)
+    .attr('markerWidth', 6).attr('markerHeight', 6).attr('orient', 'auto')
+    .append('path').attr('d', 'M0,-4L8,0L0,4').attr('class', 'arrow');
+
+  const hullLayer = view.append('g');
+  const link = view.append('g').selectAll('line').data(linkList).join('line')
+    .attr('class', 'link')
+    .classed('violation', d => d.pairs.some(p => isViolation(p[0], p[1])))
+    .classed('heuristic', d => d.pairs.every(p => (graph[p[0]].via || {})[p[1]] === 'ast'))
+    .classed('traced', d => d.pairs.some(p => tracedClass(p[0], p[1]) === 'traced'))
+    .classed('untraced', d => d.pairs.every(p => tracedClass(p[0], p[1]) === 'untraced'))
+    .classed('foreign', d => d.pairs.some(p => foreignCall(p[0], p[1])))
+    .classed('noted', d => d.pairs.some(p => callNotes[callKey(p[0], p[1])]))
+    .attr('stroke-width', d => Math.max(Math.min(1 + Math.log2(d.count), 6), 1 + 8 * d3.max(d.pairs, p => heatOf(p[0], p[1]))))
+    .attr('marker-end', 'url(#arrow)')
+    .on('click', (e, d) => showCalls(d.pairs));
+  link.append('title').text(d => d.pairs.length === 1 ? callTitle(d.pairs[0][0], d.pairs[0][1])
+    : d.pairs.length + ' calls' + d.pairs.filter(p => callNotes[callKey(p[0], p[1])]).map(p => '\n\n' + callTitle(p[0], p[1])).join(''));
+
+  const node = view.append('g').selectAll('g').data(nodeList).join('g')
+    .attr('class', d => d.proxy ? 'cluster' : 'node')
+    .on('click', (e, d) => {
+      if (d.proxy) {
+        state.collapsed.delete(d.pkg);
+        render();
+      } else {
+        select(d.id);
+      }
+    });
+  node.append('circle')
+    .attr('r', radius)
+    .style('fill', d => d.proxy ? pkgColor(d.pkg) : null)
+    .style('stroke', d => d.proxy ? null : pkgColor(d.pkg));
+  node.append('text')
+    .attr('dy', 3)
+    .attr('x', d => radius(d) + 4)
+    .text(d => d.proxy ? d.label + ' (' + d.size + ')' : d.label);
+  node.filter(d => d.proxy).on('contextmenu', (e, d) => { e.preventDefault(); showPackage(d.pkg); });
+
+  // pull functions of the same package together so hulls stay compact
+  const centers = new Map(packages().map((p, i, all) => {
+    const a = 2 * Math.PI * i / all.length;
+    return [p, [innerWidth / 2 + Math.cos(a) * innerWidth / 4, innerHeight / 2 + Math.sin(a) * innerHeight / 4]];
+  }));
+
+  const sim = d3.forceSimulation(nodeList)
+    .force('link', d3.forceLink(linkList).id(d => d.id).distance(60).strength(0.2))
+    .force('charge', d3.forceManyBody().strength(-120))
+    .force('x', d3.forceX(d => centers.get(d.pkg)[0]).strength(0.08))
+    .force('y', d3.forceY(d => centers.get(d.pkg)[1]).strength(0.08))
+    .force('collide', d3.forceCollide(d => radius(d) + 4));
+
+  // a node dragged somewhere stays there, across reloads; one merely
+  // clicked is let go again
+  let moved = false;
+  node.call(d3.drag()
+    .on('start', (e, d) => { if (!e.active) sim.alphaTarget(0.3).restart(); d.fx = d.x; d.fy = d.y; moved = false; })
+    .on('drag', (e, d) => { d.fx = e.x; d.fy = e.y; moved = true; })
+    .on('end', (e, d) => {
+      if (!e.active) sim.alphaTarget(0);
+      if (moved) savePosition(d);
+      else if (!positions[d.id]) { d.fx = null; d.fy = null; }
+    }));
+
+  const hullPath = members => {
+    const pad = 18, pts = [];
+    members.forEach(d => {
+      pts.push([d.x - pad, d.y - pad], [d.x - pad, d.y + pad], [d.x + pad, d.y - pad], [d.x + pad, d.y + pad]);
+    });
+    return 'M' + d3.polygonHull(pts).join('L') + 'Z';
+  };
+
+  sim.on('tick', () => {
+    const groups = d3.groups(nodeList.filter(d => !d.proxy), d => d.pkg);
+    hullLayer.selectAll('path').data(groups, g => g[0]).join(enter => enter.append('path')
+        .attr('class', 'hull')
+        .style('fill', g => pkgColor(g[0]))
+        .style('stroke', g => pkgColor(g[0]))
+        .on('click', (e, g) => { state.collapsed.add(g[0]); render(); })
+        .on('contextmenu', (e, g) => { e.preventDefault(); showPackage(g[0]); })
+        .call(p => p.append('title').text(g => g[0] + ' (click to collapse)')))
+      .attr('d', g => hullPath(g[1]));
+    link
+      .attr('x1', d => d.source.x).attr('y1', d => d.source.y)
+      .attr('x2', d => d.target.x).attr('y2', d => d.target.y);
+    node.attr('transform', d => 'translate(' + d.x + ',' + d.y + ')');
+  });
+}
+
+// The timeline animates the graph across the stored snapshots: every
+// function (or package) that ever existed is laid out once, and each
+// frame shows those present in one snapshot, marking what appeared since
+// the previous one green and what disappeared red.
+// openCoupling shows /api/coupling as a heatmap: one row and column per
+// package, shaded by the calls between them relative to the busiest pair
+// of different packages. Clicking a row's package filters the graph to it.
+function openCoupling() {
+  d3.select('#coupling-open').property('disabled', true);
+  fetch('api/coupling')
+    .then(r => r.ok ? r.json() : Promise.reject(r.statusText))
+    .then(c => {
+      let max = 0;
+      c.calls.forEach((row, i) => row.forEach((n, j) => { if (i !== j && n > max) max = n; }));
+      const table = d3.select('#coupling-matrix').html('').append('table');
+      const head = table.append('tr');
+      head.append('th');
+      c.packages.forEach(p => head.append('th').attr('class', 'col').text(p));
+      c.calls.forEach((row, i) => {
+        const tr = table.append('tr');
+        tr.append('th').append('a').attr('href', '#').text(c.packages[i])
+          .on('click', e => {
+            e.preventDefault();
+            closeCoupling();
+            state.filter = 'pkg("' + c.packages[i] + '")';
+            d3.select('#filter').property('value', state.filter);
+            runQuery();
+          });
+        row.forEach((n, j) => {
+          const td = tr.append('td').text(n || '')
+            .attr('title', c.packages[i] + ' → ' + c.packages[j] + ': ' + n + (n === 1 ? ' call' : ' calls'));
+          if (i === j) td.attr('class', 'diag');
+          else if (n && max) td.style('background', 'rgba(70,130,180,' + (0.15 + 0.85 * n / max).toFixed(2) + ')');
+        });
+      });
+      d3.select('#coupling').style('display', null);
+    })
+    .catch(err => { d3.select('#info-panel').text('Coupling unavailable: ' + err); })
+    .finally(() => d3.select('#coupling-open').property('disabled', false));
+}
+
+function closeCoupling() {
+  d3.select('#coupling').style('display', 'none');
+}
+
+function couplingOpen() {
+  return d3.select('#coupling').style('display') !== 'none';
+}
+
+function openTimeline() {
+  d3.select('#timeline-open').property('disabled', true);
+  fetch('api/timeline')
+    .then(r => r.ok ? r.json().then(data => [data, r.headers.get('X-Geeparse-Truncated') === 'true']) : Promise.reject(r.statusText))
+    .then(([data, truncated]) => {
+      timeline = { data: data, frame: data.snapshots.length - 1, timer: null, layout: null, truncated: truncated };
+      d3.select('#banner').style('display', 'none');
+      d3.select('#timeline').style('display', null);
+      d3.select('#tl-slider').attr('max', data.snapshots.length - 1).property('value', timeline.frame);
+      render();
+    })
+    .catch(err => { d3.select('#info-panel').text('Timeline unavailable: ' + err); })
+    .finally(() => d3.select('#timeline-open').property('disabled', false));
+}
+
+function closeTimeline() {
+  stopTimeline();
+  timeline = null;
+  d3.select('#timeline').style('display', 'none');
+  render();
+}
+
+function stopTimeline() {
+  if (timeline && timeline.timer) clearInterval(timeline.timer);
+  if (timeline) timeline.timer = null;
+  d3.select('#tl-play').text('▶').attr('aria-label', 'Play');
+}
+
+function playTimeline() {
+  if (timeline.timer) { stopTimeline(); return; }
+  if (timeline.frame >= timeline.data.snapshots.length - 1) showFrame(0);
+  d3.select('#tl-play').text('❚❚').attr('aria-label', 'Pause');
+  timeline.timer = setInterval(() => {
+    if (timeline.frame >= timeline.data.snapshots.length - 1) { stopTimeline(); return; }
+    showFrame(timeline.frame + 1);
+  }, 1500);
+}
+
+// timelineModel turns the spans of /api/timeline into per-snapshot counts
+// for functions or, grouped, packages and the calls between them.
+function timelineModel(byPackage) {
+  const data = timeline.data, n = data.snapshots.length;
+  const idOf = name => byPackage ? (data.functions[name].package || '.') : name;
+  const nodes = new Map(), links = new Map();
+  const count = (obj, spans) => spans.forEach(s => { for (let i = s[0]; i <= s[1]; i++) obj.counts[i]++; });
+  Object.entries(data.functions).forEach(([name, f]) => {
+    const id = idOf(name);
+    if (!nodes.has(id)) nodes.set(id, { id: id, pkg: f.package || '.', counts: new Array(n).fill(0) });
+    count(nodes.get(id), f.spans);
+  });
+  data.calls.forEach(c => {
+    const s = idOf(c.caller), t = idOf(c.callee);
+    if (s === t) return;
+    const key = s + '>' + t;
+    if (!links.has(key)) links.set(key, { source: s, target: t, counts: new Array(n).fill(0) });
+    count(links.get(key), c.spans);
+  });
+  return { nodes: Array.from(nodes.values()), links: Array.from(links.values()), byPackage: byPackage };
+}
+
+function drawTimeline() {
+  const byPackage = d3.select('#tl-packages').property('checked');
+  if (!timeline.layout || timeline.layout.byPackage !== byPackage) {
+    timeline.layout = timelineModel(byPackage);
+    const m = timeline.layout;
+    d3.forceSimulation(m.nodes)
+      .force('link', d3.forceLink(m.links).id(d => d.id).distance(byPackage ? 90 : 40).strength(0.2))
+      .force('charge', d3.forceManyBody().strength(byPackage ? -300 : -60))
+      .force('center', d3.forceCenter(innerWidth / 2, innerHeight / 2))
+      .force('collide', d3.forceCollide(12))
+      .stop()
+      .tick(300);
+  }
+  const m = timeline.layout;
+  const svg = d3.select('#canvas').attr('width', innerWidth).attr('height', innerHeight);
+  svg.selectAll('*').remove();
+  const view = svg.append('g').attr('class', 'tl');
+  const zoom = d3.zoom().scaleExtent([0.1, 8]).on('zoom', e => view.attr('transform', e.transform));
+  svg.call(zoom).call(zoom.transform, state.zoom);
+  viewport = { svg: svg, zoom: zoom, view: view };
+  const radius = d => byPackage ? 6 + 2 * Math.sqrt(d3.max(d.counts)) : 5;
+
+  view.append('g').selectAll('line').data(m.links).join('line')
+    .attr('class', 'link')
+    .attr('x1', d => d.source.x).attr('y1', d => d.source.y)
+    .attr('x2', d => d.target.x).attr('y2', d => d.target.y);
+  const node = view.append('g').selectAll('g').data(m.nodes).join('g')
+    .attr('class', 'node')
+    .attr('transform', d => 'translate(' + d.x + ',' + d.y + ')')
+    .on('click', (e, d) => {
+      if (byPackage) showPackage(d.pkg);
+      else if (graph[d.id]) select(d.id);
+    });
+  node.append('circle').attr('r', radius).style('stroke', d => byPackage ? null : pkgColor(d.pkg));
+  node.append('title').text(d => d.id);
+  if (byPackage) node.append('text').attr('dy', 3).attr('x', d => radius(d) + 4).text(d => d.id);
+  showFrame(timeline.frame);
+}
+
+// showFrame shows the graph as of snapshot i.
+function showFrame(i) {
+  timeline.frame = i;
+  const snap = timeline.data.snapshots[i];
+  const was = d => i > 0 && d.counts[i - 1] > 0, is = d => d.counts[i] > 0;
+  const view = viewport.view;
+  [view.selectAll('.node'), view.selectAll('.link')].forEach(sel => sel
+    .classed('appeared', d => is(d) && !was(d))
+    .classed('vanished', d => !is(d) && was(d))
+    .style('opacity', d => is(d) ? 1 : was(d) ? 0.35 : 0)
+    .style('pointer-events', d => is(d) ? null : 'none'));
+  const present = timeline.layout.nodes.filter(is).length;
+  const added = timeline.layout.nodes.filter(d => is(d) && !was(d)).length;
+  const removed = timeline.layout.nodes.filter(d => !is(d) && was(d)).length;
+  d3.select('#tl-slider').property('value', i);
+  d3.select('#tl-label').text((i + 1) + '/' + timeline.data.snapshots.length + ': ' + snap.label +
+    ' (' + new Date(snap.createdAt).toLocaleDateString() + '), ' + present +
+    (timeline.layout.byPackage ? ' packages' : ' functions') + (i > 0 ? ', +' + added + ' −' + removed : '') +
+    (timeline.truncated ? ' (longest-lived only; the server budget cut the rest)' : ''));
+}
+
+d3.select('#timeline-open').on('click', openTimeline);
+d3.select('#coupling-open').on('click', openCoupling);
+d3.select('#coupling-close').on('click', closeCoupling);
+d3.select('#tl-close').on('click', closeTimeline);
+d3.select('#tl-play').on('click', playTimeline);
+d3.select('#tl-slider').on('input', function() { stopTimeline(); showFrame(+this.value); });
+d3.select('#tl-packages').on('change', drawTimeline);
 </script>
 </body>
 </html>`
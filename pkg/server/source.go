@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// MaxContextLines caps ?context= on /api/functions/{name}/source.
+const MaxContextLines = 100
+
+// Source is a function's code as /api/functions/{name}/source serves it,
+// for clients that load the graph without definitions and for editor
+// integrations.
+type Source struct {
+	Function string `json:"function"`
+	// ID is the function's stable ID, for /f/{id} permalinks.
+	ID         string `json:"id"`
+	Signature  string `json:"signature"`
+	Definition string `json:"definition"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	EndLine    int    `json:"endLine"`
+	// Ranges locate the declaration and its parts in File as it is on
+	// disk now. They are missing when the server can't read the file or
+	// Stale is set: the function is no longer where the graph says, so
+	// the graph predates the file.
+	Ranges *callgraph.Ranges `json:"ranges,omitempty"`
+	Stale  bool              `json:"stale,omitempty"`
+	// Before and After are up to ?context= lines around the declaration,
+	// doc comment included, when Ranges are known.
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// handleSource serves one function's definition from the current graph
+// and, for Go files the server can read, where it sits in its file with
+// ?context= lines around it. Only .go files are read, so a graph naming
+// other files can't be used to fetch them.
+func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	fn, ok := s.currentGraph()[name]
+	if !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+	context := 0
+	if v := r.URL.Query().Get("context"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid context "+v, http.StatusBadRequest)
+			return
+		}
+		context = min(n, MaxContextLines)
+	}
+	src := Source{
+		Function:   name,
+		ID:         callgraph.ID(s.currentGraph(), name, s.opts.IDLength),
+		Signature:  fn.Signature,
+		Definition: fn.Definition,
+		File:       fn.File,
+		Line:       fn.Line,
+		EndLine:    fn.EndLine,
+	}
+	if filepath.Ext(fn.File) == ".go" && fn.Line > 0 {
+		if data, err := os.ReadFile(fn.File); err == nil {
+			if ranges, ok := callgraph.Locate(data, fn.File, path.Base(name), fn.Line); ok {
+				src.Ranges = &ranges
+				if context > 0 {
+					src.Before, src.After = contextLines(data, ranges, context)
+				}
+			} else {
+				src.Stale = true
+			}
+		}
+	}
+	writeJSON(w, src)
+}
+
+// contextLines returns up to n whole lines before the declaration (its
+// doc comment included) and after it.
+func contextLines(data []byte, r callgraph.Ranges, n int) (before, after []string) {
+	first := r.Declaration.StartLine
+	if r.Doc != nil {
+		first = r.Doc.StartLine
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	for i := max(first-1-n, 0); i < first-1; i++ {
+		before = append(before, string(lines[i]))
+	}
+	for i := r.Declaration.EndLine; i < min(r.Declaration.EndLine+n, len(lines)); i++ {
+		after = append(after, string(lines[i]))
+	}
+	return before, after
+}
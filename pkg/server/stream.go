@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/export"
+)
+
+// streamFlushBytes is how much /api/stream writes between flushes: enough
+// to keep the number of chunks down, little enough for clients to start
+// on the first records at once.
+const streamFlushBytes = 32 << 10
+
+// handleStream writes the graph as NDJSON, one node or edge per line as
+// export.NDJSON lays it out, flushing as it goes so clients can consume
+// very large graphs record by record and pipe them into other tools
+// instead of buffering the whole payload. It takes the filters of
+// /api/export: /api/stream?root=main&depth=3&package=pkg/server
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	graph, err := s.filteredGraph(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", export.ContentType("ndjson"))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+
+	fw := &flushWriter{w: w}
+	fw.flusher, _ = w.(http.Flusher)
+	if err := export.NDJSON(fw, graph); err != nil {
+		// the status is long sent; most likely the client went away
+		s.opts.Logger.Debug("stream ended early", "err", err)
+		return
+	}
+	fw.flush()
+}
+
+// flushWriter flushes what it writes every streamFlushBytes, where the
+// ResponseWriter can flush at all.
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	pending int
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.pending += n
+	if f.pending >= streamFlushBytes {
+		f.flush()
+	}
+	return n, err
+}
+
+func (f *flushWriter) flush() {
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	f.pending = 0
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// tagRequest is the optional body accepted by the PUT tag endpoints.
+type tagRequest struct {
+	Source string `json:"source"`
+}
+
+// handleListTags lists every stored tag, narrowed by ?tag= and ?source=
+// when given.
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.store.Tags()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tag, source := r.URL.Query().Get("tag"), r.URL.Query().Get("source")
+	if tag != "" || source != "" {
+		tags = slices.DeleteFunc(tags, func(t persistence.Tag) bool {
+			return (tag != "" && t.Tag != tag) || (source != "" && t.Source != source)
+		})
+	}
+	writeJSON(w, tags)
+}
+
+// handleGetTags lists the tags on a function and on the calls it makes.
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.currentGraph()[name]; !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+	tags, err := s.store.TagsOf(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tags)
+}
+
+// handlePutTag tags a function, or with {callee} in the path, one of its
+// calls. The body may name the tag's source.
+func (s *Server) handlePutTag(w http.ResponseWriter, r *http.Request) {
+	name, callee, tag := r.PathValue("name"), r.PathValue("callee"), r.PathValue("tag")
+	node, ok := s.currentGraph()[name]
+	if !ok {
+		http.Error(w, "unknown function "+name, http.StatusNotFound)
+		return
+	}
+	if callee != "" && !slices.Contains(node.Callees, callee) {
+		http.Error(w, name+" doesn't call "+callee, http.StatusNotFound)
+		return
+	}
+	if !validTag(tag) {
+		http.Error(w, "invalid tag "+tag+": tags are non-empty and have no spaces", http.StatusBadRequest)
+		return
+	}
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "decode tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := s.store.SetTag(name, callee, tag, req.Source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.purgeCache() // tag() queries
+	writeJSON(w, t)
+}
+
+func (s *Server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteTag(r.PathValue("name"), r.PathValue("callee"), r.PathValue("tag")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.purgeCache()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validTag reports whether tag can be written: anything printable without
+// spaces, so tags read the same in URLs, queries and lists.
+func validTag(tag string) bool {
+	return tag != "" && !strings.ContainsFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+	"github.com/ishanmadhav/geeparse/pkg/diff"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// Snapshots a timeline covers unless ?limit= asks otherwise, and at most;
+// each one is loaded in full to build it.
+const (
+	DefaultTimelineSnapshots = 20
+	MaxTimelineSnapshots     = 100
+)
+
+// timeline is the body of /api/timeline: the snapshots, oldest first, and
+// the spans of them each function and call existed in.
+type timeline struct {
+	Snapshots []persistence.Snapshot `json:"snapshots"`
+	diff.Timeline
+}
+
+// handleTimeline serves how the graph evolved over the latest ?limit=
+// snapshots, for the UI to animate. Like /graph.json it stays within the
+// node and edge budget, keeping the functions and calls that lasted
+// longest, and reports truncation in the X-Geeparse-Truncated header.
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultTimelineSnapshots
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit "+v, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, MaxTimelineSnapshots)
+	}
+	snaps, err := s.store.Snapshots()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snaps = snaps[:min(limit, len(snaps))]
+	slices.Reverse(snaps)
+
+	graphs := make([]map[string]callgraph.FunctionNode, len(snaps))
+	for i, snap := range snaps {
+		if graphs[i], err = s.store.LoadSnapshot(snap.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	t := diff.NewTimeline(graphs)
+	opts := s.options()
+	truncated := trimTimeline(&t, budget(opts.MaxNodes, r.URL.Query().Get("maxNodes")),
+		budget(opts.MaxEdges, r.URL.Query().Get("maxEdges")))
+	w.Header().Set("X-Geeparse-Truncated", strconv.FormatBool(truncated))
+	writeJSON(w, timeline{Snapshots: snaps, Timeline: t})
+}
+
+// trimTimeline cuts t down to maxNodes functions and maxEdges calls (0 =
+// unlimited), preferring those present in the most snapshots, and reports
+// whether anything was cut.
+func trimTimeline(t *diff.Timeline, maxNodes, maxEdges int) bool {
+	truncated := false
+	if maxNodes > 0 && len(t.Functions) > maxNodes {
+		names := make([]string, 0, len(t.Functions))
+		for name := range t.Functions {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := t.Functions[names[i]].Graphs(), t.Functions[names[j]].Graphs()
+			if a != b {
+				return a > b
+			}
+			return names[i] < names[j]
+		})
+		for _, name := range names[maxNodes:] {
+			delete(t.Functions, name)
+		}
+		t.Calls = slices.DeleteFunc(t.Calls, func(c diff.TimelineCall) bool {
+			_, caller := t.Functions[c.Caller]
+			_, callee := t.Functions[c.Callee]
+			return !caller || !callee
+		})
+		truncated = true
+	}
+	if maxEdges > 0 && len(t.Calls) > maxEdges {
+		sort.SliceStable(t.Calls, func(i, j int) bool { return t.Calls[i].Graphs() > t.Calls[j].Graphs() })
+		t.Calls = t.Calls[:maxEdges]
+		truncated = true
+	}
+	return truncated
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// handleTraces serves the imported trace overlay, or 404 if there is
+// none.
+func (s *Server) handleTraces(w http.ResponseWriter, r *http.Request) {
+	overlay, err := s.store.Traces()
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, overlay)
+}
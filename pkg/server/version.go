@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/ishanmadhav/geeparse/pkg/buildinfo"
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+)
+
+// Version is what /api/version reports: the server binary's build and a
+// summary of the store it serves.
+type Version struct {
+	buildinfo.Info
+	Store persistence.Info `json:"store"`
+}
+
+// handleVersion reports which geeparse is serving and which built its
+// store, so a client of one version talking to a server or store of
+// another can tell.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	info, err := s.store.Info()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, Version{Info: buildinfo.Get(), Store: info})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/persistence"
+	"github.com/ishanmadhav/geeparse/pkg/query"
+)
+
+// viewRequest is the body accepted by PUT /api/views/{name}.
+type viewRequest struct {
+	Description string   `json:"description"`
+	Filter      string   `json:"filter"`
+	Layout      string   `json:"layout"`
+	Roots       []string `json:"roots"`
+	Author      string   `json:"author"`
+}
+
+func (s *Server) handleListViews(w http.ResponseWriter, r *http.Request) {
+	views, err := s.store.Views()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, views)
+}
+
+func (s *Server) handleGetView(w http.ResponseWriter, r *http.Request) {
+	view, err := s.store.View(r.PathValue("name"))
+	if errors.Is(err, persistence.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, view)
+}
+
+// handlePutView saves a view for everyone, replacing one of the same
+// name. A filter the UI would run as a query has to parse, so a broken
+// view can't be shared.
+func (s *Server) handlePutView(w http.ResponseWriter, r *http.Request) {
+	var req viewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "decode view: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch req.Layout {
+	case "", "tree", "packages":
+	default:
+		http.Error(w, "unknown layout "+req.Layout+" (want tree or packages)", http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(req.Filter, "()&|!") {
+		if _, err := query.Parse(req.Filter); err != nil {
+			http.Error(w, "filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var roots []string
+	for _, root := range req.Roots {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	view, err := s.store.SaveView(persistence.View{
+		Name:        r.PathValue("name"),
+		Description: req.Description,
+		Filter:      req.Filter,
+		Layout:      req.Layout,
+		Roots:       roots,
+		Author:      req.Author,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, view)
+}
+
+func (s *Server) handleDeleteView(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteView(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package traces
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ishanmadhav/geeparse/pkg/analysis"
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// How an observed call relates to the static graph, as Call.Static says.
+const (
+	// StaticCall is a call the static graph has too.
+	StaticCall = "call"
+	// StaticPath is a call the static graph makes through other
+	// functions, spans of which weren't recorded or mapped.
+	StaticPath = "path"
+	// StaticMissing is a call the static graph has no way to make: a
+	// dynamic call it couldn't resolve, a call crossing services, or a
+	// design that isn't what the graph says.
+	StaticMissing = "missing"
+)
+
+// maxUnmapped bounds Overlay.Unmapped.
+const maxUnmapped = 20
+
+// Overlay is what a set of traces observed of a graph.
+type Overlay struct {
+	Traces int `json:"traces"`
+	Spans  int `json:"spans"`
+	// Mapped counts the spans mapped to a function.
+	Mapped int `json:"mapped"`
+	// Functions holds, per function, how many spans ran in it and for
+	// how long in all.
+	Functions map[string]Observed `json:"functions"`
+	// Calls are the calls observed between functions, most frequent
+	// first.
+	Calls []Call `json:"calls"`
+	// Unmapped are the commonest span names no function was found for,
+	// to write rules for.
+	Unmapped []SpanName `json:"unmapped"`
+}
+
+// Observed is how often a function was seen running and for how long.
+type Observed struct {
+	Count    int           `json:"count"`
+	Duration time.Duration `json:"duration"` // nanoseconds
+}
+
+// Call is a call seen in traces: a span in Callee whose nearest mapped
+// ancestor ran in Caller.
+type Call struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Count  int    `json:"count"`
+	// Static is StaticCall, StaticPath or StaticMissing.
+	Static string `json:"static"`
+}
+
+// SpanName counts the spans of one name.
+type SpanName struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Build maps spans onto graph with m. A span's caller is its nearest
+// ancestor in the same trace that maps to a function other than its
+// own, so unmapped spans in between, say of HTTP clients, don't hide a
+// call; spans nested in their own function's add no call.
+func Build(spans []Span, graph map[string]callgraph.FunctionNode, m *Mapper) *Overlay {
+	out := &Overlay{Spans: len(spans), Functions: make(map[string]Observed)}
+	type key struct{ trace, span string }
+	byID := make(map[key]Span, len(spans))
+	fn := make(map[key]string, len(spans))
+	traces := make(map[string]bool)
+	unmapped := make(map[string]int)
+	for _, s := range spans {
+		k := key{s.TraceID, s.ID}
+		byID[k] = s
+		traces[s.TraceID] = true
+		name, ok := m.Function(s)
+		if !ok {
+			unmapped[s.Name]++
+			continue
+		}
+		fn[k] = name
+		out.Mapped++
+		o := out.Functions[name]
+		o.Count++
+		o.Duration += s.Duration
+		out.Functions[name] = o
+	}
+	out.Traces = len(traces)
+
+	calls := make(map[[2]string]int)
+	for k, callee := range fn {
+		seen := map[string]bool{k.span: true}
+		for p := byID[k].Parent; p != "" && !seen[p]; p = byID[key{k.trace, p}].Parent {
+			seen[p] = true
+			caller, ok := fn[key{k.trace, p}]
+			if !ok {
+				continue
+			}
+			if caller != callee {
+				calls[[2]string{caller, callee}]++
+			}
+			break
+		}
+	}
+
+	reach := make(map[string]map[string]bool) // per caller, lazily
+	for c, n := range calls {
+		call := Call{Caller: c[0], Callee: c[1], Count: n, Static: StaticMissing}
+		if slices.Contains(graph[c[0]].Callees, c[1]) {
+			call.Static = StaticCall
+		} else {
+			if reach[c[0]] == nil {
+				reach[c[0]] = analysis.Reachable(graph, []string{c[0]})
+			}
+			if reach[c[0]][c[1]] {
+				call.Static = StaticPath
+			}
+		}
+		out.Calls = append(out.Calls, call)
+	}
+	sort.Slice(out.Calls, func(i, j int) bool {
+		a, b := out.Calls[i], out.Calls[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+
+	for name, n := range unmapped {
+		out.Unmapped = append(out.Unmapped, SpanName{name, n})
+	}
+	sort.Slice(out.Unmapped, func(i, j int) bool {
+		a, b := out.Unmapped[i], out.Unmapped[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	if len(out.Unmapped) > maxUnmapped {
+		out.Unmapped = out.Unmapped[:maxUnmapped]
+	}
+	if out.Calls == nil {
+		out.Calls = []Call{}
+	}
+	if out.Unmapped == nil {
+		out.Unmapped = []SpanName{}
+	}
+	return out
+}
+
+// Missing returns the observed calls the static graph has no way to
+// make, where design and reality part.
+func (o *Overlay) Missing() []Call {
+	var out []Call
+	for _, c := range o.Calls {
+		if c.Static == StaticMissing {
+			out = append(out, c)
+		}
+	}
+	return out
+}
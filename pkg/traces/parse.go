@@ -0,0 +1,188 @@
+// Package traces overlays the call paths OpenTelemetry traces observed at
+// run time on a static call-graph, to show which of the designed paths
+// are taken and where reality departs from the design. Spans are mapped
+// to functions by configurable rules (see Rule); a span's nearest mapped
+// ancestor is taken to have called it.
+package traces
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Span is one span of a trace, whatever format it came in.
+type Span struct {
+	TraceID    string
+	ID         string
+	Parent     string // "" for a root span
+	Name       string // OTLP name or Jaeger operation name
+	Attributes map[string]string
+	Duration   time.Duration
+}
+
+// Parse reads spans from an OTLP/JSON trace export, one
+// ExportTraceServiceRequest or several in a row as the collector's file
+// exporter writes them, or from Jaeger's JSON, as its API and UI
+// download traces.
+func Parse(r io.Reader) ([]Span, error) {
+	dec := json.NewDecoder(r)
+	var spans []Span
+	for {
+		var doc map[string]json.RawMessage
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode traces: %w", err)
+		}
+		var got []Span
+		switch {
+		case doc["resourceSpans"] != nil:
+			got, err = parseOTLP(doc["resourceSpans"])
+		case doc["data"] != nil:
+			got, err = parseJaeger(doc["data"])
+		default:
+			return nil, errors.New("neither OTLP (resourceSpans) nor Jaeger (data) JSON")
+		}
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, got...)
+	}
+	if len(spans) == 0 {
+		return nil, errors.New("no spans")
+	}
+	return spans, nil
+}
+
+// otlpValue is an OTLP AnyValue; only scalars are kept.
+type otlpValue struct {
+	StringValue *string         `json:"stringValue"`
+	BoolValue   *bool           `json:"boolValue"`
+	IntValue    json.RawMessage `json:"intValue"` // a string or a number
+	DoubleValue *float64        `json:"doubleValue"`
+}
+
+func (v otlpValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return string(bytes.Trim(v.IntValue, `"`))
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	}
+	return ""
+}
+
+type otlpSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Start        string `json:"startTimeUnixNano"`
+	End          string `json:"endTimeUnixNano"`
+	Attributes   []struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	} `json:"attributes"`
+}
+
+func parseOTLP(raw json.RawMessage) ([]Span, error) {
+	var resources []struct {
+		ScopeSpans []struct {
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+		// the name before OTLP 0.15
+		LibrarySpans []struct {
+			Spans []otlpSpan `json:"spans"`
+		} `json:"instrumentationLibrarySpans"`
+	}
+	if err := json.Unmarshal(raw, &resources); err != nil {
+		return nil, fmt.Errorf("decode OTLP traces: %w", err)
+	}
+	var out []Span
+	add := func(s otlpSpan) {
+		span := Span{TraceID: s.TraceID, ID: s.SpanID, Parent: s.ParentSpanID, Name: s.Name, Attributes: make(map[string]string)}
+		for _, a := range s.Attributes {
+			span.Attributes[a.Key] = a.Value.String()
+		}
+		start, err1 := strconv.ParseInt(s.Start, 10, 64)
+		end, err2 := strconv.ParseInt(s.End, 10, 64)
+		if err1 == nil && err2 == nil && end > start {
+			span.Duration = time.Duration(end - start)
+		}
+		out = append(out, span)
+	}
+	for _, rs := range resources {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				add(s)
+			}
+		}
+		for _, ss := range rs.LibrarySpans {
+			for _, s := range ss.Spans {
+				add(s)
+			}
+		}
+	}
+	return out, nil
+}
+
+func parseJaeger(raw json.RawMessage) ([]Span, error) {
+	var traces []struct {
+		TraceID string `json:"traceID"`
+		Spans   []struct {
+			TraceID       string `json:"traceID"`
+			SpanID        string `json:"spanID"`
+			ParentSpanID  string `json:"parentSpanID"`
+			OperationName string `json:"operationName"`
+			References    []struct {
+				RefType string `json:"refType"`
+				SpanID  string `json:"spanID"`
+			} `json:"references"`
+			Duration int64 `json:"duration"` // microseconds
+			Tags     []struct {
+				Key   string `json:"key"`
+				Value any    `json:"value"`
+			} `json:"tags"`
+		} `json:"spans"`
+	}
+	if err := json.Unmarshal(raw, &traces); err != nil {
+		return nil, fmt.Errorf("decode Jaeger traces: %w", err)
+	}
+	var out []Span
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			span := Span{
+				TraceID:    s.TraceID,
+				ID:         s.SpanID,
+				Parent:     s.ParentSpanID,
+				Name:       s.OperationName,
+				Attributes: make(map[string]string),
+				Duration:   time.Duration(s.Duration) * time.Microsecond,
+			}
+			if span.TraceID == "" {
+				span.TraceID = t.TraceID
+			}
+			for _, ref := range s.References {
+				if ref.RefType == "CHILD_OF" || span.Parent == "" {
+					span.Parent = ref.SpanID
+				}
+			}
+			for _, tag := range s.Tags {
+				span.Attributes[tag.Key] = fmt.Sprint(tag.Value)
+			}
+			out = append(out, span)
+		}
+	}
+	return out, nil
+}
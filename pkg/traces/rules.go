@@ -0,0 +1,104 @@
+package traces
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Rule maps spans to a function: those whose name, or attribute
+// Attribute when set, matches the regular expression Match are taken to
+// run in Function, which may refer to Match's groups as $1 or ${name}.
+// For example, match "^GET /api/(\w+)$" with function "handle$1".
+type Rule struct {
+	Match     string `yaml:"match" json:"match"`
+	Attribute string `yaml:"attribute" json:"attribute,omitempty"`
+	Function  string `yaml:"function" json:"function"`
+}
+
+// ParseRule reads a rule given on the command line as "match=function".
+func ParseRule(s string) (Rule, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return Rule{}, fmt.Errorf("span mapping %q: want regexp=function", s)
+	}
+	return Rule{Match: s[:i], Function: s[i+1:]}, nil
+}
+
+// ValidateRules reports the first rule missing a side or with a
+// malformed expression.
+func ValidateRules(rules []Rule) error {
+	for i, r := range rules {
+		if r.Match == "" || r.Function == "" {
+			return fmt.Errorf("trace rule %d: both match and function are required", i+1)
+		}
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("trace rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Mapper finds the function of graph a span ran in.
+type Mapper struct {
+	graph map[string]callgraph.FunctionNode
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// NewMapper returns a Mapper trying rules in order, then the
+// conventional attributes: OpenTelemetry's code.function.name and
+// code.function, whose last name segment is taken, and the span's own
+// name, whole or its last segment after "/", "." or a space.
+func NewMapper(graph map[string]callgraph.FunctionNode, rules []Rule) (*Mapper, error) {
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	m := &Mapper{graph: graph}
+	for _, r := range rules {
+		m.rules = append(m.rules, compiledRule{r, regexp.MustCompile(r.Match)})
+	}
+	return m, nil
+}
+
+// Function returns the function s ran in, if any.
+func (m *Mapper) Function(s Span) (string, bool) {
+	for _, r := range m.rules {
+		subject := s.Name
+		if r.Attribute != "" {
+			subject = s.Attributes[r.Attribute]
+		}
+		match := r.re.FindStringSubmatchIndex(subject)
+		if match == nil {
+			continue
+		}
+		name := string(r.re.ExpandString(nil, r.Function, subject, match))
+		if _, ok := m.graph[name]; ok {
+			return name, true
+		}
+	}
+	for _, candidate := range []string{
+		lastSegment(s.Attributes["code.function.name"]),
+		lastSegment(s.Attributes["code.function"]),
+		s.Name,
+		lastSegment(s.Name),
+	} {
+		if _, ok := m.graph[candidate]; ok && candidate != "" {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// lastSegment returns the last part of a qualified name:
+// "github.com/x/server.(*Server).handleGraph" gives "handleGraph", as
+// does "GET handleGraph".
+func lastSegment(name string) string {
+	return name[strings.LastIndexAny(name, "/. ")+1:]
+}
@@ -0,0 +1,71 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore scores name as a match for query, whose letters must all
+// appear in name in order, ignoring case. Runs of consecutive letters and
+// letters starting a word (after / . _ or a lower-to-upper case change)
+// score higher, so "hgr" ranks handleGraphRequest above shaggier.
+func fuzzyScore(query, name string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	q := []rune(strings.ToLower(query))
+	rs := []rune(name)
+	score, qi, run := 0, 0, 0
+	for i, r := range rs {
+		if qi == len(q) {
+			break
+		}
+		if unicode.ToLower(r) != q[qi] {
+			run = 0
+			continue
+		}
+		score++
+		if i == 0 || strings.ContainsRune("/._", rs[i-1]) || unicode.IsLower(rs[i-1]) && unicode.IsUpper(r) {
+			score += 3
+		}
+		if run > 0 {
+			score += 2 * run
+		}
+		run++
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+// fuzzyFind returns the names matching query, best first, then shortest,
+// then by name.
+func fuzzyFind(query string, names []string) []string {
+	type match struct {
+		name  string
+		score int
+	}
+	var ms []match
+	for _, name := range names {
+		if s, ok := fuzzyScore(query, name); ok {
+			ms = append(ms, match{name, s})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].score != ms[j].score {
+			return ms[i].score > ms[j].score
+		}
+		if len(ms[i].name) != len(ms[j].name) {
+			return len(ms[i].name) < len(ms[j].name)
+		}
+		return ms[i].name < ms[j].name
+	})
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = m.name
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package tui
+
+import "unicode/utf8"
+
+// key is one key press: a named key, or a printable rune with keyRune.
+type key struct {
+	name keyName
+	r    rune
+}
+
+type keyName int
+
+const (
+	keyRune keyName = iota
+	keyEnter
+	keyBackspace
+	keyEsc
+	keyTab
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyCtrlC
+	keyCtrlN
+	keyCtrlP
+	keyUnknown
+)
+
+// escapes are the sequences terminals send for special keys, in their
+// common xterm and VT forms.
+var escapes = map[string]keyName{
+	"\x1b[A": keyUp, "\x1bOA": keyUp,
+	"\x1b[B": keyDown, "\x1bOB": keyDown,
+	"\x1b[C": keyRight, "\x1bOC": keyRight,
+	"\x1b[D": keyLeft, "\x1bOD": keyLeft,
+	"\x1b[5~": keyPageUp, "\x1b[6~": keyPageDown,
+	"\x1b[H": keyHome, "\x1b[1~": keyHome, "\x1bOH": keyHome,
+	"\x1b[F": keyEnd, "\x1b[4~": keyEnd, "\x1bOF": keyEnd,
+}
+
+// parseKeys splits what one read from a raw terminal returned into key
+// presses. A lone ESC is the Escape key: terminals send escape sequences
+// whole, so they don't straddle reads in practice.
+func parseKeys(b []byte) []key {
+	var out []key
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			if len(b) == 1 {
+				out = append(out, key{name: keyEsc})
+				return out
+			}
+			n := escapeLen(b)
+			if name, ok := escapes[string(b[:n])]; ok {
+				out = append(out, key{name: name})
+			} else {
+				out = append(out, key{name: keyUnknown})
+			}
+			b = b[n:]
+			continue
+		}
+		switch b[0] {
+		case '\r', '\n':
+			out = append(out, key{name: keyEnter})
+		case 0x7f, 0x08:
+			out = append(out, key{name: keyBackspace})
+		case '\t':
+			out = append(out, key{name: keyTab})
+		case 0x03:
+			out = append(out, key{name: keyCtrlC})
+		case 0x0e:
+			out = append(out, key{name: keyCtrlN})
+		case 0x10:
+			out = append(out, key{name: keyCtrlP})
+		default:
+			r, n := utf8.DecodeRune(b)
+			if r >= ' ' && r != utf8.RuneError {
+				out = append(out, key{name: keyRune, r: r})
+			} else {
+				out = append(out, key{name: keyUnknown})
+			}
+			b = b[n:]
+			continue
+		}
+		b = b[1:]
+	}
+	return out
+}
+
+// escapeLen returns the length of the escape sequence b starts with: ESC
+// and one byte for ESC x, ESC O and one more byte, or a CSI sequence up
+// to its final byte.
+func escapeLen(b []byte) int {
+	switch {
+	case len(b) < 2:
+		return len(b)
+	case b[1] == 'O':
+		return min(3, len(b))
+	case b[1] != '[':
+		return 2
+	}
+	for i := 2; i < len(b); i++ {
+		if b[i] >= 0x40 && b[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,396 @@
+// Package tui is a terminal browser for a call graph: fuzzy-find a
+// function, see its callers and callees, follow calls and preview source
+// without leaving the terminal. Like bubbletea programs it is a model
+// updated by key presses and rendered whole after each, which keeps the
+// logic apart from the terminal handling.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ishanmadhav/geeparse/pkg/callgraph"
+)
+
+// Run browses graph on the terminal in and out until the user quits,
+// starting from the function start, or the search when it's "" or
+// unknown.
+func Run(graph map[string]callgraph.FunctionNode, start string, in *os.File, out io.Writer) error {
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("stdin is not a terminal: %w", err)
+	}
+	defer restore()
+
+	w := bufio.NewWriter(out)
+	// alternate screen, hidden cursor; undone on the way out
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	m := newModel(graph)
+	if _, ok := graph[start]; ok {
+		m.open(start)
+	}
+	buf := make([]byte, 256)
+	for {
+		width, height, err := termSize(int(in.Fd()))
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		fmt.Fprint(w, "\x1b[H\x1b[2J", strings.Join(m.view(width, height), "\r\n"))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		n, err := in.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			if m.update(k) {
+				return nil
+			}
+		}
+	}
+}
+
+type mode int
+
+const (
+	modeSearch mode = iota
+	modeFunction
+)
+
+// edge is one row of the function view: a caller or a callee of the
+// function shown.
+type edge struct {
+	name   string
+	caller bool
+}
+
+// model is everything on screen.
+type model struct {
+	graph   map[string]callgraph.FunctionNode
+	names   []string
+	callers map[string][]string
+
+	mode    mode
+	query   string
+	matches []string
+
+	current string   // function shown
+	edges   []edge   // its callers, then its callees
+	history []string // functions shown before, for going back
+	preview bool     // source shown below the calls
+
+	cursor int // selected row of matches or edges
+	offset int // first row on screen
+}
+
+func newModel(graph map[string]callgraph.FunctionNode) *model {
+	m := &model{graph: graph, callers: make(map[string][]string)}
+	for name, fn := range graph {
+		m.names = append(m.names, name)
+		for _, callee := range fn.Callees {
+			if _, ok := graph[callee]; ok {
+				m.callers[callee] = append(m.callers[callee], name)
+			}
+		}
+	}
+	sort.Strings(m.names)
+	for _, cs := range m.callers {
+		sort.Strings(cs)
+	}
+	m.search("")
+	return m
+}
+
+// search switches to the search with query.
+func (m *model) search(query string) {
+	m.mode, m.query = modeSearch, query
+	m.matches = fuzzyFind(query, m.names)
+	m.cursor, m.offset = 0, 0
+}
+
+// open shows the function name.
+func (m *model) open(name string) {
+	m.mode, m.current = modeFunction, name
+	m.edges = nil
+	for _, c := range m.callers[name] {
+		m.edges = append(m.edges, edge{name: c, caller: true})
+	}
+	callees := slices.Clone(m.graph[name].Callees)
+	sort.Strings(callees)
+	for _, c := range slices.Compact(callees) {
+		if _, ok := m.graph[c]; ok {
+			m.edges = append(m.edges, edge{name: c})
+		}
+	}
+	m.cursor, m.offset = 0, 0
+}
+
+// follow opens name, remembering the function shown to go back to.
+func (m *model) follow(name string) {
+	if m.current != "" {
+		m.history = append(m.history, m.current)
+	}
+	m.open(name)
+}
+
+// back returns to the function shown before, if any.
+func (m *model) back() {
+	if len(m.history) == 0 {
+		return
+	}
+	prev := m.history[len(m.history)-1]
+	m.history = m.history[:len(m.history)-1]
+	m.open(prev)
+}
+
+// rows is how many rows the cursor moves over.
+func (m *model) rows() int {
+	if m.mode == modeSearch {
+		return len(m.matches)
+	}
+	return len(m.edges)
+}
+
+func (m *model) move(by int) {
+	m.cursor = max(0, min(m.cursor+by, m.rows()-1))
+}
+
+// update applies a key press and reports whether to quit.
+func (m *model) update(k key) bool {
+	if k.name == keyCtrlC {
+		return true
+	}
+	switch k.name {
+	case keyUp, keyCtrlP:
+		m.move(-1)
+		return false
+	case keyDown, keyCtrlN:
+		m.move(1)
+		return false
+	case keyPageUp:
+		m.move(-10)
+		return false
+	case keyPageDown:
+		m.move(10)
+		return false
+	case keyHome:
+		m.cursor = 0
+		return false
+	case keyEnd:
+		m.move(m.rows())
+		return false
+	}
+
+	if m.mode == modeSearch {
+		switch k.name {
+		case keyRune:
+			m.search(m.query + string(k.r))
+		case keyBackspace:
+			if m.query != "" {
+				_, n := utf8.DecodeLastRuneInString(m.query)
+				m.search(m.query[:len(m.query)-n])
+			}
+		case keyEnter, keyRight, keyTab:
+			if m.cursor < len(m.matches) {
+				m.follow(m.matches[m.cursor])
+			}
+		case keyEsc:
+			if m.current == "" {
+				return true
+			}
+			m.open(m.current)
+		}
+		return false
+	}
+
+	switch {
+	case k.name == keyEnter, k.name == keyRight, k.name == keyRune && k.r == 'l':
+		if m.cursor < len(m.edges) {
+			m.follow(m.edges[m.cursor].name)
+		}
+	case k.name == keyLeft, k.name == keyBackspace, k.name == keyRune && k.r == 'h':
+		m.back()
+	case k.name == keyTab:
+		// jump between the callers and the callees
+		nCallers := len(m.callers[m.current])
+		if m.cursor < nCallers && nCallers < len(m.edges) {
+			m.cursor = nCallers
+		} else {
+			m.cursor = 0
+		}
+	case k.name == keyRune && k.r == 'j':
+		m.move(1)
+	case k.name == keyRune && k.r == 'k':
+		m.move(-1)
+	case k.name == keyRune && k.r == 's':
+		m.preview = !m.preview
+	case k.name == keyRune && k.r == '/':
+		m.search("")
+	case k.name == keyRune && k.r == 'q', k.name == keyEsc:
+		return true
+	}
+	return false
+}
+
+// Styles, as ANSI escapes.
+const (
+	bold    = "\x1b[1m"
+	dim     = "\x1b[2m"
+	reverse = "\x1b[7m"
+	reset   = "\x1b[0m"
+)
+
+// view renders the model as height lines at most width wide.
+func (m *model) view(width, height int) []string {
+	var lines []string
+	if m.mode == modeSearch {
+		lines = append(lines, bold+clip("Find: "+m.query, width)+reset)
+		lines = append(lines, dim+clip(fmt.Sprintf("%d of %d functions   ↑↓ select · enter open · esc back", len(m.matches), len(m.names)), width)+reset)
+		rows := make([]string, len(m.matches))
+		for i, name := range m.matches {
+			fn := m.graph[name]
+			rows[i] = name
+			if fn.Package != "" {
+				rows[i] += "  " + dim + fn.Package + reset
+			}
+		}
+		return append(lines, m.list(rows, width, height-len(lines))...)
+	}
+
+	fn := m.graph[m.current]
+	lines = append(lines, bold+clip(m.current, width)+reset)
+	where := fn.Package
+	if fn.File != "" {
+		where += fmt.Sprintf("  %s:%d", fn.File, fn.Line)
+	}
+	if fn.Generated != "" {
+		where += "  (generated)"
+	}
+	lines = append(lines, dim+clip(where, width)+reset)
+	if fn.Signature != "" {
+		lines = append(lines, clip(fn.Signature, width))
+	}
+	lines = append(lines, dim+clip("↑↓ select · enter follow · ← back · tab callers/callees · s source · / find · q quit", width)+reset, "")
+
+	var rows []string
+	for _, e := range m.edges {
+		arrow := "→ "
+		if e.caller {
+			arrow = "← "
+		}
+		row := arrow + e.name
+		if kind := m.graph[m.current].Kind(e.name); !e.caller && kind != callgraph.KindDirect {
+			row += "  " + dim + kind + reset
+		}
+		rows = append(rows, row)
+	}
+	nCallers := len(m.callers[m.current])
+	head := fmt.Sprintf("%d callers, %d callees", nCallers, len(m.edges)-nCallers)
+	lines = append(lines, bold+clip(head, width)+reset)
+
+	room := height - len(lines)
+	if m.preview {
+		src := source(fn)
+		listRoom := max(3, room/3)
+		lines = append(lines, m.list(rows, width, min(listRoom, max(1, len(rows))))...)
+		lines = append(lines, dim+strings.Repeat("─", width)+reset)
+		for _, l := range src {
+			if len(lines) >= height {
+				break
+			}
+			lines = append(lines, clip(strings.ReplaceAll(l, "\t", "    "), width))
+		}
+		return lines
+	}
+	if len(rows) == 0 {
+		return append(lines, dim+"no calls in or out"+reset)
+	}
+	return append(lines, m.list(rows, width, room)...)
+}
+
+// list renders rows in room lines, scrolled to keep the cursor in view
+// and highlighted.
+func (m *model) list(rows []string, width, room int) []string {
+	if room <= 0 {
+		return nil
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+room {
+		m.offset = m.cursor - room + 1
+	}
+	var out []string
+	for i := m.offset; i < len(rows) && i < m.offset+room; i++ {
+		if i == m.cursor {
+			out = append(out, reverse+clip(stripStyles(rows[i]), width)+reset)
+		} else {
+			out = append(out, clipStyled(rows[i], width))
+		}
+	}
+	return out
+}
+
+// source returns the lines of fn's definition, read from its file when
+// the graph doesn't carry it.
+func source(fn callgraph.FunctionNode) []string {
+	if fn.Definition != "" {
+		return strings.Split(fn.Definition, "\n")
+	}
+	if fn.File == "" || fn.Line <= 0 {
+		return []string{"(no source)"}
+	}
+	data, err := os.ReadFile(fn.File)
+	if err != nil {
+		return []string{"(" + err.Error() + ")"}
+	}
+	lines := strings.Split(string(data), "\n")
+	end := fn.EndLine
+	if end < fn.Line || end > len(lines) {
+		end = min(len(lines), fn.Line+40)
+	}
+	if fn.Line > len(lines) {
+		return []string{"(no source)"}
+	}
+	return lines[fn.Line-1 : end]
+}
+
+// clip cuts s, unstyled, to width runes.
+func clip(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	if width <= 1 {
+		return string(r[:max(width, 0)])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// clipStyled clips s to width visible runes, keeping its escapes.
+func clipStyled(s string, width int) string {
+	if utf8.RuneCountInString(stripStyles(s)) <= width {
+		return s
+	}
+	return clip(stripStyles(s), width)
+}
+
+// stripStyles removes the styles view adds.
+func stripStyles(s string) string {
+	return strings.NewReplacer(bold, "", dim, "", reverse, "", reset, "").Replace(s)
+}
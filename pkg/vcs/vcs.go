@@ -0,0 +1,229 @@
+// Package vcs runs the git command-line tool to fetch the source trees
+// geeparse analyzes.
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Checkout is a temporary clone or worktree of one revision of a
+// repository.
+type Checkout struct {
+	Dir    string // working tree
+	Commit string // full SHA of the checked-out revision
+
+	repo string // repository owning the worktree; empty for clones
+}
+
+// Clone fetches ref (a branch, tag or commit SHA; empty means the
+// default branch) of the repository at url into a new temporary
+// directory, with no history beyond that one revision. Call Remove when
+// done with it.
+func Clone(url, ref string) (*Checkout, error) {
+	if err := notOption("repository", url); err != nil {
+		return nil, err
+	}
+	if err := notOption("ref", ref); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "geeparse-clone-")
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// init+fetch rather than "clone --branch" so that commit SHAs work too
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", url},
+		{"fetch", "--quiet", "--depth", "1", "origin", ref},
+		{"checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		if _, err := Git(dir, args...); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	commit, err := Git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Checkout{Dir: dir, Commit: commit}, nil
+}
+
+// Worktree checks out ref of the local repository containing dir into a
+// new temporary worktree, leaving the caller's working tree untouched.
+// Call Remove when done with it.
+func Worktree(dir, ref string) (*Checkout, error) {
+	if err := notOption("ref", ref); err != nil {
+		return nil, err
+	}
+	repo, err := Git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	commit, err := Git(repo, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "geeparse-worktree-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Git(repo, "worktree", "add", "--quiet", "--detach", tmp, commit); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return &Checkout{Dir: tmp, Commit: commit, repo: repo}, nil
+}
+
+// MergeBase returns the best common ancestor of a and b in the repository
+// containing dir.
+func MergeBase(dir, a, b string) (string, error) {
+	for _, rev := range []string{a, b} {
+		if err := notOption("revision", rev); err != nil {
+			return "", err
+		}
+	}
+	return Git(dir, "merge-base", a, b)
+}
+
+// Pull fast-forwards the checkout of the local repository containing dir
+// to origin's branch and returns the new HEAD commit. It fails rather
+// than merge if the checkout has diverged from the remote.
+func Pull(dir, branch string) (string, error) {
+	if err := notOption("branch", branch); err != nil {
+		return "", err
+	}
+	if _, err := Git(dir, "fetch", "--quiet", "origin", branch); err != nil {
+		return "", err
+	}
+	if _, err := Git(dir, "merge", "--quiet", "--ff-only", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return Git(dir, "rev-parse", "HEAD")
+}
+
+// Remove deletes the checkout from disk, unregistering it first if it is
+// a worktree.
+func (c *Checkout) Remove() error {
+	if c.repo != "" {
+		if _, err := Git(c.repo, "worktree", "remove", "--force", c.Dir); err == nil {
+			return nil
+		}
+	}
+	return os.RemoveAll(c.Dir)
+}
+
+// notOption rejects a repository URL or revision that git would take for
+// an option, such as a batch file's ref: "--upload-pack=cmd" runs cmd.
+func notOption(what, s string) error {
+	if strings.HasPrefix(s, "-") {
+		return fmt.Errorf("%s %q starts with a dash", what, s)
+	}
+	return nil
+}
+
+// Git runs git with args in dir and returns its trimmed standard output.
+// Failures include git's standard error in the message.
+func Git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Hunk is a span of changed lines in one file, numbered as in the working
+// tree. A deleted file is reported as a single hunk with Start and End 0.
+type Hunk struct {
+	File       string // absolute path
+	Start, End int
+}
+
+// DiffHunks lists what changed in the working tree of the repository
+// containing dir since the given revision. Pure deletions inside a file
+// are reported as the line they were removed at.
+func DiffHunks(dir, since string) ([]Hunk, error) {
+	if err := notOption("revision", since); err != nil {
+		return nil, err
+	}
+	top, err := Git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	out, err := Git(top, "diff", "-U0", "--no-color", "--no-ext-diff", "--no-renames", since, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks []Hunk
+	var oldFile, file string
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			oldFile = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(line, "+++ ")
+			if file == "/dev/null" {
+				hunks = append(hunks, Hunk{File: filepath.Join(top, oldFile)})
+				file = ""
+				continue
+			}
+			file = filepath.Join(top, strings.TrimPrefix(file, "b/"))
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			start, count, ok := parseHunkHeader(line)
+			if !ok {
+				continue
+			}
+			end := start + count - 1
+			if count == 0 {
+				start = max(start, 1)
+				end = start
+			}
+			hunks = append(hunks, Hunk{File: file, Start: start, End: end})
+		}
+	}
+	return hunks, nil
+}
+
+// parseHunkHeader extracts the new-file start line and line count from a
+// unified diff header such as "@@ -10,2 +12,3 @@ func f() {".
+func parseHunkHeader(line string) (start, count int, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, false
+	}
+	spec := strings.TrimPrefix(fields[2], "+")
+	count = 1
+	if s, c, found := strings.Cut(spec, ","); found {
+		spec = s
+		n, err := strconv.Atoi(c)
+		if err != nil {
+			return 0, 0, false
+		}
+		count = n
+	}
+	start, err := strconv.Atoi(spec)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, count, true
+}
@@ -0,0 +1,105 @@
+// Package watch detects changes to Go source files by polling their
+// modification times, which works the same on every OS and filesystem
+// (including network mounts and containers where inotify is unreliable).
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stamp is what a poll records per file.
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// scan records every .go file under root.
+func scan(root string) (map[string]stamp, error) {
+	files := make(map[string]stamp)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = stamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// diff returns, sorted, the files created, modified or deleted between two
+// scans.
+func diff(old, new map[string]stamp) []string {
+	var changed []string
+	for path, st := range new {
+		if prev, ok := old[path]; !ok || prev != st {
+			changed = append(changed, path)
+		}
+	}
+	for path := range old {
+		if _, ok := new[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Watch polls root every interval and calls onChange with the .go files
+// that were created, modified or deleted. Changes are batched until a poll
+// sees nothing new, so saving many files at once (a branch switch, a
+// formatter run) triggers one callback. It returns when ctx is done.
+func Watch(ctx context.Context, root string, interval time.Duration, onChange func(changed []string)) error {
+	last, err := scan(root)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]bool)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		cur, err := scan(root)
+		if err != nil {
+			return err
+		}
+		changed := diff(last, cur)
+		last = cur
+		for _, path := range changed {
+			pending[path] = true
+		}
+		if len(changed) > 0 || len(pending) == 0 {
+			continue
+		}
+
+		batch := make([]string, 0, len(pending))
+		for path := range pending {
+			batch = append(batch, path)
+		}
+		sort.Strings(batch)
+		pending = make(map[string]bool)
+		onChange(batch)
+	}
+}